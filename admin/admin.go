@@ -0,0 +1,298 @@
+// Package admin guards the operator only endpoints of the site.
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+)
+
+// Role is a set of admin capabilities that can be given to a token without
+// handing out the master admin token.
+type Role string
+
+// The admin roles.
+const (
+	RolePurge  Role = "purge"  // purge deleted user data for good
+	RoleDebug  Role = "debug"  // pprof and expvar
+	RoleConfig Role = "config" // reload the config
+	RoleCache  Role = "cache"  // export, import, refresh and purge the BGG cache
+	RoleData   Role = "data"   // correct bundled game data, such as sleeves
+)
+
+// Roles are all the admin roles.
+var Roles = []Role{RolePurge, RoleDebug, RoleConfig, RoleCache, RoleData}
+
+// Access knows which tokens may use which admin endpoints. The master token
+// has every role.
+type Access struct {
+	master string
+	tokens map[string][]Role
+}
+
+// New returns the access of the master token and of roleTokens, comma
+// separated role:token pairs each granting one role, such as
+// "purge:abc,debug:abc,purge:xyz". Either may be empty.
+func New(master, roleTokens string) (*Access, error) {
+	a := &Access{master: master, tokens: make(map[string][]Role)}
+	for _, pair := range strings.Split(roleTokens, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.Index(pair, ":")
+		if i < 0 || pair[i+1:] == "" {
+			return nil, fmt.Errorf("bad admin role token %q, please provide role:token", pair)
+		}
+		role, token := Role(pair[:i]), pair[i+1:]
+		if !valid(role) {
+			return nil, fmt.Errorf("bad admin role %q, please pick one of %s", role, strings.Join(roleNames(), ", "))
+		}
+		a.tokens[token] = append(a.tokens[token], role)
+	}
+	return a, nil
+}
+
+func valid(role Role) bool {
+	for _, r := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func roleNames() []string {
+	names := make([]string, len(Roles))
+	for i, r := range Roles {
+		names[i] = string(r)
+	}
+	return names
+}
+
+// enabled reports whether any token may have role.
+func (a *Access) enabled(role Role) bool {
+	if a.master != "" {
+		return true
+	}
+	for _, roles := range a.tokens {
+		for _, r := range roles {
+			if r == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// check reports whether token is an admin token at all, and whether it has
+// role. Every token is compared so the time taken doesn't tell which ones
+// exist.
+func (a *Access) check(token string, role Role) (known, allowed bool) {
+	if a.master != "" && subtle.ConstantTimeCompare([]byte(token), []byte(a.master)) == 1 {
+		known, allowed = true, true
+	}
+	for t, roles := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) != 1 {
+			continue
+		}
+		known = true
+		for _, r := range roles {
+			allowed = allowed || r == role
+		}
+	}
+	return known, allowed
+}
+
+// Protect only lets requests carrying a token with role through to h, either
+// as a bearer token or in the X-Admin-Token header. When no token has the
+// role its endpoints are disabled and answer not found.
+func (a *Access) Protect(role Role, h http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.enabled(role) {
+			http.NotFound(w, r)
+			return
+		}
+		got := r.Header.Get("X-Admin-Token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			got = strings.TrimPrefix(auth, "Bearer ")
+		}
+		switch known, allowed := a.check(got, role); {
+		case !known:
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		case !allowed:
+			http.Error(w, "forbidden, the token lacks the "+string(role)+" role", http.StatusForbidden)
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+}
+
+// ReloadFunc reloads the config, returning the keys of the changed settings
+// it applied and of those needing a restart.
+type ReloadFunc func() (applied, restart []string, err error)
+
+// Reload runs reload on demand, for admins.
+func Reload(reload ReloadFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		applied, restart, err := reload()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unable to reload config: %s", err), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "applied: %s\n", strings.Join(applied, ", "))
+		fmt.Fprintf(w, "needs restart: %s\n", strings.Join(restart, ", "))
+	}
+}
+
+// Cache is the cache of BGG data, dumped as portable JSON.
+type Cache interface {
+	ExportCache(w io.Writer) error
+	ImportCache(r io.Reader) (things, owned int, err error)
+}
+
+// maxImport bounds the size of an imported cache dump.
+const maxImport = 512 << 20
+
+// ExportCache downloads a dump of the cached games and collections, to move
+// them to another deployment.
+func ExportCache(c Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="bgg-cache.json"`)
+		if err := c.ExportCache(w); err != nil {
+			log.Printf("Error exporting cache: %s", err)
+		}
+	}
+}
+
+// ImportCache adds the games and collections of a dump made by ExportCache,
+// sent as the request body, to the cache.
+func ImportCache(c Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		things, owned, err := c.ImportCache(http.MaxBytesReader(w, r.Body, maxImport))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, "imported %d games and %d collections\n", things, owned)
+	}
+}
+
+// CacheEntries are the cached collections and games, for admins.
+type CacheEntries interface {
+	CachedCollections() []bgg.CacheEntry
+	CachedThings() []bgg.CacheEntry
+	ForgetOwned(bggName string) bool
+	ForgetThing(id string) bool
+}
+
+// Refresher fetches a collection or game from BGG again.
+type Refresher interface {
+	RefreshCollection(ctx context.Context, bggName string) error
+	RefreshGame(ctx context.Context, gameID string) error
+}
+
+// ListCache lists the cached collections and games with when they were
+// fetched, as JSON.
+func ListCache(c CacheEntries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(struct {
+			Users []bgg.CacheEntry `json:"users"`
+			Games []bgg.CacheEntry `json:"games"`
+		}{c.CachedCollections(), c.CachedThings()}); err != nil {
+			log.Printf("Error encoding cache entries: %s", err)
+		}
+	}
+}
+
+// cacheTarget reads the bggName or gameID param of a cache request.
+func cacheTarget(r *http.Request) (bggName, gameID string, ok bool) {
+	bggName, gameID = r.FormValue("bggName"), r.FormValue("gameID")
+	return bggName, gameID, (bggName == "") != (gameID == "")
+}
+
+// RefreshCache fetches the collection of a bggName param, or the game of a
+// gameID param, from BGG again, without waiting for it to go stale.
+func RefreshCache(rf Refresher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bggName, gameID, ok := cacheTarget(r)
+		if !ok {
+			http.Error(w, "bad params, please provide either a bggName or a gameID", http.StatusBadRequest)
+			return
+		}
+		if bggName != "" {
+			if err := rf.RefreshCollection(r.Context(), bggName); err != nil {
+				http.Error(w, "unable to refresh collection", http.StatusServiceUnavailable)
+				log.Printf("%s", err)
+				return
+			}
+			fmt.Fprintf(w, "refreshed collection of %s\n", bggName)
+			return
+		}
+		if err := rf.RefreshGame(r.Context(), gameID); err != nil {
+			http.Error(w, "unable to refresh game", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		fmt.Fprintf(w, "refreshed game %s\n", gameID)
+	}
+}
+
+// PurgeCache drops the cached collection of a bggName param, or the game of
+// a gameID param, so the next request fetches it from BGG.
+func PurgeCache(c CacheEntries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bggName, gameID, ok := cacheTarget(r)
+		if !ok {
+			http.Error(w, "bad params, please provide either a bggName or a gameID", http.StatusBadRequest)
+			return
+		}
+		if bggName != "" {
+			if !c.ForgetOwned(bggName) {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprintf(w, "purged collection of %s\n", bggName)
+			return
+		}
+		if !c.ForgetThing(gameID) {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintf(w, "purged game %s\n", gameID)
+	}
+}
@@ -0,0 +1,56 @@
+package analytics
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/plays"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// AggregateKind is the store kind precomputed stats are kept under.
+const AggregateKind = "StatsAggregate"
+
+// Aggregate is the materialized stats of a user's plays, so stats pages
+// don't go through every play on each view.
+type Aggregate struct {
+	Owner     string
+	Plays     int // plays the aggregate was computed from
+	Seats     []*SeatBias
+	Standings *Standings
+	Computed  time.Time
+}
+
+// Precompute computes owner's stats from their recorded plays and stores
+// them for LoadAggregate.
+func Precompute(st *store.Store, owner string) (*Aggregate, error) {
+	all, err := plays.List(st, owner)
+	if err != nil {
+		return nil, err
+	}
+	a := &Aggregate{
+		Owner:     owner,
+		Plays:     len(all),
+		Seats:     SeatBiases(all),
+		Standings: Ratings(all),
+		Computed:  time.Now(),
+	}
+	if err := st.Put(AggregateKind, strings.ToLower(owner), a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// LoadAggregate returns owner's precomputed stats, computing them first if
+// they haven't been yet.
+func LoadAggregate(st *store.Store, owner string) (*Aggregate, error) {
+	a := &Aggregate{}
+	switch err := st.Get(AggregateKind, strings.ToLower(owner), a); err {
+	case nil:
+		return a, nil
+	case store.ErrNotFound:
+		return Precompute(st, owner)
+	default:
+		return nil, err
+	}
+}
@@ -0,0 +1,244 @@
+package analytics
+
+import (
+	"html/template"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/plays"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// StartRating is the Elo rating of a player before their first play.
+const StartRating = 1500
+
+// eloK is how far a play moves ratings. A play of n players is scored as
+// every pair of them facing off, each pair moving ratings by up to
+// eloK/(n-1), so a play moves a player by at most eloK however many took
+// part.
+const eloK = 32
+
+// PlayerRating is a player's Elo rating over the plays they took part in.
+type PlayerRating struct {
+	Name   string
+	Rating float64
+	Plays  int
+	Wins   int
+}
+
+// WinPercent is the share of their plays the player won, as a percentage.
+func (p *PlayerRating) WinPercent() float64 {
+	if p.Plays == 0 {
+		return 0
+	}
+	return float64(p.Wins) * 100 / float64(p.Plays)
+}
+
+// GameRatings is the players' ratings in a single game.
+type GameRatings struct {
+	GameID   string
+	GameName string
+	Plays    int
+	Players  []*PlayerRating // highest rated first
+}
+
+// Standings is the Elo ratings of a play group, the players of a user's
+// recorded plays, overall and per game.
+type Standings struct {
+	Overall []*PlayerRating // highest rated first
+	Games   []*GameRatings  // most played first
+}
+
+// Rating returns the overall rating of the player called name, and whether
+// they have one.
+func (s *Standings) Rating(name string) (float64, bool) {
+	for _, p := range s.Overall {
+		if strings.EqualFold(p.Name, name) {
+			return p.Rating, true
+		}
+	}
+	return 0, false
+}
+
+// ratings tracks the Elo ratings of one pool of plays.
+type ratings struct {
+	plays   int
+	players map[string]*PlayerRating // by player key
+}
+
+func newRatings() *ratings {
+	return &ratings{players: make(map[string]*PlayerRating)}
+}
+
+// play rates p, whose players are keyed by keys and won if listed in won.
+func (rs *ratings) play(p *plays.Play, keys []string, won map[int]bool) {
+	rs.plays++
+	players := make([]*PlayerRating, len(p.Players))
+	for i, pl := range p.Players {
+		r := rs.players[keys[i]]
+		if r == nil {
+			r = &PlayerRating{Name: playerName(pl), Rating: StartRating}
+			rs.players[keys[i]] = r
+		}
+		r.Plays++
+		if won[i] {
+			r.Wins++
+		}
+		players[i] = r
+	}
+	// Every delta is taken from the ratings before the play.
+	k := eloK / float64(len(players)-1)
+	deltas := make([]float64, len(players))
+	for i := range players {
+		for j := i + 1; j < len(players); j++ {
+			expected := 1 / (1 + math.Pow(10, (players[j].Rating-players[i].Rating)/400))
+			d := k * (outcome(p, won, i, j) - expected)
+			deltas[i] += d
+			deltas[j] -= d
+		}
+	}
+	for i, r := range players {
+		r.Rating += deltas[i]
+	}
+}
+
+// sorted returns the pool's players, highest rated first.
+func (rs *ratings) sorted() []*PlayerRating {
+	out := make([]*PlayerRating, 0, len(rs.players))
+	for _, r := range rs.players {
+		out = append(out, r)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Rating != out[j].Rating {
+			return out[i].Rating > out[j].Rating
+		}
+		return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name)
+	})
+	return out
+}
+
+// outcome scores player i of p against player j, 1 for a win, 0 for a loss
+// and 0.5 for a draw. A winner beats a non winner, otherwise the higher
+// score wins.
+func outcome(p *plays.Play, won map[int]bool, i, j int) float64 {
+	a, b := p.Players[i], p.Players[j]
+	switch {
+	case won[i] && !won[j]:
+		return 1
+	case won[j] && !won[i]:
+		return 0
+	case a.HasScore && b.HasScore && a.Score > b.Score:
+		return 1
+	case a.HasScore && b.HasScore && a.Score < b.Score:
+		return 0
+	}
+	return 0.5
+}
+
+// playerKey identifies a player across plays, by BGG username if they have
+// one and by name otherwise.
+func playerKey(pl plays.Player) string {
+	if pl.Username != "" {
+		return "@" + strings.ToLower(pl.Username)
+	}
+	return strings.ToLower(strings.TrimSpace(pl.Name))
+}
+
+func playerName(pl plays.Player) string {
+	if pl.Name != "" {
+		return pl.Name
+	}
+	return pl.Username
+}
+
+// Ratings rates the players of all, oldest play first. Plays with fewer
+// than two players, without a winner or scores to tell one, or won by
+// everyone, as cooperative games are, are skipped.
+func Ratings(all []*plays.Play) *Standings {
+	sorted := make([]*plays.Play, len(all))
+	copy(sorted, all)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+
+	overall := newRatings()
+	games := make(map[string]*ratings)
+	names := make(map[string]string)
+	for _, p := range sorted {
+		if len(p.Players) < 2 {
+			continue
+		}
+		w := winners(p)
+		if len(w) == 0 || len(w) == len(p.Players) {
+			continue
+		}
+		won := make(map[int]bool, len(w))
+		for _, i := range w {
+			won[i] = true
+		}
+		keys := make([]string, len(p.Players))
+		for i, pl := range p.Players {
+			keys[i] = playerKey(pl)
+		}
+		overall.play(p, keys, won)
+		g := games[p.GameID]
+		if g == nil {
+			g = newRatings()
+			games[p.GameID] = g
+		}
+		g.play(p, keys, won)
+		if p.GameName != "" {
+			names[p.GameID] = p.GameName
+		}
+	}
+
+	lb := &Standings{Overall: overall.sorted()}
+	for id, g := range games {
+		lb.Games = append(lb.Games, &GameRatings{GameID: id, GameName: names[id], Plays: g.plays, Players: g.sorted()})
+	}
+	sort.Slice(lb.Games, func(i, j int) bool {
+		if lb.Games[i].Plays != lb.Games[j].Plays {
+			return lb.Games[i].Plays > lb.Games[j].Plays
+		}
+		return lb.Games[i].GameName < lb.Games[j].GameName
+	})
+	return lb
+}
+
+type leaderboardData struct {
+	BGGName string
+	*Standings
+	Computed time.Time
+}
+
+// Leaderboard is the play group leaderboard page function, it shows the
+// precomputed Elo ratings which are refreshed in the background after plays
+// are recorded.
+func Leaderboard(tpl *template.Template, st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+
+		a, err := LoadAggregate(st, bggName)
+		if err == nil && a.Standings == nil {
+			// Computed before standings were part of the stats.
+			a, err = Precompute(st, bggName)
+		}
+		if err != nil {
+			http.Error(w, "unable to load plays", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+
+		data := leaderboardData{BGGName: bggName, Standings: a.Standings, Computed: a.Computed}
+		if err := tpl.ExecuteTemplate(w, "leaderboard.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package analytics
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/plays"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// significance is the p-value below which a seat bias is reported.
+const significance = 0.05
+
+// minExpectedWins is the smallest expected win count per seat for which the
+// chi-square test is trusted.
+const minExpectedWins = 5
+
+// SeatStats summarizes the results of a single starting seat.
+type SeatStats struct {
+	Seat     int
+	Wins     float64
+	WinRate  float64
+	AvgScore float64
+}
+
+// SeatBias is the seat analysis of one game at one player count.
+type SeatBias struct {
+	GameID      string
+	GameName    string
+	NumPlayers  int
+	Plays       int
+	Seats       []SeatStats
+	ScoreStdDev float64
+	ChiSquare   float64
+	PValue      float64
+	Enough      bool // whether there are enough plays to trust the test
+	Biased      bool
+	Note        string
+}
+
+// WinPercent is WinRate as a percentage.
+func (s SeatStats) WinPercent() float64 {
+	return s.WinRate * 100
+}
+
+type biasKey struct {
+	gameID     string
+	numPlayers int
+}
+
+// SeatBiases tests, per game and player count, whether wins are spread
+// evenly across starting seats. Plays without complete seat information or
+// without a winner are ignored.
+func SeatBiases(all []*plays.Play) []*SeatBias {
+	byKey := make(map[biasKey]*SeatBias)
+	wins := make(map[biasKey][]float64)
+	scores := make(map[biasKey][][]float64)
+
+	for _, p := range all {
+		n := len(p.Players)
+		if n < 2 || !seated(p) {
+			continue
+		}
+		winners := winners(p)
+		if len(winners) == 0 {
+			continue
+		}
+		k := biasKey{p.GameID, n}
+		b := byKey[k]
+		if b == nil {
+			b = &SeatBias{GameID: p.GameID, GameName: p.GameName, NumPlayers: n}
+			byKey[k] = b
+			wins[k] = make([]float64, n)
+			scores[k] = make([][]float64, n)
+		}
+		b.Plays++
+		for _, i := range winners {
+			wins[k][p.Players[i].Seat-1] += 1 / float64(len(winners))
+		}
+		for _, pl := range p.Players {
+			if pl.HasScore {
+				scores[k][pl.Seat-1] = append(scores[k][pl.Seat-1], pl.Score)
+			}
+		}
+	}
+
+	var biases []*SeatBias
+	for k, b := range byKey {
+		expected := float64(b.Plays) / float64(k.numPlayers)
+		var allScores []float64
+		for i, w := range wins[k] {
+			b.Seats = append(b.Seats, SeatStats{
+				Seat:     i + 1,
+				Wins:     w,
+				WinRate:  w / float64(b.Plays),
+				AvgScore: mean(scores[k][i]),
+			})
+			b.ChiSquare += (w - expected) * (w - expected) / expected
+			allScores = append(allScores, scores[k][i]...)
+		}
+		b.ScoreStdDev = stdDev(allScores)
+		b.PValue = chiSquarePValue(b.ChiSquare, k.numPlayers-1)
+		b.Enough = expected >= minExpectedWins
+		b.Biased = b.Enough && b.PValue < significance
+		b.Note = note(b)
+		biases = append(biases, b)
+	}
+	sort.Slice(biases, func(i, j int) bool {
+		if biases[i].GameName != biases[j].GameName {
+			return biases[i].GameName < biases[j].GameName
+		}
+		return biases[i].NumPlayers < biases[j].NumPlayers
+	})
+	return biases
+}
+
+// seated reports whether every player of p has a distinct seat.
+func seated(p *plays.Play) bool {
+	seen := make(map[int]bool, len(p.Players))
+	for _, pl := range p.Players {
+		if pl.Seat < 1 || pl.Seat > len(p.Players) || seen[pl.Seat] {
+			return false
+		}
+		seen[pl.Seat] = true
+	}
+	return true
+}
+
+// winners returns the indexes of the winning players of p, falling back to
+// the highest score when no winner was recorded.
+func winners(p *plays.Play) []int {
+	var idx []int
+	for i, pl := range p.Players {
+		if pl.Win {
+			idx = append(idx, i)
+		}
+	}
+	if len(idx) > 0 {
+		return idx
+	}
+	best, found := 0.0, false
+	for i, pl := range p.Players {
+		if !pl.HasScore {
+			continue
+		}
+		switch {
+		case !found || pl.Score > best:
+			best, found, idx = pl.Score, true, []int{i}
+		case pl.Score == best:
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+func note(b *SeatBias) string {
+	if !b.Enough {
+		return fmt.Sprintf("Not enough plays yet, at least %d are needed.", minExpectedWins*b.NumPlayers)
+	}
+	if !b.Biased {
+		return "No seat advantage detected."
+	}
+	top := b.Seats[0]
+	for _, s := range b.Seats[1:] {
+		if s.WinRate > top.WinRate {
+			top = s
+		}
+	}
+	return fmt.Sprintf("Seat %d wins %.0f%% of %d player games (expected %.0f%%), consider a handicap or start variant.",
+		top.Seat, top.WinPercent(), b.NumPlayers, 100/float64(b.NumPlayers))
+}
+
+type seatsData struct {
+	BGGName   string
+	Biases    []*SeatBias
+	Computed  time.Time
+	Imported  int // plays just imported, if any
+	Unmatched int // plays of the import skipped for games not found on BGG
+}
+
+// Seats is the seat bias analysis page function, it shows the precomputed
+// analysis which is refreshed in the background after plays are imported.
+func Seats(tpl *template.Template, st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+
+		a, err := LoadAggregate(st, bggName)
+		if err != nil {
+			http.Error(w, "unable to load plays", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+
+		data := seatsData{BGGName: bggName, Biases: a.Seats, Computed: a.Computed}
+		data.Imported, _ = strconv.Atoi(r.FormValue("imported"))
+		data.Unmatched, _ = strconv.Atoi(r.FormValue("unmatched"))
+		if err := tpl.ExecuteTemplate(w, "seats.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,303 @@
+// Package apiv1 is the versioned JSON API of the site, served under
+// /api/v1/ and described by the OpenAPI document at /api/v1/openapi.json.
+// It uses the same service as the pages, but has its own routes and never
+// renders HTML, so either can change without breaking the other.
+package apiv1
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/middleware"
+	"github.com/mattkoler/board_game_helper/plays"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// spec is the OpenAPI document of the API.
+//
+//go:embed openapi.json
+var spec []byte
+
+// Handler serves the API. Paths are matched in full, so it is mounted at
+// /api/v1/. Logging plays on BGG takes one of apiKeys, even when the rest of
+// the API is open.
+func Handler(svc *service.Service, jm *jobs.Manager, apiKeys []string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/openapi.json", openAPI)
+	mux.HandleFunc("/api/v1/collections/", collection(svc, jm))
+	mux.HandleFunc("/api/v1/recommendations/", recommendations(svc))
+	mux.HandleFunc("/api/v1/games", search(svc))
+	mux.HandleFunc("/api/v1/games/", game(svc))
+	mux.HandleFunc("/api/v1/jobs/", job(jm))
+	mux.HandleFunc("/api/v1/plays/", logPlay(svc, apiKeys))
+	return mux
+}
+
+func openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec)
+}
+
+// collection serves /api/v1/collections/{bggName}. GET loads the collection
+// while the client waits, POST loads it as a job and answers with the job
+// straight away.
+func collection(svc *service.Service, jm *jobs.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := collectionRequest(w, r, "/api/v1/collections/")
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			c, err := svc.LoadCollection(r.Context(), req, nil)
+			if err != nil {
+				http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+				log.Printf("%s", err)
+				return
+			}
+			writeJSON(w, http.StatusOK, c)
+		case http.MethodPost:
+			j, err := jm.Start("", func(*jobs.Job) (interface{}, error) {
+				return svc.LoadCollection(context.Background(), req, nil)
+			})
+			if err != nil {
+				http.Error(w, "unable to start collection job", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			w.Header().Set("Location", "/api/v1/jobs/"+j.ID)
+			writeJSON(w, http.StatusAccepted, j.Progress())
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// recommendations serves /api/v1/recommendations/{bggName}, the games of the
+// collection voted best or recommended, best first.
+func recommendations(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		req, ok := collectionRequest(w, r, "/api/v1/recommendations/")
+		if !ok {
+			return
+		}
+		c, err := svc.Recommend(r.Context(), req)
+		if err != nil {
+			http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, c)
+	}
+}
+
+// collectionRequest reads the collection request of r from the BGG name
+// after prefix in its path and its query. It answers bad requests itself.
+func collectionRequest(w http.ResponseWriter, r *http.Request, prefix string) (service.CollectionRequest, bool) {
+	numPlayers, err := strconv.Atoi(r.FormValue("numPlayers"))
+	if err != nil {
+		http.Error(w, "bad num players param, please provide a number", http.StatusBadRequest)
+		return service.CollectionRequest{}, false
+	}
+	minConfidence := 0
+	if v := r.FormValue("minConfidence"); v != "" {
+		if minConfidence, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "bad min confidence param, please provide a number", http.StatusBadRequest)
+			return service.CollectionRequest{}, false
+		}
+	}
+	req := service.CollectionRequest{
+		BGGName:       strings.TrimPrefix(r.URL.Path, prefix),
+		NumPlayers:    numPlayers,
+		Mood:          r.FormValue("mood"),
+		Scorer:        r.FormValue("scorer"),
+		Family:        r.FormValue("family") == "true",
+		Unplayed:      r.FormValue("unplayed") == "true",
+		MinConfidence: minConfidence,
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return service.CollectionRequest{}, false
+	}
+	return req, true
+}
+
+// search serves /api/v1/games?q={name}, the games whose name matches.
+func search(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		q := r.FormValue("q")
+		if q == "" || len(q) > 100 {
+			http.Error(w, "bad q param, please provide 1-100 characters", http.StatusBadRequest)
+			return
+		}
+		items, err := svc.Search(r.Context(), q)
+		if err != nil {
+			http.Error(w, "unable to search games", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, items)
+	}
+}
+
+// game serves /api/v1/games/{id}, a game's details rated for the optional
+// numPlayers, with the moods the optional bggName sees for it, and
+// /api/v1/games/{id}/trend, how its ratings moved.
+func game(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		gameID := strings.TrimPrefix(r.URL.Path, "/api/v1/games/")
+		trend := strings.HasSuffix(gameID, "/trend")
+		gameID = strings.TrimSuffix(gameID, "/trend")
+		if _, err := strconv.Atoi(gameID); err != nil {
+			http.Error(w, "bad game id, please provide a numeric game id", http.StatusBadRequest)
+			return
+		}
+		if trend {
+			t, err := svc.Trend(gameID)
+			if err == service.ErrNotFound {
+				http.Error(w, "no ratings recorded for this game yet", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				http.Error(w, "unable to load game trend", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			writeJSON(w, http.StatusOK, t)
+			return
+		}
+		var numPlayers int
+		if np := r.FormValue("numPlayers"); np != "" {
+			n, err := strconv.Atoi(np)
+			if err != nil || n < 1 || n > 100 {
+				http.Error(w, "bad num players param, please provide a number between 1 and 100", http.StatusBadRequest)
+				return
+			}
+			numPlayers = n
+		}
+		detail, err := svc.Game(r.Context(), gameID, numPlayers, r.FormValue("bggName"))
+		if err != nil {
+			http.Error(w, "unable to get game information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, detail)
+	}
+}
+
+// job serves /api/v1/jobs/{id}, the progress of a job and its result once
+// it is done.
+func job(jm *jobs.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		j, ok := jm.Get(strings.TrimPrefix(r.URL.Path, "/api/v1/jobs/"))
+		if !ok {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		p := j.Progress()
+		if p.Template != "" {
+			p.Result = nil // rendered by a page, not meant for the API
+		}
+		writeJSON(w, http.StatusOK, p)
+	}
+}
+
+// playInput is a play sent to be logged.
+type playInput struct {
+	GameID   string `json:"gameId"`
+	GameName string `json:"gameName"`
+	Date     string `json:"date"` // YYYY-MM-DD
+	Quantity int    `json:"quantity"`
+	Players  []struct {
+		Name     string   `json:"name"`
+		Username string   `json:"username"`
+		Seat     int      `json:"seat"`
+		Score    *float64 `json:"score"`
+		Win      bool     `json:"win"`
+	} `json:"players"`
+	Push bool `json:"push"` // log it on BGG too
+}
+
+// logPlay serves POST /api/v1/plays/{bggName}, recording a play of the user
+// and logging it on BGG too when asked with an API key.
+func logPlay(svc *service.Service, apiKeys []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bggName := strings.TrimPrefix(r.URL.Path, "/api/v1/plays/")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		var in playInput
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&in); err != nil {
+			http.Error(w, "bad play, please send it as JSON", http.StatusBadRequest)
+			return
+		}
+		date, err := time.Parse("2006-01-02", in.Date)
+		if err != nil {
+			http.Error(w, "bad date, please provide a date as YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		p := &plays.Play{GameID: in.GameID, GameName: in.GameName, Date: date, Quantity: in.Quantity}
+		for _, pl := range in.Players {
+			player := plays.Player{Name: pl.Name, Username: pl.Username, Seat: pl.Seat, Win: pl.Win}
+			if pl.Score != nil {
+				player.Score, player.HasScore = *pl.Score, true
+			}
+			p.Players = append(p.Players, player)
+		}
+		if err := p.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if in.Push && !middleware.HasAPIKey(r, apiKeys) {
+			http.Error(w, "missing or bad API key, one is needed to log plays on BGG", http.StatusUnauthorized)
+			return
+		}
+		pushed, err := svc.LogPlay(r.Context(), bggName, p, in.Push)
+		if err == service.ErrNoPush {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			http.Error(w, "unable to record play", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]interface{}{"id": p.ID, "pushed": pushed})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding response: %s", err)
+	}
+}
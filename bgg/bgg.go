@@ -0,0 +1,231 @@
+// Package bgg is a client for the BoardGameGeek XML API and game pages. It
+// caches what it fetches so pages can reuse game data without another round
+// trip to BGG.
+package bgg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Client fetches data from BGG.
+type Client struct {
+	http   *http.Client
+	base   *url.URL
+	token  string
+	slots  chan struct{} // limits the requests in flight
+	cache  *cache
+	owned  flightGroup // keyed by lowercased bggName
+	things flightGroup // keyed by game ID
+
+	fallback GameDataSource // used for games BGG can't provide, may be nil
+	breaker  *breaker
+	pacer    *pacer
+}
+
+// ErrNoToken is returned by calls needing authenticated API access when the
+// client has no token.
+var ErrNoToken = errors.New("BGG API token not configured")
+
+// unavailableError is an error of BGG's side: it couldn't be reached, timed
+// out or failed.
+type unavailableError struct{ error }
+
+func unavailable(err error) error {
+	return unavailableError{err}
+}
+
+// Unavailable reports whether err means BGG couldn't be reached or failed on
+// its side, rather than rejecting the request.
+func Unavailable(err error) bool {
+	_, ok := err.(unavailableError)
+	return ok || err == ErrCircuitOpen
+}
+
+// NewClient returns a Client making its requests with hc to the BGG site at
+// baseURL, with at most maxConcurrent requests in flight. token is sent with
+// every request when set, it is needed for the endpoints writing to BGG.
+func NewClient(hc *http.Client, baseURL, token string, maxConcurrent int) (*Client, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("bad BGG base URL %q: %s", baseURL, err)
+	}
+	return &Client{
+		http:  hc,
+		base:  base,
+		token: token,
+		slots: make(chan struct{}, maxConcurrent),
+		cache: newCache(),
+		// The defaults, SetBreaker and SetRate change them.
+		breaker: &breaker{limit: 5, cooldown: 30 * time.Second},
+		pacer:   &pacer{rate: 5, tokens: 5, last: time.Now()},
+	}, nil
+}
+
+// Authenticated reports whether the client has an API token, features that
+// write to BGG should be hidden without one.
+func (c *Client) Authenticated() bool {
+	return c.token != ""
+}
+
+// InFlight returns the number of requests to BGG currently in flight.
+func (c *Client) InFlight() int {
+	return len(c.slots)
+}
+
+// url returns the URL of path on BGG with the given query.
+func (c *Client) url(path string, query url.Values) string {
+	u := *c.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// get requests u. Responses BGG sends an ETag or Last-Modified with are
+// kept, and asked for again conditionally: when BGG answers 304 Not Modified
+// the kept body is returned as a 200.
+func (c *Client) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	kept, ok := c.cache.response(u)
+	if ok {
+		if kept.ETag != "" {
+			req.Header.Set("If-None-Match", kept.ETag)
+		}
+		if kept.LastModified != "" {
+			req.Header.Set("If-Modified-Since", kept.LastModified)
+		}
+	}
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && ok {
+		resp.Body.Close()
+		resp.StatusCode, resp.Status = http.StatusOK, "200 OK (not modified)"
+		resp.Body = ioutil.NopCloser(bytes.NewReader(kept.Body))
+		return resp, nil
+	}
+	if resp.StatusCode == http.StatusOK {
+		etag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+		if etag != "" || modified != "" {
+			resp.Body = &keptBody{ReadCloser: resp.Body, keep: func(body []byte) {
+				c.cache.putResponse(u, keptResponse{ETag: etag, LastModified: modified, Body: body})
+			}}
+		}
+	}
+	return resp, nil
+}
+
+// do sends req, waiting for a free slot and then for its turn under the rate
+// limit first. The slot is held until the response body is closed. Errors,
+// 429s and 5xx responses count towards opening the breaker, while it is open
+// ErrCircuitOpen is returned.
+func (c *Client) do(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	select {
+	case c.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-c.slots }
+	if err := c.pacer.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	if err := c.breaker.allow(time.Now()); err != nil {
+		release()
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		release()
+		if ctx.Err() == nil {
+			c.breaker.done(false, time.Now())
+		} else { // the caller giving up says nothing about BGG
+			c.breaker.cancel()
+		}
+		return nil, err
+	}
+	c.breaker.done(resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500, time.Now())
+	if resp.StatusCode == http.StatusUnauthorized && c.token != "" {
+		log.Printf("warning: BGG rejected the API token for %s", req.URL.Path)
+	}
+	resp.Body = &slotBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// maxKeptBody is the size of the largest response body kept for
+// conditional requests.
+const maxKeptBody = 1 << 20
+
+// keptBody copies a body as it is read, and hands it to keep once it has
+// been read to the end. Decoders stop at the end of the document, so the rest
+// is read on close.
+type keptBody struct {
+	io.ReadCloser
+	buf  bytes.Buffer
+	keep func(body []byte)
+}
+
+func (b *keptBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.keep != nil {
+		b.buf.Write(p[:n])
+		if b.buf.Len() > maxKeptBody {
+			b.keep, b.buf = nil, bytes.Buffer{}
+		}
+	}
+	if err == io.EOF && b.keep != nil {
+		b.keep(b.buf.Bytes())
+		b.keep = nil
+	}
+	return n, err
+}
+
+func (b *keptBody) Close() error {
+	if b.keep != nil {
+		io.Copy(ioutil.Discard, io.LimitReader(b, maxKeptBody+1))
+	}
+	return b.ReadCloser.Close()
+}
+
+// slotBody gives back a request slot when the body is closed.
+type slotBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *slotBody) Close() error {
+	b.once.Do(b.release)
+	return b.ReadCloser.Close()
+}
+
+// tooManyRequests logs the details BGG sends along with a 429 and returns
+// the error to report for it.
+func tooManyRequests(resp *http.Response, what string) error {
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("Too many requests and unable to read %s body: %s", what, err)
+	}
+	for k, v := range resp.Header {
+		log.Printf("%s : %q", k, v)
+	}
+	log.Printf("Too many request to %s body:\n%q", what, body)
+	return fmt.Errorf("Too many requests, see logs for timeout information")
+}
@@ -0,0 +1,88 @@
+package bgg
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+)
+
+// Box is the size of a game box in centimeters. Depth is the height of
+// the box lying flat.
+type Box struct {
+	Width  float64
+	Length float64
+	Depth  float64
+}
+
+// version is an edition of a game, BGG gives its box size in inches, 0
+// when unknown.
+type version struct {
+	Width struct {
+		Num float64 `xml:"value,attr"`
+	} `xml:"width"`
+	Length struct {
+		Num float64 `xml:"value,attr"`
+	} `xml:"length"`
+	Depth struct {
+		Num float64 `xml:"value,attr"`
+	} `xml:"depth"`
+}
+
+// BoxSize fetches the box size of the game with the given ID, nil if BGG has
+// none. It comes from the game's versions, which run to hundreds for popular
+// games, so they are only fetched for this and not cached, sizes are kept by
+// the caller.
+func (c *Client) BoxSize(ctx context.Context, gameID string) (*Box, error) {
+	resp, err := c.get(ctx, c.url("/xmlapi2/thing", url.Values{"id": {gameID}, "versions": {"1"}}))
+	if err != nil {
+		return nil, unavailable(fmt.Errorf("error fetching versions: %s", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, tooManyRequests(resp, "versions")
+	}
+	if resp.StatusCode >= 500 {
+		return nil, unavailable(fmt.Errorf("Bad status code fetching versions: %s", resp.Status))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Bad status code fetching versions: %s", resp.Status)
+	}
+
+	var result struct {
+		Versions []version `xml:"item>versions>item"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding versions xml: %s", err)
+	}
+	return box(result.Versions), nil
+}
+
+// box returns the box size most of versions with a known size share, or nil
+// if none has one.
+func box(versions []version) *Box {
+	counts := make(map[Box]int)
+	var best Box
+	for _, v := range versions {
+		if v.Width.Num <= 0 || v.Length.Num <= 0 || v.Depth.Num <= 0 {
+			continue
+		}
+		b := Box{Width: inchesToCm(v.Width.Num), Length: inchesToCm(v.Length.Num), Depth: inchesToCm(v.Depth.Num)}
+		counts[b]++
+		if counts[b] > counts[best] {
+			best = b
+		}
+	}
+	if counts[best] == 0 {
+		return nil
+	}
+	return &best
+}
+
+// inchesToCm converts inches to centimeters, to the millimeter.
+func inchesToCm(in float64) float64 {
+	return math.Round(in*25.4) / 10
+}
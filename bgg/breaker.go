@@ -0,0 +1,79 @@
+package bgg
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling BGG while it keeps failing.
+var ErrCircuitOpen = errors.New("BGG keeps failing, requests to it are paused for a moment")
+
+// breaker stops calling BGG after limit consecutive failures, so a struggling
+// BGG isn't hit with a storm of retries and pages fail fast. Once cooldown
+// has passed a single probe request is let through: calls resume if it
+// succeeds, otherwise the breaker opens again.
+type breaker struct {
+	mu       sync.Mutex
+	limit    int
+	cooldown time.Duration
+	failures int       // consecutive failures
+	opened   time.Time // when the breaker last opened
+	probing  bool      // a probe request is in flight
+}
+
+// allow reports whether a request may be made now.
+func (b *breaker) allow(now time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.limit {
+		return nil
+	}
+	if b.probing || now.Sub(b.opened) < b.cooldown {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+// done records how a request let through by allow went.
+func (b *breaker) done(ok bool, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if ok {
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.limit {
+		b.opened = now
+	}
+}
+
+// cancel records that a request let through by allow ended without a
+// result, the caller gave up on it. Only a probe in flight is cleared, so the
+// next request may probe again.
+func (b *breaker) cancel() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// isOpen reports whether requests are being refused.
+func (b *breaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.limit
+}
+
+// SetBreaker makes the client stop calling BGG for cooldown after failures
+// consecutive failed requests. It must be called before the client is used.
+func (c *Client) SetBreaker(failures int, cooldown time.Duration) {
+	c.breaker = &breaker{limit: failures, cooldown: cooldown}
+}
+
+// BreakerOpen reports whether requests to BGG are paused after failures.
+func (c *Client) BreakerOpen() bool {
+	return c.breaker.isOpen()
+}
@@ -0,0 +1,356 @@
+package bgg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type thingEntry struct {
+	thing   *Thing
+	fetched time.Time
+}
+
+// keptResponse is a response body with the validators BGG sent with it.
+type keptResponse struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Body         []byte `json:"body"`
+}
+
+type ownedEntry struct {
+	bggName string
+	games   []OwnedGame
+	ids     map[string]bool
+	fetched time.Time
+	changed time.Time // when a fetch last found games different from the one before
+}
+
+// cache holds data already fetched from BGG.
+type cache struct {
+	mu     sync.RWMutex
+	things map[string]thingEntry
+	owned  map[string]ownedEntry // lowercased bggName -> owned object IDs
+
+	responses map[string]keptResponse // by URL, for conditional requests
+}
+
+func newCache() *cache {
+	return &cache{
+		things: make(map[string]thingEntry),
+		owned:  make(map[string]ownedEntry),
+
+		responses: make(map[string]keptResponse),
+	}
+}
+
+func (c *cache) thing(id string) *Thing {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.things[id].thing
+}
+
+func (c *cache) putThing(t *Thing) {
+	c.putThingAt(t, time.Now())
+}
+
+// putThingAt caches t as if fetched at the given time, which decides when
+// it goes stale.
+func (c *cache) putThingAt(t *Thing, fetched time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.things[t.ID] = thingEntry{thing: t, fetched: fetched}
+}
+
+func (c *cache) ownedBy(bggName string) map[string]bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.owned[strings.ToLower(bggName)].ids
+}
+
+// ownedGames returns the collection of bggName as last fetched, or nil.
+func (c *cache) ownedGames(bggName string) []OwnedGame {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.owned[strings.ToLower(bggName)].games
+}
+
+func (c *cache) putOwned(bggName string, games []OwnedGame) {
+	c.putOwnedAt(bggName, games, time.Now())
+}
+
+func (c *cache) putOwnedAt(bggName string, games []OwnedGame, fetched time.Time) {
+	owned := make(map[string]bool, len(games))
+	for _, g := range games {
+		owned[g.ID] = true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := strings.ToLower(bggName)
+	changed := fetched
+	if old, ok := c.owned[key]; ok && sameGames(old.games, games) {
+		changed = old.changed
+	}
+	c.owned[key] = ownedEntry{bggName: bggName, games: games, ids: owned, fetched: fetched, changed: changed}
+}
+
+func sameGames(a, b []OwnedGame) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *cache) response(u string) (keptResponse, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	r, ok := c.responses[u]
+	return r, ok
+}
+
+func (c *cache) putResponse(u string, r keptResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.responses[u] = r
+}
+
+// CachedThing returns the game with the given ID if it has already been
+// fetched, or nil.
+func (c *Client) CachedThing(id string) *Thing {
+	return c.cache.thing(id)
+}
+
+// Fetched returns when the game with the given ID was last fetched, or the
+// zero time if it isn't cached.
+func (c *Client) Fetched(id string) time.Time {
+	c.cache.mu.RLock()
+	defer c.cache.mu.RUnlock()
+	return c.cache.things[id].fetched
+}
+
+// OwnedFetched returns when the collection of bggName was last fetched, and
+// when it last changed, or zero times if it isn't cached.
+func (c *Client) OwnedFetched(bggName string) (fetched, changed time.Time) {
+	c.cache.mu.RLock()
+	defer c.cache.mu.RUnlock()
+	e := c.cache.owned[strings.ToLower(bggName)]
+	return e.fetched, e.changed
+}
+
+// CachedOwned returns the set of object IDs owned by bggName, or nil if the
+// collection hasn't been fetched yet.
+func (c *Client) CachedOwned(bggName string) map[string]bool {
+	return c.cache.ownedBy(bggName)
+}
+
+// StaleThings returns the IDs of cached games fetched more than age ago.
+func (c *Client) StaleThings(age time.Duration) []string {
+	cutoff := time.Now().Add(-age)
+	c.cache.mu.RLock()
+	defer c.cache.mu.RUnlock()
+	var ids []string
+	for id, e := range c.cache.things {
+		if e.fetched.Before(cutoff) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// StaleCollections returns the names of users whose cached collection was
+// fetched more than age ago.
+func (c *Client) StaleCollections(age time.Duration) []string {
+	cutoff := time.Now().Add(-age)
+	c.cache.mu.RLock()
+	defer c.cache.mu.RUnlock()
+	var names []string
+	for _, e := range c.cache.owned {
+		if e.fetched.Before(cutoff) {
+			names = append(names, e.bggName)
+		}
+	}
+	return names
+}
+
+// CacheEntry is a cached collection or game, as listed for admins.
+type CacheEntry struct {
+	Key     string    `json:"key"`             // the BGG name or game ID
+	Name    string    `json:"name,omitempty"`  // of the game
+	Games   int       `json:"games,omitempty"` // in the collection
+	Fetched time.Time `json:"fetched"`
+}
+
+// CachedCollections lists the cached collections by BGG name.
+func (c *Client) CachedCollections() []CacheEntry {
+	c.cache.mu.RLock()
+	entries := make([]CacheEntry, 0, len(c.cache.owned))
+	for _, e := range c.cache.owned {
+		entries = append(entries, CacheEntry{Key: e.bggName, Games: len(e.games), Fetched: e.fetched})
+	}
+	c.cache.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool { return strings.ToLower(entries[i].Key) < strings.ToLower(entries[j].Key) })
+	return entries
+}
+
+// CachedThings lists the cached games by name.
+func (c *Client) CachedThings() []CacheEntry {
+	c.cache.mu.RLock()
+	entries := make([]CacheEntry, 0, len(c.cache.things))
+	for id, e := range c.cache.things {
+		entries = append(entries, CacheEntry{Key: id, Name: e.thing.Name, Fetched: e.fetched})
+	}
+	c.cache.mu.RUnlock()
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Key < entries[j].Key
+	})
+	return entries
+}
+
+// ForgetOwned drops the cached collection of bggName, reporting whether
+// there was one.
+func (c *Client) ForgetOwned(bggName string) bool {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	key := strings.ToLower(bggName)
+	_, ok := c.cache.owned[key]
+	delete(c.cache.owned, key)
+	return ok
+}
+
+// ForgetThing drops the cached game with the given ID, reporting whether
+// there was one.
+func (c *Client) ForgetThing(id string) bool {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	_, ok := c.cache.things[id]
+	delete(c.cache.things, id)
+	return ok
+}
+
+// cacheFile is the cache as saved by SaveCache.
+type cacheFile struct {
+	Things []cachedThing `json:"things"`
+	Owned  []cachedOwned `json:"owned"`
+
+	Responses map[string]keptResponse `json:"responses,omitempty"`
+}
+
+type cachedThing struct {
+	Thing   *Thing    `json:"thing"`
+	Fetched time.Time `json:"fetched"`
+}
+
+type cachedOwned struct {
+	BGGName string      `json:"bggName"`
+	Games   []OwnedGame `json:"games"`
+	Fetched time.Time   `json:"fetched"`
+}
+
+// snapshot copies the cache, with the response bodies kept for conditional
+// requests only if responses is set.
+func (c *Client) snapshot(responses bool) *cacheFile {
+	f := &cacheFile{Things: []cachedThing{}, Owned: []cachedOwned{}}
+	c.cache.mu.RLock()
+	defer c.cache.mu.RUnlock()
+	for _, e := range c.cache.things {
+		f.Things = append(f.Things, cachedThing{Thing: e.thing, Fetched: e.fetched})
+	}
+	for _, e := range c.cache.owned {
+		f.Owned = append(f.Owned, cachedOwned{BGGName: e.bggName, Games: e.games, Fetched: e.fetched})
+	}
+	if responses {
+		f.Responses = make(map[string]keptResponse, len(c.cache.responses))
+		for u, r := range c.cache.responses {
+			f.Responses[u] = r
+		}
+	}
+	return f
+}
+
+// restore adds the contents of f to the cache.
+func (c *Client) restore(f *cacheFile) (things, owned int) {
+	for _, e := range f.Things {
+		if e.Thing != nil {
+			c.cache.putThingAt(e.Thing, e.Fetched)
+			things++
+		}
+	}
+	for _, e := range f.Owned {
+		c.cache.putOwnedAt(e.BGGName, e.Games, e.Fetched)
+	}
+	for u, r := range f.Responses {
+		c.cache.putResponse(u, r)
+	}
+	return things, len(f.Owned)
+}
+
+// ExportCache writes the cached games and collections to w as JSON, a
+// portable dump for ImportCache on another deployment. Unlike SaveCache it
+// leaves out the raw BGG responses.
+func (c *Client) ExportCache(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", " ")
+	return enc.Encode(c.snapshot(false))
+}
+
+// ImportCache adds the games and collections of a dump written by
+// ExportCache, or a file saved by SaveCache, to the cache. Entries keep when
+// they were fetched, so stale ones still refresh.
+func (c *Client) ImportCache(r io.Reader) (things, owned int, err error) {
+	var f cacheFile
+	if err := json.NewDecoder(r).Decode(&f); err != nil {
+		return 0, 0, fmt.Errorf("unable to decode cache dump: %s", err)
+	}
+	things, owned = c.restore(&f)
+	return things, owned, nil
+}
+
+// SaveCache writes the cached games and collections to path, so a restart
+// doesn't start from a cold cache.
+func (c *Client) SaveCache(path string) error {
+	raw, err := json.Marshal(c.snapshot(true))
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return fmt.Errorf("unable to write cache: %s", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("unable to replace cache: %s", err)
+	}
+	return nil
+}
+
+// LoadCache adds the games and collections saved to path by SaveCache to the
+// cache, keeping when they were fetched so stale entries still refresh. A
+// missing file loads nothing.
+func (c *Client) LoadCache(path string) (things, owned int, err error) {
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to read cache: %s", err)
+	}
+	var f cacheFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return 0, 0, fmt.Errorf("unable to decode cache %q: %s", path, err)
+	}
+	things, owned = c.restore(&f)
+	return things, owned, nil
+}
@@ -0,0 +1,156 @@
+package bgg
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type collectionItem struct {
+	ObjectID string `xml:"objectid,attr"`
+	Name     string `xml:"name"`
+	NumPlays int    `xml:"numplays"`
+	Rating   struct {
+		Value string `xml:"value,attr"` // the user's, "N/A" if unrated
+		Ranks []struct {
+			Name  string `xml:"name,attr"`
+			Value string `xml:"value,attr"`
+		} `xml:"ranks>rank"`
+	} `xml:"stats>rating"`
+}
+
+// OwnedGame is a game in a user's collection.
+type OwnedGame struct {
+	ID       string
+	Name     string
+	NumPlays int     // plays the user logged
+	Rank     int     // BGG board game rank, 0 if not ranked
+	Rating   float64 // the user's own rating out of 10, 0 if unrated
+}
+
+type collection struct {
+	Items []collectionItem `xml:"item"`
+}
+
+// Owned fetches the base games owned by bggName and records their IDs in
+// the cache. Concurrent calls for the same user share a single fetch. The
+// returned slice is shared and must not be modified.
+func (c *Client) Owned(ctx context.Context, bggName string) ([]OwnedGame, error) {
+	games, err := c.owned.do(ctx, strings.ToLower(bggName), func() (interface{}, error) {
+		return c.fetchOwned(ctx, bggName)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return games.([]OwnedGame), nil
+}
+
+// OwnedOrStale is Owned, except that while BGG is unavailable it returns the
+// collection as last fetched, if there is one, with stale set.
+func (c *Client) OwnedOrStale(ctx context.Context, bggName string) (games []OwnedGame, stale bool, err error) {
+	games, err = c.Owned(ctx, bggName)
+	if err == nil || !Unavailable(err) || ctx.Err() != nil {
+		return games, false, err
+	}
+	if cached := c.cache.ownedGames(bggName); cached != nil {
+		log.Printf("warning: using the cached collection of %q: %s", bggName, err)
+		return cached, true, nil
+	}
+	return nil, false, err
+}
+
+func (c *Client) fetchOwned(ctx context.Context, bggName string) ([]OwnedGame, error) {
+	raw, err := c.fetchCollection(ctx, url.Values{
+		"username":       {bggName},
+		"excludesubtype": {"boardgameexpansion"},
+		"own":            {"1"},
+		"stats":          {"1"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	games, err := parseOwned(raw)
+	if err != nil {
+		return nil, err
+	}
+	c.cache.putOwned(bggName, games)
+	return games, nil
+}
+
+// OwnedExpansions fetches the expansions owned by bggName. Unlike Owned,
+// they aren't cached.
+func (c *Client) OwnedExpansions(ctx context.Context, bggName string) ([]OwnedGame, error) {
+	raw, err := c.fetchCollection(ctx, url.Values{
+		"username": {bggName},
+		"subtype":  {"boardgameexpansion"},
+		"own":      {"1"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return parseOwned(raw)
+}
+
+// parseOwned reads the games of a collection XML.
+func parseOwned(raw []byte) ([]OwnedGame, error) {
+	var coll collection
+	if err := xml.Unmarshal(raw, &coll); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal XML: %s", err)
+	}
+
+	games := make([]OwnedGame, len(coll.Items))
+	for i, item := range coll.Items {
+		games[i] = OwnedGame{ID: item.ObjectID, Name: item.Name, NumPlays: item.NumPlays}
+		games[i].Rating, _ = strconv.ParseFloat(item.Rating.Value, 64) // "N/A" stays 0
+		for _, r := range item.Rating.Ranks {
+			if r.Name == "boardgame" {
+				games[i].Rank, _ = strconv.Atoi(r.Value) // "Not Ranked" stays 0
+			}
+		}
+	}
+	return games, nil
+}
+
+// fetchCollection fetches the collection XML matching query, waiting while
+// BGG answers that it is still preparing it.
+func (c *Client) fetchCollection(ctx context.Context, query url.Values) ([]byte, error) {
+	collURL := c.url("/xmlapi2/collection", query)
+retry:
+	resp, err := c.get(ctx, collURL)
+	if err != nil {
+		return nil, unavailable(fmt.Errorf("error fetching collection: %s", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, tooManyRequests(resp, "collection")
+	}
+	if resp.StatusCode >= 500 {
+		return nil, unavailable(fmt.Errorf("Bad status code fetching collection: %s", resp.Status))
+	}
+
+	if resp.StatusCode == http.StatusAccepted {
+		log.Printf("BGG request accepted, waiting for body")
+		resp.Body.Close()
+		select {
+		case <-time.After(10 * time.Second):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		goto retry
+	}
+
+	// TODO: BGG gives 200 on invalid username, write check to let user know they provided invalid name and to try again
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read collection body: %s", err)
+	}
+	return raw, nil
+}
@@ -0,0 +1,51 @@
+package bgg
+
+import (
+	"context"
+	"sync"
+)
+
+// flightGroup collapses concurrent calls for the same key into a single
+// call whose result every caller shares, so simultaneous requests for one
+// user or game make one trip to BGG.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+type flightCall struct {
+	done chan struct{}
+	val  interface{}
+	err  error
+}
+
+// do runs fn for key unless a call for key is already running, in which
+// case it waits for that call's result. Waiting gives up when ctx is done,
+// but the running call carries on for the others. fn runs with the context
+// of the first caller, so if that is cancelled the waiters see the error.
+func (g *flightGroup) do(ctx context.Context, key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.val, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	c := &flightCall{done: make(chan struct{})}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	close(c.done)
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+	return c.val, c.err
+}
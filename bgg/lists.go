@@ -0,0 +1,98 @@
+package bgg
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+type valueAttr struct {
+	Value string `xml:"value,attr"`
+}
+
+// HotItem is a single entry of the BGG hotness list.
+type HotItem struct {
+	ID        string
+	Rank      int
+	Name      string
+	Year      string
+	Thumbnail string
+}
+
+// Hot fetches the BGG hotness list of board games.
+func (c *Client) Hot(ctx context.Context) ([]HotItem, error) {
+	resp, err := c.get(ctx, c.url("/xmlapi2/hot", url.Values{"type": {"boardgame"}}))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching hot list: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Bad status code fetching hot list: %s", resp.Status)
+	}
+
+	var hot struct {
+		Items []struct {
+			ID            string    `xml:"id,attr"`
+			Rank          int       `xml:"rank,attr"`
+			Name          valueAttr `xml:"name"`
+			YearPublished valueAttr `xml:"yearpublished"`
+			Thumbnail     valueAttr `xml:"thumbnail"`
+		} `xml:"item"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&hot); err != nil {
+		return nil, fmt.Errorf("error decoding hot list xml: %s", err)
+	}
+	items := make([]HotItem, len(hot.Items))
+	for i, item := range hot.Items {
+		items[i] = HotItem{
+			ID:        item.ID,
+			Rank:      item.Rank,
+			Name:      item.Name.Value,
+			Year:      item.YearPublished.Value,
+			Thumbnail: item.Thumbnail.Value,
+		}
+	}
+	return items, nil
+}
+
+// SearchItem is a single board game search result.
+type SearchItem struct {
+	ID   string
+	Name string
+	Year string
+}
+
+// Search finds board games by name.
+func (c *Client) Search(ctx context.Context, query string) ([]SearchItem, error) {
+	resp, err := c.get(ctx, c.url("/xmlapi2/search", url.Values{
+		"query": {query},
+		"type":  {"boardgame"},
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching search results: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Bad status code fetching search results: %s", resp.Status)
+	}
+
+	var results struct {
+		Items []struct {
+			ID            string    `xml:"id,attr"`
+			Name          valueAttr `xml:"name"`
+			YearPublished valueAttr `xml:"yearpublished"`
+		} `xml:"item"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, fmt.Errorf("error decoding search xml: %s", err)
+	}
+	items := make([]SearchItem, len(results.Items))
+	for i, item := range results.Items {
+		items[i] = SearchItem{ID: item.ID, Name: item.Name.Value, Year: item.YearPublished.Value}
+	}
+	return items, nil
+}
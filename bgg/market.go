@@ -0,0 +1,67 @@
+package bgg
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Listing is a copy of a game for sale on the BGG marketplace.
+type Listing struct {
+	Price     float64
+	Currency  string // ISO 4217 code, such as USD
+	Condition string // such as new, likenew or verygood
+	Listed    time.Time
+}
+
+// Listings fetches the marketplace listings of the game with the given ID.
+// They aren't cached, prices are kept by the caller.
+func (c *Client) Listings(ctx context.Context, gameID string) ([]Listing, error) {
+	resp, err := c.get(ctx, c.url("/xmlapi2/thing", url.Values{"id": {gameID}, "marketplace": {"1"}}))
+	if err != nil {
+		return nil, unavailable(fmt.Errorf("error fetching listings: %s", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, tooManyRequests(resp, "listings")
+	}
+	if resp.StatusCode >= 500 {
+		return nil, unavailable(fmt.Errorf("Bad status code fetching listings: %s", resp.Status))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Bad status code fetching listings: %s", resp.Status)
+	}
+
+	var result struct {
+		Listings []struct {
+			Date struct {
+				Value string `xml:"value,attr"`
+			} `xml:"listdate"`
+			Price struct {
+				Currency string `xml:"currency,attr"`
+				Value    string `xml:"value,attr"`
+			} `xml:"price"`
+			Condition struct {
+				Value string `xml:"value,attr"`
+			} `xml:"condition"`
+		} `xml:"item>marketplacelistings>listing"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding listings xml: %s", err)
+	}
+	listings := make([]Listing, 0, len(result.Listings))
+	for _, l := range result.Listings {
+		price, err := strconv.ParseFloat(l.Price.Value, 64)
+		if err != nil || price <= 0 {
+			continue
+		}
+		listed, _ := time.Parse(time.RFC1123Z, l.Date.Value) // zero if BGG changes the format
+		listings = append(listings, Listing{Price: price, Currency: l.Price.Currency, Condition: l.Condition.Value, Listed: listed})
+	}
+	return listings, nil
+}
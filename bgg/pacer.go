@@ -0,0 +1,52 @@
+package bgg
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// pacer spreads the requests of every caller out to at most rate a second,
+// in bursts of up to rate. Callers over the rate queue up in order.
+type pacer struct {
+	mu     sync.Mutex
+	rate   float64
+	tokens float64 // negative while callers are queued
+	last   time.Time
+}
+
+// wait blocks until a request may be made, or ctx is done.
+func (p *pacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	now := time.Now()
+	p.tokens = math.Min(p.rate, p.tokens+now.Sub(p.last).Seconds()*p.rate)
+	p.last = now
+	p.tokens--
+	delay := time.Duration(-p.tokens / p.rate * float64(time.Second))
+	p.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		// Give the turn back so callers queued behind don't wait for it.
+		p.mu.Lock()
+		p.tokens++
+		p.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// SetRate limits the requests to BGG of every caller, pages and background
+// jobs alike, to perSecond. It may be called while the client is in use.
+func (c *Client) SetRate(perSecond int) {
+	c.pacer.mu.Lock()
+	defer c.pacer.mu.Unlock()
+	c.pacer.rate = float64(perSecond)
+}
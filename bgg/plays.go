@@ -0,0 +1,180 @@
+package bgg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// PlaysPerPage is how many plays BGG returns per page of a user's plays.
+const PlaysPerPage = 100
+
+// LoggedPlay is a play a user logged on BGG.
+type LoggedPlay struct {
+	ID       string
+	GameID   string
+	GameName string
+	Date     time.Time
+	Quantity int // times the game was played in this session
+	Players  []LoggedPlayer
+}
+
+// LoggedPlayer is a participant of a logged play.
+type LoggedPlayer struct {
+	Username string
+	Name     string
+	Seat     int // 1 based start position, 0 when not logged
+	Score    string
+	Win      bool
+}
+
+// Plays fetches a page, counted from 1, of the plays bggName logged, newest
+// first, and the total number of plays logged.
+func (c *Client) Plays(ctx context.Context, bggName string, page int) ([]LoggedPlay, int, error) {
+	resp, err := c.get(ctx, c.url("/xmlapi2/plays", url.Values{
+		"username": {bggName},
+		"page":     {strconv.Itoa(page)},
+	}))
+	if err != nil {
+		return nil, 0, unavailable(fmt.Errorf("error fetching plays: %s", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, 0, tooManyRequests(resp, "plays")
+	}
+	if resp.StatusCode >= 500 {
+		return nil, 0, unavailable(fmt.Errorf("Bad status code fetching plays: %s", resp.Status))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("Bad status code fetching plays: %s", resp.Status)
+	}
+
+	var result struct {
+		Total int `xml:"total,attr"`
+		Plays []struct {
+			ID       string `xml:"id,attr"`
+			Date     string `xml:"date,attr"`
+			Quantity int    `xml:"quantity,attr"`
+			Item     struct {
+				ObjectID string `xml:"objectid,attr"`
+				Name     string `xml:"name,attr"`
+			} `xml:"item"`
+			Players []struct {
+				Username      string `xml:"username,attr"`
+				Name          string `xml:"name,attr"`
+				StartPosition string `xml:"startposition,attr"`
+				Score         string `xml:"score,attr"`
+				Win           string `xml:"win,attr"`
+			} `xml:"players>player"`
+		} `xml:"play"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, 0, fmt.Errorf("error decoding plays xml: %s", err)
+	}
+	plays := make([]LoggedPlay, 0, len(result.Plays))
+	for _, p := range result.Plays {
+		date, err := time.Parse("2006-01-02", p.Date)
+		if err != nil {
+			continue // BGG allows plays without a date, they can't be placed
+		}
+		lp := LoggedPlay{ID: p.ID, GameID: p.Item.ObjectID, GameName: p.Item.Name, Date: date, Quantity: p.Quantity}
+		if lp.Quantity < 1 {
+			lp.Quantity = 1
+		}
+		for _, pl := range p.Players {
+			seat, _ := strconv.Atoi(pl.StartPosition) // may be empty or free text
+			lp.Players = append(lp.Players, LoggedPlayer{
+				Username: pl.Username,
+				Name:     pl.Name,
+				Seat:     seat,
+				Score:    pl.Score,
+				Win:      pl.Win == "1",
+			})
+		}
+		plays = append(plays, lp)
+	}
+	return plays, result.Total, nil
+}
+
+// geekPlayPlayer is a player of a play logged with geekplay.php.
+type geekPlayPlayer struct {
+	Username string `json:"username"`
+	Name     string `json:"name"`
+	Position string `json:"position"`
+	Score    string `json:"score"`
+	Win      bool   `json:"win"`
+}
+
+// LogPlay logs p as a play of the user owning the client's token on BGG,
+// returning the ID BGG gave it. p's ID is ignored.
+func (c *Client) LogPlay(ctx context.Context, p LoggedPlay) (string, error) {
+	if c.token == "" {
+		return "", ErrNoToken
+	}
+	quantity := p.Quantity
+	if quantity < 1 {
+		quantity = 1
+	}
+	players := make([]geekPlayPlayer, len(p.Players))
+	for i, pl := range p.Players {
+		players[i] = geekPlayPlayer{Username: pl.Username, Name: pl.Name, Score: pl.Score, Win: pl.Win}
+		if pl.Seat > 0 {
+			players[i].Position = strconv.Itoa(pl.Seat)
+		}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"action":     "save",
+		"ajax":       1,
+		"objecttype": "thing",
+		"objectid":   p.GameID,
+		"playdate":   p.Date.Format("2006-01-02"),
+		"quantity":   quantity,
+		"players":    players,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url("/geekplay.php", nil), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.do(ctx, req)
+	if err != nil {
+		return "", unavailable(fmt.Errorf("error logging play: %s", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return "", tooManyRequests(resp, "play logging")
+	}
+	if resp.StatusCode >= 500 {
+		return "", unavailable(fmt.Errorf("Bad status code logging play: %s", resp.Status))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Bad status code logging play: %s", resp.Status)
+	}
+	// BGG answers errors with a 200 too, naming them in the body.
+	var result struct {
+		PlayID json.Number `json:"playid"`
+		Error  string      `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("error decoding play logging response: %s", err)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("BGG refused the play: %s", result.Error)
+	}
+	if result.PlayID == "" {
+		return "", errors.New("BGG logged the play without an ID")
+	}
+	return result.PlayID.String(), nil
+}
@@ -0,0 +1,54 @@
+package bgg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// RelatedGame is a game BGG recommends to the fans of another.
+type RelatedGame struct {
+	ID   string
+	Name string
+}
+
+// Related fetches the games BGG's "fans also like" recommends for the game
+// with the given ID, best match first. They aren't cached.
+func (c *Client) Related(ctx context.Context, gameID string) ([]RelatedGame, error) {
+	resp, err := c.get(ctx, c.url("/api/geekitem/recs", url.Values{"objectid": {gameID}, "objecttype": {"thing"}}))
+	if err != nil {
+		return nil, unavailable(fmt.Errorf("error fetching related games: %s", err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, tooManyRequests(resp, "related games")
+	}
+	if resp.StatusCode >= 500 {
+		return nil, unavailable(fmt.Errorf("Bad status code fetching related games: %s", resp.Status))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Bad status code fetching related games: %s", resp.Status)
+	}
+
+	var result struct {
+		Recs []struct {
+			Item struct {
+				ID   string `json:"id"`
+				Name string `json:"name"`
+			} `json:"item"`
+		} `json:"recs"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("error decoding related games json: %s", err)
+	}
+	games := make([]RelatedGame, 0, len(result.Recs))
+	for _, r := range result.Recs {
+		if r.Item.ID != "" && r.Item.ID != gameID {
+			games = append(games, RelatedGame{ID: r.Item.ID, Name: r.Item.Name})
+		}
+	}
+	return games, nil
+}
@@ -0,0 +1,94 @@
+package bgg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// GameDataSource provides game data. The Client fetching from BGG is the
+// primary source, a fallback source stands in for it while BGG is down.
+type GameDataSource interface {
+	Thing(ctx context.Context, gameID string) (*Thing, error)
+}
+
+// OpenSource returns the fallback source named by src: a mirror of the BGG
+// site when src is an http or https URL, otherwise a dump file.
+func OpenSource(hc *http.Client, src string, maxConcurrent int) (GameDataSource, error) {
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		return NewClient(hc, src, "", maxConcurrent)
+	}
+	return LoadDump(src)
+}
+
+// Dump is a source of games read from a JSON file holding an array of
+// Things, such as an export of the cache. Games keep the fetch times they
+// were dumped with, but their source becomes the dump.
+type Dump struct {
+	path   string
+	things map[string]*Thing
+}
+
+// LoadDump reads the dump file at path.
+func LoadDump(path string) (*Dump, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open game dump: %s", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read game dump: %s", err)
+	}
+	var things []*Thing
+	if err := json.NewDecoder(f).Decode(&things); err != nil {
+		return nil, fmt.Errorf("unable to decode game dump %s: %s", path, err)
+	}
+	d := &Dump{path: path, things: make(map[string]*Thing, len(things))}
+	for _, t := range things {
+		for _, o := range []*Origin{&t.Info, &t.Stats} {
+			o.Source = "dump " + path
+			if o.Fetched.IsZero() {
+				o.Fetched = info.ModTime()
+			}
+		}
+		d.things[t.ID] = t
+	}
+	return d, nil
+}
+
+// Thing returns the game with the given ID from the dump.
+func (d *Dump) Thing(ctx context.Context, gameID string) (*Thing, error) {
+	t, ok := d.things[gameID]
+	if !ok {
+		return nil, fmt.Errorf("game %q not in dump %s", gameID, d.path)
+	}
+	return t, nil
+}
+
+// SetFallback makes the client answer from src when a game can't be fetched
+// from BGG. It must be called before the client is used.
+func (c *Client) SetFallback(src GameDataSource) {
+	c.fallback = src
+}
+
+// thingFallback returns gameID from the fallback source after fetching it
+// from BGG failed with err. The game is cached as stale, so the next
+// refresh fetches it from BGG again.
+func (c *Client) thingFallback(ctx context.Context, gameID string, err error) (*Thing, error) {
+	if c.fallback == nil || ctx.Err() != nil {
+		return nil, err
+	}
+	t, ferr := c.fallback.Thing(ctx, gameID)
+	if ferr != nil {
+		return nil, fmt.Errorf("%s, fallback failed too: %s", err, ferr)
+	}
+	log.Printf("warning: using %s for game %q: %s", t.Info.Source, gameID, err)
+	c.cache.putThingAt(t, time.Time{})
+	return t, nil
+}
@@ -0,0 +1,438 @@
+package bgg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type gameName struct {
+	Name string `xml:"value,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type link struct {
+	Type    string `xml:"type,attr"`
+	ID      string `xml:"id,attr"`
+	Value   string `xml:"value,attr"`
+	Inbound bool   `xml:"inbound,attr"`
+}
+
+type result struct {
+	NumPlayers string `xml:"numplayers,attr"`
+	Votes      []struct {
+		Num int `xml:"numvotes,attr"`
+	} `xml:"result"`
+}
+
+type poll struct {
+	Name       string   `xml:"name,attr"`
+	TotalVotes int      `xml:"totalvotes,attr"`
+	Results    []result `xml:"results"`
+}
+
+type gameXML struct {
+	Names       []gameName `xml:"item>name"`
+	Description string     `xml:"item>description"`
+	Thumbnail   string     `xml:"item>thumbnail"`
+	Image       string     `xml:"item>image"`
+	Year        struct {
+		Num int `xml:"value,attr"`
+	} `xml:"item>yearpublished"`
+	MinAge struct {
+		Num int `xml:"value,attr"`
+	} `xml:"item>minage"`
+	MinPlayers struct {
+		Num int `xml:"value,attr"`
+	} `xml:"item>minplayers"`
+	MaxPlayers struct {
+		Num int `xml:"value,attr"`
+	} `xml:"item>maxplayers"`
+	MinTime struct {
+		Num int `xml:"value,attr"`
+	} `xml:"item>minplaytime"`
+	MaxTime struct {
+		Num int `xml:"value,attr"`
+	} `xml:"item>maxplaytime"`
+	Polls []*poll `xml:"item>poll"`
+	Links []link  `xml:"item>link"`
+}
+
+// linkValues returns the names of every link of the given type, such as
+// boardgamecategory or boardgamemechanic.
+func (gx *gameXML) linkValues(linkType string) []string {
+	var values []string
+	for _, l := range gx.Links {
+		if l.Type == linkType {
+			values = append(values, l.Value)
+		}
+	}
+	return values
+}
+
+// links returns every link of the given type, such as
+// boardgameimplementation or boardgamecompilation.
+func (gx *gameXML) links(linkType string) []Link {
+	var links []Link
+	for _, l := range gx.Links {
+		if l.Type == linkType {
+			links = append(links, Link{ID: l.ID, Name: l.Value, Inbound: l.Inbound})
+		}
+	}
+	return links
+}
+
+type gameJSON struct {
+	Score   float64 `json:"average,string"`
+	Weight  float64 `json:"avgweight,string"`
+	BScore  float64 `json:"baverage,string"`
+	Ratings int     `json:"usersrated,string"`
+}
+
+// PlayerPoll is the community vote on a single player count.
+type PlayerPoll struct {
+	NumPlayers string // BGG uses n+ for counts above the box maximum
+	Best       int
+	Rec        int
+	Nay        int
+}
+
+// Thing is the player count independent data of a single game.
+type Thing struct {
+	ID          string
+	Name        string
+	Description string
+	Thumbnail   string
+	Image       string // the full size cover
+	Year        int
+	MinAge      int
+	MinPlayers  int
+	MaxPlayers  int
+	MinTime     int // playing time in minutes
+	MaxTime     int
+	Categories  []string
+	Mechanics   []string
+	Score       float64
+	Weight      float64
+	BScore      float64
+	Ratings     int
+	Polls       []PlayerPoll // the suggested_numplayers poll
+	PollVotes   int          // people who voted in it
+
+	// Implementations are the games this one reimplements, and the ones
+	// reimplementing it. Compilations are the games collecting it, and the
+	// ones it collects.
+	Implementations []Link
+	Compilations    []Link
+	// Expands is the base games an expansion expands, from its inbound
+	// expansion links. It is empty for base games.
+	Expands []Link
+
+	Info  Origin // of the name, players, polls, description and tags
+	Stats Origin // of the score, weight and ratings
+}
+
+// Link is another game a Thing is linked to on BGG. Inbound links are
+// set on the other game, so an inbound implementation link names a game
+// reimplementing this one.
+type Link struct {
+	ID      string
+	Name    string
+	Inbound bool
+}
+
+// Editions returns the IDs of the games that are reimplementations,
+// compilations or other editions of t, in either direction.
+func (t *Thing) Editions() []string {
+	var ids []string
+	for _, l := range t.Implementations {
+		ids = append(ids, l.ID)
+	}
+	for _, l := range t.Compilations {
+		ids = append(ids, l.ID)
+	}
+	return ids
+}
+
+// Origin records where and when part of a Thing came from.
+type Origin struct {
+	Source  string // such as the BGG thing XML or a dump file
+	Fetched time.Time
+}
+
+// Verdict is the community's call on a single player count.
+type Verdict int
+
+// The verdicts, worst first.
+const (
+	NotRecommended Verdict = iota
+	Recommended
+	Best
+)
+
+var verdictNames = [...]string{"not recommended", "recommended", "best"}
+
+func (v Verdict) String() string {
+	if v < NotRecommended || v > Best {
+		return "unknown"
+	}
+	return verdictNames[v]
+}
+
+// Verdict is the call the votes on p make: not recommended when the nay
+// votes match the others together, otherwise best when best outvotes
+// recommended.
+func (p PlayerPoll) Verdict() Verdict {
+	switch {
+	case p.Best+p.Rec <= p.Nay:
+		return NotRecommended
+	case p.Best > p.Rec:
+		return Best
+	}
+	return Recommended
+}
+
+// Count is the player count p is about, and whether it is BGG's n+ count,
+// meaning more than the box maximum.
+func (p PlayerPoll) Count() (n int, plus bool, err error) {
+	n, err = strconv.Atoi(strings.TrimSuffix(p.NumPlayers, "+"))
+	if err != nil {
+		return 0, false, fmt.Errorf("Failed to convert numPlayers string to int: %s", err)
+	}
+	return n, strings.HasSuffix(p.NumPlayers, "+"), nil
+}
+
+// PlayerCounts sums up the suggested_numplayers poll of a game.
+type PlayerCounts struct {
+	Best []int // voted best
+	Good []int // voted best or recommended
+}
+
+// PlayerCounts returns the player counts the community voted best and the
+// ones voted at least recommended, lowest first. BGG's n+ count is taken as
+// 1 more than the max number of players on the box.
+func (t *Thing) PlayerCounts() (PlayerCounts, error) {
+	var pc PlayerCounts
+	for _, p := range t.Polls {
+		n, plus, err := p.Count()
+		if err != nil {
+			return PlayerCounts{}, err
+		}
+		if plus {
+			n++
+		}
+		switch p.Verdict() {
+		case Best:
+			pc.Best = append(pc.Best, n)
+			pc.Good = append(pc.Good, n)
+		case Recommended:
+			pc.Good = append(pc.Good, n)
+		}
+	}
+	return pc, nil
+}
+
+// PollVoters is how many people voted in the suggested_numplayers poll.
+// Games cached before the total was kept count the votes on their most
+// voted player count, everyone votes on each.
+func (t *Thing) PollVoters() int {
+	if t.PollVotes > 0 {
+		return t.PollVotes
+	}
+	voters := 0
+	for _, p := range t.Polls {
+		if n := p.Best + p.Rec + p.Nay; n > voters {
+			voters = n
+		}
+	}
+	return voters
+}
+
+// PlayerFit reports whether the community voted the game best or
+// recommended at targetPlayers, going by the votes PollAt finds. Polls with
+// fewer than minVotes voters aren't trusted, every player count on the box
+// is then taken as recommended.
+func (t *Thing) PlayerFit(targetPlayers, minVotes int) (bestAt, recAt bool, err error) {
+	if t.PollVoters() < minVotes {
+		return false, t.MinPlayers <= targetPlayers && targetPlayers <= t.MaxPlayers, nil
+	}
+	p, ok, err := t.PollAt(targetPlayers)
+	if !ok || err != nil {
+		return false, false, err
+	}
+	v := p.Verdict()
+	return v == Best, v == Recommended, nil
+}
+
+// PollAt returns the votes of the suggested_numplayers poll on
+// targetPlayers, with ok false if nobody voted on it. BGG's n+ count stands
+// for anything above n up to twice n.
+func (t *Thing) PollAt(targetPlayers int) (p PlayerPoll, ok bool, err error) {
+	for _, p := range t.Polls {
+		n, plus, err := p.Count()
+		if err != nil {
+			return PlayerPoll{}, false, err
+		}
+		if n == targetPlayers || (plus && n < targetPlayers && targetPlayers <= n*2) {
+			return p, true, nil
+		}
+	}
+	return PlayerPoll{}, false, nil
+}
+
+// Thing returns the game with the given ID, using the cache when possible.
+func (c *Client) Thing(ctx context.Context, gameID string) (*Thing, error) {
+	if t := c.cache.thing(gameID); t != nil {
+		return t, nil
+	}
+	return c.RefreshThing(ctx, gameID)
+}
+
+// RefreshThing fetches the game with the given ID from BGG, replacing any
+// cached copy. Concurrent calls for the same game share a single fetch. If
+// BGG fails the fallback source is used, when there is one.
+func (c *Client) RefreshThing(ctx context.Context, gameID string) (*Thing, error) {
+	t, err := c.things.do(ctx, gameID, func() (interface{}, error) {
+		t, err := c.fetchThing(ctx, gameID)
+		if err != nil {
+			return c.thingFallback(ctx, gameID, err)
+		}
+		return t, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.(*Thing), nil
+}
+
+func (c *Client) fetchThing(ctx context.Context, gameID string) (*Thing, error) {
+	xresp, err := c.get(ctx, c.url("/xmlapi2/thing", url.Values{"id": {gameID}}))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching game xml: %s", err)
+	}
+	defer xresp.Body.Close()
+
+	if xresp.StatusCode == http.StatusTooManyRequests {
+		return nil, tooManyRequests(xresp, "game")
+	}
+
+	if xresp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Bad status code fetching game xml: %s", xresp.Status)
+	}
+
+	var gXML gameXML
+	if err := xml.NewDecoder(xresp.Body).Decode(&gXML); err != nil {
+		return nil, fmt.Errorf("error decoding game xml: %s", err)
+	}
+	xresp.Body.Close() // give back the request slot before the next request
+	info := Origin{Source: "thing XML from " + c.base.Host, Fetched: time.Now()}
+
+	jresp, err := c.get(ctx, c.url(path.Join("/boardgame", url.PathEscape(gameID)), nil))
+	if err != nil {
+		return nil, fmt.Errorf("error fetching game json: %s", err)
+	}
+	defer jresp.Body.Close()
+
+	if jresp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Bad status code fetching game json: %s", jresp.Status)
+	}
+	gJSON, err := jsonDecode(jresp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to decode json: %s", err)
+	}
+
+	t := newThing(gameID, &gXML, gJSON)
+	t.Info = info
+	t.Stats = Origin{Source: "stats page from " + c.base.Host, Fetched: time.Now()}
+	c.cache.putThing(t)
+	return t, nil
+}
+
+func newThing(id string, gx *gameXML, gj *gameJSON) *Thing {
+	t := &Thing{
+		ID:          id,
+		Description: gx.Description,
+		Thumbnail:   gx.Thumbnail,
+		Image:       gx.Image,
+		Year:        gx.Year.Num,
+		MinAge:      gx.MinAge.Num,
+		MinPlayers:  gx.MinPlayers.Num,
+		MaxPlayers:  gx.MaxPlayers.Num,
+		MinTime:     gx.MinTime.Num,
+		MaxTime:     gx.MaxTime.Num,
+		Categories:  gx.linkValues("boardgamecategory"),
+		Mechanics:   gx.linkValues("boardgamemechanic"),
+		Score:       gj.Score,
+		Weight:      gj.Weight,
+		BScore:      gj.BScore,
+		Ratings:     gj.Ratings,
+	}
+	t.Implementations = gx.links("boardgameimplementation")
+	t.Compilations = gx.links("boardgamecompilation")
+	for _, l := range gx.links("boardgameexpansion") {
+		if l.Inbound {
+			t.Expands = append(t.Expands, l)
+		}
+	}
+	for _, name := range gx.Names {
+		if name.Type == "primary" {
+			t.Name = name.Name
+			break
+		}
+	}
+	for _, p := range gx.Polls {
+		if p.Name != "suggested_numplayers" {
+			continue
+		}
+		t.PollVotes = p.TotalVotes
+		for _, res := range p.Results {
+			if len(res.Votes) < 3 {
+				continue
+			}
+			t.Polls = append(t.Polls, PlayerPoll{
+				NumPlayers: res.NumPlayers,
+				Best:       res.Votes[0].Num,
+				Rec:        res.Votes[1].Num,
+				Nay:        res.Votes[2].Num,
+			})
+		}
+	}
+	return t
+}
+
+func jsonDecode(r io.Reader) (*gameJSON, error) {
+	htmlRaw, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read body: %s", err)
+	}
+
+	needle := []byte("GEEK.geekitemPreload")
+	start := bytes.Index(htmlRaw, needle)
+	if start < 0 {
+		return nil, fmt.Errorf("Couldn't find GEEK.geekitemPreload in htmlRaw")
+	}
+	start += len(needle)
+
+	preload := htmlRaw[start:]
+	brace := bytes.IndexByte(preload, '{')
+	if brace < 0 {
+		return nil, fmt.Errorf("Couldn't find the first brace in preloaded data")
+	}
+	preload = preload[brace:]
+
+	var data struct{ Item struct{ Stats gameJSON } }
+	if err := json.NewDecoder(bytes.NewReader(preload)).Decode(&data); err != nil {
+		return nil, fmt.Errorf("Failed to parse json")
+	}
+	return &data.Item.Stats, nil
+}
@@ -0,0 +1,65 @@
+package bgg
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// ListedGame is a game a user flagged for trade or put on their wishlist.
+type ListedGame struct {
+	ID       string
+	Name     string
+	Priority int // wishlist priority, from 1 "must have" to 5 "don't buy this", 0 off the wishlist
+}
+
+// DontBuy is the wishlist priority of games the user doesn't want after all.
+const DontBuy = 5
+
+// TradeLists fetches the games bggName flagged for trade and the games on
+// their wishlist.
+func (c *Client) TradeLists(ctx context.Context, bggName string) (forTrade, wishlist []ListedGame, err error) {
+	if forTrade, err = c.listedGames(ctx, bggName, "trade"); err != nil {
+		return nil, nil, err
+	}
+	if wishlist, err = c.Wishlist(ctx, bggName); err != nil {
+		return nil, nil, err
+	}
+	return forTrade, wishlist, nil
+}
+
+// Wishlist fetches the games on bggName's wishlist, with their priority.
+func (c *Client) Wishlist(ctx context.Context, bggName string) ([]ListedGame, error) {
+	return c.listedGames(ctx, bggName, "wishlist")
+}
+
+// listedGames fetches the games of bggName's collection with the status
+// filter set, such as trade or wishlist.
+func (c *Client) listedGames(ctx context.Context, bggName, filter string) ([]ListedGame, error) {
+	raw, err := c.fetchCollection(ctx, url.Values{"username": {bggName}, filter: {"1"}})
+	if err != nil {
+		return nil, err
+	}
+	var coll struct {
+		Items []struct {
+			ObjectID string `xml:"objectid,attr"`
+			Name     string `xml:"name"`
+			Status   struct {
+				Priority string `xml:"wishlistpriority,attr"`
+			} `xml:"status"`
+		} `xml:"item"`
+	}
+	if err := xml.Unmarshal(raw, &coll); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal XML: %s", err)
+	}
+	games := make([]ListedGame, len(coll.Items))
+	for i, item := range coll.Items {
+		games[i] = ListedGame{ID: item.ObjectID, Name: item.Name}
+		if filter == "wishlist" {
+			games[i].Priority, _ = strconv.Atoi(item.Status.Priority)
+		}
+	}
+	return games, nil
+}
@@ -0,0 +1,53 @@
+// Package branding lets a deployment skin the site without forking it: a
+// site name, logo and accent color injected into every template, plus a
+// directory of templates that replace the built in ones.
+package branding
+
+import (
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"regexp"
+)
+
+// Branding is the look of a deployment.
+type Branding struct {
+	SiteName string
+	Logo     string // URL of the logo shown in the navbar, if any
+	Accent   template.CSS
+}
+
+var colorRE = regexp.MustCompile(`^(#[0-9a-fA-F]{3,8}|[a-zA-Z]{3,20}|rgba?\([0-9., %]+\))$`)
+
+// New returns the branding for a site name, logo URL and CSS accent color.
+func New(siteName, logo, accent string) (Branding, error) {
+	b := Branding{SiteName: siteName, Logo: logo}
+	if !colorRE.MatchString(accent) {
+		return b, fmt.Errorf("bad site accent %q, please provide a CSS color", accent)
+	}
+	b.Accent = template.CSS(accent)
+	return b, nil
+}
+
+// Funcs makes the branding available to templates as {{ brand }}.
+func (b Branding) Funcs() template.FuncMap {
+	return template.FuncMap{
+		"brand": func() Branding { return b },
+	}
+}
+
+// Override parses every html file in dir into tpl, replacing any template
+// with the same name. A missing or empty dir leaves tpl unchanged.
+func Override(tpl *template.Template, dir string) (*template.Template, error) {
+	if dir == "" {
+		return tpl, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+	if err != nil {
+		return nil, fmt.Errorf("bad template override dir %q: %s", dir, err)
+	}
+	if len(files) == 0 {
+		return tpl, nil
+	}
+	return tpl.ParseFiles(files...)
+}
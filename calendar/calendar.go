@@ -0,0 +1,134 @@
+// Package calendar serves planned game nights as iCalendar feeds, so they
+// show up in the attendees' calendar apps and follow any changes.
+package calendar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// eventLength is how long a game night with a start time is assumed to run,
+// events without one fill the whole day.
+const eventLength = 4 * time.Hour
+
+// Events serves /events/{token}.ics, the calendar of a single event, and
+// passes other requests on to next. Links in the calendar point to siteURL,
+// or to the host of the request if it is empty.
+func Events(next http.Handler, svc *service.Service, siteURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.URL.Path, "/events/")
+		if !strings.HasSuffix(token, ".ics") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		e, err := svc.Event(strings.TrimSuffix(token, ".ics"))
+		if err == service.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "unable to load event", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		serve(w, r, siteURL, "Game night", []*service.Event{e})
+	}
+}
+
+// Feed serves /calendar.ics?bggName={name}, a feed of the recent and
+// upcoming events the user is attending, for calendar apps to subscribe to.
+func Feed(svc *service.Service, siteURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		events, err := svc.EventsOf(bggName, time.Now().AddDate(0, -3, 0))
+		if err != nil {
+			http.Error(w, "unable to load events", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		serve(w, r, siteURL, bggName+"'s game nights", events)
+	}
+}
+
+func serve(w http.ResponseWriter, r *http.Request, siteURL, name string, events []*service.Event) {
+	base := strings.TrimSuffix(siteURL, "/")
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if err := Write(w, base, name, events); err != nil {
+		log.Printf("Error writing calendar: %s", err)
+	}
+}
+
+// Write writes events as an iCalendar named name, linking each one to its
+// page under base.
+func Write(w io.Writer, base, name string, events []*service.Event) error {
+	host := strings.TrimPrefix(strings.TrimPrefix(base, "https://"), "http://")
+	bw := bufio.NewWriter(w)
+	line := func(prop, value string) { fold(bw, prop+":"+value) }
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//board_game_helper//game nights//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("X-WR-CALNAME", escape(name))
+	for _, e := range events {
+		line("BEGIN", "VEVENT")
+		line("UID", e.Token+"@"+host)
+		line("DTSTAMP", e.Created.UTC().Format("20060102T150405Z"))
+		// Dates are entered as the attendees' local time, so they are
+		// written floating, without a time zone.
+		if h, m, s := e.Date.Clock(); h == 0 && m == 0 && s == 0 {
+			line("DTSTART;VALUE=DATE", e.Date.Format("20060102"))
+			line("DTEND;VALUE=DATE", e.Date.AddDate(0, 0, 1).Format("20060102"))
+		} else {
+			line("DTSTART", e.Date.Format("20060102T150405"))
+			line("DTEND", e.Date.Add(eventLength).Format("20060102T150405"))
+		}
+		line("SUMMARY", escape(fmt.Sprintf("Game night for %d", e.NumPlayers)))
+		if e.Location != "" {
+			line("LOCATION", escape(e.Location))
+		}
+		line("DESCRIPTION", escape("With "+strings.Join(e.Attendees, ", ")+".\nPicks: "+base+"/events/"+e.Token))
+		line("URL", base+"/events/"+e.Token)
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return bw.Flush()
+}
+
+// escape escapes the characters iCalendar text values can't hold as is.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+// fold writes a content line, folding it into lines of at most 75 bytes
+// without splitting a UTF-8 character, as iCalendar asks.
+func fold(w *bufio.Writer, l string) {
+	limit := 75
+	for len(l) > limit {
+		cut := limit
+		for cut > 0 && l[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(l[:cut] + "\r\n ")
+		l = l[cut:]
+		limit = 74 // the leading space counts
+	}
+	w.WriteString(l + "\r\n")
+}
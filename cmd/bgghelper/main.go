@@ -0,0 +1,315 @@
+// Command bgghelper looks up BGG collections and recommendations from the
+// command line, with the same BGG client and service as the site.
+//
+// Usage:
+//
+//	bgghelper [settings] collection fetch <bgg name>
+//	bgghelper [settings] recs -players N [-mood mood] [-scorer name] <bgg name>
+//	bgghelper [settings] game show <game id>
+//	bgghelper [settings] export -format csv|json -players N <bgg name>
+//	bgghelper [settings] cache export|import <file>
+//
+// The settings are the site's, such as -bgg_token or -config, run with -h to
+// list them. Flags of a command go before its arguments. The cache command
+// moves the file set by cache_path to and from the portable dump of
+// /admin/export, so a cache can be carried to another deployment before it
+// starts.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/config"
+	"github.com/mattkoler/board_game_helper/gamefmt"
+	"github.com/mattkoler/board_game_helper/queue"
+	"github.com/mattkoler/board_game_helper/service"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+const usage = `usage: bgghelper [settings] <command>
+
+commands:
+  collection fetch <bgg name>                          list the games a user owns
+  recs -players N [-mood m] [-scorer s] <bgg name>     best and recommended games
+  game show <game id>                                  a game's details
+  export -format csv|json -players N <bgg name>        every game of a collection, rated
+  cache export|import <file>                           dump cache_path to a file, or add a dump to it
+`
+
+// app is what the commands share.
+type app struct {
+	cfg    *config.Config
+	client *bgg.Client
+	svc    *service.Service
+	out    io.Writer
+}
+
+// commands run with the arguments after their name.
+var commands = map[string]func(ctx context.Context, a *app, args []string) error{
+	"collection": collectionCmd,
+	"recs":       recsCmd,
+	"game":       gameCmd,
+	"export":     exportCmd,
+	"cache":      cacheCmd,
+}
+
+func main() {
+	log.SetFlags(0)
+	cfg, args, err := config.LoadArgs(os.Args[1:], os.Getenv)
+	if err != nil {
+		log.Fatalf("unable to load config: %s", err)
+	}
+	if len(args) == 0 || commands[args[0]] == nil {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	hc := &http.Client{Timeout: cfg.BGGTimeout}
+	client, err := bgg.NewClient(hc, cfg.BGGBaseURL, cfg.BGGToken, cfg.BGGConcurrency)
+	if err != nil {
+		log.Fatalf("unable to create BGG client: %s", err)
+	}
+	client.SetBreaker(cfg.BreakerFailures, cfg.BreakerCooldown)
+	client.SetRate(cfg.BGGRate)
+	if cfg.FallbackSource != "" {
+		fallback, err := bgg.OpenSource(hc, cfg.FallbackSource, cfg.BGGConcurrency)
+		if err != nil {
+			log.Fatalf("unable to open fallback source: %s", err)
+		}
+		client.SetFallback(fallback)
+	}
+	// The store is kept in memory, so the command never writes to the
+	// site's store file. With no background workers every game of a
+	// collection is fetched while the command waits.
+	st, err := store.Open("")
+	if err != nil {
+		log.Fatalf("unable to open store: %s", err)
+	}
+	cfg.CollectionLimit = int(^uint(0) >> 1)
+	svc := service.New(cfg, client, st, queue.NewStoreQueue(st))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-stop
+		cancel()
+	}()
+
+	if err := commands[args[0]](ctx, &app{cfg: cfg, client: client, svc: svc, out: os.Stdout}, args[1:]); err != nil {
+		log.Fatalf("%s: %s", args[0], err)
+	}
+}
+
+// collectionCmd lists the games a user owns, most played first.
+func collectionCmd(ctx context.Context, a *app, args []string) error {
+	if len(args) != 2 || args[0] != "fetch" {
+		return fmt.Errorf("usage: collection fetch <bgg name>")
+	}
+	owned, err := a.client.Owned(ctx, args[1])
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(owned, func(i, j int) bool { return owned[i].NumPlays > owned[j].NumPlays })
+
+	tw := tabwriter.NewWriter(a.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tPLAYS\tRANK")
+	for _, g := range owned {
+		rank := "-"
+		if g.Rank != 0 {
+			rank = strconv.Itoa(g.Rank)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", g.ID, g.Name, g.NumPlays, rank)
+	}
+	return tw.Flush()
+}
+
+// requestFlags adds the flags picking a collection request to fs, the BGG
+// name is taken from the first argument.
+func requestFlags(fs *flag.FlagSet) func(args []string) (service.CollectionRequest, error) {
+	players := fs.Int("players", 0, "number of players")
+	mood := fs.String("mood", "", "only games with this mood")
+	scorer := fs.String("scorer", "", "name of the scorer, the default if empty")
+	family := fs.Bool("family", false, "hide games unsuitable for family mode")
+	unplayed := fs.Bool("unplayed", false, "only games not played in 6 months")
+	return func(args []string) (service.CollectionRequest, error) {
+		if err := fs.Parse(args); err != nil {
+			return service.CollectionRequest{}, err
+		}
+		if fs.NArg() != 1 {
+			return service.CollectionRequest{}, fmt.Errorf("please provide one bgg name after the flags")
+		}
+		req := service.CollectionRequest{BGGName: fs.Arg(0), NumPlayers: *players, Mood: *mood, Scorer: *scorer, Family: *family, Unplayed: *unplayed}
+		return req, req.Validate()
+	}
+}
+
+// recsCmd prints the best and recommended games of a collection.
+func recsCmd(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("recs", flag.ContinueOnError)
+	parse := requestFlags(fs)
+	req, err := parse(args)
+	if err != nil {
+		return err
+	}
+	c, err := a.svc.Recommend(ctx, req)
+	if err != nil {
+		return err
+	}
+	if len(c.Games) == 0 {
+		fmt.Fprintf(a.out, "Nothing voted best or recommended for %d players\n", req.NumPlayers)
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(a.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "VOTE\tNAME\tPLAYERS\tWEIGHT\tFIT\tMOODS")
+	for _, g := range c.Games {
+		vote := "rec"
+		if g.Best {
+			vote = "best"
+		}
+		name := g.Name
+		if g.Favorite {
+			name += " ★"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d-%d\t%.1f\t%.2f\t%s\n", vote, name, g.MinPlayers, g.MaxPlayers, g.Weight, g.Fit, strings.Join(g.Moods, ", "))
+	}
+	return tw.Flush()
+}
+
+// gameCmd prints a game's details.
+func gameCmd(ctx context.Context, a *app, args []string) error {
+	if len(args) != 2 || args[0] != "show" {
+		return fmt.Errorf("usage: game show <game id>")
+	}
+	d, err := a.svc.Game(ctx, args[1], 0, "")
+	if err != nil {
+		return err
+	}
+	g := d.Game
+	fmt.Fprintf(a.out, "%s", g.Name)
+	if d.Year != 0 {
+		fmt.Fprintf(a.out, " (%d)", d.Year)
+	}
+	fmt.Fprintf(a.out, "\nhttps://boardgamegeek.com/boardgame/%s\n\n", g.ID)
+
+	tw := tabwriter.NewWriter(a.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "Players\t%s\n", gamefmt.PlayerSummary(g.BestAt, g.GoodAt, g.MinPlayers, g.MaxPlayers))
+	fmt.Fprintf(tw, "Age\t%d+\n", g.MinAge)
+	fmt.Fprintf(tw, "Weight\t%.2f\n", g.Weight)
+	fmt.Fprintf(tw, "Rating\t%.2f by %d users (bayes %.2f)\n", g.Score, g.Ratings, g.BScore)
+	fmt.Fprintf(tw, "Moods\t%s\n", strings.Join(g.Moods, ", "))
+	fmt.Fprintf(tw, "Categories\t%s\n", strings.Join(g.Categories, ", "))
+	fmt.Fprintf(tw, "Mechanics\t%s\n", strings.Join(g.Mechanics, ", "))
+	for _, p := range d.Polls {
+		fmt.Fprintf(tw, "%s players\t%d best, %d recommended, %d not recommended\n", p.NumPlayers, p.Best, p.Rec, p.Nay)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if d.Stale {
+		fmt.Fprintln(a.out, "\nSome of this data is older than the game TTL.")
+	}
+	if d.Description != "" {
+		fmt.Fprintf(a.out, "\n%s\n", d.Description)
+	}
+	return nil
+}
+
+// exportCmd writes every game of a collection, rated for the player count,
+// as CSV or JSON.
+func exportCmd(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "csv", "csv or json")
+	parse := requestFlags(fs)
+	req, err := parse(args)
+	if err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("bad format %q, please pick csv or json", *format)
+	}
+	c, err := a.svc.LoadCollection(ctx, req, nil)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(a.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(c)
+	}
+	w := csv.NewWriter(a.out)
+	w.Write([]string{"id", "name", "best", "rec", "min_players", "max_players", "min_age", "weight", "score", "bscore", "ratings", "fit", "favorite", "moods"})
+	for _, g := range c.Games {
+		w.Write([]string{
+			g.ID, g.Name,
+			strconv.FormatBool(g.Best), strconv.FormatBool(g.Rec),
+			strconv.Itoa(g.MinPlayers), strconv.Itoa(g.MaxPlayers), strconv.Itoa(g.MinAge),
+			strconv.FormatFloat(g.Weight, 'f', 2, 64),
+			strconv.FormatFloat(g.Score, 'f', 2, 64),
+			strconv.FormatFloat(g.BScore, 'f', 2, 64),
+			strconv.Itoa(g.Ratings),
+			strconv.FormatFloat(g.Fit, 'f', 3, 64),
+			strconv.FormatBool(g.Favorite),
+			strings.Join(g.Moods, ";"),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// cacheCmd writes the cache saved at cache_path as a dump, or adds a dump to
+// it.
+func cacheCmd(ctx context.Context, a *app, args []string) error {
+	if len(args) != 2 || (args[0] != "export" && args[0] != "import") {
+		return fmt.Errorf("usage: cache export|import <file>")
+	}
+	if a.cfg.CachePath == "" {
+		return fmt.Errorf("please set cache_path to the cache file of the site")
+	}
+	if _, _, err := a.client.LoadCache(a.cfg.CachePath); err != nil {
+		return err
+	}
+
+	if args[0] == "export" {
+		f, err := os.Create(args[1])
+		if err != nil {
+			return err
+		}
+		if err := a.client.ExportCache(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	f, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	things, owned, err := a.client.ImportCache(f)
+	if err != nil {
+		return err
+	}
+	if err := a.client.SaveCache(a.cfg.CachePath); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.out, "Imported %d games and %d collections into %s\n", things, owned, a.cfg.CachePath)
+	return nil
+}
@@ -0,0 +1,55 @@
+package collection
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// Catalog is the printable catalog of a collection, /catalog?bggName=X,
+// covers and how each game plays, laid out for paper. format=pdf downloads
+// it as a PDF.
+func Catalog(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		c, err := svc.Catalog(r.Context(), bggName)
+		if err != nil {
+			http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		switch {
+		case r.FormValue("format") == "pdf":
+			var buf bytes.Buffer
+			if err := c.WritePDF(&buf); err != nil {
+				http.Error(w, "unable to make pdf", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-catalog.pdf"`, bggName))
+			if _, err := buf.WriteTo(w); err != nil {
+				log.Printf("Error writing catalog pdf: %s", err)
+			}
+		case jobs.WantsJSON(r):
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(c); err != nil {
+				log.Printf("Error encoding catalog: %s", err)
+			}
+		default:
+			if err := tpl.ExecuteTemplate(w, "catalog.html", c); err != nil {
+				log.Printf("Error executing template: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package collection
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// Challenge is the 10x10 challenge page, /challenge?bggName=X&year=Y, this
+// year by default. GET shows the progress towards playing the picked games
+// ten times each, or the games to pick from, POST saves the games picked
+// with the game params and shows the progress.
+func Challenge(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		year := time.Now().Year()
+		if y := r.FormValue("year"); y != "" {
+			n, err := strconv.Atoi(y)
+			if err != nil || n < 1900 || n > year+1 {
+				http.Error(w, fmt.Sprintf("bad year param, please provide a year between 1900 and %d", year+1), http.StatusBadRequest)
+				return
+			}
+			year = n
+		}
+
+		if r.Method == http.MethodPost {
+			c := &service.Challenge{BGGName: bggName, Year: year, GameIDs: r.Form["game"]}
+			if err := c.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := svc.SetChallenge(c); err != nil {
+				http.Error(w, "unable to save challenge", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			http.Redirect(w, r, "/challenge?"+url.Values{
+				"bggName": {bggName},
+				"year":    {strconv.Itoa(year)},
+			}.Encode(), http.StatusSeeOther)
+			return
+		}
+
+		progress, err := svc.ChallengeProgress(r.Context(), bggName, year)
+		if err != nil {
+			http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		if jobs.WantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(progress); err != nil {
+				log.Printf("Error encoding challenge: %s", err)
+			}
+			return
+		}
+		if err := tpl.ExecuteTemplate(w, "challenge.html", progress); err != nil {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
@@ -1,81 +1,24 @@
 package collection
 
 import (
-	"bytes"
-	"encoding/json"
-	"encoding/xml"
+	"context"
 	"fmt"
 	"html/template"
-	"io"
-	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
-	"path"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
-)
-
-type collectionItem struct {
-	ObjectID string `xml:"objectid,attr"`
-}
-
-type collection struct {
-	Items []collectionItem `xml:"item"`
-}
-
-type gameName struct {
-	Name string `xml:"value,attr"`
-	Type string `xml:"type,attr"`
-}
-
-type result struct {
-	NumPlayers string `xml:"numplayers,attr"`
-	Votes      []struct {
-		Num int `xml:"numvotes,attr"`
-	} `xml:"result"`
-}
-
-type poll struct {
-	Name       string   `xml:"name,attr"`
-	TotalVotes int      `xml:"totalvotes,attr"`
-	Results    []result `xml:"results"`
-}
-
-type gameXML struct {
-	Names       []gameName `xml:"item>name"`
-	PrimaryName string     `xml:"-"`
-	Description string     `xml:"item>description"`
-	MinPlayers  struct {
-		Num int `xml:"value,attr"`
-	} `xml:"item>minplayers"`
-	MaxPlayers struct {
-		Num int `xml:"value,attr"`
-	} `xml:"item>maxplayers"`
-	Polls []*poll `xml:"item>poll"`
-}
-
-type gameJSON struct {
-	Score   float64 `json:"average,string"`
-	Weight  float64 `json:"avgweight,string"`
-	BScore  float64 `json:"baverage,string"`
-	Ratings int     `json:"usersrated,string"`
-}
 
-type game struct {
-	Name       string
-	ID         string
-	Best       bool
-	Rec        bool
-	MinPlayers int
-	MaxPlayers int
-	Score      float64
-	Weight     float64
-	BScore     float64
-	Ratings    int
-}
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/family"
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/moods"
+	"github.com/mattkoler/board_game_helper/notify"
+	"github.com/mattkoler/board_game_helper/recommend"
+	"github.com/mattkoler/board_game_helper/service"
+	"github.com/mattkoler/board_game_helper/session"
+)
 
 func formWrapper(h http.HandlerFunc, params ...string) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -93,10 +36,28 @@ func formWrapper(h http.HandlerFunc, params ...string) http.HandlerFunc {
 	})
 }
 
-// Home is the homepage function.
-func Home(tpl *template.Template) http.HandlerFunc {
+type homeData struct {
+	Moods   []string
+	Scorers []string
+	Sorts   []string
+	Family  bool
+	Prefs   *session.Prefs // prefills the form
+	Email   bool           // emails can be sent, offer them
+}
+
+// Home is the homepage function, its form is prefilled with the choices the
+// browser made last time. When mailer can send emails the form offers one
+// once the collection has loaded.
+func Home(tpl *template.Template, sessions *session.Sessions, mailer *notify.Mailer, apiKeys []string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if err := tpl.ExecuteTemplate(w, "home.html", nil); err != nil {
+		if err := tpl.ExecuteTemplate(w, "home.html", homeData{
+			Moods:   moods.All,
+			Scorers: recommend.Scorers(),
+			Sorts:   session.Sorts,
+			Family:  family.Enabled(r),
+			Prefs:   sessions.Load(r),
+			Email:   mailer.Enabled() && keysSet(apiKeys),
+		}); err != nil {
 			log.Printf("Error executing template: %s", err)
 			return
 		}
@@ -106,265 +67,323 @@ func Home(tpl *template.Template) http.HandlerFunc {
 type collectionData struct {
 	BGGName    string
 	NumPlayers int
-	Games      []*game
+	Mood       string
+	Scorer     string
+	Sort       string
+	Family     bool
+	Unplayed   bool // only games not played in a while are shown
+	Expansions bool // owned expansions are nested under their base games
+	// MinConfidence is how sure in percent the poll must be of the games
+	// shown, 0 if any game goes.
+	MinConfidence int
+	Public        bool // the collection is published at /u/{BGGName}
+	Total         int
+	Deferred      int                   // games still loading in the background
+	Stale         bool                  // BGG is down, the collection is the one last fetched and may be out of date
+	Pending       []bgg.OwnedGame       // placeholders shown until each game loads
+	Orphans       []recommend.Expansion // owned expansions of games not owned
+	Loaded        int
+	Hidden        int
+	Rows          []collectionRow
 }
 
-// Collection is the Collection page function.
-func Collection(tpl *template.Template, client *http.Client) http.HandlerFunc {
-	return formWrapper(func(w http.ResponseWriter, r *http.Request) {
-		bggName := r.FormValue("bggName")
-		if len(bggName) < 4 || len(bggName) > 20 {
-			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
-			return
-		}
-		numPlayers, err := strconv.Atoi(r.FormValue("numPlayers"))
-		if err != nil {
-			http.Error(w, "bad num players param, please provide a number", http.StatusBadRequest)
-			return
-		}
-		if numPlayers < 1 || numPlayers > 100 {
-			http.Error(w, "bad num players param, please provide a number between 1 and 100", http.StatusBadRequest)
-			return
-		}
-
-		games, err := fetchCollection(client, bggName, numPlayers)
-		if err != nil {
-			http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
-			log.Printf("%s", err)
-			return
-		}
-
-		data := collectionData{
-			BGGName:    bggName,
-			NumPlayers: numPlayers,
-			Games:      games,
-		}
-		if err := tpl.ExecuteTemplate(w, "collection.html", data); err != nil {
-			log.Printf("Error executing template: %s", err)
-			return
-		}
-	}, "numPlayers", "bggName")
+// collectionRow is a single streamed game of the collection page. Game is nil
+// when the game couldn't be loaded or is filtered out, the row then only
+// reports progress.
+type collectionRow struct {
+	BGGName    string
+	NumPlayers int
+	ID         string
+	Game       *recommend.Game
+	Done       int
+	Total      int
 }
 
-func fetchCollection(client *http.Client, bggName string, numPlayers int) (games []*game, err error) {
-	collURL := &url.URL{
-		Scheme: "https",
-		Host:   "www.boardgamegeek.com",
-		Path:   "/xmlapi2/collection",
-		RawQuery: url.Values{
-			"username":       {bggName},
-			"excludesubtype": {"boardgameexpansion"},
-			"own":            {"1"},
-		}.Encode(),
+// ReturnURL is a GET URL reproducing the collection page.
+func (d collectionData) ReturnURL() string {
+	v := url.Values{
+		"bggName":    {d.BGGName},
+		"numPlayers": {strconv.Itoa(d.NumPlayers)},
+		"mood":       {d.Mood},
+		"scorer":     {d.Scorer},
+		"sort":       {d.Sort},
 	}
-retry:
-	resp, err := client.Get(collURL.String())
-	if err != nil {
-		return nil, fmt.Errorf("error fetching collection: %s", err)
+	if d.Unplayed {
+		v.Set("unplayed", "1")
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == http.StatusTooManyRequests {
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("Too many requests and unable to read collection body: %s", err)
-		}
-		for k, v := range resp.Header {
-			log.Printf("%s : %q", k, v)
-		}
-		log.Printf("Too many request to collection body:\n%q", body)
-		return nil, fmt.Errorf("Too many requests, see logs for timeout information")
+	if d.Expansions {
+		v.Set("expansions", "1")
 	}
-
-	if resp.StatusCode == http.StatusAccepted {
-		log.Printf("BGG request accepted, waiting for body")
-		time.Sleep(10 * time.Second)
-		goto retry
+	if d.MinConfidence > 0 {
+		v.Set("minConfidence", strconv.Itoa(d.MinConfidence))
 	}
+	return "/collection?" + v.Encode()
+}
 
-	// TODO: BGG gives 200 on invalid username, write check to let user know they provided invalid name and to try again
-	raw, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to read collection body: %s", err)
+// SortColumn is the index of the table column the collection is sorted by.
+func (d collectionData) SortColumn() int {
+	switch d.Sort {
+	case "name":
+		return 0
+	case "score":
+		return 3
+	case "bscore":
+		return 4
+	case "weight":
+		return 5
 	}
+	return 8
+}
 
-	var coll collection
-	if err := xml.Unmarshal(raw, &coll); err != nil {
-		return nil, fmt.Errorf("Failed to unmarshal XML: %s", err)
+// SortDir is the direction of SortColumn, names read best from A to Z and
+// everything else from the highest.
+func (d collectionData) SortDir() string {
+	if d.Sort == "name" {
+		return "asc"
 	}
+	return "desc"
+}
 
-	var wg sync.WaitGroup
-	allGames := make([]*game, len(coll.Items))
-	for i, game := range coll.Items {
-		wg.Add(1)
-		i, game := i, game // don't capture loop variables
-		go func() {
-			defer wg.Done()
-			g, err := fetchGame(client, game.ObjectID, numPlayers)
-			if err != nil {
-				log.Printf("warning: unable to fetch game %q info: %s", game.ObjectID, err)
-				return
-			}
-			allGames[i] = g // only safe due to preallocation of array size
-		}()
+// ExportURL is the "export for chat" page of the collection.
+func (d collectionData) ExportURL() string {
+	v := url.Values{
+		"bggName":    {d.BGGName},
+		"numPlayers": {strconv.Itoa(d.NumPlayers)},
+		"mood":       {d.Mood},
+		"scorer":     {d.Scorer},
 	}
-	wg.Wait()
-	for _, g := range allGames {
-		if g != nil {
-			return allGames, nil
-		}
+	if d.Unplayed {
+		v.Set("unplayed", "1")
 	}
-	return nil, fmt.Errorf("no valid games found")
+	return "/collection/export?" + v.Encode()
 }
 
-func fetchGame(client *http.Client, gameID string, numPlayers int) (*game, error) {
-	xmlURL := &url.URL{
-		Scheme: "https",
-		Host:   "www.boardgamegeek.com",
-		Path:   "/xmlapi2/thing",
-		RawQuery: url.Values{
-			"id": {gameID},
-		}.Encode(),
+// Summary describes how many games were loaded once all rows are rendered.
+func (d collectionData) Summary() string {
+	if d.Loaded == 0 {
+		return "No games could be loaded from BGG, please try again later."
 	}
+	return fmt.Sprintf("%d of %d games loaded", d.Loaded, d.Total)
+}
 
-	xresp, err := client.Get(xmlURL.String())
-	if err != nil {
-		return nil, fmt.Errorf("error fetching game xml: %s", err)
+// add records the progress of a collection load and returns the row for the
+// game that just finished.
+func (d *collectionData) add(p service.Progress) collectionRow {
+	d.Total, d.Loaded, d.Hidden = p.Total, p.Loaded, p.Hidden
+	row := collectionRow{
+		BGGName:    d.BGGName,
+		NumPlayers: d.NumPlayers,
+		ID:         p.ID,
+		Game:       p.Game,
+		Done:       p.Done,
+		Total:      p.Total,
 	}
-	defer xresp.Body.Close()
+	d.Rows = append(d.Rows, row)
+	return row
+}
+
+// start records the games a collection load is about to fetch.
+func (d *collectionData) start(p service.Progress) {
+	d.Total, d.Deferred, d.Stale, d.Pending, d.Orphans = p.Total, p.Deferred, p.Stale, p.Pending, p.Orphans
+}
 
-	if xresp.StatusCode == http.StatusTooManyRequests {
-		body, err := ioutil.ReadAll(xresp.Body)
+// Collection is the Collection page function. GET requests are streamed,
+// the page skeleton is flushed before BGG is asked for anything and rows
+// replace their placeholders as each game finishes loading. POST
+// requests queue the fetch as a job and answer with its ID straight away.
+// Valid choices made in a browser are saved to its session for the homepage
+// form.
+func Collection(tpl *template.Template, svc *service.Service, jm *jobs.Manager, sessions *session.Sessions, mailer *notify.Mailer, apiKeys []string) http.HandlerFunc {
+	return formWrapper(func(w http.ResponseWriter, r *http.Request) {
+		numPlayers, err := strconv.Atoi(r.FormValue("numPlayers"))
 		if err != nil {
-			return nil, fmt.Errorf("Too many requests and unable to read body: %s", err)
+			http.Error(w, "bad num players param, please provide a number", http.StatusBadRequest)
+			return
 		}
-		for k, v := range xresp.Header {
-			log.Printf("%s : %q", k, v)
+		minConfidence := 0
+		if v := r.FormValue("minConfidence"); v != "" {
+			if minConfidence, err = strconv.Atoi(v); err != nil {
+				http.Error(w, "bad min confidence param, please provide a number", http.StatusBadRequest)
+				return
+			}
 		}
-		log.Printf("Too many request body:\n%q", body)
-		return nil, fmt.Errorf("Too many requests, see logs for timeout information")
-	}
-
-	if xresp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Bad status code fetching game xml: %s", xresp.Status)
-	}
-
-	var gXML gameXML
-	if err := xml.NewDecoder(xresp.Body).Decode(&gXML); err != nil {
-		return nil, fmt.Errorf("error decoding game xml: %s", err)
-	}
-
-	for _, name := range gXML.Names {
-		if name.Type == "primary" {
-			gXML.PrimaryName = name.Name
-			break
+		req := service.CollectionRequest{
+			BGGName:       r.FormValue("bggName"),
+			NumPlayers:    numPlayers,
+			Mood:          r.FormValue("mood"),
+			Scorer:        r.FormValue("scorer"),
+			Family:        family.Enabled(r),
+			Unplayed:      r.FormValue("unplayed") == "1",
+			Expansions:    r.FormValue("expansions") == "1",
+			MinConfidence: minConfidence,
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sort := r.FormValue("sort")
+		if sort == "" {
+			sort = session.Sorts[0]
+		}
+		if !session.ValidSort(sort) {
+			http.Error(w, "bad sort param, please pick one of "+strings.Join(session.Sorts, ", "), http.StatusBadRequest)
+			return
+		}
+		if !jobs.WantsJSON(r) {
+			sessions.Save(w, r, &session.Prefs{
+				BGGName:    req.BGGName,
+				NumPlayers: req.NumPlayers,
+				Mood:       req.Mood,
+				Scorer:     req.Scorer,
+				Sort:       sort,
+			})
 		}
-	}
-
-	bestAt, recAt, err := gXML.parsePolls(numPlayers)
-	if err != nil {
-		return nil, fmt.Errorf("error parsing polls: %s", err)
-	}
-
-	jsonURL := &url.URL{
-		Scheme: "https",
-		Host:   "www.boardgamegeek.com",
-		Path:   path.Join("/boardgame", url.PathEscape(gameID)),
-	}
-
-	jresp, err := client.Get(jsonURL.String())
-	if err != nil {
-		return nil, fmt.Errorf("error fetching game json: %s", err)
-	}
-	defer jresp.Body.Close()
 
-	if jresp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("Bad status code fetching game json: %s", jresp.Status)
-	}
-	gJSON, err := jsonDecode(jresp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("Unable to decode json: %s", err)
-	}
+		data := &collectionData{
+			BGGName:       req.BGGName,
+			NumPlayers:    req.NumPlayers,
+			Mood:          req.Mood,
+			Scorer:        req.Scorer,
+			Sort:          sort,
+			Family:        req.Family,
+			Unplayed:      req.Unplayed,
+			Expansions:    req.Expansions,
+			MinConfidence: req.MinConfidence,
+		}
+		if p, err := svc.Profile(req.BGGName); err == nil {
+			data.Public = p.Public
+		} else {
+			log.Printf("warning: unable to load profile of %q: %s", req.BGGName, err)
+		}
 
-	return &game{
-		Name:       gXML.PrimaryName,
-		ID:         gameID,
-		Best:       bestAt,
-		Rec:        recAt,
-		MinPlayers: gXML.MinPlayers.Num,
-		MaxPlayers: gXML.MaxPlayers.Num,
-		Score:      gJSON.Score,
-		Weight:     gJSON.Weight,
-		BScore:     gJSON.BScore,
-		Ratings:    gJSON.Ratings,
-	}, nil
-}
+		if r.Method == http.MethodPost {
+			fn := collectionJob(svc, req, data)
+			if email := r.FormValue("notify"); email != "" && mailer.Enabled() {
+				if !notify.ValidAddress(email) {
+					http.Error(w, "bad notify param, please provide an email address", http.StatusBadRequest)
+					return
+				}
+				if !requireKey(w, r, apiKeys, "be emailed") {
+					return
+				}
+				fn = notifyJob(fn, mailer, email, req)
+			}
+			j, err := jm.Start("collection.html", fn)
+			if err != nil {
+				http.Error(w, "unable to start collection job", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			jobs.Accepted(w, r, j)
+			return
+		}
 
-func (gx *gameXML) parsePolls(targetPlayers int) (bestAt, recAt bool, err error) {
-	var playerPoll *poll
-	for _, poll := range gx.Polls {
-		switch poll.Name {
-		case "suggested_numplayers":
-			playerPoll = poll
-			/*case "suggested_playerage":
-				agePoll = poll
-			case "language_dependence":
-				langPoll = poll
-			*/
+		// Browsers and proxies may keep pages of loaded collections, asking
+		// whether they changed before reusing them.
+		if version, ok := svc.CollectionVersion(req); ok {
+			etag := `W/"` + version + "-" + sort + `"`
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Add("Vary", "Cookie")
+			if notModified(r, etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
 		}
-	}
-	// TODO: check votes and defer to min/max players if <n
-	if playerPoll != nil {
-		for _, playerCount := range playerPoll.Results {
-			bestVotes, recVotes, nayVotes := playerCount.Votes[0].Num, playerCount.Votes[1].Num, playerCount.Votes[2].Num
 
-			// BGG can return n+ which is taken here as 1 more than the max number of players on the box
-			numPlayers, err := strconv.Atoi(strings.TrimSuffix(playerCount.NumPlayers, "+"))
-			if err != nil {
-				return false, false, fmt.Errorf("Failed to convert numPlayers string to int: %s", err)
+		flusher, _ := w.(http.Flusher)
+		flush := func() {
+			if flusher != nil {
+				flusher.Flush()
 			}
-			if bestVotes+recVotes <= nayVotes {
-				continue
+		}
+
+		tplErr := tpl.ExecuteTemplate(w, "collection_head", data)
+		flush()
+		_, err = svc.LoadCollection(r.Context(), req, func(p service.Progress) {
+			if tplErr != nil {
+				return
 			}
-			if bestVotes > recVotes {
-				bestAt = true
+			if p.Done == 0 {
+				data.start(p)
+				tplErr = tpl.ExecuteTemplate(w, "collection_start", data)
+			} else {
+				tplErr = tpl.ExecuteTemplate(w, "collection_row", data.add(p))
 			}
-			if strings.HasSuffix(playerCount.NumPlayers, "+") {
-				if numPlayers*2 >= targetPlayers {
-					return bestAt, !bestAt, nil
+			flush()
+		})
+		if tplErr == nil {
+			if err != nil {
+				// The status is already sent, so report the failure in the page.
+				msg := "Unable to get collection information, please try again later."
+				if bgg.Unavailable(err) {
+					msg = "BGG is having trouble right now, please try again in a few minutes."
 				}
-			}
-			if numPlayers == targetPlayers {
-				return bestAt, !bestAt, nil
+				tplErr = tpl.ExecuteTemplate(w, "collection_error", msg)
+			} else {
+				tplErr = tpl.ExecuteTemplate(w, "collection_foot", data)
 			}
 		}
-	}
-	return false, false, nil
+		if tplErr != nil {
+			log.Printf("Error executing template: %s", tplErr)
+			return
+		}
+		if err != nil {
+			log.Printf("%s", err)
+		}
+	}, "numPlayers", "bggName")
 }
 
-func jsonDecode(r io.Reader) (*gameJSON, error) {
-	htmlRaw, err := ioutil.ReadAll(r)
-	if err != nil {
-		return nil, fmt.Errorf("Failed to read body: %s", err)
-	}
-
-	needle := []byte("GEEK.geekitemPreload")
-	start := bytes.Index(htmlRaw, needle)
-	if start < 0 {
-		return nil, fmt.Errorf("Couldn't find GEEK.geekitemPreload in htmlRaw")
+// notModified reports whether the If-None-Match header of r names etag,
+// comparing weakly.
+func notModified(r *http.Request, etag string) bool {
+	for _, t := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
 	}
-	start += len(needle)
+	return false
+}
 
-	preload := htmlRaw[start:]
-	brace := bytes.IndexByte(preload, '{')
-	if brace < 0 {
-		return nil, fmt.Errorf("Couldn't find the first brace in preloaded data")
+// notifyJob runs fn and then emails to once the collection of req finished
+// loading, or failed to.
+func notifyJob(fn jobs.Func, mailer *notify.Mailer, to string, req service.CollectionRequest) jobs.Func {
+	return func(j *jobs.Job) (interface{}, error) {
+		result, err := fn(j)
+		notice := struct {
+			JobID      string
+			BGGName    string
+			NumPlayers int
+			Failed     bool
+		}{j.ID, req.BGGName, req.NumPlayers, err != nil}
+		subject := "Your collection is ready"
+		if err != nil {
+			subject = "Your collection couldn't be loaded"
+		}
+		if err := mailer.Send(to, subject, "email_job.html", notice); err != nil {
+			log.Printf("warning: unable to send job notice: %s", err)
+		}
+		return result, err
 	}
-	preload = preload[brace:]
+}
 
-	var data struct{ Item struct{ Stats gameJSON } }
-	if err := json.NewDecoder(bytes.NewReader(preload)).Decode(&data); err != nil {
-		return nil, fmt.Errorf("Failed to parse json")
+// collectionJob loads the collection described by req in the background,
+// reporting a step of progress per game.
+func collectionJob(svc *service.Service, req service.CollectionRequest, data *collectionData) jobs.Func {
+	return func(j *jobs.Job) (interface{}, error) {
+		_, err := svc.LoadCollection(context.Background(), req, func(p service.Progress) {
+			if p.Done == 0 {
+				data.start(p)
+				j.SetTotal(p.Total)
+				return
+			}
+			data.add(p)
+			j.Advance(p.Name)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return data, nil
 	}
-	return &data.Item.Stats, nil
 }
@@ -0,0 +1,111 @@
+package collection
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/dataset"
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// dataExport is the result of a data export job, kept in memory with the
+// job until it expires.
+type dataExport struct {
+	BGGName  string `json:"bggName"`
+	Format   string `json:"format"`
+	Records  int    `json:"records"`
+	Download string `json:"download"`
+
+	data   []byte
+	format dataset.Format
+}
+
+// StartDataExport queues an export of a user's games, collection and plays
+// as a job, the file is downloadable from the job page once it is done.
+func StartDataExport(svc *service.Service, jm *jobs.Manager) http.HandlerFunc {
+	return formWrapper(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		name := r.FormValue("format")
+		if name == "" || name == "json" {
+			name = dataset.Default
+		}
+		format, ok := dataset.Lookup(name)
+		if !ok {
+			http.Error(w, "bad format param, please pick one of "+strings.Join(dataset.Formats(), ", "), http.StatusBadRequest)
+			return
+		}
+		// The download needs the key the export was started with.
+		var query string
+		if key := r.FormValue("api_key"); key != "" {
+			query = "?" + url.Values{"api_key": {key}}.Encode()
+		}
+
+		j, err := jm.Start("dataexport.html", func(j *jobs.Job) (interface{}, error) {
+			var buf bytes.Buffer
+			n, err := svc.ExportData(context.Background(), bggName, format.New(&buf), func(done, total int) {
+				if done == 1 {
+					j.SetTotal(total)
+				}
+				j.Advance("")
+			})
+			if err != nil {
+				return nil, err
+			}
+			return &dataExport{
+				BGGName:  bggName,
+				Format:   format.Name,
+				Records:  n,
+				Download: "/export/data/" + j.ID + query,
+				data:     buf.Bytes(),
+				format:   format,
+			}, nil
+		})
+		if err != nil {
+			http.Error(w, "unable to start export job", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		jobs.Accepted(w, r, j)
+	}, "bggName")
+}
+
+// DownloadDataExport serves the file of a finished data export job at
+// /export/data/{id}.
+func DownloadDataExport(jm *jobs.Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		j, ok := jm.Get(strings.TrimPrefix(r.URL.Path, "/export/data/"))
+		if !ok {
+			http.Error(w, "export not found", http.StatusNotFound)
+			return
+		}
+		p := j.Progress()
+		e, ok := p.Result.(*dataExport)
+		if !ok {
+			if p.Finished() {
+				http.Error(w, "export not found", http.StatusNotFound)
+			} else {
+				http.Error(w, "export still running", http.StatusConflict)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", e.format.ContentType)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": e.BGGName + e.format.Ext}))
+		w.Header().Set("Content-Length", strconv.Itoa(len(e.data)))
+		w.Write(e.data)
+	}
+}
@@ -0,0 +1,39 @@
+package collection
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// Discover is the discover page, /discover?bggName=X, games X doesn't own
+// that owners of their games also own.
+func Discover(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		report, err := svc.Discover(r.Context(), bggName)
+		if err != nil {
+			http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		if jobs.WantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(report); err != nil {
+				log.Printf("Error encoding discoveries: %s", err)
+			}
+			return
+		}
+		if err := tpl.ExecuteTemplate(w, "discover.html", report); err != nil {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package collection
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/notify"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// NewEvent is the event planner. GET shows the form, POST saves the event,
+// emails the invites when mailer can send emails and one of apiKeys is
+// given, and sends the user to its page, the link to hand to the attendees.
+func NewEvent(tpl *template.Template, svc *service.Service, mailer *notify.Mailer, apiKeys []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			data := struct {
+				Today        string
+				MaxAttendees int
+				Email        bool
+			}{time.Now().Format("2006-01-02"), service.MaxAttendees, mailer.Enabled() && keysSet(apiKeys)}
+			if err := tpl.ExecuteTemplate(w, "event_new.html", data); err != nil {
+				log.Printf("Error executing template: %s", err)
+			}
+			return
+		}
+
+		date, err := time.Parse("2006-01-02T15:04", r.FormValue("date")+"T"+r.FormValue("time"))
+		if err != nil {
+			if date, err = time.Parse("2006-01-02", r.FormValue("date")); err != nil {
+				http.Error(w, "bad date param, please provide a date as YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
+		numPlayers, err := strconv.Atoi(r.FormValue("numPlayers"))
+		if err != nil {
+			http.Error(w, "bad num players param, please provide a number", http.StatusBadRequest)
+			return
+		}
+		e := &service.Event{
+			Date:       date,
+			Location:   strings.TrimSpace(r.FormValue("location")),
+			Attendees:  strings.FieldsFunc(r.FormValue("attendees"), func(c rune) bool { return c == ',' || c == '\n' || c == ' ' }),
+			NumPlayers: numPlayers,
+		}
+		if err := e.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		invites := strings.FieldsFunc(r.FormValue("invite"), func(c rune) bool { return c == ',' || c == '\n' || c == ' ' || c == '\r' })
+		if len(invites) > service.MaxAttendees {
+			http.Error(w, fmt.Sprintf("bad invite param, please provide at most %d email addresses", service.MaxAttendees), http.StatusBadRequest)
+			return
+		}
+		for _, to := range invites {
+			if !notify.ValidAddress(to) {
+				http.Error(w, fmt.Sprintf("bad invite %q, please provide email addresses", to), http.StatusBadRequest)
+				return
+			}
+		}
+		if len(invites) > 0 && mailer.Enabled() && !requireKey(w, r, apiKeys, "email invites") {
+			return
+		}
+		if _, err := svc.CreateEvent(e); err != nil {
+			http.Error(w, "unable to save event", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		if mailer.Enabled() && len(invites) > 0 {
+			public := e.Public()
+			go func() {
+				for _, to := range invites {
+					if err := mailer.Send(to, "You're invited to a game night", "email_invite.html", public); err != nil {
+						log.Printf("warning: unable to send event invite: %s", err)
+					}
+				}
+			}()
+		}
+		// The key in the link lets the organizer find the voting links again.
+		http.Redirect(w, r, "/events/"+e.Token+"?key="+e.Key, http.StatusSeeOther)
+	}
+}
+
+type eventData struct {
+	*service.EventPicks
+	VotingLinks map[string]string // voting token by attendee, for the organizer only
+	Voter       *service.EventVoter
+}
+
+// Event serves the event of /events/{token} with the picks from its
+// attendees' collections and their votes, as HTML or, when asked for, JSON.
+// With the organizer's key it lists each attendee's voting link too.
+func Event(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e, err := svc.Event(strings.TrimPrefix(r.URL.Path, "/events/"))
+		if err == service.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "unable to load event", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		data := eventData{}
+		if key := r.FormValue("key"); key != "" && subtle.ConstantTimeCompare([]byte(key), []byte(e.Key)) == 1 {
+			if data.VotingLinks, err = svc.VotingLinks(e); err != nil {
+				http.Error(w, "unable to load voting links", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+		}
+		if data.EventPicks, err = svc.EventPicks(r.Context(), e.Public()); err != nil {
+			http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+
+		if jobs.WantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(data.EventPicks); err != nil {
+				log.Printf("Error encoding event: %s", err)
+			}
+			return
+		}
+		if err := tpl.ExecuteTemplate(w, "event.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
+
+// Vote is the voting page of an attendee, /events/vote/{token}. GET shows the
+// event's picks with the attendee's votes, POST records a vote on a pick and
+// shows the page again.
+func Vote(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		voter, err := svc.Voter(strings.TrimPrefix(r.URL.Path, "/events/vote/"))
+		if err == service.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "unable to load event", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			vote, err := strconv.Atoi(r.FormValue("vote"))
+			if err != nil || vote < -1 || vote > 1 {
+				http.Error(w, "bad vote param, please pick 1, -1 or 0", http.StatusBadRequest)
+				return
+			}
+			if err := svc.Vote(voter, r.FormValue("gameID"), vote); err != nil {
+				http.Error(w, "unable to save vote", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
+		}
+
+		data := eventData{Voter: voter}
+		if data.EventPicks, err = svc.EventPicks(r.Context(), voter.Event.Public()); err != nil {
+			http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		if err := tpl.ExecuteTemplate(w, "event.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package collection
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/mattkoler/board_game_helper/family"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+type exportData struct {
+	service.CollectionRequest
+	Message   string
+	CanPost   bool // a Discord webhook is configured
+	Posted    bool
+	ReturnURL string
+}
+
+// Export is the "export for chat" page, the recommendations of a collection
+// as a Discord message to copy. When webhookURL is set, POST requests post
+// the message to it.
+func Export(tpl *template.Template, svc *service.Service, webhookURL string) http.HandlerFunc {
+	return formWrapper(func(w http.ResponseWriter, r *http.Request) {
+		numPlayers, err := strconv.Atoi(r.FormValue("numPlayers"))
+		if err != nil {
+			http.Error(w, "bad num players param, please provide a number", http.StatusBadRequest)
+			return
+		}
+		req := service.CollectionRequest{
+			BGGName:    r.FormValue("bggName"),
+			NumPlayers: numPlayers,
+			Mood:       r.FormValue("mood"),
+			Scorer:     r.FormValue("scorer"),
+			Family:     family.Enabled(r),
+			Unplayed:   r.FormValue("unplayed") == "1",
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if r.Method == http.MethodPost && webhookURL == "" {
+			http.Error(w, "posting to discord is not configured", http.StatusNotFound)
+			return
+		}
+
+		c, err := svc.Recommend(r.Context(), req)
+		if err != nil {
+			http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		msg := service.DiscordMessage(c, service.DiscordLimit)
+
+		query := url.Values{
+			"bggName":    {req.BGGName},
+			"numPlayers": {strconv.Itoa(req.NumPlayers)},
+			"mood":       {req.Mood},
+			"scorer":     {req.Scorer},
+		}
+		if req.Unplayed {
+			query.Set("unplayed", "1")
+		}
+		if r.Method == http.MethodPost {
+			if err := svc.PostDiscord(r.Context(), webhookURL, msg); err != nil {
+				http.Error(w, "unable to post to discord", http.StatusBadGateway)
+				log.Printf("%s", err)
+				return
+			}
+			query.Set("posted", "1")
+			http.Redirect(w, r, "/collection/export?"+query.Encode(), http.StatusSeeOther)
+			return
+		}
+
+		if err := tpl.ExecuteTemplate(w, "export.html", exportData{
+			CollectionRequest: req,
+			Message:           msg,
+			CanPost:           webhookURL != "",
+			Posted:            r.FormValue("posted") != "",
+			ReturnURL:         "/collection?" + query.Encode(),
+		}); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}, "numPlayers", "bggName")
+}
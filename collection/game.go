@@ -0,0 +1,90 @@
+package collection
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/mattkoler/board_game_helper/moods"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+type gameData struct {
+	*service.GameDetail
+	BGGName    string
+	NumPlayers int
+	AllMoods   []string
+	Trend      *service.GameTrend // nil until the game's ratings were recorded
+}
+
+// Game is the game detail page function.
+func Game(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return formWrapper(func(w http.ResponseWriter, r *http.Request) {
+		gameID := r.FormValue("id")
+		if _, err := strconv.Atoi(gameID); err != nil {
+			http.Error(w, "bad id param, please provide a numeric game id", http.StatusBadRequest)
+			return
+		}
+		var numPlayers int
+		if np := r.FormValue("numPlayers"); np != "" {
+			n, err := strconv.Atoi(np)
+			if err != nil || n < 1 || n > 100 {
+				http.Error(w, "bad num players param, please provide a number between 1 and 100", http.StatusBadRequest)
+				return
+			}
+			numPlayers = n
+		}
+		bggName := r.FormValue("bggName")
+
+		detail, err := svc.Game(r.Context(), gameID, numPlayers, bggName)
+		if err != nil {
+			http.Error(w, "unable to get game information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+
+		data := gameData{
+			GameDetail: detail,
+			BGGName:    bggName,
+			NumPlayers: numPlayers,
+			AllMoods:   moods.All,
+		}
+		if data.Trend, err = svc.Trend(gameID); err != nil && err != service.ErrNotFound {
+			log.Printf("warning: unable to load the trend of game %q: %s", gameID, err)
+		}
+		if err := tpl.ExecuteTemplate(w, "game.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}, "id")
+}
+
+// RefreshGame fetches a game from BGG again and sends the user back to its
+// detail page.
+func RefreshGame(svc *service.Service) http.HandlerFunc {
+	return formWrapper(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		gameID := r.FormValue("id")
+		if _, err := strconv.Atoi(gameID); err != nil {
+			http.Error(w, "bad id param, please provide a numeric game id", http.StatusBadRequest)
+			return
+		}
+		if err := svc.RefreshGame(r.Context(), gameID); err != nil {
+			http.Error(w, "unable to refresh game information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		back := url.Values{"id": {gameID}}
+		for _, param := range []string{"numPlayers", "bggName"} {
+			if v := r.FormValue(param); v != "" {
+				back.Set(param, v)
+			}
+		}
+		http.Redirect(w, r, "/game?"+back.Encode(), http.StatusSeeOther)
+	}, "id")
+}
@@ -0,0 +1,73 @@
+package collection
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// History shows what changed in a collection between two dates,
+// /history?bggName=X&from=YYYY-MM-DD&to=YYYY-MM-DD. from defaults to when
+// the collection was first fetched and to to today.
+func History(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		var from, to time.Time
+		if v := r.FormValue("from"); v != "" {
+			var err error
+			if from, err = time.Parse("2006-01-02", v); err != nil {
+				http.Error(w, "bad from param, please provide a date as YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
+		to = time.Now()
+		if v := r.FormValue("to"); v != "" {
+			var err error
+			if to, err = time.Parse("2006-01-02", v); err != nil {
+				http.Error(w, "bad to param, please provide a date as YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+			to = to.Add(24*time.Hour - time.Nanosecond) // the whole day
+		}
+
+		diff, err := svc.CollectionDiff(bggName, from, to)
+		if err == service.ErrNotFound {
+			http.Error(w, "no history yet, load the collection first", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, "unable to load collection history", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		if jobs.WantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(diff); err != nil {
+				log.Printf("Error encoding history: %s", err)
+			}
+			return
+		}
+		changes, err := svc.History(bggName)
+		if err != nil {
+			http.Error(w, "unable to load collection history", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		data := struct {
+			*service.CollectionDiff
+			Changes []time.Time
+		}{diff, changes}
+		if err := tpl.ExecuteTemplate(w, "history.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package collection
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/mattkoler/board_game_helper/family"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+type hotData struct {
+	BGGName string
+	Family  bool
+	Hidden  int
+	Games   []*service.HotGame
+}
+
+// Hot is the BGG hotness page function.
+func Hot(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if bggName != "" && (len(bggName) < 4 || len(bggName) > 20) {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+
+		data := hotData{BGGName: bggName, Family: family.Enabled(r)}
+		hot, err := svc.Hot(r.Context(), bggName, data.Family)
+		if err != nil {
+			http.Error(w, "unable to get hotness information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		data.Games, data.Hidden = hot.Games, hot.Hidden
+
+		if err := tpl.ExecuteTemplate(w, "hot.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package collection
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/middleware"
+)
+
+// keysSet reports whether any API keys are configured.
+func keysSet(apiKeys []string) bool {
+	for _, k := range apiKeys {
+		if strings.TrimSpace(k) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// requireKey checks that r carries one of apiKeys, answering it with an
+// error if not. The actions needing one act as the site itself, logging
+// plays on its BGG account or sending its emails to any address, so they
+// are never open to everyone, not even when no keys are set.
+func requireKey(w http.ResponseWriter, r *http.Request, apiKeys []string, action string) bool {
+	if !middleware.HasAPIKey(r, apiKeys) {
+		http.Error(w, "missing or bad API key, one is needed to "+action, http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
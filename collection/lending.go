@@ -0,0 +1,124 @@
+package collection
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/notify"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+type lendingData struct {
+	*service.LendingReport
+	Today string
+	Email bool // borrowers can be nudged by email
+}
+
+// Lending is the lending tracker, /lending?bggName=X. GET lists the games X
+// lent out, overdue ones first, and the games on the shelf to lend. POST
+// records a game as lent, or with a return param the loan of that ID as
+// returned, or with a delete param moves it to the trash, and sends the
+// user back to the list. Loans with the borrower's
+// email, to remind them, take one of apiKeys.
+func Lending(tpl *template.Template, svc *service.Service, mailer *notify.Mailer, apiKeys []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			returned, deleted := r.FormValue("return"), r.FormValue("delete")
+			if returned != "" || deleted != "" {
+				var err error
+				if deleted != "" {
+					err = svc.DeleteLoan(bggName, deleted)
+				} else {
+					err = svc.ReturnLoan(bggName, returned)
+				}
+				if err == service.ErrNotFound {
+					http.NotFound(w, r)
+					return
+				}
+				if err != nil {
+					http.Error(w, "unable to save loan", http.StatusInternalServerError)
+					log.Printf("%s", err)
+					return
+				}
+			} else {
+				l, err := formLoan(r, bggName)
+				if err == nil {
+					err = l.Validate()
+				}
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				if l.Email != "" && !requireKey(w, r, apiKeys, "email borrowers") {
+					return
+				}
+				switch err := svc.Lend(r.Context(), l); err {
+				case nil:
+				case service.ErrNotOwned:
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				default:
+					http.Error(w, "unable to save loan", http.StatusInternalServerError)
+					log.Printf("%s", err)
+					return
+				}
+			}
+			http.Redirect(w, r, "/lending?"+url.Values{"bggName": {bggName}}.Encode(), http.StatusSeeOther)
+			return
+		}
+
+		report, err := svc.Lending(r.Context(), bggName)
+		if err != nil {
+			http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		if jobs.WantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(report); err != nil {
+				log.Printf("Error encoding loans: %s", err)
+			}
+			return
+		}
+		data := lendingData{LendingReport: report, Today: time.Now().Format("2006-01-02"), Email: mailer.Enabled() && keysSet(apiKeys)}
+		if err := tpl.ExecuteTemplate(w, "lending.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
+
+// formLoan reads the loan posted by the lending form.
+func formLoan(r *http.Request, owner string) (*service.Loan, error) {
+	l := &service.Loan{
+		Owner:    owner,
+		GameID:   r.FormValue("gameID"),
+		Borrower: strings.TrimSpace(r.FormValue("borrower")),
+		Email:    strings.TrimSpace(r.FormValue("email")),
+	}
+	var err error
+	if l.Lent, err = time.Parse("2006-01-02", r.FormValue("lent")); err != nil {
+		return nil, errors.New("bad lent param, please provide a date as YYYY-MM-DD")
+	}
+	if due := r.FormValue("due"); due != "" {
+		if l.Due, err = time.Parse("2006-01-02", due); err != nil {
+			return nil, errors.New("bad due param, please provide a date as YYYY-MM-DD")
+		}
+	}
+	if l.Email != "" && !notify.ValidAddress(l.Email) {
+		return nil, errors.New("bad email param, please provide an email address")
+	}
+	return l, nil
+}
@@ -0,0 +1,56 @@
+package collection
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// NewToYou is the yearly new to you report, /newtoyou?bggName=X&year=Y, the
+// games X first played in year Y, this year by default. format=markdown
+// serves just the markdown, to post as a geeklist or in a forum.
+func NewToYou(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		year := time.Now().Year()
+		if y := r.FormValue("year"); y != "" {
+			n, err := strconv.Atoi(y)
+			if err != nil || n < 1900 || n > year {
+				http.Error(w, fmt.Sprintf("bad year param, please provide a year between 1900 and %d", year), http.StatusBadRequest)
+				return
+			}
+			year = n
+		}
+		report, err := svc.NewToYou(r.Context(), bggName, year)
+		if err != nil {
+			http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		switch {
+		case r.FormValue("format") == "markdown":
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			fmt.Fprint(w, report.Markdown())
+		case jobs.WantsJSON(r):
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(report); err != nil {
+				log.Printf("Error encoding new to you report: %s", err)
+			}
+		default:
+			if err := tpl.ExecuteTemplate(w, "newtoyou.html", report); err != nil {
+				log.Printf("Error executing template: %s", err)
+			}
+		}
+	}
+}
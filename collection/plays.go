@@ -0,0 +1,175 @@
+package collection
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/plays"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// maxUpload bounds the size of an uploaded plays export.
+const maxUpload = 32 << 20
+
+// ImportBGStats stores the plays of an uploaded BG Stats export, then sends
+// the user to their stats with how many plays were imported.
+func ImportBGStats(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxUpload)
+		if err := r.ParseMultipartForm(maxUpload); err != nil {
+			http.Error(w, "bad upload, please send a BG Stats export of at most 32 MB", http.StatusBadRequest)
+			return
+		}
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		f, header, err := r.FormFile("export")
+		if err != nil {
+			http.Error(w, "missing export file", http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		ps, err := plays.ParseBGStats(f, header.Filename)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		n, unmatched, err := svc.ImportBGStats(r.Context(), bggName, ps)
+		if err != nil {
+			http.Error(w, "unable to import plays", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		http.Redirect(w, r, "/analytics/seats?"+url.Values{
+			"bggName":   {bggName},
+			"imported":  {strconv.Itoa(n)},
+			"unmatched": {strconv.Itoa(unmatched)},
+		}.Encode(), http.StatusSeeOther)
+	}
+}
+
+// logRows is how many player rows the play logging form has.
+const logRows = 6
+
+type logPlayData struct {
+	BGGName  string
+	GameID   string
+	GameName string
+	Today    string
+	Rows     []int
+	CanPush  bool
+	Logged   bool
+	Pushed   bool
+}
+
+// LogPlay is the play logging page. GET shows the form, prefilled with the
+// game of the gameID param, POST records the play and shows the form again
+// with how it went. With the push box ticked and one of apiKeys given the
+// play is logged on BGG too.
+func LogPlay(tpl *template.Template, svc *service.Service, apiKeys []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			p, err := formPlay(r)
+			if err == nil {
+				err = p.Validate()
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			push := r.FormValue("push") == "1"
+			if push && !requireKey(w, r, apiKeys, "log plays on BGG") {
+				return
+			}
+			pushed, err := svc.LogPlay(r.Context(), bggName, p, push)
+			if err == service.ErrNoPush {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				http.Error(w, "unable to record play", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			http.Redirect(w, r, "/plays/log?"+url.Values{
+				"bggName": {bggName},
+				"logged":  {"1"},
+				"pushed":  {strconv.FormatBool(pushed)},
+			}.Encode(), http.StatusSeeOther)
+			return
+		}
+
+		data := logPlayData{
+			BGGName:  bggName,
+			GameID:   r.FormValue("gameID"),
+			GameName: r.FormValue("gameName"),
+			Today:    time.Now().Format("2006-01-02"),
+			CanPush:  canPush(svc, bggName, apiKeys),
+			Logged:   r.FormValue("logged") == "1",
+			Pushed:   r.FormValue("pushed") == "true",
+		}
+		for i := 1; i <= logRows; i++ {
+			data.Rows = append(data.Rows, i)
+		}
+		if err := tpl.ExecuteTemplate(w, "plays_log.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
+
+// formPlay reads the play posted by the play logging form. Player rows are
+// numbered from 1, rows without a name or username are skipped.
+func formPlay(r *http.Request) (*plays.Play, error) {
+	date, err := time.Parse("2006-01-02", r.FormValue("date"))
+	if err != nil {
+		return nil, errors.New("bad date param, please provide a date as YYYY-MM-DD")
+	}
+	p := &plays.Play{GameID: r.FormValue("gameID"), GameName: r.FormValue("gameName"), Date: date}
+	for i := 1; i <= logRows; i++ {
+		n := strconv.Itoa(i)
+		name := strings.TrimSpace(r.FormValue("name" + n))
+		username := strings.TrimSpace(r.FormValue("username" + n))
+		if name == "" && username == "" {
+			continue
+		}
+		pl := plays.Player{Name: name, Username: username, Win: r.FormValue("win"+n) == "1"}
+		if score := strings.TrimSpace(r.FormValue("score" + n)); score != "" {
+			if pl.Score, err = strconv.ParseFloat(score, 64); err != nil {
+				return nil, fmt.Errorf("bad score %q, please provide a number", score)
+			}
+			pl.HasScore = true
+		}
+		if r.FormValue("seated") == "1" {
+			pl.Seat = len(p.Players) + 1
+		}
+		p.Players = append(p.Players, pl)
+	}
+	return p, nil
+}
+
+// canPush reports whether the plays of bggName may be logged on BGG, which
+// also takes API keys to check the request against.
+func canPush(svc *service.Service, bggName string, apiKeys []string) bool {
+	return keysSet(apiKeys) && svc.CanPushPlays(bggName)
+}
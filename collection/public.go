@@ -0,0 +1,77 @@
+package collection
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+type publicData struct {
+	BGGName string
+	Games   []service.ShelfGame
+}
+
+// Public is the read only page of a published collection, serving
+// /u/{bggName} as HTML or, when asked for, JSON.
+func Public(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := strings.TrimPrefix(r.URL.Path, "/u/")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.NotFound(w, r)
+			return
+		}
+		games, err := svc.PublicCollection(r.Context(), bggName)
+		if err == service.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+
+		if jobs.WantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(games); err != nil {
+				log.Printf("Error encoding collection: %s", err)
+			}
+			return
+		}
+		if err := tpl.ExecuteTemplate(w, "public.html", publicData{BGGName: bggName, Games: games}); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
+
+// SetPublic publishes or hides a user's collection, then sends them back to
+// the page they came from.
+func SetPublic(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		if err := svc.SetPublic(bggName, r.FormValue("public") == "1"); err != nil {
+			http.Error(w, "unable to save sharing settings", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		back := r.FormValue("return")
+		if !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") {
+			back = "/u/" + bggName
+		}
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	}
+}
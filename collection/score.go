@@ -0,0 +1,180 @@
+package collection
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/scoring"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// maxScorers is how many players a score sheet takes.
+const maxScorers = 8
+
+type scoreData struct {
+	BGGName    string
+	GameID     string
+	GameName   string
+	Today      string
+	Categories []string
+	Custom     bool // the user made the sheet themselves
+	Players    []int
+	CanPush    bool
+	Entries    []*scoring.Entry // the sheets just recorded, highest total first
+	Pushed     bool
+}
+
+// ScoreSheet is the score sheet page, /score?bggName=X&gameID=G&players=N.
+// GET shows a sheet per player with the game's scoring categories, POST
+// totals the filled in sheets, records them as a play and shows the totals.
+func ScoreSheet(tpl *template.Template, svc *service.Service, apiKeys []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName, gameID := r.FormValue("bggName"), r.FormValue("gameID")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		if _, err := strconv.Atoi(gameID); err != nil {
+			http.Error(w, "bad game id param, please provide a numeric game id", http.StatusBadRequest)
+			return
+		}
+		numPlayers := 4
+		if np := r.FormValue("players"); np != "" {
+			n, err := strconv.Atoi(np)
+			if err != nil || n < 1 || n > maxScorers {
+				http.Error(w, fmt.Sprintf("bad players param, please provide a number between 1 and %d", maxScorers), http.StatusBadRequest)
+				return
+			}
+			numPlayers = n
+		}
+		data := scoreData{
+			BGGName:  bggName,
+			GameID:   gameID,
+			GameName: r.FormValue("gameName"),
+			Today:    time.Now().Format("2006-01-02"),
+			CanPush:  canPush(svc, bggName, apiKeys),
+		}
+		data.Categories, data.Custom = svc.ScoreSheet(bggName, gameID)
+		for i := 1; i <= numPlayers; i++ {
+			data.Players = append(data.Players, i)
+		}
+
+		if r.Method == http.MethodPost {
+			date, err := time.Parse("2006-01-02", r.FormValue("date"))
+			if err != nil {
+				http.Error(w, "bad date param, please provide a date as YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+			entries, err := formEntries(r, numPlayers, len(data.Categories))
+			if err == nil {
+				err = scoring.Tally(data.Categories, entries)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			push := r.FormValue("push") == "1"
+			if push && !requireKey(w, r, apiKeys, "log plays on BGG") {
+				return
+			}
+			data.Pushed, err = svc.LogScores(r.Context(), bggName, gameID, data.GameName, date, entries, push)
+			if err == service.ErrNoPush {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			if err != nil {
+				http.Error(w, "unable to record play", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			sort.SliceStable(entries, func(i, j int) bool { return entries[i].Total > entries[j].Total })
+			data.Entries = entries
+		}
+		if err := tpl.ExecuteTemplate(w, "score.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
+
+// formEntries reads the sheets posted by the score sheet page. Players are
+// numbered from 1 and categories from 0, players without a name are
+// skipped and blank points count as 0.
+func formEntries(r *http.Request, numPlayers, numCategories int) ([]*scoring.Entry, error) {
+	var entries []*scoring.Entry
+	for i := 1; i <= numPlayers; i++ {
+		n := strconv.Itoa(i)
+		name := strings.TrimSpace(r.FormValue("name" + n))
+		if name == "" {
+			continue
+		}
+		e := &scoring.Entry{Name: name, Points: make([]float64, numCategories)}
+		for c := range e.Points {
+			v := strings.TrimSpace(r.FormValue(fmt.Sprintf("points%s_%d", n, c)))
+			if v == "" {
+				continue
+			}
+			p, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad points %q for %s, please provide a number", v, name)
+			}
+			e.Points[c] = p
+		}
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("bad players param, please fill in at least one player")
+	}
+	return entries, nil
+}
+
+// SaveScoreSheet replaces the scoring categories a user's sheet for a game
+// has, one per line of the categories param, then sends them back to the
+// sheet. Submitting with reset set goes back to the built in sheet.
+func SaveScoreSheet(svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bggName, gameID := r.FormValue("bggName"), r.FormValue("gameID")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		if _, err := strconv.Atoi(gameID); err != nil {
+			http.Error(w, "bad game id param, please provide a numeric game id", http.StatusBadRequest)
+			return
+		}
+		if r.FormValue("reset") != "" {
+			if err := svc.ResetScoreSheet(bggName, gameID); err != nil {
+				http.Error(w, "unable to reset score sheet", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+		} else {
+			categories, err := scoring.Clean(strings.Split(r.FormValue("categories"), "\n"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := svc.SaveScoreSheet(bggName, gameID, categories); err != nil {
+				http.Error(w, "unable to save score sheet", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+		}
+		http.Redirect(w, r, "/score?"+url.Values{
+			"bggName":  {bggName},
+			"gameID":   {gameID},
+			"gameName": {r.FormValue("gameName")},
+		}.Encode(), http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,45 @@
+package collection
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+type searchData struct {
+	Query   string
+	BGGName string
+	Results []bgg.SearchItem
+}
+
+// Search is the game search page function.
+func Search(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := searchData{
+			Query:   r.FormValue("q"),
+			BGGName: r.FormValue("bggName"),
+		}
+		if len(data.Query) > 100 {
+			http.Error(w, "bad search param, please provide at most 100 characters", http.StatusBadRequest)
+			return
+		}
+
+		if data.Query != "" {
+			results, err := svc.Search(r.Context(), data.Query)
+			if err != nil {
+				http.Error(w, "unable to search games", http.StatusServiceUnavailable)
+				log.Printf("%s", err)
+				return
+			}
+			data.Results = results
+		}
+
+		if err := tpl.ExecuteTemplate(w, "search.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
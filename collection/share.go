@@ -0,0 +1,77 @@
+package collection
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/family"
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// Share snapshots the recommendations of a collection and sends the user to
+// the read only link for them.
+func Share(svc *service.Service) http.HandlerFunc {
+	return formWrapper(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		numPlayers, err := strconv.Atoi(r.FormValue("numPlayers"))
+		if err != nil {
+			http.Error(w, "bad num players param, please provide a number", http.StatusBadRequest)
+			return
+		}
+		req := service.CollectionRequest{
+			BGGName:    r.FormValue("bggName"),
+			NumPlayers: numPlayers,
+			Mood:       r.FormValue("mood"),
+			Scorer:     r.FormValue("scorer"),
+			Family:     family.Enabled(r),
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		snap, err := svc.Share(r.Context(), req)
+		if err != nil {
+			http.Error(w, "unable to share recommendations", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		http.Redirect(w, r, "/r/"+snap.Token, http.StatusSeeOther)
+	}, "numPlayers", "bggName")
+}
+
+// Shared serves the snapshot of /r/{token} as HTML or, when asked for, JSON.
+func Shared(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snap, err := svc.Shared(strings.TrimPrefix(r.URL.Path, "/r/"))
+		if err == service.ErrNotFound {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			http.Error(w, "unable to load shared recommendations", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+
+		if jobs.WantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(snap); err != nil {
+				log.Printf("Error encoding snapshot: %s", err)
+			}
+			return
+		}
+		if err := tpl.ExecuteTemplate(w, "shared.html", snap); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
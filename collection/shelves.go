@@ -0,0 +1,109 @@
+package collection
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+type shelvesData struct {
+	*service.ShelfPlan
+	Presets []service.ShelfUnit
+}
+
+// Shelves is the shelf planner, /shelves?bggName=X. GET suggests which of
+// X's shelf units each owned game goes on. POST adds a shelf unit, from a
+// preset param or its own sizes, or with a delete param drops the unit of
+// that ID, and sends the user back to the plan.
+func Shelves(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			var err error
+			if id := r.FormValue("delete"); id != "" {
+				err = svc.DeleteShelfUnit(bggName, id)
+			} else {
+				u, ferr := formShelfUnit(r, bggName)
+				if ferr == nil {
+					ferr = u.Validate()
+				}
+				if ferr != nil {
+					http.Error(w, ferr.Error(), http.StatusBadRequest)
+					return
+				}
+				err = svc.AddShelfUnit(u)
+			}
+			if err != nil {
+				http.Error(w, "unable to save shelf unit", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			http.Redirect(w, r, "/shelves?"+url.Values{"bggName": {bggName}}.Encode(), http.StatusSeeOther)
+			return
+		}
+
+		plan, err := svc.ShelfPlan(r.Context(), bggName)
+		if err != nil {
+			http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		if jobs.WantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(plan); err != nil {
+				log.Printf("Error encoding shelf plan: %s", err)
+			}
+			return
+		}
+		if err := tpl.ExecuteTemplate(w, "shelves.html", shelvesData{plan, service.ShelfPresets}); err != nil {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
+
+// formShelfUnit reads the shelf unit posted by the shelves form, a preset
+// unless it gives its own width.
+func formShelfUnit(r *http.Request, owner string) (*service.ShelfUnit, error) {
+	u := &service.ShelfUnit{Owner: owner, Count: 1}
+	if r.FormValue("width") == "" {
+		i, err := strconv.Atoi(r.FormValue("preset"))
+		if err != nil || i < 0 || i >= len(service.ShelfPresets) {
+			return nil, errors.New("bad preset param, please pick one of the listed shelf units")
+		}
+		*u = service.ShelfPresets[i]
+		u.Owner = owner
+	} else {
+		u.Name = strings.TrimSpace(r.FormValue("name"))
+		for _, f := range []struct {
+			param string
+			dst   *float64
+		}{{"width", &u.Width}, {"height", &u.Height}, {"depth", &u.Depth}} {
+			v, err := strconv.ParseFloat(r.FormValue(f.param), 64)
+			if err != nil {
+				return nil, errors.New("bad " + f.param + " param, please provide a size in cm")
+			}
+			*f.dst = v
+		}
+	}
+	if c := r.FormValue("count"); c != "" {
+		n, err := strconv.Atoi(c)
+		if err != nil {
+			return nil, errors.New("bad count param, please provide a number between 1 and 100")
+		}
+		u.Count = n
+	}
+	return u, nil
+}
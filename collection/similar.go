@@ -0,0 +1,47 @@
+package collection
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// Similar is the "fans also like" page, /similar/{id}?bggName=X, the games
+// BGG recommends to fans of a game. bggName is optional, with it the games
+// they own are told apart from the ones they could wishlist.
+func Similar(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		gameID := strings.TrimPrefix(r.URL.Path, "/similar/")
+		if _, err := strconv.Atoi(gameID); err != nil {
+			http.Error(w, "bad id param, please provide a numeric game id", http.StatusBadRequest)
+			return
+		}
+		bggName := r.FormValue("bggName")
+		if bggName != "" && (len(bggName) < 4 || len(bggName) > 20) {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		report, err := svc.Similar(r.Context(), gameID, bggName)
+		if err != nil {
+			http.Error(w, "unable to get similar games", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		if jobs.WantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(report); err != nil {
+				log.Printf("Error encoding similar games: %s", err)
+			}
+			return
+		}
+		if err := tpl.ExecuteTemplate(w, "similar.html", report); err != nil {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package collection
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+type teamsData struct {
+	Players string // as entered, to fill the form again
+	Apart   string
+	BGGName string
+	Teams   int
+	Split   *service.TeamSplit
+}
+
+// Teams is the team randomizer, /teams?players=A,B,C,D&teams=2&apart=A,B,
+// splitting the players into teams of sizes at most one apart. Each line of
+// apart lists players to keep in different teams. With bggName set the
+// teams are balanced by the players' ratings in that user's leaderboard.
+// Without players it shows the form.
+func Teams(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := teamsData{
+			Players: r.FormValue("players"),
+			Apart:   strings.Join(r.Form["apart"], "\n"),
+			BGGName: strings.TrimSpace(r.FormValue("bggName")),
+			Teams:   2,
+		}
+		if data.BGGName != "" && (len(data.BGGName) < 4 || len(data.BGGName) > 20) {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		players, ok := playerNames(data.Players)
+		if !ok {
+			http.Error(w, "bad players param, please provide names of at most 40 characters", http.StatusBadRequest)
+			return
+		}
+		if len(players) > maxTurnPlayers {
+			http.Error(w, fmt.Sprintf("bad players param, please provide at most %d players", maxTurnPlayers), http.StatusBadRequest)
+			return
+		}
+		if t := r.FormValue("teams"); t != "" {
+			n, err := strconv.Atoi(t)
+			if err != nil || n < 2 || n > maxTurnPlayers {
+				http.Error(w, fmt.Sprintf("bad teams param, please provide a number between 2 and %d", maxTurnPlayers), http.StatusBadRequest)
+				return
+			}
+			data.Teams = n
+		}
+		var apart [][]string
+		for _, line := range strings.Split(data.Apart, "\n") {
+			group, ok := playerNames(line)
+			if !ok {
+				http.Error(w, "bad apart param, please provide names of at most 40 characters", http.StatusBadRequest)
+				return
+			}
+			if len(group) > maxTurnPlayers {
+				http.Error(w, fmt.Sprintf("bad apart param, please provide at most %d players to keep apart", maxTurnPlayers), http.StatusBadRequest)
+				return
+			}
+			if len(group) > 1 {
+				apart = append(apart, group)
+			}
+		}
+
+		if len(players) > 0 {
+			if len(players) < data.Teams {
+				http.Error(w, "bad players param, please provide at least a player per team", http.StatusBadRequest)
+				return
+			}
+			split, err := svc.SplitTeams(players, data.Teams, apart, data.BGGName)
+			if err != nil {
+				http.Error(w, "unable to load plays", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			data.Split = split
+		}
+		if jobs.WantsJSON(r) {
+			if data.Split == nil {
+				http.Error(w, "bad players param, please provide at least a player per team", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(data.Split); err != nil {
+				log.Printf("Error encoding teams: %s", err)
+			}
+			return
+		}
+		if err := tpl.ExecuteTemplate(w, "teams.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
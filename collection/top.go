@@ -0,0 +1,63 @@
+package collection
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// Top is the top list page, /top?bggName=X&by=weight|score|bscore&n=10&category=C,
+// the highest ranked games of X's cached collection, ready to paste into a
+// forum or group chat. format=markdown serves just the markdown.
+func Top(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		by := r.FormValue("by")
+		if by == "" {
+			by = "score"
+		}
+		if !service.ValidTopBy(by) {
+			http.Error(w, "bad by param, please provide one of "+strings.Join(service.TopBy, ", "), http.StatusBadRequest)
+			return
+		}
+		n := 10
+		if v := r.FormValue("n"); v != "" {
+			i, err := strconv.Atoi(v)
+			if err != nil || i < 1 || i > service.MaxTop {
+				http.Error(w, fmt.Sprintf("bad n param, please provide a number between 1 and %d", service.MaxTop), http.StatusBadRequest)
+				return
+			}
+			n = i
+		}
+		list, ok := svc.Top(bggName, by, n, r.FormValue("category"))
+		if !ok {
+			http.Error(w, "collection not loaded yet, please look it up first", http.StatusNotFound)
+			return
+		}
+		switch {
+		case r.FormValue("format") == "markdown":
+			w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+			fmt.Fprint(w, list.Markdown())
+		case jobs.WantsJSON(r):
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(list); err != nil {
+				log.Printf("Error encoding top list: %s", err)
+			}
+		default:
+			if err := tpl.ExecuteTemplate(w, "top.html", list); err != nil {
+				log.Printf("Error executing template: %s", err)
+			}
+		}
+	}
+}
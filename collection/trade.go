@@ -0,0 +1,52 @@
+package collection
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// Trade matches two users' games for trade with each other's wishlists,
+// /trade?a=X&b=Y. Without the names it shows the form.
+func Trade(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a, b := strings.TrimSpace(r.FormValue("a")), strings.TrimSpace(r.FormValue("b"))
+		data := struct {
+			A, B  string
+			Match *service.TradeMatch
+		}{A: a, B: b}
+		if a != "" || b != "" {
+			for _, name := range []string{a, b} {
+				if len(name) < 4 || len(name) > 20 {
+					http.Error(w, "bad bgg name param, please provide two names between 4-20 characters", http.StatusBadRequest)
+					return
+				}
+			}
+			if strings.EqualFold(a, b) {
+				http.Error(w, "bad bgg name param, please provide two different users", http.StatusBadRequest)
+				return
+			}
+			var err error
+			if data.Match, err = svc.TradeMatch(r.Context(), a, b); err != nil {
+				http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+				log.Printf("%s", err)
+				return
+			}
+			if jobs.WantsJSON(r) {
+				w.Header().Set("Content-Type", "application/json")
+				if err := json.NewEncoder(w).Encode(data.Match); err != nil {
+					log.Printf("Error encoding trade match: %s", err)
+				}
+				return
+			}
+		}
+		if err := tpl.ExecuteTemplate(w, "trade.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package collection
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// maxTurnPlayers bounds the players of a turn order pick.
+const maxTurnPlayers = 20
+
+type turnOrderData struct {
+	Players  string // as entered, to fill the form again
+	Group    string
+	Weighted bool
+	Order    *service.TurnOrder
+}
+
+// TurnOrder is the first player picker, /turnorder?players=A,B,C&group=G&weighted=1,
+// answering with a random first player and the turn order after them.
+// group, optional, names the play group the pick is remembered for, and
+// weighted makes players who went first lately in that group less likely
+// to go first again. Without players it shows the form.
+func TurnOrder(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		data := turnOrderData{
+			Players:  r.FormValue("players"),
+			Group:    strings.TrimSpace(r.FormValue("group")),
+			Weighted: r.FormValue("weighted") == "1",
+		}
+		if len(data.Group) > 40 {
+			http.Error(w, "bad group param, please provide a name of at most 40 characters", http.StatusBadRequest)
+			return
+		}
+		if data.Weighted && data.Group == "" {
+			http.Error(w, "bad group param, please name the group to weigh the pick by its history", http.StatusBadRequest)
+			return
+		}
+		players, ok := playerNames(data.Players)
+		if !ok {
+			http.Error(w, "bad players param, please provide names of at most 40 characters", http.StatusBadRequest)
+			return
+		}
+		if len(players) > maxTurnPlayers {
+			http.Error(w, "bad players param, please provide at most 20 players", http.StatusBadRequest)
+			return
+		}
+
+		if len(players) > 0 {
+			if len(players) < 2 {
+				http.Error(w, "bad players param, please provide at least 2 players", http.StatusBadRequest)
+				return
+			}
+			order, err := svc.PickTurnOrder(data.Group, players, data.Weighted)
+			if err != nil {
+				http.Error(w, "unable to pick a turn order", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			data.Order = order
+		}
+		if jobs.WantsJSON(r) {
+			if data.Order == nil {
+				http.Error(w, "bad players param, please provide at least 2 players", http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(data.Order); err != nil {
+				log.Printf("Error encoding turn order: %s", err)
+			}
+			return
+		}
+		if err := tpl.ExecuteTemplate(w, "turnorder.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
+
+// playerNames reads a list of player names separated by commas or lines,
+// dropping blank and repeated ones. ok is false if a name is too long.
+func playerNames(list string) (names []string, ok bool) {
+	seen := make(map[string]bool)
+	for _, p := range strings.FieldsFunc(list, func(c rune) bool { return c == ',' || c == '\n' || c == '\r' }) {
+		p = strings.TrimSpace(p)
+		if p == "" || seen[strings.ToLower(p)] {
+			continue
+		}
+		if len(p) > 40 {
+			return nil, false
+		}
+		seen[strings.ToLower(p)] = true
+		names = append(names, p)
+	}
+	return names, true
+}
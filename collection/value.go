@@ -0,0 +1,74 @@
+package collection
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// Value is the collection value report, /value?bggName=X. Add format=csv
+// for a spreadsheet of it, such as for insurance.
+func Value(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		report, err := svc.Value(r.Context(), bggName)
+		if err != nil {
+			http.Error(w, "unable to get collection information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+
+		switch {
+		case r.FormValue("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv"):
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": bggName + "-value.csv"}))
+			if err := writeValueCSV(w, report); err != nil {
+				log.Printf("Error writing value report: %s", err)
+			}
+		case jobs.WantsJSON(r):
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(report); err != nil {
+				log.Printf("Error encoding value report: %s", err)
+			}
+		default:
+			if err := tpl.ExecuteTemplate(w, "value.html", report); err != nil {
+				log.Printf("Error executing template: %s", err)
+			}
+		}
+	}
+}
+
+// writeValueCSV writes a row per game and a total row. Games without a
+// value have empty price columns rather than zeros.
+func writeValueCSV(w http.ResponseWriter, report *service.ValueReport) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "name", "value", "low", "high", "listings", "currency", "priced"})
+	price := func(v float64) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	}
+	for _, g := range report.Games {
+		priced := ""
+		if !g.Priced.IsZero() {
+			priced = g.Priced.Format("2006-01-02")
+		}
+		cw.Write([]string{g.ID, g.Name, price(g.Value), price(g.Low), price(g.High), strconv.Itoa(g.Listings), report.Currency, priced})
+	}
+	cw.Write([]string{"", "Total", price(report.Total), "", "", "", report.Currency, ""})
+	cw.Flush()
+	return cw.Error()
+}
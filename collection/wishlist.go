@@ -0,0 +1,50 @@
+package collection
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// Wishlist is the gift buying guide, /wishlist?bggName=X&numPlayers=N, the
+// wishlist sorted by how likely each game is to get played. numPlayers, the
+// usual group size, is optional.
+func Wishlist(tpl *template.Template, svc *service.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		var numPlayers int
+		if np := r.FormValue("numPlayers"); np != "" {
+			n, err := strconv.Atoi(np)
+			if err != nil || n < 1 || n > 100 {
+				http.Error(w, "bad num players param, please provide a number between 1 and 100", http.StatusBadRequest)
+				return
+			}
+			numPlayers = n
+		}
+		report, err := svc.Wishlist(r.Context(), bggName, numPlayers)
+		if err != nil {
+			http.Error(w, "unable to get wishlist information", http.StatusServiceUnavailable)
+			log.Printf("%s", err)
+			return
+		}
+		if jobs.WantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(report); err != nil {
+				log.Printf("Error encoding wishlist: %s", err)
+			}
+			return
+		}
+		if err := tpl.ExecuteTemplate(w, "wishlist.html", report); err != nil {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+// Package config gathers the settings of the site from, in increasing order
+// of precedence, built in defaults, an optional config file, environment
+// variables and command line flags.
+package config
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/mail"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the complete configuration of the site.
+type Config struct {
+	Port                string
+	SiteURL             string // public URL of the site, search engines are kept out if empty
+	BGGBaseURL          string
+	BGGToken            string // BGG API token, features writing to BGG are off without one
+	BGGTokenUser        string // BGG name the token belongs to, plays are only logged on BGG for it
+	FallbackSource      string // mirror URL or dump file used while BGG is down
+	ValueCurrency       string // currency of the marketplace listings collections are valued from
+	DiscordWebhook      string // where "export for chat" posts, posting is off if empty
+	SlackSigningSecret  string // verifies Slack slash commands, the command is off if empty
+	DiscordBotToken     string // registers the Discord bot's commands, the bot is off if empty
+	DiscordAppID        string
+	DiscordPublicKey    string // hex Ed25519 key verifying Discord interactions
+	TelegramBotToken    string // token of the Telegram bot, the bot is off if empty
+	TelegramSecret      string // sent by Telegram with every update to the bot's webhook
+	SMTPAddr            string // host:port of the SMTP server emails are sent through, emails are off if empty
+	SMTPUser            string
+	SMTPPassword        string
+	SMTPFrom            string // From address of the emails
+	StorePath           string
+	CachePath           string // where the BGG cache is saved at shutdown and loaded at startup, off if empty
+	TemplateDir         string // templates and static files are loaded from here instead of embedded, if set
+	TemplateOverrideDir string
+	AdminToken          string // has every admin role
+	AdminRoleTokens     string // comma separated role:token pairs granting single admin roles
+	TrustProxy          bool   // take client IPs from X-Forwarded-For
+	AllowNets           string // comma separated CIDRs of the only clients served, everyone if empty
+	ProxyAuthHeader     string // header an authenticating proxy sets to the user, required on every request if set
+	CORSOrigins         string // comma separated origins allowed to call the JSON API, off if empty
+	CORSMethods         string
+	APIKeys             string // comma separated keys required for JSON and CSV, open if empty
+	DebugEndpoints      bool   // serve pprof and expvar under /debug/, admin token required
+
+	SiteName   string
+	SiteLogo   string
+	SiteAccent string
+
+	JobWorkers      int           // collection jobs run at once
+	CollectionLimit int           // uncached games fetched while the user waits, the rest load in the background
+	MinPollVotes    int           // voters a player count poll needs to be trusted over the box counts
+	BGGConcurrency  int           // requests to BGG in flight at once
+	BGGTimeout      time.Duration // per request to BGG
+	BGGRate         int           // requests a second to BGG, shared by pages and background jobs
+	BreakerFailures int           // consecutive failed BGG requests after which BGG isn't called for a while
+	BreakerCooldown time.Duration // how long BGG isn't called after too many failures
+	RateLimit       int           // requests a minute per client IP to pages calling BGG
+	RateBurst       int           // requests a client IP may make at once
+	CORSMaxAge      time.Duration // how long browsers may cache a CORS preflight
+
+	GameTTL         time.Duration // age at which cached games are refreshed
+	CollectionTTL   time.Duration // age at which cached collections are refreshed
+	RefreshInterval time.Duration // how often to look for stale cache entries
+	PageCacheTTL    time.Duration // longest a rendered stats or browse page is reused
+
+	RequestTimeout  time.Duration // deadline of the work done for a request
+	ReadTimeout     time.Duration
+	WriteTimeout    time.Duration // also the deadline of streamed collection pages
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+}
+
+// Default returns the configuration used when nothing is set.
+func Default() *Config {
+	return &Config{
+		Port:            "8080",
+		BGGBaseURL:      "https://www.boardgamegeek.com",
+		ValueCurrency:   "USD",
+		SiteName:        "BGG Helper",
+		SiteAccent:      "#7ce0f9",
+		JobWorkers:      4,
+		CollectionLimit: 300,
+		MinPollVotes:    10,
+		BGGConcurrency:  8,
+		BGGTimeout:      30 * time.Second,
+		BGGRate:         5,
+		BreakerFailures: 5,
+		BreakerCooldown: 30 * time.Second,
+		RateLimit:       30,
+		RateBurst:       10,
+		CORSMethods:     "GET, POST",
+		CORSMaxAge:      10 * time.Minute,
+		GameTTL:         7 * 24 * time.Hour,
+		CollectionTTL:   24 * time.Hour,
+		RefreshInterval: time.Hour,
+		PageCacheTTL:    10 * time.Minute,
+		RequestTimeout:  2 * time.Minute,
+		ReadTimeout:     30 * time.Second,
+		WriteTimeout:    5 * time.Minute,
+		IdleTimeout:     2 * time.Minute,
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// setting ties a config field to its file key, flag and environment
+// variable. The file key is also the flag name.
+type setting struct {
+	key   string
+	env   string
+	usage string
+	field interface{} // *string, *bool, *int or *time.Duration
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"port", "PORT", "port to listen on", &c.Port},
+		{"site_url", "SITE_URL", "public URL of the site for the sitemap, not indexed if empty", &c.SiteURL},
+		{"bgg_base_url", "BGG_BASE_URL", "base URL of the BGG site and API", &c.BGGBaseURL},
+		{"bgg_token", "BGG_TOKEN", "BGG API token, needed to write wishlists and log plays", &c.BGGToken},
+		{"bgg_token_user", "BGG_TOKEN_USER", "BGG name bgg_token belongs to, the only user whose plays are logged on BGG", &c.BGGTokenUser},
+		{"fallback_source", "FALLBACK_SOURCE", "mirror URL or game dump file used while BGG is down", &c.FallbackSource},
+		{"value_currency", "VALUE_CURRENCY", "currency code of the marketplace listings collections are valued from", &c.ValueCurrency},
+		{"discord_webhook", "DISCORD_WEBHOOK", "Discord webhook URL recommendations can be posted to", &c.DiscordWebhook},
+		{"discord_bot_token", "DISCORD_BOT_TOKEN", "token of the Discord bot, enables its slash commands", &c.DiscordBotToken},
+		{"discord_app_id", "DISCORD_APP_ID", "application ID of the Discord bot", &c.DiscordAppID},
+		{"discord_public_key", "DISCORD_PUBLIC_KEY", "public key of the Discord bot's application, in hex", &c.DiscordPublicKey},
+		{"telegram_bot_token", "TELEGRAM_BOT_TOKEN", "token of the Telegram bot, enables its inline queries", &c.TelegramBotToken},
+		{"telegram_secret", "TELEGRAM_SECRET", "secret Telegram sends with the bot's updates", &c.TelegramSecret},
+		{"slack_signing_secret", "SLACK_SIGNING_SECRET", "signing secret of the Slack app sending slash commands", &c.SlackSigningSecret},
+		{"smtp_addr", "SMTP_ADDR", "host:port of the SMTP server to send emails through, emails are off if empty", &c.SMTPAddr},
+		{"smtp_user", "SMTP_USER", "user to log in to the SMTP server as, no login if empty", &c.SMTPUser},
+		{"smtp_password", "SMTP_PASSWORD", "password of the SMTP user", &c.SMTPPassword},
+		{"smtp_from", "SMTP_FROM", "From address of the emails, such as \"Game Night <games@example.com>\"", &c.SMTPFrom},
+		{"store_path", "STORE_PATH", "file to persist user data to, memory only if empty", &c.StorePath},
+		{"cache_path", "CACHE_PATH", "file the BGG cache is saved to at shutdown and loaded from at startup, off if empty", &c.CachePath},
+		{"template_dir", "TEMPLATE_DIR", "directory to load templates and static/ from instead of the embedded ones, for development", &c.TemplateDir},
+		{"template_override_dir", "TEMPLATE_OVERRIDE_DIR", "directory of templates replacing the built in ones", &c.TemplateOverrideDir},
+		{"admin_token", "ADMIN_TOKEN", "token for the admin endpoints, disabled if empty", &c.AdminToken},
+		{"admin_role_tokens", "ADMIN_ROLE_TOKENS", "comma separated role:token pairs giving a token one admin role (purge, debug, config, cache, data)", &c.AdminRoleTokens},
+		{"debug_endpoints", "DEBUG_ENDPOINTS", "serve pprof and expvar under /debug/ to admins", &c.DebugEndpoints},
+		{"site_name", "SITE_NAME", "name shown in the navbar and titles", &c.SiteName},
+		{"site_logo", "SITE_LOGO", "URL of the navbar logo", &c.SiteLogo},
+		{"site_accent", "SITE_ACCENT", "CSS accent color", &c.SiteAccent},
+		{"job_workers", "JOB_WORKERS", "collection jobs run at once", &c.JobWorkers},
+		{"collection_limit", "COLLECTION_LIMIT", "uncached games of a collection fetched while the user waits", &c.CollectionLimit},
+		{"min_poll_votes", "MIN_POLL_VOTES", "voters a player count poll needs, games with fewer are recommended across their box counts", &c.MinPollVotes},
+		{"bgg_concurrency", "BGG_CONCURRENCY", "requests to BGG in flight at once", &c.BGGConcurrency},
+		{"bgg_timeout", "BGG_TIMEOUT", "timeout of a single BGG request", &c.BGGTimeout},
+		{"bgg_rate", "BGG_RATE", "requests a second to BGG, shared by pages and background jobs", &c.BGGRate},
+		{"breaker_failures", "BREAKER_FAILURES", "consecutive failed BGG requests after which BGG isn't called for a while", &c.BreakerFailures},
+		{"breaker_cooldown", "BREAKER_COOLDOWN", "how long BGG isn't called after too many failed requests", &c.BreakerCooldown},
+		{"rate_limit", "RATE_LIMIT", "requests a minute per client IP to pages calling BGG", &c.RateLimit},
+		{"rate_burst", "RATE_BURST", "requests a client IP may make at once to pages calling BGG", &c.RateBurst},
+		{"cors_origins", "CORS_ORIGINS", "comma separated origins allowed to call the JSON API, * for any", &c.CORSOrigins},
+		{"cors_methods", "CORS_METHODS", "methods allowed to other origins", &c.CORSMethods},
+		{"cors_max_age", "CORS_MAX_AGE", "how long browsers may cache a CORS preflight", &c.CORSMaxAge},
+		{"api_keys", "API_KEYS", "comma separated keys required to get JSON and CSV, open if empty", &c.APIKeys},
+		{"trust_proxy", "TRUST_PROXY", "take client IPs from X-Forwarded-For, only behind a proxy setting it", &c.TrustProxy},
+		{"allow_nets", "ALLOW_NETS", "comma separated addresses or CIDRs of the only clients served, everyone if empty", &c.AllowNets},
+		{"proxy_auth_header", "PROXY_AUTH_HEADER", "header, such as Remote-User, an authenticating proxy sets on every request, off if empty", &c.ProxyAuthHeader},
+		{"game_ttl", "GAME_TTL", "age at which cached games are refreshed", &c.GameTTL},
+		{"collection_ttl", "COLLECTION_TTL", "age at which cached collections are refreshed", &c.CollectionTTL},
+		{"refresh_interval", "REFRESH_INTERVAL", "how often to refresh stale cache entries", &c.RefreshInterval},
+		{"request_timeout", "REQUEST_TIMEOUT", "deadline of the work done for a request, streamed collection pages get write_timeout", &c.RequestTimeout},
+		{"page_cache_ttl", "PAGE_CACHE_TTL", "longest a rendered stats or browse page is reused", &c.PageCacheTTL},
+		{"read_timeout", "READ_TIMEOUT", "timeout reading a request", &c.ReadTimeout},
+		{"write_timeout", "WRITE_TIMEOUT", "timeout writing a response", &c.WriteTimeout},
+		{"idle_timeout", "IDLE_TIMEOUT", "timeout of idle keep-alive connections", &c.IdleTimeout},
+		{"shutdown_timeout", "SHUTDOWN_TIMEOUT", "time allowed to drain requests at shutdown", &c.ShutdownTimeout},
+	}
+}
+
+func (s setting) set(value string) error {
+	switch f := s.field.(type) {
+	case *string:
+		*f = value
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("bad %s %q, please provide true or false", s.key, value)
+		}
+		*f = b
+	case *int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("bad %s %q, please provide a whole number", s.key, value)
+		}
+		*f = n
+	case *time.Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("bad %s %q, please provide a duration such as 30s or 2h", s.key, value)
+		}
+		*f = d
+	}
+	return nil
+}
+
+// Load builds the configuration from args, the command line without the
+// program name, and getenv. The config file is named by the -config flag or
+// the CONFIG_FILE environment variable.
+func Load(args []string, getenv func(string) string) (*Config, error) {
+	c, _, err := LoadArgs(args, getenv)
+	return c, err
+}
+
+// LoadArgs is Load for commands taking arguments after the flags, which are
+// returned.
+func LoadArgs(args []string, getenv func(string) string) (*Config, []string, error) {
+	c := Default()
+	settings := c.settings()
+
+	fs := flag.NewFlagSet("board_game_helper", flag.ContinueOnError)
+	configFile := fs.String("config", getenv("CONFIG_FILE"), "config file of key = value lines")
+	flags := make(map[string]*string, len(settings))
+	for _, s := range settings {
+		flags[s.key] = fs.String(s.key, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *configFile != "" {
+		if err := c.loadFile(*configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, s := range settings {
+		if v := getenv(s.env); v != "" {
+			if err := s.set(v); err != nil {
+				return nil, nil, fmt.Errorf("%s (from %s)", err, s.env)
+			}
+		}
+	}
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.key == f.Name && flagErr == nil {
+				flagErr = s.set(*flags[s.key])
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, nil, flagErr
+	}
+	return c, fs.Args(), c.Validate()
+}
+
+func (c *Config) loadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("unable to open config file: %s", err)
+	}
+	defer f.Close()
+	if err := c.parse(f); err != nil {
+		return fmt.Errorf("config file %s: %s", path, err)
+	}
+	return nil
+}
+
+// parse reads key = value lines, the flat subset of TOML. Values may be
+// quoted, blank lines and lines starting with # are ignored.
+func (c *Config) parse(r io.Reader) error {
+	byKey := make(map[string]setting)
+	for _, s := range c.settings() {
+		byKey[s.key] = s
+	}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return fmt.Errorf("line %d: expected key = value", n)
+		}
+		key, value := strings.TrimSpace(line[:eq]), strings.TrimSpace(line[eq+1:])
+		if strings.HasPrefix(value, `"`) {
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return fmt.Errorf("line %d: bad quoted value %s", n, value)
+			}
+			value = unquoted
+		}
+		s, ok := byKey[key]
+		if !ok {
+			return fmt.Errorf("line %d: unknown setting %q", n, key)
+		}
+		if err := s.set(value); err != nil {
+			return fmt.Errorf("line %d: %s", n, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// Validate checks that every setting is usable.
+func (c *Config) Validate() error {
+	if p, err := strconv.Atoi(c.Port); err != nil || p < 1 || p > 65535 {
+		return fmt.Errorf("bad port %q, please provide a number between 1 and 65535", c.Port)
+	}
+	u, err := url.Parse(c.BGGBaseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("bad bgg_base_url %q, please provide an http or https URL", c.BGGBaseURL)
+	}
+	if c.SiteURL != "" {
+		if u, err := url.Parse(c.SiteURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("bad site_url %q, please provide an http or https URL", c.SiteURL)
+		}
+	}
+	if !validCurrency(c.ValueCurrency) {
+		return fmt.Errorf("bad value_currency %q, please provide a currency code such as USD", c.ValueCurrency)
+	}
+	if c.DiscordWebhook != "" && !strings.HasPrefix(c.DiscordWebhook, "https://") {
+		return fmt.Errorf("bad discord_webhook, please provide an https URL")
+	}
+	if c.DiscordBotToken != "" {
+		if c.DiscordAppID == "" {
+			return fmt.Errorf("bad discord_app_id, please provide the application ID of the bot")
+		}
+		if key, err := hex.DecodeString(c.DiscordPublicKey); err != nil || len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("bad discord_public_key, please provide the application's hex public key")
+		}
+	}
+	if c.TelegramBotToken != "" && !validTelegramSecret(c.TelegramSecret) {
+		return fmt.Errorf("bad telegram_secret, please provide 1-256 letters, digits, _ or -")
+	}
+	if c.SMTPAddr != "" {
+		if _, _, err := net.SplitHostPort(c.SMTPAddr); err != nil {
+			return fmt.Errorf("bad smtp_addr %q, please provide host:port", c.SMTPAddr)
+		}
+		if _, err := mail.ParseAddress(c.SMTPFrom); err != nil {
+			return fmt.Errorf("bad smtp_from %q, please provide an email address", c.SMTPFrom)
+		}
+		if c.SiteURL == "" {
+			return fmt.Errorf("bad site_url, please provide the site's URL for the links in emails")
+		}
+	}
+	for _, s := range c.settings() {
+		switch f := s.field.(type) {
+		case *int:
+			if *f < 1 {
+				return fmt.Errorf("bad %s %d, please provide a number above 0", s.key, *f)
+			}
+		case *time.Duration:
+			if *f <= 0 {
+				return fmt.Errorf("bad %s %s, please provide a positive duration", s.key, *f)
+			}
+		}
+	}
+	return nil
+}
+
+// validTelegramSecret reports whether s is a secret token Telegram accepts.
+func validTelegramSecret(s string) bool {
+	if len(s) < 1 || len(s) > 256 {
+		return false
+	}
+	for _, r := range s {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// validCurrency reports whether s looks like an ISO 4217 currency code.
+func validCurrency(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,61 @@
+package config
+
+import "time"
+
+// Reloadable are the keys of the settings a running site applies on reload,
+// the others need a restart.
+var Reloadable = []string{"rate_limit", "rate_burst", "collection_limit", "bgg_rate", "game_ttl", "collection_ttl", "page_cache_ttl"}
+
+func reloadable(key string) bool {
+	for _, k := range Reloadable {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload returns a copy of cur with the reloadable settings taken from next,
+// along with the keys of the changed settings it applied and of those
+// needing a restart.
+func Reload(cur, next *Config) (merged *Config, applied, restart []string) {
+	c := *cur
+	merged = &c
+	to, from, old := merged.settings(), next.settings(), cur.settings()
+	for i, s := range to {
+		if value(from[i]) == value(old[i]) {
+			continue
+		}
+		if !reloadable(s.key) {
+			restart = append(restart, s.key)
+			continue
+		}
+		applied = append(applied, s.key)
+		switch f := s.field.(type) {
+		case *string:
+			*f = *from[i].field.(*string)
+		case *bool:
+			*f = *from[i].field.(*bool)
+		case *int:
+			*f = *from[i].field.(*int)
+		case *time.Duration:
+			*f = *from[i].field.(*time.Duration)
+		}
+	}
+	return merged, applied, restart
+}
+
+// value is the current value of s, comparable with others of the same key.
+func value(s setting) interface{} {
+	switch f := s.field.(type) {
+	case *string:
+		return *f
+	case *bool:
+		return *f
+	case *int:
+		return *f
+	case *time.Duration:
+		return *f
+	}
+	return nil
+}
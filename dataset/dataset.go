@@ -0,0 +1,71 @@
+// Package dataset writes a user's games, collection and plays out in file
+// formats meant for data analysis tools such as pandas or DuckDB.
+package dataset
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+)
+
+// Record is a single exported row. Type names what Data is, "collection",
+// "game" or "play".
+type Record struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// Writer writes records in one file format. Formats needing a footer, such
+// as Parquet, write it on Close.
+type Writer interface {
+	Write(r Record) error
+	Close() error
+}
+
+// Format is a file format exports can be written in.
+type Format struct {
+	Name        string
+	ContentType string
+	Ext         string
+	New         func(w io.Writer) Writer
+}
+
+var formats = map[string]Format{
+	"ndjson": {Name: "ndjson", ContentType: "application/x-ndjson", Ext: ".ndjson", New: NDJSON},
+}
+
+// Default is the format used when none is picked.
+const Default = "ndjson"
+
+// Lookup returns the format registered under name.
+func Lookup(name string) (Format, bool) {
+	f, ok := formats[name]
+	return f, ok
+}
+
+// Formats returns the names of the available formats, sorted.
+func Formats() []string {
+	var names []string
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+// NDJSON returns a Writer writing one JSON object per line.
+func NDJSON(w io.Writer) Writer {
+	return ndjsonWriter{enc: json.NewEncoder(w)}
+}
+
+func (n ndjsonWriter) Write(r Record) error {
+	return n.enc.Encode(r)
+}
+
+func (n ndjsonWriter) Close() error {
+	return nil
+}
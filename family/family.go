@@ -0,0 +1,184 @@
+// Package family implements family mode, which hides adult themed games from
+// shared and kiosk views.
+package family
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+	"github.com/mattkoler/board_game_helper/syncapi"
+	"github.com/mattkoler/board_game_helper/trash"
+)
+
+// matureCategory is the BGG category for adult themed games.
+const matureCategory = "Mature / Adult"
+
+// maxAge is the highest BGG minimum age still considered family friendly.
+const maxAge = 14
+
+const cookieName = "family"
+
+// ExclusionKind is the store kind of the games excluded from family mode.
+const ExclusionKind = "FamilyExclusion"
+
+func init() {
+	trash.Register(ExclusionKind, "Family mode exclusion")
+	syncapi.Register(ExclusionKind)
+}
+
+// Exclusion is a game a user always hides in family mode.
+type Exclusion struct {
+	Owner    string
+	GameID   string
+	GameName string
+	Added    time.Time
+}
+
+func exclusionKey(owner, gameID string) string {
+	return store.Key(strings.ToLower(owner), gameID)
+}
+
+// Hidden reports whether a game with the given BGG minimum age and
+// categories should be hidden in family mode.
+func Hidden(minAge int, categories []string) bool {
+	if minAge > maxAge {
+		return true
+	}
+	for _, c := range categories {
+		if c == matureCategory {
+			return true
+		}
+	}
+	return false
+}
+
+// Enabled reports whether family mode is on for the request, either through
+// the family form value or the cookie set by Toggle.
+func Enabled(r *http.Request) bool {
+	if v := r.FormValue("family"); v != "" {
+		return v == "1"
+	}
+	c, err := r.Cookie(cookieName)
+	return err == nil && c.Value == "1"
+}
+
+// Excluded returns the IDs of the games owner has excluded from family mode.
+func Excluded(st *store.Store, owner string) map[string]bool {
+	var all []*Exclusion
+	if _, err := st.GetAll(ExclusionKind, store.Key(strings.ToLower(owner), ""), &all); err != nil {
+		log.Printf("warning: unable to load family exclusions for %q: %s", owner, err)
+		return nil
+	}
+	excluded := make(map[string]bool, len(all))
+	for _, e := range all {
+		excluded[e.GameID] = true
+	}
+	return excluded
+}
+
+// Toggle turns family mode on or off for the browser with a long lived
+// cookie, so a kiosk stays in family mode between visits. The user is sent
+// back to the return form value, or the referring page if there isn't one.
+func Toggle() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		value := "0"
+		if r.FormValue("on") == "1" {
+			value = "1"
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     cookieName,
+			Value:    value,
+			Path:     "/",
+			MaxAge:   365 * 24 * 60 * 60,
+			HttpOnly: true,
+		})
+		back := r.FormValue("return")
+		if ref, err := url.Parse(r.Referer()); back == "" && err == nil && ref.Host == r.Host {
+			back = ref.RequestURI()
+		}
+		if !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") {
+			back = "/"
+		}
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	}
+}
+
+type exclusionsData struct {
+	BGGName    string
+	Family     bool
+	Exclusions []*Exclusion
+}
+
+// Exclusions is the page for managing a user's family mode exclusion list.
+func Exclusions(tpl *template.Template, st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+
+		var all []*Exclusion
+		if _, err := st.GetAll(ExclusionKind, store.Key(strings.ToLower(bggName), ""), &all); err != nil {
+			http.Error(w, "unable to load exclusions", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+
+		data := exclusionsData{BGGName: bggName, Family: Enabled(r), Exclusions: all}
+		if err := tpl.ExecuteTemplate(w, "family.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
+
+// Exclude adds a game to, or with remove set moves it to the trash from, a
+// user's family mode exclusion list.
+func Exclude(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bggName, gameID := r.FormValue("bggName"), r.FormValue("gameID")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		if gameID == "" {
+			http.Error(w, "missing gameID", http.StatusBadRequest)
+			return
+		}
+
+		key := exclusionKey(bggName, gameID)
+		var err error
+		if r.FormValue("remove") != "" {
+			if err = st.SoftDelete(ExclusionKind, key); err == store.ErrNotFound {
+				err = nil
+			}
+		} else {
+			err = st.Put(ExclusionKind, key, &Exclusion{
+				Owner:    bggName,
+				GameID:   gameID,
+				GameName: r.FormValue("gameName"),
+				Added:    time.Now(),
+			})
+		}
+		if err != nil {
+			http.Error(w, "unable to update exclusions", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		http.Redirect(w, r, "/family?"+url.Values{"bggName": {bggName}}.Encode(), http.StatusSeeOther)
+	}
+}
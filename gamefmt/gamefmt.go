@@ -0,0 +1,126 @@
+// Package gamefmt formats game data for people, so templates show players,
+// weights and ratings the same way without formatting logic of their own.
+package gamefmt
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// Funcs makes the helpers available to templates.
+func Funcs() template.FuncMap {
+	return template.FuncMap{
+		"playerRange":         PlayerRange,
+		"playTime":            PlayTime,
+		"countList":           CountList,
+		"playerSummary":       PlayerSummary,
+		"weightLabel":         WeightLabel,
+		"stars":               Stars,
+		"truncateDescription": TruncateDescription,
+	}
+}
+
+// PlayerRange formats a player count range such as "2-5", or "4" when both
+// ends are the same. It is empty when the counts aren't known.
+func PlayerRange(min, max int) string {
+	switch {
+	case max == 0:
+		return ""
+	case min == max:
+		return fmt.Sprint(min)
+	}
+	return fmt.Sprintf("%d-%d", min, max)
+}
+
+// PlayTime formats a playing time range in minutes such as "45-90 min", or
+// "60 min" when both ends are the same. It is empty when the time isn't
+// known.
+func PlayTime(min, max int) string {
+	switch {
+	case max == 0:
+		return ""
+	case min == 0 || min == max:
+		return fmt.Sprintf("%d min", max)
+	}
+	return fmt.Sprintf("%d-%d min", min, max)
+}
+
+// CountList formats player counts such as 1, 5 and 6 as "1, 5-6".
+func CountList(counts []int) string {
+	var parts []string
+	for i := 0; i < len(counts); {
+		j := i
+		for j+1 < len(counts) && counts[j+1] == counts[j]+1 {
+			j++
+		}
+		parts = append(parts, PlayerRange(counts[i], counts[j]))
+		i = j + 1
+	}
+	return strings.Join(parts, ", ")
+}
+
+// PlayerSummary sums up how a game plays at each player count, such as
+// "Best: 3, Good: 2-4, Supports: 2-5", from the counts voted best and good
+// and the box range. Parts nobody voted on are left out.
+func PlayerSummary(best, good []int, min, max int) string {
+	var parts []string
+	if len(best) > 0 {
+		parts = append(parts, "Best: "+CountList(best))
+	}
+	if len(good) > 0 {
+		parts = append(parts, "Good: "+CountList(good))
+	}
+	if r := PlayerRange(min, max); r != "" {
+		parts = append(parts, "Supports: "+r)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// WeightLabel names a BGG weight the way BGG's own scale does, from "Light"
+// at 1 to "Heavy" at 5. It is empty for games nobody has rated.
+func WeightLabel(weight float64) string {
+	switch {
+	case weight <= 0:
+		return ""
+	case weight < 1.5:
+		return "Light"
+	case weight < 2.5:
+		return "Medium Light"
+	case weight < 3.5:
+		return "Medium"
+	case weight < 4.5:
+		return "Medium Heavy"
+	}
+	return "Heavy"
+}
+
+// Stars shows a BGG rating out of 10 as five stars, such as "★★★★☆" for
+// 7.9. It is empty for games nobody has rated.
+func Stars(score float64) string {
+	if score <= 0 {
+		return ""
+	}
+	n := int(math.Round(math.Min(score, 10) / 2))
+	return strings.Repeat("★", n) + strings.Repeat("☆", 5-n)
+}
+
+// TruncateDescription shortens desc to at most n characters, cutting at a
+// word and adding an ellipsis. It takes n first so templates can pipe into
+// it: {{ .Description | truncateDescription 200 }}.
+func TruncateDescription(n int, desc string) string {
+	runes := []rune(strings.TrimSpace(desc))
+	if len(runes) <= n {
+		return string(runes)
+	}
+	cut := n
+	for cut > 0 && !unicode.IsSpace(runes[cut]) {
+		cut--
+	}
+	if cut == 0 { // a single long word
+		cut = n
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace) + "…"
+}
@@ -1,8 +1,5 @@
 module github.com/mattkoler/board_game_helper
 
-go 1.13
+go 1.16
 
-require (
-	github.com/kylelemons/godebug v1.1.0
-	google.golang.org/appengine v1.6.5
-)
+require github.com/kylelemons/godebug v1.1.0
@@ -0,0 +1,290 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/moods"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// discordAPI is the base URL of Discord's REST API.
+const discordAPI = "https://discord.com/api/v10"
+
+// discordClient calls Discord's REST API.
+var discordClient = &http.Client{Timeout: 10 * time.Second}
+
+// The interaction and response types used by the bot.
+const (
+	interactionPing    = 1
+	interactionCommand = 2
+
+	responsePong     = 1
+	responseMessage  = 4
+	responseDeferred = 5
+
+	flagEphemeral = 64
+)
+
+// Discord is the Discord bot. It answers slash commands sent to its
+// interactions endpoint with the same service the web pages use.
+type Discord struct {
+	svc       *service.Service
+	jm        *jobs.Manager
+	appID     string
+	token     string
+	publicKey ed25519.PublicKey
+}
+
+// NewDiscord returns the bot of the Discord application appID, using token
+// to register its commands and the hex publicKey to verify interactions.
+func NewDiscord(svc *service.Service, jm *jobs.Manager, appID, token, publicKey string) (*Discord, error) {
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("bad discord public key %q", publicKey)
+	}
+	return &Discord{svc: svc, jm: jm, appID: appID, token: token, publicKey: key}, nil
+}
+
+// discordOption describes a command option, the types are 3 for strings
+// and 4 for integers.
+type discordOption struct {
+	Type        int             `json:"type"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Required    bool            `json:"required,omitempty"`
+	Choices     []discordChoice `json:"choices,omitempty"`
+}
+
+type discordChoice struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type discordCommand struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Options     []discordOption `json:"options"`
+}
+
+func discordCommands() []discordCommand {
+	var moodChoices []discordChoice
+	for _, m := range moods.All {
+		moodChoices = append(moodChoices, discordChoice{Name: m, Value: m})
+	}
+	bggName := discordOption{Type: 3, Name: "bgg_name", Description: "BGG username", Required: true}
+	players := discordOption{Type: 4, Name: "players", Description: "number of players", Required: true}
+	mood := discordOption{Type: 3, Name: "mood", Description: "only games with this mood", Choices: moodChoices}
+	return []discordCommand{
+		{Name: "recs", Description: "Best and recommended games of a collection", Options: []discordOption{bggName, players, mood}},
+		{Name: "random", Description: "Pick a random recommended game of a collection", Options: []discordOption{bggName, players, mood}},
+		{Name: "game", Description: "Show a game's details", Options: []discordOption{
+			{Type: 3, Name: "game", Description: "BGG game ID or name", Required: true},
+		}},
+	}
+}
+
+// RegisterCommands replaces the bot's global slash commands with its own.
+func (d *Discord) RegisterCommands(ctx context.Context) error {
+	body, err := json.Marshal(discordCommands())
+	if err != nil {
+		return err
+	}
+	return d.call(ctx, http.MethodPut, fmt.Sprintf("%s/applications/%s/commands", discordAPI, d.appID), body)
+}
+
+// call sends a request to Discord's REST API authorized as the bot.
+func (d *Discord) call(ctx context.Context, method, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bot "+d.token)
+	resp, err := discordClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error calling discord: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Bad status code calling discord %s: %s", url, resp.Status)
+	}
+	return nil
+}
+
+// discordMessage is the data of a message response. Mentions are disabled
+// so game names can't ping anyone.
+type discordMessage struct {
+	Content         string              `json:"content"`
+	Flags           int                 `json:"flags,omitempty"`
+	AllowedMentions map[string][]string `json:"allowed_mentions"`
+}
+
+func newDiscordMessage(content string, flags int) *discordMessage {
+	return &discordMessage{Content: content, Flags: flags, AllowedMentions: map[string][]string{"parse": {}}}
+}
+
+type discordResponse struct {
+	Type int             `json:"type"`
+	Data *discordMessage `json:"data,omitempty"`
+}
+
+type interaction struct {
+	Type  int    `json:"type"`
+	Token string `json:"token"`
+	Data  struct {
+		Name    string `json:"name"`
+		Options []struct {
+			Name  string      `json:"name"`
+			Value interface{} `json:"value"`
+		} `json:"options"`
+	} `json:"data"`
+}
+
+// option returns the value of the named option as a string, empty if it
+// wasn't given.
+func (in *interaction) option(name string) string {
+	for _, o := range in.Data.Options {
+		if o.Name == name {
+			switch v := o.Value.(type) {
+			case string:
+				return v
+			case float64:
+				return strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		}
+	}
+	return ""
+}
+
+// Handler serves the bot's interactions endpoint. Commands that take too
+// long are deferred and their reply edited in once it is ready.
+func (d *Discord) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "unable to read request", http.StatusBadRequest)
+			return
+		}
+		sig, err := hex.DecodeString(r.Header.Get("X-Signature-Ed25519"))
+		if err != nil || !ed25519.Verify(d.publicKey, append([]byte(r.Header.Get("X-Signature-Timestamp")), body...), sig) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		var in interaction
+		if err := json.Unmarshal(body, &in); err != nil {
+			http.Error(w, "bad interaction", http.StatusBadRequest)
+			return
+		}
+
+		switch in.Type {
+		case interactionPing:
+			discordAnswer(w, discordResponse{Type: responsePong})
+			return
+		case interactionCommand:
+		default:
+			http.Error(w, "unsupported interaction", http.StatusBadRequest)
+			return
+		}
+
+		work, err := d.command(&in)
+		if err != nil {
+			discordAnswer(w, discordResponse{Type: responseMessage, Data: newDiscordMessage(err.Error(), flagEphemeral)})
+			return
+		}
+		msg, deferred, err := runOrDefer(d.jm, work, func(msg string) error {
+			body, err := json.Marshal(newDiscordMessage(msg, 0))
+			if err != nil {
+				return err
+			}
+			return d.call(context.Background(), http.MethodPatch, fmt.Sprintf("%s/webhooks/%s/%s/messages/@original", discordAPI, d.appID, in.Token), body)
+		})
+		switch {
+		case err != nil:
+			http.Error(w, "unable to start command job", http.StatusInternalServerError)
+			log.Printf("%s", err)
+		case deferred:
+			discordAnswer(w, discordResponse{Type: responseDeferred})
+		default:
+			discordAnswer(w, discordResponse{Type: responseMessage, Data: newDiscordMessage(msg, 0)})
+		}
+	}
+}
+
+// command checks the options of a slash command and returns the work
+// answering it.
+func (d *Discord) command(in *interaction) (func() string, error) {
+	const failed = "Unable to get information from BGG, please try again later."
+	switch in.Data.Name {
+	case "recs", "random":
+		numPlayers, err := strconv.Atoi(in.option("players"))
+		if err != nil {
+			return nil, fmt.Errorf("bad players option, please provide a number")
+		}
+		req := service.CollectionRequest{BGGName: in.option("bgg_name"), NumPlayers: numPlayers, Mood: in.option("mood")}
+		if err := req.Validate(); err != nil {
+			return nil, err
+		}
+		random := in.Data.Name == "random"
+		return func() string {
+			c, err := d.svc.Recommend(context.Background(), req)
+			if err != nil {
+				log.Printf("%s", err)
+				return failed
+			}
+			if random && len(c.Games) > 0 {
+				pick := rand.New(rand.NewSource(time.Now().UnixNano())).Intn(len(c.Games))
+				return service.DiscordPickMessage(c.Games[pick])
+			}
+			return service.DiscordMessage(c, service.DiscordLimit)
+		}, nil
+	case "game":
+		query := in.option("game")
+		if query == "" {
+			return nil, fmt.Errorf("missing game option")
+		}
+		return func() string {
+			id := query
+			if _, err := strconv.Atoi(query); err != nil {
+				items, err := d.svc.Search(context.Background(), query)
+				if err != nil {
+					log.Printf("%s", err)
+					return failed
+				}
+				if len(items) == 0 {
+					return fmt.Sprintf("No game called %q found on BGG.", query)
+				}
+				id = items[0].ID
+			}
+			detail, err := d.svc.Game(context.Background(), id, 0, "")
+			if err != nil {
+				log.Printf("%s", err)
+				return failed
+			}
+			return service.DiscordGameMessage(detail)
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown command %q", in.Data.Name)
+}
+
+func discordAnswer(w http.ResponseWriter, resp discordResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Error encoding discord response: %s", err)
+	}
+}
@@ -0,0 +1,52 @@
+package integrations
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+)
+
+// chatDeadline is how long a command may take before it is answered with a
+// loading message and the result sent later. Slack and Discord both give up
+// after three seconds.
+const chatDeadline = 2500 * time.Millisecond
+
+// runOrDefer runs work as a job. If it finishes within chatDeadline its
+// message is returned. Otherwise deferred is set, and late is called from the
+// job with the message once it is ready, to deliver it some other way.
+func runOrDefer(jm *jobs.Manager, work func() string, late func(msg string) error) (msg string, deferred bool, err error) {
+	// The job hands its message to the request while it is still waiting,
+	// after that it delivers the message itself.
+	var mu sync.Mutex
+	waiting := true
+	result := make(chan string, 1)
+	_, err = jm.Start("", func(j *jobs.Job) (interface{}, error) {
+		msg := work()
+		mu.Lock()
+		defer mu.Unlock()
+		if waiting {
+			result <- msg
+			return nil, nil
+		}
+		return nil, late(msg)
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	select {
+	case msg := <-result:
+		return msg, false, nil
+	case <-time.After(chatDeadline):
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	select {
+	case msg := <-result:
+		return msg, false, nil
+	default:
+		waiting = false
+		return "", true, nil
+	}
+}
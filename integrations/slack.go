@@ -0,0 +1,153 @@
+// Package integrations answers recommendation requests made from chat
+// services, using the same service as the web pages.
+package integrations
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// slackMaxAge is the oldest Slack request accepted, older ones may be
+// replayed.
+const slackMaxAge = 5 * time.Minute
+
+const slackFailed = "Unable to get collection information, please try again later."
+
+// slackResponseURL is where Slack's response URLs live, results are never
+// posted anywhere else.
+const slackResponseURL = "https://hooks.slack.com/"
+
+const slackUsage = "Usage: `/boardgame recs <bgg name> <number of players> [mood]`"
+
+// slackReply is the JSON answer to a slash command.
+type slackReply struct {
+	ResponseType string `json:"response_type"` // "in_channel" or "ephemeral"
+	Text         string `json:"text"`
+}
+
+// Slack answers Slack slash commands, such as "/boardgame recs cpt_lemons 5",
+// with the best and recommended games of the collection. Cached collections
+// are answered straight away; cold ones are loaded as a job and the result
+// posted to the command's response URL. Requests are verified with
+// signingSecret, the handler is not found when it is empty.
+func Slack(svc *service.Service, jm *jobs.Manager, signingSecret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if signingSecret == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "unable to read request", http.StatusBadRequest)
+			return
+		}
+		if !verifySlack(r.Header, body, signingSecret, time.Now()) {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("bad form values %s", err), http.StatusBadRequest)
+			return
+		}
+
+		req, err := parseSlackCommand(form.Get("text"))
+		if err != nil {
+			slackAnswer(w, slackReply{ResponseType: "ephemeral", Text: err.Error()})
+			return
+		}
+		responseURL := form.Get("response_url")
+
+		msg, deferred, err := runOrDefer(jm, func() string {
+			c, err := svc.Recommend(context.Background(), req)
+			if err != nil {
+				log.Printf("%s", err)
+				return slackFailed
+			}
+			return service.SlackMessage(c, service.SlackLimit)
+		}, func(msg string) error {
+			if !strings.HasPrefix(responseURL, slackResponseURL) {
+				return fmt.Errorf("bad slack response url %q", responseURL)
+			}
+			return svc.PostSlack(context.Background(), responseURL, msg)
+		})
+		switch {
+		case err != nil:
+			http.Error(w, "unable to start collection job", http.StatusInternalServerError)
+			log.Printf("%s", err)
+		case deferred:
+			slackAnswer(w, slackReply{
+				ResponseType: "ephemeral",
+				Text:         fmt.Sprintf("Fetching %s's collection from BGG, the picks will be posted here shortly :hourglass:", req.BGGName),
+			})
+		case msg == slackFailed:
+			slackAnswer(w, slackReply{ResponseType: "ephemeral", Text: msg})
+		default:
+			slackAnswer(w, slackReply{ResponseType: "in_channel", Text: msg})
+		}
+	}
+}
+
+// parseSlackCommand reads the text of a "recs <bgg name> <players> [mood]"
+// command.
+func parseSlackCommand(text string) (service.CollectionRequest, error) {
+	fields := strings.Fields(text)
+	if len(fields) < 3 || len(fields) > 4 || fields[0] != "recs" {
+		return service.CollectionRequest{}, errors.New(slackUsage)
+	}
+	numPlayers, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return service.CollectionRequest{}, fmt.Errorf("bad number of players %q. %s", fields[2], slackUsage)
+	}
+	req := service.CollectionRequest{BGGName: fields[1], NumPlayers: numPlayers}
+	if len(fields) == 4 {
+		req.Mood = fields[3]
+	}
+	if err := req.Validate(); err != nil {
+		return service.CollectionRequest{}, err
+	}
+	return req, nil
+}
+
+// verifySlack checks the signature Slack puts on every request, an HMAC of
+// the timestamp and body keyed by the app's signing secret.
+func verifySlack(h http.Header, body []byte, secret string, now time.Time) bool {
+	ts := h.Get("X-Slack-Request-Timestamp")
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := now.Sub(time.Unix(sec, 0)); age > slackMaxAge || age < -slackMaxAge {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+	want := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(want), []byte(h.Get("X-Slack-Signature")))
+}
+
+func slackAnswer(w http.ResponseWriter, reply slackReply) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(reply); err != nil {
+		log.Printf("Error encoding slack reply: %s", err)
+	}
+}
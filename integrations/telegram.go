@@ -0,0 +1,349 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/moods"
+	"github.com/mattkoler/board_game_helper/service"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// telegramAPI is the base URL of Telegram's Bot API.
+const telegramAPI = "https://api.telegram.org"
+
+// telegramClient calls the Bot API.
+var telegramClient = &http.Client{Timeout: 10 * time.Second}
+
+// telegramLinkKind is the store kind of the BGG names Telegram users have
+// linked, keyed by their Telegram user ID.
+const telegramLinkKind = "TelegramLink"
+
+const telegramFailed = "Unable to get collection information, please try again later"
+
+// telegramResults is the most results an inline query may be answered with.
+const telegramResults = 50
+
+const telegramHelp = "I suggest games from BoardGameGeek collections.\n\n" +
+	"Send /link <bgg name> to link your collection, then type my name and a number of players in any chat, such as \"4 players\" or \"3 chill\". " +
+	"Put a BGG name first to see someone else's collection."
+
+// telegramLink is a Telegram user's linked BGG name.
+type telegramLink struct {
+	UserID  int64
+	BGGName string
+	Linked  time.Time
+}
+
+// Telegram is the Telegram bot. It answers inline queries, such as
+// "@bot 4 players", from the cache only, since Telegram shows nothing if the
+// answer is slow. Collections that aren't cached yet are loaded as a job for
+// the next query.
+type Telegram struct {
+	svc    *service.Service
+	jm     *jobs.Manager
+	st     *store.Store
+	token  string
+	secret string // sent by Telegram with every update
+
+	mu      sync.Mutex
+	warming map[string]bool // collections being loaded, by lower case BGG name
+}
+
+// NewTelegram returns the bot using token to call the Bot API, accepting
+// updates carrying secret.
+func NewTelegram(svc *service.Service, jm *jobs.Manager, st *store.Store, token, secret string) *Telegram {
+	return &Telegram{svc: svc, jm: jm, st: st, token: token, secret: secret, warming: make(map[string]bool)}
+}
+
+// SetWebhook has Telegram send the bot's messages and inline queries to url.
+func (t *Telegram) SetWebhook(ctx context.Context, url string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"url":             url,
+		"secret_token":    t.secret,
+		"allowed_updates": []string{"message", "inline_query"},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/bot%s/setWebhook", telegramAPI, t.token), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := telegramClient.Do(req)
+	if err != nil {
+		// The error holds the URL, and so the token.
+		return errors.New("error calling telegram")
+	}
+	defer resp.Body.Close()
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("Bad response setting telegram webhook: %s", resp.Status)
+	}
+	if !result.OK {
+		return fmt.Errorf("Unable to set telegram webhook: %s", result.Description)
+	}
+	return nil
+}
+
+type telegramUpdate struct {
+	Message *struct {
+		Chat struct {
+			ID   int64  `json:"id"`
+			Type string `json:"type"`
+		} `json:"chat"`
+		From *struct {
+			ID int64 `json:"id"`
+		} `json:"from"`
+		Text string `json:"text"`
+	} `json:"message"`
+	InlineQuery *struct {
+		ID   string `json:"id"`
+		From struct {
+			ID int64 `json:"id"`
+		} `json:"from"`
+		Query string `json:"query"`
+	} `json:"inline_query"`
+}
+
+// telegramText is the content of a message sent by picking an inline result.
+type telegramText struct {
+	MessageText string `json:"message_text"`
+	ParseMode   string `json:"parse_mode"`
+}
+
+type telegramArticle struct {
+	Type        string       `json:"type"`
+	ID          string       `json:"id"`
+	Title       string       `json:"title"`
+	Description string       `json:"description,omitempty"`
+	URL         string       `json:"url,omitempty"`
+	Content     telegramText `json:"input_message_content"`
+}
+
+// telegramButton is shown above the results of an inline query, tapping it
+// opens a private chat with the bot sending "/start <StartParameter>".
+type telegramButton struct {
+	Text           string `json:"text"`
+	StartParameter string `json:"start_parameter"`
+}
+
+// telegramAnswer answers an inline query as the webhook's response, so no
+// separate API call is needed.
+type telegramAnswer struct {
+	Method        string            `json:"method"`
+	InlineQueryID string            `json:"inline_query_id"`
+	Results       []telegramArticle `json:"results"`
+	CacheTime     int               `json:"cache_time"`
+	IsPersonal    bool              `json:"is_personal"`
+	Button        *telegramButton   `json:"button,omitempty"`
+}
+
+// telegramReply sends a message to a chat as the webhook's response.
+type telegramReply struct {
+	Method string `json:"method"`
+	ChatID int64  `json:"chat_id"`
+	Text   string `json:"text"`
+}
+
+// Handler serves the bot's webhook, only accepting updates carrying the
+// bot's secret.
+func (t *Telegram) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Telegram-Bot-Api-Secret-Token")), []byte(t.secret)) != 1 {
+			http.Error(w, "bad secret token", http.StatusUnauthorized)
+			return
+		}
+		var u telegramUpdate
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&u); err != nil {
+			http.Error(w, "bad update", http.StatusBadRequest)
+			return
+		}
+
+		switch {
+		case u.InlineQuery != nil:
+			answer := t.inline(u.InlineQuery.From.ID, u.InlineQuery.Query)
+			answer.InlineQueryID = u.InlineQuery.ID
+			telegramRespond(w, answer)
+		case u.Message != nil && u.Message.From != nil && u.Message.Chat.Type == "private":
+			telegramRespond(w, telegramReply{
+				Method: "sendMessage",
+				ChatID: u.Message.Chat.ID,
+				Text:   t.command(u.Message.From.ID, u.Message.Text),
+			})
+		default:
+			// Updates the bot doesn't answer, such as messages in groups.
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
+
+// command answers a message sent to the bot in a private chat.
+func (t *Telegram) command(userID int64, text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || fields[0] != "/link" {
+		return telegramHelp
+	}
+	if len(fields) != 2 {
+		return "Usage: /link <bgg name>"
+	}
+	bggName := fields[1]
+	if len(bggName) < 4 || len(bggName) > 20 {
+		return "bad bgg name, please provide a name between 4-20 characters"
+	}
+	key := strconv.FormatInt(userID, 10)
+	if err := t.st.Put(telegramLinkKind, key, &telegramLink{UserID: userID, BGGName: bggName, Linked: time.Now()}); err != nil {
+		log.Printf("%s", err)
+		return "Unable to link your collection, please try again later."
+	}
+	// Start loading the collection so the first inline query has picks.
+	t.warm(service.CollectionRequest{BGGName: bggName, NumPlayers: 1})
+	return fmt.Sprintf("Linked to %s's collection. Type my name and a number of players in any chat to get picks.", bggName)
+}
+
+// inline answers an inline query of "[bgg name] <players> [mood]", using the
+// user's linked BGG name if the query has none.
+func (t *Telegram) inline(userID int64, query string) telegramAnswer {
+	answer := telegramAnswer{Method: "answerInlineQuery", Results: []telegramArticle{}, IsPersonal: true}
+	hint := func(text, param string) telegramAnswer {
+		answer.Button = &telegramButton{Text: text, StartParameter: param}
+		return answer
+	}
+
+	req, err := parseTelegramQuery(query)
+	if err != nil {
+		return hint(err.Error(), "help")
+	}
+	if req.BGGName == "" {
+		var link telegramLink
+		switch err := t.st.Get(telegramLinkKind, strconv.FormatInt(userID, 10), &link); err {
+		case nil:
+			req.BGGName = link.BGGName
+		case store.ErrNotFound:
+			return hint("Link your BGG collection first", "link")
+		default:
+			log.Printf("%s", err)
+			return hint(telegramFailed, "help")
+		}
+	}
+	if err := req.Validate(); err != nil {
+		return hint(err.Error(), "help")
+	}
+
+	c, ok, err := t.svc.RecommendCached(req)
+	if err != nil {
+		log.Printf("%s", err)
+		return hint(telegramFailed, "help")
+	}
+	if !ok {
+		t.warm(req)
+		return hint(fmt.Sprintf("Loading %s's collection from BGG, try again shortly", req.BGGName), "help")
+	}
+
+	summary := fmt.Sprintf("%d best or recommended", len(c.Games))
+	if c.Deferred > 0 {
+		summary += fmt.Sprintf(", %d games still loading", c.Deferred)
+	}
+	answer.CacheTime = 60
+	answer.Results = append(answer.Results, telegramArticle{
+		Type:        "article",
+		ID:          "all",
+		Title:       fmt.Sprintf("Picks for %d players from %s's collection", req.NumPlayers, req.BGGName),
+		Description: summary,
+		Content:     telegramText{MessageText: service.TelegramMessage(c, service.TelegramLimit), ParseMode: "HTML"},
+	})
+	for _, g := range c.Games {
+		if len(answer.Results) == telegramResults {
+			break
+		}
+		vote := "Recommended"
+		if g.Best {
+			vote = "Best"
+		}
+		answer.Results = append(answer.Results, telegramArticle{
+			Type:        "article",
+			ID:          g.ID,
+			Title:       g.Name,
+			Description: fmt.Sprintf("%s at %d · %d-%d players · weight %.1f", vote, req.NumPlayers, g.MinPlayers, g.MaxPlayers, g.Weight),
+			URL:         "https://boardgamegeek.com/boardgame/" + g.ID,
+			Content:     telegramText{MessageText: service.TelegramPickMessage(g), ParseMode: "HTML"},
+		})
+	}
+	return answer
+}
+
+// parseTelegramQuery reads an inline query such as "4 players",
+// "cpt_lemons 3 chill" or "5p". The BGG name is left empty if not given.
+func parseTelegramQuery(query string) (service.CollectionRequest, error) {
+	var req service.CollectionRequest
+	for _, f := range strings.Fields(strings.ToLower(query)) {
+		if n, err := strconv.Atoi(strings.TrimSuffix(f, "p")); err == nil {
+			req.NumPlayers = n
+			continue
+		}
+		switch {
+		case f == "player" || f == "players" || f == "people":
+		case moods.Valid(f):
+			req.Mood = f
+		case req.BGGName == "":
+			req.BGGName = f
+		default:
+			return req, errors.New(`Try "4 players" or "<bgg name> 4 players"`)
+		}
+	}
+	if req.NumPlayers == 0 {
+		return req, errors.New(`Type a number of players, such as "4 players"`)
+	}
+	return req, nil
+}
+
+// warm loads req's collection as a job, unless it is already loading, so
+// later inline queries can be answered from the cache.
+func (t *Telegram) warm(req service.CollectionRequest) {
+	key := strings.ToLower(req.BGGName)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.warming[key] {
+		return
+	}
+	_, err := t.jm.Start("", func(*jobs.Job) (interface{}, error) {
+		defer func() {
+			t.mu.Lock()
+			delete(t.warming, key)
+			t.mu.Unlock()
+		}()
+		_, err := t.svc.LoadCollection(context.Background(), req, nil)
+		return nil, err
+	})
+	if err != nil {
+		log.Printf("%s", err)
+		return
+	}
+	t.warming[key] = true
+}
+
+func telegramRespond(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding telegram response: %s", err)
+	}
+}
@@ -0,0 +1,177 @@
+package jobs
+
+import (
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/websocket"
+)
+
+// WantsJSON reports whether the client asked for a JSON response rather
+// than a page.
+func WantsJSON(r *http.Request) bool {
+	return r.FormValue("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// Accepted answers the request that started j, with the job ID for JSON
+// clients or a redirect to the job page for browsers.
+func Accepted(w http.ResponseWriter, r *http.Request, j *Job) {
+	if WantsJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/jobs/"+j.ID)
+		w.WriteHeader(http.StatusAccepted)
+		if err := json.NewEncoder(w).Encode(j.Progress()); err != nil {
+			log.Printf("Error encoding job: %s", err)
+		}
+		return
+	}
+	http.Redirect(w, r, "/jobs/"+j.ID, http.StatusSeeOther)
+}
+
+// Status is the job status page function, serving /jobs/{id}. Unfinished
+// jobs show their progress, finished jobs are rendered with their result
+// template.
+func Status(tpl *template.Template, m *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		j, ok := m.Get(strings.TrimPrefix(r.URL.Path, "/jobs/"))
+		if !ok {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		p := j.Progress()
+
+		if WantsJSON(r) {
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(p); err != nil {
+				log.Printf("Error encoding job: %s", err)
+			}
+			return
+		}
+
+		name := "job.html"
+		var data interface{} = p
+		if p.Status == Done && p.Template != "" {
+			name, data = p.Template, p.Result
+		}
+		if err := tpl.ExecuteTemplate(w, name, data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
+
+// Socket serves /ws/jobs/{id}, pushing an event over a WebSocket each time
+// the job advances so pages can show live progress without polling. The
+// last event carries the finished state, after which the socket is closed.
+func Socket(m *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		j, ok := m.Get(strings.TrimPrefix(r.URL.Path, "/ws/jobs/"))
+		if !ok {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			log.Printf("%s", err)
+			return
+		}
+		defer conn.Close()
+
+		events, cancel := j.Subscribe()
+		defer cancel()
+
+		// The client never sends anything useful, but reading notices when
+		// it goes away.
+		gone := make(chan struct{})
+		go func() {
+			defer close(gone)
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+
+		send := func(p Progress) bool {
+			p.Result = nil
+			if err := conn.WriteJSON(Event{Progress: p}); err != nil {
+				log.Printf("%s", err)
+				return false
+			}
+			return true
+		}
+		if p := j.Progress(); !send(p) || p.Finished() {
+			return
+		}
+		for {
+			select {
+			case e, ok := <-events:
+				if !ok {
+					send(j.Progress())
+					return
+				}
+				if err := conn.WriteJSON(e); err != nil {
+					log.Printf("%s", err)
+					return
+				}
+			case <-gone:
+				return
+			}
+		}
+	}
+}
+
+// pollTimeout is how long a long-poll request waits for the job to change.
+// It stays under the idle timeouts of common proxies.
+const pollTimeout = 25 * time.Second
+
+// Poll serves /poll/jobs/{id}, a long-poll fallback for clients that can't
+// use the WebSocket. Responses carry the job's version as an ETag. A request
+// whose If-None-Match header, or since form value, names the current version
+// waits until the job changes and gets 304 Not Modified if it doesn't within
+// pollTimeout. Otherwise the progress is returned straight away.
+func Poll(m *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		j, ok := m.Get(strings.TrimPrefix(r.URL.Path, "/poll/jobs/"))
+		if !ok {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		since := r.FormValue("since")
+		if inm := r.Header.Get("If-None-Match"); inm != "" {
+			since = strings.Trim(strings.TrimPrefix(inm, "W/"), `"`)
+		}
+
+		version, changed := j.Changes()
+		if since == strconv.FormatInt(version, 10) && !j.Progress().Finished() {
+			select {
+			case <-changed:
+				version, _ = j.Changes()
+			case <-time.After(pollTimeout):
+				w.Header().Set("ETag", etag(version))
+				w.WriteHeader(http.StatusNotModified)
+				return
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		p := j.Progress()
+		p.Result = nil // the result is rendered by the job page
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("ETag", etag(version))
+		if err := json.NewEncoder(w).Encode(p); err != nil {
+			log.Printf("Error encoding job: %s", err)
+		}
+	}
+}
+
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
@@ -0,0 +1,288 @@
+// Package jobs runs long requests, such as loading a whole collection, in the
+// background and tracks their progress so clients can poll for the result.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// State is the lifecycle state of a job.
+type State string
+
+// The job states.
+const (
+	Queued  State = "queued"
+	Running State = "running"
+	Done    State = "done"
+	Failed  State = "failed"
+)
+
+// keep is how long finished jobs are kept for clients to collect.
+const keep = time.Hour
+
+// Job is a single unit of background work.
+type Job struct {
+	ID       string
+	Template string // template rendering the result for HTML clients
+	Created  time.Time
+
+	mu       sync.Mutex
+	status   State
+	done     int
+	total    int
+	result   interface{}
+	err      error
+	finished time.Time
+	subs     map[chan Event]struct{}
+	version  int64         // bumped on every change
+	changed  chan struct{} // closed on the next change, nil until someone waits
+}
+
+// Progress is a point in time snapshot of a job.
+type Progress struct {
+	ID       string      `json:"id"`
+	Status   State       `json:"status"`
+	Done     int         `json:"done"`
+	Total    int         `json:"total"`
+	Error    string      `json:"error,omitempty"`
+	Result   interface{} `json:"result,omitempty"`
+	Template string      `json:"-"`
+}
+
+// Finished reports whether the job has completed, successfully or not.
+func (p Progress) Finished() bool {
+	return p.Status == Done || p.Status == Failed
+}
+
+// Percent is how far along the job is, from 0 to 100.
+func (p Progress) Percent() int {
+	if p.Total == 0 {
+		return 0
+	}
+	return 100 * p.Done / p.Total
+}
+
+// Event is sent to subscribers each time a job changes. Item names the step
+// that just finished, if any.
+type Event struct {
+	Progress
+	Item string `json:"item,omitempty"`
+}
+
+// SetTotal sets the number of steps the job will take.
+func (j *Job) SetTotal(total int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.total = total
+	j.publish("")
+}
+
+// Advance marks one more step of the job as done. item names the step, such
+// as the game that just loaded, and may be empty.
+func (j *Job) Advance(item string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.done++
+	j.publish(item)
+}
+
+// Subscribe returns a channel of the job's events. The channel is closed
+// once the job finishes, or when cancel is called. Events are dropped if the
+// subscriber falls behind, so the final state should be read from Progress.
+func (j *Job) Subscribe() (events <-chan Event, cancel func()) {
+	ch := make(chan Event, 64)
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.finished.IsZero() {
+		close(ch)
+		return ch, func() {}
+	}
+	if j.subs == nil {
+		j.subs = make(map[chan Event]struct{})
+	}
+	j.subs[ch] = struct{}{}
+	return ch, func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if _, ok := j.subs[ch]; ok {
+			delete(j.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Changes returns the job's current version and a channel closed when the
+// job next changes.
+func (j *Job) Changes() (version int64, changed <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.changed == nil {
+		j.changed = make(chan struct{})
+	}
+	return j.version, j.changed
+}
+
+// publish records a change and sends the current state to subscribers, the
+// caller must hold j.mu.
+func (j *Job) publish(item string) {
+	j.version++
+	if j.changed != nil {
+		close(j.changed)
+		j.changed = nil
+	}
+	if len(j.subs) == 0 {
+		return
+	}
+	e := Event{Progress: j.progress(), Item: item}
+	e.Result = nil // subscribers fetch the result from the job page
+	for ch := range j.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// Progress returns a snapshot of the job.
+func (j *Job) Progress() Progress {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.progress()
+}
+
+func (j *Job) progress() Progress {
+	p := Progress{
+		ID:       j.ID,
+		Status:   j.status,
+		Done:     j.done,
+		Total:    j.total,
+		Template: j.Template,
+	}
+	if j.status == Done {
+		p.Result = j.result
+	}
+	if j.err != nil {
+		p.Error = j.err.Error()
+	}
+	return p
+}
+
+func (j *Job) setStatus(status State) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.status = status
+	j.publish("")
+}
+
+func (j *Job) finish(result interface{}, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.result, j.err = result, err
+	j.status = Done
+	if err != nil {
+		j.status = Failed
+	}
+	j.finished = time.Now()
+	j.publish("")
+	for ch := range j.subs {
+		close(ch)
+	}
+	j.subs = nil
+}
+
+func (j *Job) expired(now time.Time) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return !j.finished.IsZero() && now.Sub(j.finished) > keep
+}
+
+// Func is the work of a job. It reports progress through j and returns the
+// job's result.
+type Func func(j *Job) (interface{}, error)
+
+// Manager runs jobs on a bounded number of workers.
+type Manager struct {
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	slots   chan struct{}
+	running sync.WaitGroup
+}
+
+// NewManager returns a Manager running at most workers jobs at once.
+func NewManager(workers int) *Manager {
+	return &Manager{
+		jobs:  make(map[string]*Job),
+		slots: make(chan struct{}, workers),
+	}
+}
+
+// Start queues fn and returns its job immediately.
+func (m *Manager) Start(template string, fn Func) (*Job, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return nil, fmt.Errorf("unable to generate job id: %s", err)
+	}
+	j := &Job{
+		ID:       hex.EncodeToString(b),
+		Template: template,
+		Created:  time.Now(),
+		status:   Queued,
+	}
+
+	m.mu.Lock()
+	m.evict(j.Created)
+	m.jobs[j.ID] = j
+	m.mu.Unlock()
+
+	m.running.Add(1)
+	go func() {
+		defer m.running.Done()
+		m.slots <- struct{}{}
+		defer func() { <-m.slots }()
+		j.setStatus(Running)
+		result, err := fn(j)
+		if err != nil {
+			log.Printf("job %s failed: %s", j.ID, err)
+		}
+		j.finish(result, err)
+	}()
+	return j, nil
+}
+
+// Wait blocks until every started job has finished, or ctx is done.
+func (m *Manager) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Get returns the job with the given ID.
+func (m *Manager) Get(id string) (*Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j, ok := m.jobs[id]
+	return j, ok
+}
+
+// evict drops jobs that finished too long ago, the caller must hold m.mu.
+func (m *Manager) evict(now time.Time) {
+	for id, j := range m.jobs {
+		if j.expired(now) {
+			delete(m.jobs, id)
+		}
+	}
+}
@@ -1,29 +1,401 @@
 package main
 
 import (
+	"context"
+	"expvar"
+	"flag"
+	"fmt"
 	"html/template"
+	"io/fs"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/mattkoler/board_game_helper/admin"
+	"github.com/mattkoler/board_game_helper/analytics"
+	"github.com/mattkoler/board_game_helper/apiv1"
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/branding"
+	"github.com/mattkoler/board_game_helper/calendar"
 	"github.com/mattkoler/board_game_helper/collection"
+	"github.com/mattkoler/board_game_helper/config"
+	"github.com/mattkoler/board_game_helper/debug"
+	"github.com/mattkoler/board_game_helper/family"
+	"github.com/mattkoler/board_game_helper/gamefmt"
+	"github.com/mattkoler/board_game_helper/integrations"
+	"github.com/mattkoler/board_game_helper/jobs"
+	"github.com/mattkoler/board_game_helper/middleware"
+	"github.com/mattkoler/board_game_helper/moods"
+	"github.com/mattkoler/board_game_helper/notes"
+	"github.com/mattkoler/board_game_helper/notify"
+	"github.com/mattkoler/board_game_helper/picks"
+	"github.com/mattkoler/board_game_helper/queue"
+	"github.com/mattkoler/board_game_helper/resources"
+	"github.com/mattkoler/board_game_helper/respcache"
+	"github.com/mattkoler/board_game_helper/selfcheck"
+	"github.com/mattkoler/board_game_helper/service"
+	"github.com/mattkoler/board_game_helper/session"
+	"github.com/mattkoler/board_game_helper/sitemap"
+	"github.com/mattkoler/board_game_helper/sleeves"
+	"github.com/mattkoler/board_game_helper/store"
+	"github.com/mattkoler/board_game_helper/syncapi"
+	"github.com/mattkoler/board_game_helper/timer"
+	"github.com/mattkoler/board_game_helper/trash"
 )
 
 func main() {
-	tpl, err := template.ParseGlob("resources/*.html")
-	if err != nil {
-		log.Fatalf("unable to parse html resources: %s", err)
+	// Everything the site needs is checked up front and reported together.
+	var (
+		cfg    *config.Config
+		tpl    *template.Template
+		static fs.FS
+		st     *store.Store
+		client *bgg.Client
+	)
+	checks := []selfcheck.Check{{
+		Name: "config",
+		Fix:  "correct the setting named above, run with -h to list the settings and their environment variables",
+		Run: func(context.Context) (string, error) {
+			var err error
+			if cfg, err = config.Load(os.Args[1:], os.Getenv); err == flag.ErrHelp {
+				os.Exit(0) // the settings were listed
+			} else if err != nil {
+				return "", err
+			}
+			return "port " + cfg.Port, nil
+		},
+	}, {
+		Name: "templates",
+		Fix:  "check site_accent is a CSS color, and the templates in template_dir and template_override_dir parse",
+		Run: func(context.Context) (string, error) {
+			brand, err := branding.New(cfg.SiteName, cfg.SiteLogo, cfg.SiteAccent)
+			if err != nil {
+				return "", err
+			}
+			// The embedded resources can be swapped for a directory, so
+			// templates can be edited without rebuilding.
+			var res fs.FS = resources.FS
+			from := "embedded"
+			if cfg.TemplateDir != "" {
+				res, from = os.DirFS(cfg.TemplateDir), cfg.TemplateDir
+			}
+			if static, err = fs.Sub(res, "static"); err != nil {
+				return "", fmt.Errorf("unable to open static files: %s", err)
+			}
+			if tpl, err = template.New("").Funcs(brand.Funcs()).Funcs(gamefmt.Funcs()).ParseFS(res, "*.html"); err != nil {
+				return "", fmt.Errorf("unable to parse html resources: %s", err)
+			}
+			if tpl, err = branding.Override(tpl, cfg.TemplateOverrideDir); err != nil {
+				return "", fmt.Errorf("unable to parse template overrides: %s", err)
+			}
+			return fmt.Sprintf("%d templates, %s", len(tpl.Templates()), from), nil
+		},
+	}, {
+		Name: "store",
+		Fix:  "check store_path names a store file in a directory the site can write, or leave it empty to keep data in memory",
+		Run: func(context.Context) (string, error) {
+			var err error
+			if st, err = store.Open(cfg.StorePath); err != nil {
+				return "", err
+			}
+			if err := st.Check(); err != nil {
+				return "", err
+			}
+			if cfg.StorePath == "" {
+				return "memory only", nil
+			}
+			return cfg.StorePath, nil
+		},
+	}, {
+		Name: "bgg",
+		Fix:  "check bgg_base_url and that the site can make outbound requests, set fallback_source to run while BGG is unreachable",
+		Run: func(ctx context.Context) (string, error) {
+			hc := &http.Client{Timeout: cfg.BGGTimeout}
+			var err error
+			if client, err = bgg.NewClient(hc, cfg.BGGBaseURL, cfg.BGGToken, cfg.BGGConcurrency); err != nil {
+				return "", err
+			}
+			client.SetBreaker(cfg.BreakerFailures, cfg.BreakerCooldown)
+			client.SetRate(cfg.BGGRate)
+			if cfg.FallbackSource != "" {
+				fallback, err := bgg.OpenSource(hc, cfg.FallbackSource, cfg.BGGConcurrency)
+				if err != nil {
+					return "", fmt.Errorf("unable to open fallback source: %s", err)
+				}
+				client.SetFallback(fallback)
+			}
+			if _, err := client.Hot(ctx); err != nil {
+				if cfg.FallbackSource != "" {
+					return "", selfcheck.Warning(fmt.Errorf("%s, using the fallback source", err))
+				}
+				return "", err
+			}
+			return cfg.BGGBaseURL + " reachable", nil
+		},
+	}, {
+		Name: "cache",
+		Fix:  "check cache_path names a cache file saved by this site, or delete it to start with a cold cache",
+		Run: func(context.Context) (string, error) {
+			if cfg.CachePath == "" {
+				return "off", nil
+			}
+			things, owned, err := client.LoadCache(cfg.CachePath)
+			if err != nil {
+				return "", selfcheck.Warning(err)
+			}
+			return fmt.Sprintf("%d games and %d collections from %s", things, owned, cfg.CachePath), nil
+		},
+	}}
+	if !selfcheck.Run(context.Background(), os.Stderr, checks) {
+		os.Exit(1)
+	}
+	if !client.Authenticated() {
+		log.Printf("no BGG API token set, wishlist writes and play logging are disabled")
 	}
+	q := queue.NewStoreQueue(st)
+	svc := service.New(cfg, client, st, q)
+	jm := jobs.NewManager(cfg.JobWorkers)
 
-	http.HandleFunc("/", collection.Home(tpl))
-	http.HandleFunc("/collection", collection.Collection(tpl, http.DefaultClient))
+	// Background loops run until ctx is cancelled at shutdown.
+	ctx, stopBackground := context.WithCancel(context.Background())
+	var background sync.WaitGroup
+	runBackground := func(loop func(ctx context.Context)) {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			loop(ctx)
+		}()
+	}
+	fetcher := &queue.Worker{Q: q, Queue: service.GameFetchQueue, Handler: svc.FetchGameTask, Poll: 2 * time.Second}
+	runBackground(fetcher.Run)
+	stats := &queue.Worker{Q: q, Queue: service.StatsQueue, Handler: svc.StatsTask, Poll: 2 * time.Second}
+	runBackground(stats.Run)
+	playSync := &queue.Worker{Q: q, Queue: service.PlaysQueue, Handler: svc.PlaysTask, Poll: 2 * time.Second}
+	runBackground(playSync.Run)
+	pricer := &queue.Worker{Q: q, Queue: service.PriceQueue, Handler: svc.PriceTask, Poll: 2 * time.Second}
+	runBackground(pricer.Run)
+	boxer := &queue.Worker{Q: q, Queue: service.BoxQueue, Handler: svc.BoxTask, Poll: 2 * time.Second}
+	runBackground(boxer.Run)
+	runBackground(func(ctx context.Context) { trash.PurgeEvery(ctx, st, 24*time.Hour) })
+	runBackground(func(ctx context.Context) { svc.RefreshEvery(ctx, cfg.RefreshInterval) })
+	runBackground(func(ctx context.Context) { svc.DiscoverEvery(ctx, 24*time.Hour) })
+	mailer := notify.New(cfg.SMTPAddr, cfg.SMTPUser, cfg.SMTPPassword, cfg.SMTPFrom, cfg.SiteURL, tpl)
+	runBackground(func(ctx context.Context) { notify.DigestEvery(ctx, st, svc, mailer, time.Hour) })
+	runBackground(func(ctx context.Context) { notify.NudgeLoansEvery(ctx, svc, mailer, time.Hour) })
 
-	port := os.Getenv("PORT")
+	// Pages calling BGG are rate limited per client, so one client can't get
+	// the site banned by BGG.
+	limiter := middleware.NewRateLimiter(cfg.RateLimit, cfg.RateBurst, cfg.TrustProxy)
+	limit := limiter.Limit
+	// Routes answering JSON can be called from the allowed origins, with an
+	// API key when keys are configured.
+	cors := middleware.CORS(strings.Split(cfg.CORSOrigins, ","), cfg.CORSMethods, cfg.CORSMaxAge)
+	apiKeys := strings.Split(cfg.APIKeys, ",")
+	keys := middleware.APIKeys(apiKeys)
+	api := func(h http.Handler) http.Handler { return middleware.Chain(h, cors, keys) }
+	// Exports proxy a whole collection from BGG, so they always need a key.
+	exportKeys := middleware.RequireAPIKeys(apiKeys)
+	// Stats and browse pages are reused until the data behind them changes.
+	pages := respcache.New(st, cfg.PageCacheTTL)
+	sessions := session.New(st)
+	access, err := admin.New(cfg.AdminToken, cfg.AdminRoleTokens)
+	if err != nil {
+		log.Fatalf("unable to load admin roles: %s", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", collection.Home(tpl, sessions, mailer, apiKeys))
+	mux.HandleFunc("/session/forget", sessions.Forget())
+	mux.Handle("/collection", api(limit(collection.Collection(tpl, svc, jm, sessions, mailer, apiKeys))))
+	mux.Handle("/collection/export", api(limit(collection.Export(tpl, svc, cfg.DiscordWebhook))))
+	mux.Handle("/export/data", middleware.Chain(limit(collection.StartDataExport(svc, jm)), cors, exportKeys))
+	mux.Handle("/export/data/", exportKeys(collection.DownloadDataExport(jm)))
+	mux.Handle("/jobs/", api(jobs.Status(tpl, jm)))
+	mux.HandleFunc("/ws/jobs/", jobs.Socket(jm))
+	mux.Handle("/poll/jobs/", api(jobs.Poll(jm)))
+	mux.Handle("/api/v1/sync", api(syncapi.Handler(st)))
+	mux.Handle("/api/v1/", api(limit(apiv1.Handler(svc, jm, apiKeys))))
+	mux.Handle("/u/", api(limit(collection.Public(tpl, svc))))
+	mux.Handle("/history", api(collection.History(tpl, svc)))
+	mux.Handle("/value", api(limit(collection.Value(tpl, svc))))
+	mux.Handle("/cull", api(limit(collection.Cull(tpl, svc))))
+	mux.Handle("/trade", api(limit(collection.Trade(tpl, svc))))
+	mux.Handle("/wishlist", api(limit(collection.Wishlist(tpl, svc))))
+	mux.Handle("/similar/", api(limit(collection.Similar(tpl, svc))))
+	mux.Handle("/discover", api(limit(collection.Discover(tpl, svc))))
+	mux.Handle("/top", api(limit(collection.Top(tpl, svc))))
+	mux.Handle("/newtoyou", api(limit(collection.NewToYou(tpl, svc))))
+	mux.Handle("/challenge", limit(collection.Challenge(tpl, svc)))
+	mux.HandleFunc("/public", collection.SetPublic(svc))
+	mux.Handle("/share", limit(collection.Share(svc)))
+	mux.Handle("/r/", api(collection.Shared(tpl, svc)))
+	mux.Handle("/events", limit(collection.NewEvent(tpl, svc, mailer, apiKeys)))
+	mux.Handle("/events/", api(calendar.Events(limit(collection.Event(tpl, svc)), svc, cfg.SiteURL)))
+	mux.HandleFunc("/calendar.ics", calendar.Feed(svc, cfg.SiteURL))
+	mux.Handle("/digest", limit(notify.Digests(tpl, st, mailer, apiKeys)))
+	mux.Handle("/events/vote/", limit(collection.Vote(tpl, svc)))
+	mux.HandleFunc("/integrations/slack", integrations.Slack(svc, jm, cfg.SlackSigningSecret))
+	if cfg.DiscordBotToken != "" {
+		bot, err := integrations.NewDiscord(svc, jm, cfg.DiscordAppID, cfg.DiscordBotToken, cfg.DiscordPublicKey)
+		if err != nil {
+			log.Fatalf("unable to create discord bot: %s", err)
+		}
+		runBackground(func(ctx context.Context) {
+			if err := bot.RegisterCommands(ctx); err != nil {
+				log.Printf("warning: unable to register discord commands: %s", err)
+			}
+		})
+		mux.HandleFunc("/integrations/discord", bot.Handler())
+	}
+	if cfg.TelegramBotToken != "" {
+		bot := integrations.NewTelegram(svc, jm, st, cfg.TelegramBotToken, cfg.TelegramSecret)
+		if cfg.SiteURL != "" {
+			runBackground(func(ctx context.Context) {
+				if err := bot.SetWebhook(ctx, strings.TrimSuffix(cfg.SiteURL, "/")+"/integrations/telegram"); err != nil {
+					log.Printf("warning: unable to set telegram webhook: %s", err)
+				}
+			})
+		} else {
+			log.Printf("warning: site_url is empty, set the telegram webhook to /integrations/telegram by hand")
+		}
+		mux.HandleFunc("/integrations/telegram", bot.Handler())
+	}
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.FS(static))))
+	mux.HandleFunc("/sitemap.xml", sitemap.Handler(svc, cfg.SiteURL))
+	mux.HandleFunc("/robots.txt", sitemap.Robots(cfg.SiteURL))
+	mux.Handle("/hot", limit(collection.Hot(tpl, svc)))
+	mux.Handle("/search", limit(collection.Search(tpl, svc)))
+	mux.Handle("/game", limit(collection.Game(tpl, svc)))
+	mux.Handle("/game/refresh", limit(collection.RefreshGame(svc)))
+	mux.HandleFunc("/moods/override", moods.SaveOverride(st))
+	mux.HandleFunc("/family", family.Exclusions(tpl, st))
+	mux.HandleFunc("/family/toggle", family.Toggle())
+	mux.HandleFunc("/family/exclude", family.Exclude(st))
+	mux.HandleFunc("/picks", picks.Page(tpl, st, sessions))
+	mux.HandleFunc("/picks/mark", picks.Mark(st, sessions))
+	mux.HandleFunc("/notes", notes.Notes(tpl, st))
+	mux.Handle("/notes/save", limit(notes.SaveNote(tpl, st)))
+	mux.Handle("/houserules", pages.Page(notes.HouseRules(tpl, st), notes.HouseRuleKind))
+	mux.Handle("/houserules/publish", limit(notes.PublishHouseRule(st)))
+	mux.Handle("/houserules/clone", limit(notes.CloneHouseRule(st)))
+	mux.Handle("/plays/import", limit(collection.ImportBGStats(svc)))
+	mux.Handle("/plays/log", limit(collection.LogPlay(tpl, svc, apiKeys)))
+	mux.Handle("/score", limit(collection.ScoreSheet(tpl, svc, apiKeys)))
+	mux.HandleFunc("/score/sheet", collection.SaveScoreSheet(svc))
+	mux.Handle("/turnorder", api(limit(collection.TurnOrder(tpl, svc))))
+	mux.Handle("/teams", api(limit(collection.Teams(tpl, svc))))
+	tm := timer.NewManager()
+	mux.Handle("/timer/", limit(timer.Page(tpl, tm)))
+	mux.HandleFunc("/ws/timer/", timer.Socket(tm))
+	mux.Handle("/lending", limit(collection.Lending(tpl, svc, mailer, apiKeys)))
+	mux.Handle("/shelves", limit(collection.Shelves(tpl, svc)))
+	mux.Handle("/catalog", api(limit(collection.Catalog(tpl, svc))))
+	mux.Handle("/analytics/seats", pages.Page(analytics.Seats(tpl, st), analytics.AggregateKind))
+	mux.Handle("/leaderboard", pages.Page(analytics.Leaderboard(tpl, st), analytics.AggregateKind))
+	mux.HandleFunc("/trash", trash.Page(tpl, st))
+	mux.HandleFunc("/trash/restore", trash.Restore(st))
+	mux.HandleFunc("/admin/purge", access.Protect(admin.RolePurge, trash.PurgeHandler(st)))
 
-	if port == "" {
-		port = "8080"
-		//log.Fatal("$PORT must be set")
+	// Some settings can change without a restart, which would empty the
+	// caches. The config is reloaded on SIGHUP or by an admin.
+	var reloadMu sync.Mutex
+	live := cfg
+	reload := func() (applied, restart []string, err error) {
+		reloadMu.Lock()
+		defer reloadMu.Unlock()
+		next, err := config.Load(os.Args[1:], os.Getenv)
+		if err != nil {
+			return nil, nil, err
+		}
+		live, applied, restart = config.Reload(live, next)
+		limiter.SetRate(live.RateLimit, live.RateBurst)
+		pages.SetTTL(live.PageCacheTTL)
+		client.SetRate(live.BGGRate)
+		svc.SetConfig(live)
+		return applied, restart, nil
+	}
+	mux.HandleFunc("/admin/reload", access.Protect(admin.RoleConfig, admin.Reload(reload)))
+	mux.HandleFunc("/admin/export", access.Protect(admin.RoleCache, admin.ExportCache(client)))
+	mux.HandleFunc("/admin/import", access.Protect(admin.RoleCache, admin.ImportCache(client)))
+	mux.HandleFunc("/admin/cache", access.Protect(admin.RoleCache, admin.ListCache(client)))
+	mux.HandleFunc("/admin/cache/refresh", access.Protect(admin.RoleCache, admin.RefreshCache(svc)))
+	mux.HandleFunc("/admin/cache/purge", access.Protect(admin.RoleCache, admin.PurgeCache(client)))
+	mux.HandleFunc("/admin/sleeves", access.Protect(admin.RoleData, sleeves.AdminHandler(st)))
+	runBackground(func(ctx context.Context) {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-hup:
+				applied, restart, err := reload()
+				if err != nil {
+					log.Printf("warning: unable to reload config: %s", err)
+					continue
+				}
+				log.Printf("reloaded config, applied: %s, needs restart: %s", strings.Join(applied, ", "), strings.Join(restart, ", "))
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	if cfg.DebugEndpoints {
+		expvar.Publish("bgg_in_flight", expvar.Func(func() interface{} { return client.InFlight() }))
+		expvar.Publish("bgg_breaker_open", expvar.Func(func() interface{} { return client.BreakerOpen() }))
+		mux.Handle("/debug/", access.Protect(admin.RoleDebug, debug.Handler()))
 	}
 
-	log.Fatalf("serve failed: %s", http.ListenAndServe(":"+port, nil))
+	// Homelab deployments can keep the whole site to some networks, or behind
+	// a logged in proxy.
+	nets, err := middleware.ParseNets(cfg.AllowNets)
+	if err != nil {
+		log.Fatalf("unable to load allow_nets: %s", err)
+	}
+	allow := middleware.AllowNets(nets, cfg.TrustProxy)
+	// Collection pages stream for as long as BGG takes, up to the write
+	// timeout rather than the request deadline.
+	streamed := func(r *http.Request) bool { return r.Method == http.MethodGet && r.URL.Path == "/collection" }
+	timeout := middleware.Timeout(cfg.RequestTimeout, cfg.WriteTimeout, streamed)
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           middleware.Chain(mux, middleware.Log, middleware.Recover, allow, middleware.ProxyAuth(cfg.ProxyAuthHeader), middleware.Gzip, timeout),
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+		<-sigs
+		log.Printf("shutting down, draining requests and jobs")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			log.Printf("warning: requests still running at shutdown: %s", err)
+		}
+		if err := jm.Wait(shutdownCtx); err != nil {
+			log.Printf("warning: jobs still running at shutdown: %s", err)
+		}
+		stopBackground()
+		background.Wait()
+		if cfg.CachePath != "" {
+			if err := client.SaveCache(cfg.CachePath); err != nil {
+				log.Printf("warning: unable to save BGG cache: %s", err)
+			}
+		}
+	}()
+
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatalf("serve failed: %s", err)
+	}
+	<-drained
 }
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ParseNets parses comma separated networks in CIDR notation, such as
+// "192.168.1.0/24,10.0.0.5". A bare address is a network of just itself.
+func ParseNets(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if ip := net.ParseIP(s); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad network %q, please provide an address or CIDR", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// AllowNets only serves clients with an IP in one of nets, the rest get a
+// 403. Every client is served when nets is empty. With trustProxy the client
+// IP is taken from X-Forwarded-For, as by ClientIP.
+func AllowNets(nets []*net.IPNet, trustProxy bool) Middleware {
+	return func(h http.Handler) http.Handler {
+		if len(nets) == 0 {
+			return h
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := net.ParseIP(ClientIP(r, trustProxy))
+			for _, n := range nets {
+				if ip != nil && n.Contains(ip) {
+					h.ServeHTTP(w, r)
+					return
+				}
+			}
+			http.Error(w, "forbidden", http.StatusForbidden)
+		})
+	}
+}
+
+// ProxyAuth leaves authentication to a reverse proxy in front of the site,
+// such as Authelia or Authentik, requiring the header it sets to the logged
+// in user, such as Remote-User. Requests without it get a 401. Only use it
+// when the site can't be reached around the proxy and the proxy strips the
+// header from client requests. Nothing is required when header is empty.
+func ProxyAuth(header string) Middleware {
+	return func(h http.Handler) http.Handler {
+		if header == "" {
+			return h
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.TrimSpace(r.Header.Get(header)) == "" {
+				http.Error(w, "unauthorized, please log in through the proxy", http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// APIKeys requires one of keys, in the X-API-Key header or the api_key
+// param, on requests asking for JSON or CSV. Pages for browsers are left
+// open, as is everything when there are no keys.
+func APIKeys(keys []string) Middleware {
+	return requireKeys(keys, wantsData)
+}
+
+// RequireAPIKeys requires one of keys on every request, for endpoints that
+// are costly whatever they answer with, such as exports. Everything is open
+// when there are no keys.
+func RequireAPIKeys(keys []string) Middleware {
+	return requireKeys(keys, func(*http.Request) bool { return true })
+}
+
+// HasAPIKey reports whether r carries one of keys, never when there are no
+// keys.
+func HasAPIKey(r *http.Request, keys []string) bool {
+	return hasKey(r, validKeys(keys))
+}
+
+func requireKeys(keys []string, needed func(*http.Request) bool) Middleware {
+	valid := validKeys(keys)
+	return func(h http.Handler) http.Handler {
+		if len(valid) == 0 {
+			return h
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if needed(r) && !hasKey(r, valid) {
+				http.Error(w, "missing or bad API key", http.StatusUnauthorized)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func validKeys(keys []string) [][]byte {
+	var valid [][]byte
+	for _, k := range keys {
+		if k = strings.TrimSpace(k); k != "" {
+			valid = append(valid, []byte(k))
+		}
+	}
+	return valid
+}
+
+// hasKey reports whether r carries one of valid. Every key is compared so
+// the time taken doesn't tell which ones exist.
+func hasKey(r *http.Request, valid [][]byte) bool {
+	got := r.Header.Get("X-API-Key")
+	if got == "" {
+		got = r.FormValue("api_key")
+	}
+	ok := 0
+	for _, k := range valid {
+		ok |= subtle.ConstantTimeCompare([]byte(got), k)
+	}
+	return ok == 1
+}
+
+// wantsData reports whether r asks for JSON or CSV rather than a page, as
+// everything under /api/ does.
+func wantsData(r *http.Request) bool {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		return true
+	}
+	switch r.FormValue("format") {
+	case "json", "csv", "ndjson":
+		return true
+	}
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, "application/json") || strings.Contains(accept, "text/csv") || strings.Contains(accept, "application/x-ndjson")
+}
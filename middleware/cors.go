@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS lets browsers on the given origins call the wrapped handlers, "*"
+// allowing any origin. Preflight requests are answered directly, allowing
+// methods and caching the answer for maxAge. With no origins the handlers
+// are left as they are.
+func CORS(origins []string, methods string, maxAge time.Duration) Middleware {
+	allowed := make(map[string]bool)
+	for _, o := range origins {
+		if o = strings.TrimSpace(o); o != "" {
+			allowed[o] = true
+		}
+	}
+	return func(h http.Handler) http.Handler {
+		if len(allowed) == 0 {
+			return h
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			w.Header().Add("Vary", "Origin")
+			if origin == "" || !(allowed["*"] || allowed[origin]) {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent) // without CORS headers the browser refuses
+					return
+				}
+				h.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, Location, Retry-After")
+			if !preflight {
+				h.ServeHTTP(w, r)
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			if reqHeaders := r.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+				w.Header().Set("Access-Control-Allow-Headers", reqHeaders)
+			}
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// compressible are the content types worth compressing.
+var compressible = []string{"text/html", "application/json", "text/csv"}
+
+// Gzip compresses HTML, JSON and CSV responses for clients accepting gzip.
+// Flushing flushes the compressor too, so streamed pages still render as
+// they arrive.
+func Gzip(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !acceptsGzip(r) || r.Header.Get("Upgrade") != "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+		gw := &gzipWriter{ResponseWriter: w}
+		defer gw.close()
+		h.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		parts := strings.Split(enc, ";")
+		if strings.TrimSpace(parts[0]) != "gzip" {
+			continue
+		}
+		for _, param := range parts[1:] {
+			q := strings.TrimSpace(param)
+			if !strings.HasPrefix(q, "q=") {
+				continue
+			}
+			if v, err := strconv.ParseFloat(q[2:], 64); err == nil && v == 0 {
+				return false // explicitly refused
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// gzipWriter decides whether to compress when the response starts, from
+// its status and content type.
+type gzipWriter struct {
+	http.ResponseWriter
+	gz      *gzip.Writer // nil when not compressing
+	started bool
+}
+
+func (w *gzipWriter) start(code int) {
+	w.started = true
+	header := w.Header()
+	if code < 200 || code == http.StatusNoContent || code == http.StatusNotModified || header.Get("Content-Encoding") != "" {
+		return
+	}
+	ct := header.Get("Content-Type")
+	for _, t := range compressible {
+		if strings.HasPrefix(ct, t) {
+			header.Set("Content-Encoding", "gzip")
+			header.Add("Vary", "Accept-Encoding")
+			header.Del("Content-Length")
+			w.gz = gzip.NewWriter(w.ResponseWriter)
+			return
+		}
+	}
+}
+
+func (w *gzipWriter) WriteHeader(code int) {
+	if !w.started {
+		w.start(code)
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *gzipWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.start(http.StatusOK)
+	}
+	if w.gz != nil {
+		return w.gz.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *gzipWriter) Flush() {
+	if w.gz != nil {
+		w.gz.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *gzipWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking not supported")
+	}
+	return hj.Hijack()
+}
+
+func (w *gzipWriter) close() {
+	if w.gz != nil {
+		w.gz.Close()
+	}
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter gives each client IP a token bucket, refilled at a steady
+// rate up to a burst. Requests finding the bucket empty get a 429.
+type RateLimiter struct {
+	trustProxy bool
+
+	mu      sync.Mutex
+	rate    float64 // tokens per second
+	burst   float64
+	buckets map[string]*bucket
+	swept   time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows perMinute requests a minute per client IP, in
+// bursts of up to burst. With trustProxy the client IP is taken from
+// X-Forwarded-For, only set it behind a proxy that sets the header.
+func NewRateLimiter(perMinute, burst int, trustProxy bool) *RateLimiter {
+	return &RateLimiter{
+		rate:       float64(perMinute) / 60,
+		burst:      float64(burst),
+		trustProxy: trustProxy,
+		buckets:    make(map[string]*bucket),
+		swept:      time.Now(),
+	}
+}
+
+// SetRate changes the rate and burst of every client, for config reloads.
+func (l *RateLimiter) SetRate(perMinute, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rate, l.burst = float64(perMinute)/60, float64(burst)
+}
+
+// Limit is the middleware applying l.
+func (l *RateLimiter) Limit(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wait := l.take(ClientIP(r, l.trustProxy), time.Now()); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			http.Error(w, "too many requests, please slow down", http.StatusTooManyRequests)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// take takes a token from the bucket of ip, returning how long to wait for
+// one if it is empty.
+func (l *RateLimiter) take(ip string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sweep(now)
+	b, ok := l.buckets[ip]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[ip] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+// sweep forgets buckets that have refilled, at most once a minute, so the
+// map doesn't grow with every client ever seen.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.swept) < time.Minute {
+		return
+	}
+	l.swept = now
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	for ip, b := range l.buckets {
+		if now.Sub(b.last) > full {
+			delete(l.buckets, ip)
+		}
+	}
+}
+
+// ClientIP returns the IP address of the client making r. With trustProxy
+// it is the last address in X-Forwarded-For, the one the proxy added.
+func ClientIP(r *http.Request, trustProxy bool) string {
+	if trustProxy {
+		fwd := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+		if ip := strings.TrimSpace(fwd[len(fwd)-1]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,206 @@
+// Package moods tags games with the kind of evening they make for, based on
+// their BGG categories and mechanics with per user overrides.
+package moods
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+	"github.com/mattkoler/board_game_helper/syncapi"
+	"github.com/mattkoler/board_game_helper/trash"
+)
+
+// The curated moods.
+const (
+	Cutthroat    = "cutthroat"
+	Chill        = "chill"
+	LaughOutLoud = "laugh-out-loud"
+	BrainBurner  = "brain-burner"
+)
+
+// All lists every mood in display order.
+var All = []string{Cutthroat, Chill, LaughOutLoud, BrainBurner}
+
+var byCategory = map[string][]string{
+	"Abstract Strategy": {BrainBurner},
+	"Animals":           {Chill},
+	"Bluffing":          {Cutthroat, LaughOutLoud},
+	"Economic":          {BrainBurner},
+	"Humor":             {LaughOutLoud},
+	"Negotiation":       {Cutthroat},
+	"Party Game":        {LaughOutLoud},
+	"Puzzle":            {Chill},
+	"Wargame":           {Cutthroat},
+	"Word Game":         {LaughOutLoud},
+}
+
+var byMechanic = map[string][]string{
+	"Acting":                       {LaughOutLoud},
+	"Area Majority / Influence":    {Cutthroat},
+	"Betting and Bluffing":         {Cutthroat},
+	"Drawing":                      {LaughOutLoud},
+	"Engine Building":              {BrainBurner},
+	"Hidden Roles":                 {LaughOutLoud},
+	"Pattern Building":             {Chill},
+	"Player Elimination":           {Cutthroat},
+	"Set Collection":               {Chill},
+	"Singing":                      {LaughOutLoud},
+	"Storytelling":                 {LaughOutLoud},
+	"Take That":                    {Cutthroat},
+	"Tile Placement":               {Chill},
+	"Voting":                       {LaughOutLoud},
+	"Worker Placement":             {BrainBurner},
+	"Deck, Bag, and Pool Building": {BrainBurner},
+}
+
+// Tag returns the moods suggested by a game's categories and mechanics.
+func Tag(categories, mechanics []string) []string {
+	found := make(map[string]bool)
+	for _, c := range categories {
+		for _, m := range byCategory[c] {
+			found[m] = true
+		}
+	}
+	for _, mech := range mechanics {
+		for _, m := range byMechanic[mech] {
+			found[m] = true
+		}
+	}
+	var tags []string
+	for _, m := range All {
+		if found[m] {
+			tags = append(tags, m)
+		}
+	}
+	return tags
+}
+
+// Valid reports whether mood is one of the curated moods.
+func Valid(mood string) bool {
+	for _, m := range All {
+		if m == mood {
+			return true
+		}
+	}
+	return false
+}
+
+// Has reports whether tags contains mood.
+func Has(tags []string, mood string) bool {
+	for _, t := range tags {
+		if t == mood {
+			return true
+		}
+	}
+	return false
+}
+
+// OverrideKind is the store kind of mood overrides.
+const OverrideKind = "MoodOverride"
+
+func init() {
+	trash.Register(OverrideKind, "Mood override")
+	syncapi.Register(OverrideKind)
+}
+
+// Override is a user's replacement for the moods of a game.
+type Override struct {
+	Owner   string
+	GameID  string
+	Moods   []string
+	Updated time.Time
+}
+
+func overrideKey(owner, gameID string) string {
+	return store.Key(strings.ToLower(owner), gameID)
+}
+
+// Lookup returns owner's override of the moods of a game, or nil if they
+// haven't made one.
+func Lookup(st *store.Store, owner, gameID string) *Override {
+	if owner == "" {
+		return nil
+	}
+	var o Override
+	err := st.Get(OverrideKind, overrideKey(owner, gameID), &o)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Printf("warning: unable to load mood override for %q: %s", gameID, err)
+		}
+		return nil
+	}
+	return &o
+}
+
+// Resolve returns the moods of a game for owner, preferring their override
+// over the tags derived from categories and mechanics.
+func Resolve(st *store.Store, owner, gameID string, categories, mechanics []string) []string {
+	if o := Lookup(st, owner, gameID); o != nil {
+		return o.Moods
+	}
+	return Tag(categories, mechanics)
+}
+
+// SaveOverride replaces the moods a user sees for a game. Submitting with
+// reset set moves the override to the trash so the derived tags apply again.
+func SaveOverride(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "bad form values", http.StatusBadRequest)
+			return
+		}
+		bggName, gameID := r.FormValue("bggName"), r.FormValue("gameID")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		if gameID == "" {
+			http.Error(w, "missing gameID", http.StatusBadRequest)
+			return
+		}
+
+		key := overrideKey(bggName, gameID)
+		if r.FormValue("reset") != "" {
+			if err := st.SoftDelete(OverrideKind, key); err != nil && err != store.ErrNotFound {
+				http.Error(w, "unable to reset moods", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+		} else {
+			var chosen []string
+			for _, m := range r.Form["mood"] {
+				if !Valid(m) {
+					http.Error(w, "unknown mood "+m, http.StatusBadRequest)
+					return
+				}
+				chosen = append(chosen, m)
+			}
+			sort.Slice(chosen, func(i, j int) bool { return index(chosen[i]) < index(chosen[j]) })
+			o := &Override{Owner: bggName, GameID: gameID, Moods: chosen, Updated: time.Now()}
+			if err := st.Put(OverrideKind, key, o); err != nil {
+				http.Error(w, "unable to save moods", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+		}
+		http.Redirect(w, r, "/game?"+url.Values{"id": {gameID}, "bggName": {bggName}}.Encode(), http.StatusSeeOther)
+	}
+}
+
+func index(mood string) int {
+	for i, m := range All {
+		if m == mood {
+			return i
+		}
+	}
+	return len(All)
+}
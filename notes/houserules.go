@@ -0,0 +1,195 @@
+package notes
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// HouseRuleKind is the store kind house rules are kept under.
+const HouseRuleKind = "HouseRule"
+
+// HouseRule is a Markdown house rule published for every user of the
+// deployment to browse.
+type HouseRule struct {
+	ID       string
+	Author   string
+	GameID   string
+	GameName string
+	Title    string
+	Body     string
+	Created  time.Time
+}
+
+// HTML renders the Markdown of the rule's body.
+func (h *HouseRule) HTML() template.HTML {
+	return markdown(h.Body)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type houseRulesData struct {
+	BGGName string
+	GameID  string
+	Rules   []*HouseRule
+}
+
+// HouseRules is the page for browsing published house rules, optionally
+// limited to a single game.
+func HouseRules(tpl *template.Template, st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		gameID := r.FormValue("gameID")
+
+		var all []*HouseRule
+		if _, err := st.GetAll(HouseRuleKind, "", &all); err != nil {
+			http.Error(w, "unable to load house rules", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+
+		data := houseRulesData{BGGName: r.FormValue("bggName"), GameID: gameID}
+		for _, rule := range all {
+			if gameID == "" || rule.GameID == gameID {
+				data.Rules = append(data.Rules, rule)
+			}
+		}
+		if err := tpl.ExecuteTemplate(w, "houserules.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
+
+// PublishHouseRule shares a new house rule with the rest of the deployment.
+func PublishHouseRule(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bggName := r.FormValue("bggName")
+		if !validName(bggName) {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		gameID, title, body := r.FormValue("gameID"), r.FormValue("title"), r.FormValue("body")
+		if id, err := strconv.Atoi(gameID); err != nil || id < 1 {
+			http.Error(w, "bad game id param, please provide a BGG game id", http.StatusBadRequest)
+			return
+		}
+		switch {
+		case title == "" || len(title) > maxTitle:
+			http.Error(w, fmt.Sprintf("bad title param, please provide a title of at most %d characters", maxTitle), http.StatusBadRequest)
+			return
+		case len(r.FormValue("gameName")) > maxGameName:
+			http.Error(w, fmt.Sprintf("bad game name param, please provide a name of at most %d characters", maxGameName), http.StatusBadRequest)
+			return
+		case body == "" || len(body) > maxBody:
+			http.Error(w, fmt.Sprintf("bad body param, please provide rules of at most %d characters", maxBody), http.StatusBadRequest)
+			return
+		}
+
+		id, err := newID()
+		if err != nil {
+			http.Error(w, "unable to publish house rule", http.StatusInternalServerError)
+			log.Printf("unable to generate house rule id: %s", err)
+			return
+		}
+		rule := &HouseRule{
+			ID:       id,
+			Author:   bggName,
+			GameID:   gameID,
+			GameName: r.FormValue("gameName"),
+			Title:    title,
+			Body:     body,
+			Created:  time.Now(),
+		}
+		if err := st.Put(HouseRuleKind, id, rule); err != nil {
+			http.Error(w, "unable to publish house rule", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		http.Redirect(w, r, "/houserules?"+url.Values{
+			"bggName": {bggName},
+			"gameID":  {rule.GameID},
+		}.Encode(), http.StatusSeeOther)
+	}
+}
+
+// CloneHouseRule copies a published house rule into the user's own note for
+// that game.
+func CloneHouseRule(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bggName := r.FormValue("bggName")
+		if !validName(bggName) {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+
+		var rule HouseRule
+		if err := st.Get(HouseRuleKind, r.FormValue("id"), &rule); err != nil {
+			http.Error(w, "house rule not found", http.StatusNotFound)
+			return
+		}
+
+		err := appendToNote(st, bggName, &rule)
+		if err == errNoteFull {
+			http.Error(w, fmt.Sprintf("your note for this game is full, notes are at most %d characters", maxBody), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "unable to save note", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		http.Redirect(w, r, notesURL(bggName), http.StatusSeeOther)
+	}
+}
+
+// errNoteFull is returned by appendToNote when the note would outgrow maxBody.
+var errNoteFull = errors.New("note is full")
+
+// appendToNote adds rule to the end of bggName's note for its game. Appending
+// never loses anyone's edit, so it simply retries when the note changes
+// underneath it.
+func appendToNote(st *store.Store, bggName string, rule *HouseRule) error {
+	key := noteKey(bggName, rule.GameID)
+	for {
+		note := &Note{Owner: bggName, GameID: rule.GameID, GameName: rule.GameName}
+		version, err := st.GetVersion(noteKind, key, note)
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+		if note.Body != "" {
+			note.Body += "\n\n"
+		}
+		note.Body += fmt.Sprintf("## %s\n_House rule by %s_\n\n%s", rule.Title, rule.Author, rule.Body)
+		if len(note.Body) > maxBody {
+			return errNoteFull
+		}
+		note.Updated = time.Now()
+
+		if _, err := st.PutIf(noteKind, key, note, version); err != store.ErrConflict {
+			return err
+		}
+	}
+}
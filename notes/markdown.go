@@ -0,0 +1,75 @@
+package notes
+
+import (
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+// headingRE matches a heading line, the inline Markdown is matched against
+// already escaped text.
+var (
+	headingRE = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	codeRE    = regexp.MustCompile("`([^`]+)`")
+	boldRE    = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italicRE  = regexp.MustCompile(`(^|[^\w*])[*_]([^*_]+)[*_]`)
+)
+
+// markdown renders the subset of Markdown house rules are written in:
+// headings, bullet lists, paragraphs, bold, italics and code. Everything
+// else, raw HTML and links included, shows as the text it is, so the result
+// is safe to put in a page.
+func markdown(src string) template.HTML {
+	var b strings.Builder
+	inList := false
+	var para []string
+	flush := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>" + strings.Join(para, "<br>") + "</p>\n")
+			para = nil
+		}
+		if inList {
+			b.WriteString("</ul>\n")
+			inList = false
+		}
+	}
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		heading := headingRE.FindStringSubmatch(trimmed)
+		switch {
+		case trimmed == "":
+			flush()
+		case heading != nil:
+			// Rules are shown under the page's own headings.
+			level := len(heading[1])
+			if level > 3 {
+				level = 3
+			}
+			flush()
+			tag := []string{"h4", "h5", "h6"}[level-1]
+			b.WriteString("<" + tag + ">" + inline(heading[2]) + "</" + tag + ">\n")
+		case strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "* "):
+			if !inList {
+				flush()
+				b.WriteString("<ul>\n")
+				inList = true
+			}
+			b.WriteString("<li>" + inline(trimmed[2:]) + "</li>\n")
+		default:
+			if inList {
+				flush()
+			}
+			para = append(para, inline(trimmed))
+		}
+	}
+	flush()
+	return template.HTML(b.String())
+}
+
+// inline escapes text and renders its bold, italics and code.
+func inline(text string) string {
+	s := template.HTMLEscapeString(text)
+	s = codeRE.ReplaceAllString(s, "<code>$1</code>")
+	s = boldRE.ReplaceAllString(s, "<strong>$1</strong>")
+	return italicRE.ReplaceAllString(s, "$1<em>$2</em>")
+}
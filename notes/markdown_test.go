@@ -0,0 +1,28 @@
+package notes
+
+import "testing"
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"paragraph", "Draw two.\nDiscard one.", "<p>Draw two.<br>Discard one.</p>\n"},
+		{"heading", "## Setup", "<h5>Setup</h5>\n"},
+		{"deep heading", "##### Setup", "<h6>Setup</h6>\n"},
+		{"hash without space", "#1 rule", "<p>#1 rule</p>\n"},
+		{"list", "- one\n* two\n\nafter", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n<p>after</p>\n"},
+		{"inline", "**no** _trading_ with `robber`", "<p><strong>no</strong> <em>trading</em> with <code>robber</code></p>\n"},
+		{"snake case", "max_hand_size", "<p>max_hand_size</p>\n"},
+		{"html is escaped", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"links are text", "[x](javascript:alert(1))", "<p>[x](javascript:alert(1))</p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(markdown(tt.src)); got != tt.want {
+				t.Errorf("markdown(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+// Package notes holds per user game notes and the house rules users share
+// with each other.
+package notes
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+	"github.com/mattkoler/board_game_helper/syncapi"
+	"github.com/mattkoler/board_game_helper/trash"
+)
+
+const noteKind = "Note"
+
+func init() {
+	trash.Register(noteKind, "Note")
+	syncapi.Register(noteKind)
+}
+
+// Note is a user's private Markdown notes for a single game.
+type Note struct {
+	Owner    string
+	GameID   string
+	GameName string
+	Body     string
+	Updated  time.Time
+}
+
+func noteKey(owner, gameID string) string {
+	return store.Key(strings.ToLower(owner), gameID)
+}
+
+// The longest titles, game names and bodies of notes and house rules kept,
+// the store file is rewritten on every write.
+const (
+	maxTitle    = 100
+	maxGameName = 200
+	maxBody     = 20000
+)
+
+func validName(bggName string) bool {
+	return len(bggName) >= 4 && len(bggName) <= 20
+}
+
+// versionedNote is a note along with the store version it was read at, which
+// edits send back so concurrent changes are detected.
+type versionedNote struct {
+	*Note
+	Version int64
+}
+
+type notesData struct {
+	BGGName string
+	Notes   []versionedNote
+}
+
+// conflictData is shown when a note changed since the editor loaded it.
+type conflictData struct {
+	BGGName  string
+	GameID   string
+	GameName string
+	Mine     string
+	Current  *Note // nil if the note has since been deleted
+	Version  int64
+}
+
+// Notes is the page listing a user's game notes.
+func Notes(tpl *template.Template, st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if !validName(bggName) {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+
+		var notes []*Note
+		keys, err := st.GetAll(noteKind, store.Key(strings.ToLower(bggName), ""), &notes)
+		if err != nil {
+			http.Error(w, "unable to load notes", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+
+		data := notesData{BGGName: bggName}
+		for i, n := range notes {
+			data.Notes = append(data.Notes, versionedNote{Note: n, Version: st.Version(noteKind, keys[i])})
+		}
+		if err := tpl.ExecuteTemplate(w, "notes.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
+
+// SaveNote creates or replaces a user's note for a game. Submitting with
+// delete set moves the note to the trash instead. The version form value is
+// the version the editor started from, 0 for a new note. If the note changed
+// since, both versions are shown so the user can merge them and retry.
+func SaveNote(tpl *template.Template, st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bggName, gameID := r.FormValue("bggName"), r.FormValue("gameID")
+		if !validName(bggName) {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		if gameID == "" {
+			http.Error(w, "missing gameID", http.StatusBadRequest)
+			return
+		}
+		switch {
+		case len(r.FormValue("gameName")) > maxGameName:
+			http.Error(w, fmt.Sprintf("bad game name param, please provide a name of at most %d characters", maxGameName), http.StatusBadRequest)
+			return
+		case len(r.FormValue("body")) > maxBody:
+			http.Error(w, fmt.Sprintf("bad body param, please provide notes of at most %d characters", maxBody), http.StatusBadRequest)
+			return
+		}
+
+		if r.FormValue("delete") != "" {
+			if err := st.SoftDelete(noteKind, noteKey(bggName, gameID)); err != nil && err != store.ErrNotFound {
+				http.Error(w, "unable to delete note", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			http.Redirect(w, r, notesURL(bggName), http.StatusSeeOther)
+			return
+		}
+
+		var version int64
+		if v := r.FormValue("version"); v != "" {
+			var err error
+			if version, err = strconv.ParseInt(v, 10, 64); err != nil || version < 0 {
+				http.Error(w, "bad version param", http.StatusBadRequest)
+				return
+			}
+		}
+
+		note := &Note{
+			Owner:    bggName,
+			GameID:   gameID,
+			GameName: r.FormValue("gameName"),
+			Body:     r.FormValue("body"),
+			Updated:  time.Now(),
+		}
+		key := noteKey(bggName, gameID)
+		_, err := st.PutIf(noteKind, key, note, version)
+		if err == store.ErrConflict {
+			data := conflictData{BGGName: bggName, GameID: gameID, GameName: note.GameName, Mine: note.Body}
+			var current Note
+			switch data.Version, err = st.GetVersion(noteKind, key, &current); err {
+			case nil:
+				data.Current = &current
+				if data.GameName == "" {
+					data.GameName = current.GameName
+				}
+			case store.ErrNotFound:
+			default:
+				http.Error(w, "unable to load note", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			w.WriteHeader(http.StatusConflict)
+			if err := tpl.ExecuteTemplate(w, "note_conflict.html", data); err != nil {
+				log.Printf("Error executing template: %s", err)
+			}
+			return
+		}
+		if err != nil {
+			http.Error(w, "unable to save note", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		http.Redirect(w, r, notesURL(bggName), http.StatusSeeOther)
+	}
+}
+
+func notesURL(bggName string) string {
+	return fmt.Sprintf("/notes?%s", url.Values{"bggName": {bggName}}.Encode())
+}
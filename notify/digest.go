@@ -0,0 +1,194 @@
+package notify
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/middleware"
+	"github.com/mattkoler/board_game_helper/service"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// subscriptionKind is the store kind of digest subscriptions, keyed by
+// their token.
+const subscriptionKind = "DigestSubscription"
+
+// digestEvery is how often a subscriber gets a digest.
+const digestEvery = 7 * 24 * time.Hour
+
+// confirmWithin is how long a subscription waits to be confirmed before it is
+// dropped.
+const confirmWithin = 48 * time.Hour
+
+// Subscription is an email address getting a weekly digest of a user's
+// games. Digests are only sent once the address confirmed it, so nobody can
+// be subscribed by someone else.
+type Subscription struct {
+	Token      string // in the confirm and unsubscribe links
+	Email      string
+	BGGName    string
+	NumPlayers int
+	Confirmed  bool
+	Created    time.Time
+	LastSent   time.Time
+}
+
+func newSubscriptionToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// subscribe stores a new unconfirmed subscription and sends the email asking
+// to confirm it.
+func subscribe(st *store.Store, m *Mailer, email, bggName string, numPlayers int) error {
+	token, err := newSubscriptionToken()
+	if err != nil {
+		return fmt.Errorf("unable to generate subscription token: %s", err)
+	}
+	sub := &Subscription{Token: token, Email: email, BGGName: bggName, NumPlayers: numPlayers, Created: time.Now()}
+	if err := st.Put(subscriptionKind, token, sub); err != nil {
+		return err
+	}
+	return m.Send(email, "Confirm your weekly game digest", "email_confirm.html", sub)
+}
+
+// confirm marks the subscription of token confirmed.
+func confirm(st *store.Store, token string) (*Subscription, error) {
+	var sub Subscription
+	if err := st.Get(subscriptionKind, token, &sub); err != nil {
+		return nil, err
+	}
+	sub.Confirmed = true
+	return &sub, st.Put(subscriptionKind, token, &sub)
+}
+
+// Digests is the digest subscription page. GET shows the form, POST to
+// /digest subscribes, and the links in the emails confirm or unsubscribe.
+// Subscribing sends the confirm email to any address typed in, so it needs
+// one of apiKeys, even when none are set.
+func Digests(tpl *template.Template, st *store.Store, m *Mailer, apiKeys []string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !m.Enabled() {
+			http.NotFound(w, r)
+			return
+		}
+		status := r.FormValue("status")
+		switch token := r.FormValue("token"); {
+		case r.Method == http.MethodPost:
+			if !middleware.HasAPIKey(r, apiKeys) {
+				http.Error(w, "missing or bad API key, one is needed to subscribe an address", http.StatusUnauthorized)
+				return
+			}
+			email, bggName := r.FormValue("email"), r.FormValue("bggName")
+			numPlayers, err := strconv.Atoi(r.FormValue("numPlayers"))
+			switch {
+			case !ValidAddress(email):
+				http.Error(w, "bad email param, please provide an email address", http.StatusBadRequest)
+				return
+			case len(bggName) < 4 || len(bggName) > 20:
+				http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+				return
+			case err != nil || numPlayers < 1 || numPlayers > 100:
+				http.Error(w, "bad num players param, please provide a number between 1 and 100", http.StatusBadRequest)
+				return
+			}
+			if err := subscribe(st, m, email, bggName, numPlayers); err != nil {
+				http.Error(w, "unable to subscribe", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			http.Redirect(w, r, "/digest?"+url.Values{"status": {"sent"}}.Encode(), http.StatusSeeOther)
+			return
+		case token != "" && r.FormValue("unsubscribe") == "1":
+			if err := st.Delete(subscriptionKind, token); err != nil && err != store.ErrNotFound {
+				http.Error(w, "unable to unsubscribe", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			status = "unsubscribed"
+		case token != "":
+			_, err := confirm(st, token)
+			if err == store.ErrNotFound {
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				http.Error(w, "unable to confirm subscription", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			status = "confirmed"
+		}
+		if err := tpl.ExecuteTemplate(w, "digest.html", struct{ Status string }{status}); err != nil {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
+
+// DigestEvery sends the weekly digests that are due every interval until ctx
+// is done.
+func DigestEvery(ctx context.Context, st *store.Store, svc *service.Service, m *Mailer, interval time.Duration) {
+	if !m.Enabled() {
+		return
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		if err := sendDigests(st, svc, m, time.Now()); err != nil {
+			log.Printf("warning: unable to send digests: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// sendDigests sends the digests of the confirmed subscriptions that haven't
+// had one for a week, and drops those left unconfirmed for confirmWithin.
+func sendDigests(st *store.Store, svc *service.Service, m *Mailer, now time.Time) error {
+	var subs []*Subscription
+	if _, err := st.GetAll(subscriptionKind, "", &subs); err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		if !sub.Confirmed && now.Sub(sub.Created) > confirmWithin {
+			if err := st.Delete(subscriptionKind, sub.Token); err != nil && err != store.ErrNotFound {
+				return err
+			}
+			continue
+		}
+		if !sub.Confirmed || now.Sub(sub.LastSent) < digestEvery {
+			continue
+		}
+		since := now.Add(-digestEvery)
+		d, err := svc.Digest(sub.BGGName, sub.NumPlayers, since)
+		if err == nil {
+			err = m.Send(sub.Email, "Your week of board games", "email_digest.html", struct {
+				*service.Digest
+				Token string
+			}{d, sub.Token})
+		}
+		if err != nil {
+			log.Printf("warning: unable to send digest of %q: %s", sub.BGGName, err)
+			continue
+		}
+		sub.LastSent = now
+		if err := st.Put(subscriptionKind, sub.Token, sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
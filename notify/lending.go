@@ -0,0 +1,48 @@
+package notify
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+// NudgeLoansEvery reminds the borrowers of overdue games every interval
+// until ctx is done. Each borrower is emailed at most once per
+// service.NudgeEvery for a loan.
+func NudgeLoansEvery(ctx context.Context, svc *service.Service, m *Mailer, interval time.Duration) {
+	if !m.Enabled() {
+		return
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		if err := nudgeLoans(svc, m, time.Now()); err != nil {
+			log.Printf("warning: unable to nudge borrowers: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+// nudgeLoans emails the borrowers of the loans due a nudge.
+func nudgeLoans(svc *service.Service, m *Mailer, now time.Time) error {
+	loans, err := svc.LoansToNudge(now)
+	if err != nil {
+		return err
+	}
+	for _, l := range loans {
+		if err := m.Send(l.Email, "A reminder about "+l.GameName, "email_loan.html", l); err != nil {
+			log.Printf("warning: unable to nudge borrower of %q: %s", l.GameName, err)
+			continue
+		}
+		if err := svc.MarkNudged(l, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
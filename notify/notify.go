@@ -0,0 +1,92 @@
+// Package notify sends the site's emails over SMTP: game night invites,
+// notices that long collection jobs finished and weekly digests. Messages
+// are rendered from the site's template set, so they can be overridden like
+// any page.
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// Mailer sends emails through an SMTP server. A Mailer with no server sends
+// nothing, see Enabled.
+type Mailer struct {
+	addr     string // host:port of the SMTP server
+	auth     smtp.Auth
+	from     string // the From header
+	envelope string // the bare address of from
+	base     string // URL of the site, for links in emails
+	tpl      *template.Template
+}
+
+// New returns a Mailer sending from the address from through the SMTP server
+// at addr, logging in as user when set. Emails link to the site at siteURL
+// and are rendered from tpl. With no addr the Mailer is disabled.
+func New(addr, user, password, from, siteURL string, tpl *template.Template) *Mailer {
+	m := &Mailer{addr: addr, from: from, envelope: from, base: strings.TrimSuffix(siteURL, "/"), tpl: tpl}
+	if a, err := mail.ParseAddress(from); err == nil {
+		m.envelope = a.Address
+	}
+	if user != "" {
+		host, _, _ := net.SplitHostPort(addr)
+		m.auth = smtp.PlainAuth("", user, password, host)
+	}
+	return m
+}
+
+// Enabled reports whether m sends emails, features offering them should be
+// hidden otherwise.
+func (m *Mailer) Enabled() bool {
+	return m != nil && m.addr != ""
+}
+
+// ValidAddress reports whether to is a single plain email address.
+func ValidAddress(to string) bool {
+	a, err := mail.ParseAddress(to)
+	return err == nil && a.Address == to
+}
+
+// Send renders the template name with data and sends it to to as an HTML
+// email. The template sees data as .Data and the site's URL as .Base.
+func (m *Mailer) Send(to, subject, name string, data interface{}) error {
+	if !m.Enabled() {
+		return fmt.Errorf("unable to send %s: no smtp server configured", name)
+	}
+	if !ValidAddress(to) {
+		return fmt.Errorf("bad email address %q", to)
+	}
+	var body bytes.Buffer
+	if err := m.tpl.ExecuteTemplate(&body, name, struct {
+		Base string
+		Data interface{}
+	}{m.base, data}); err != nil {
+		return fmt.Errorf("unable to render %s: %s", name, err)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprint(&msg, "MIME-Version: 1.0\r\n")
+	fmt.Fprint(&msg, "Content-Type: text/html; charset=utf-8\r\n")
+	fmt.Fprint(&msg, "Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&msg)
+	qp.Write(body.Bytes())
+	if err := qp.Close(); err != nil {
+		return err
+	}
+	if err := smtp.SendMail(m.addr, m.auth, m.envelope, []string{to}, msg.Bytes()); err != nil {
+		return fmt.Errorf("unable to send %s to %s: %s", name, to, err)
+	}
+	return nil
+}
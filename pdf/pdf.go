@@ -0,0 +1,165 @@
+// Package pdf writes simple text documents as PDF, enough for printable
+// lists. It only uses the standard Helvetica fonts, so nothing needs
+// embedding, and only Latin-1 text prints; other characters show as "?".
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// The size of a US letter page in points, a 72nd of an inch.
+const (
+	PageWidth  = 612
+	PageHeight = 792
+)
+
+// Font is how text is set.
+type Font struct {
+	Size float64
+	Bold bool
+	Gray float64 // 0 is black, 1 white
+}
+
+// Doc is a document being written, page by page.
+type Doc struct {
+	pages []*bytes.Buffer
+}
+
+// New returns an empty document.
+func New() *Doc {
+	return &Doc{}
+}
+
+// AddPage starts a new page, which text and lines then go on.
+func (d *Doc) AddPage() {
+	d.pages = append(d.pages, new(bytes.Buffer))
+}
+
+// page returns the current page, starting the first one if needed.
+func (d *Doc) page() *bytes.Buffer {
+	if len(d.pages) == 0 {
+		d.AddPage()
+	}
+	return d.pages[len(d.pages)-1]
+}
+
+// Text sets s on the current page with its baseline starting at x, y,
+// measured in points from the top left corner.
+func (d *Doc) Text(x, y float64, f Font, s string) {
+	name := "F1"
+	if f.Bold {
+		name = "F2"
+	}
+	fmt.Fprintf(d.page(), "BT %.3g g /%s %.3g Tf %.2f %.2f Td (%s) Tj ET\n", f.Gray, name, f.Size, x, PageHeight-y, escape(s))
+}
+
+// Line draws a thin gray line from x1, y1 to x2, y2.
+func (d *Doc) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.page(), "0.75 G 0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, PageHeight-y1, x2, PageHeight-y2)
+}
+
+// WriteTo writes the document as a PDF file.
+func (d *Doc) WriteTo(w io.Writer) (int64, error) {
+	d.page()
+	var buf bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, p := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			PageWidth, PageHeight, 6+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.Len(), p.Bytes()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return buf.WriteTo(w)
+}
+
+// winAnsi maps the characters WinAnsiEncoding has outside of Latin-1.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '…': 0x85, '‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94,
+	'•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// escape encodes s as the bytes of a PDF string in WinAnsiEncoding.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case winAnsi[r] != 0:
+			fmt.Fprintf(&b, "\\%03o", winAnsi[r])
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// widths are the widths of the printable ASCII characters in Helvetica, in
+// thousandths of the font size.
+var widths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// Width is about how wide s is set in f, in points. Bold text is taken to
+// be a little wider than regular.
+func Width(s string, f Font) float64 {
+	var w int
+	for _, r := range s {
+		if r >= 0x20 && r < 0x7f {
+			w += widths[r-0x20]
+		} else {
+			w += 556
+		}
+	}
+	width := float64(w) * f.Size / 1000
+	if f.Bold {
+		width *= 1.08
+	}
+	return width
+}
+
+// Fit shortens s with an ellipsis until it is at most width points wide
+// set in f.
+func Fit(s string, f Font, width float64) string {
+	if Width(s, f) <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 && Width(string(runes)+"…", f) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return strings.TrimSpace(string(runes)) + "…"
+}
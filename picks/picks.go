@@ -0,0 +1,180 @@
+// Package picks keeps each user's hidden and favorite games. Hidden games are
+// never suggested, favorites are boosted in recommendations.
+package picks
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/session"
+	"github.com/mattkoler/board_game_helper/store"
+	"github.com/mattkoler/board_game_helper/syncapi"
+	"github.com/mattkoler/board_game_helper/trash"
+)
+
+// The store kinds of the two lists.
+const (
+	HiddenKind   = "HiddenGame"
+	FavoriteKind = "FavoriteGame"
+)
+
+// Boost is the share of its fit a favorite game gains in recommendations.
+const Boost = 0.25
+
+func init() {
+	trash.Register(HiddenKind, "Hidden game")
+	trash.Register(FavoriteKind, "Favorite game")
+	syncapi.Register(HiddenKind)
+	syncapi.Register(FavoriteKind)
+}
+
+// Pick is a game on one of a user's lists.
+type Pick struct {
+	Owner    string
+	GameID   string
+	GameName string
+	Added    time.Time
+}
+
+// Lists are the IDs of a user's hidden and favorite games.
+type Lists struct {
+	Hidden   map[string]bool
+	Favorite map[string]bool
+}
+
+func pickKey(owner, gameID string) string {
+	return store.Key(strings.ToLower(owner), gameID)
+}
+
+func list(st *store.Store, kind, owner string) ([]*Pick, error) {
+	var all []*Pick
+	if _, err := st.GetAll(kind, store.Key(strings.ToLower(owner), ""), &all); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// Load returns owner's lists. Lists that can't be loaded are left empty, a
+// broken list shouldn't stop recommendations.
+func Load(st *store.Store, owner string) Lists {
+	l := Lists{Hidden: make(map[string]bool), Favorite: make(map[string]bool)}
+	for kind, ids := range map[string]map[string]bool{HiddenKind: l.Hidden, FavoriteKind: l.Favorite} {
+		all, err := list(st, kind, owner)
+		if err != nil {
+			log.Printf("warning: unable to load %s list of %q: %s", kind, owner, err)
+			continue
+		}
+		for _, p := range all {
+			ids[p.GameID] = true
+		}
+	}
+	return l
+}
+
+// Has reports whether gameID is on owner's list of kind.
+func Has(st *store.Store, kind, owner, gameID string) bool {
+	var p Pick
+	return st.Get(kind, pickKey(owner, gameID), &p) == nil
+}
+
+// owner is the user a request acts for, the bggName form value or else the
+// BGG name saved in the browser's session.
+func owner(r *http.Request, sessions *session.Sessions) string {
+	if bggName := r.FormValue("bggName"); bggName != "" {
+		return bggName
+	}
+	return sessions.Load(r).BGGName
+}
+
+type picksData struct {
+	BGGName   string
+	Hidden    []*Pick
+	Favorites []*Pick
+}
+
+// Page is the page for managing a user's hidden and favorite games.
+func Page(tpl *template.Template, st *store.Store, sessions *session.Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := owner(r, sessions)
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+
+		data := picksData{BGGName: bggName}
+		var err error
+		if data.Hidden, err = list(st, HiddenKind, bggName); err == nil {
+			data.Favorites, err = list(st, FavoriteKind, bggName)
+		}
+		if err != nil {
+			http.Error(w, "unable to load lists", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		if err := tpl.ExecuteTemplate(w, "picks.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
+
+// Mark adds a game to, or with remove set moves it to the trash from, the
+// hidden or favorite list picked by the list form value. The user is sent
+// back to the return form value, or the lists page if there isn't one.
+func Mark(st *store.Store, sessions *session.Sessions) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bggName, gameID := owner(r, sessions), r.FormValue("gameID")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		if gameID == "" {
+			http.Error(w, "missing gameID", http.StatusBadRequest)
+			return
+		}
+		var kind string
+		switch r.FormValue("list") {
+		case "hidden":
+			kind = HiddenKind
+		case "favorite":
+			kind = FavoriteKind
+		default:
+			http.Error(w, "bad list param, please pick hidden or favorite", http.StatusBadRequest)
+			return
+		}
+
+		key := pickKey(bggName, gameID)
+		var err error
+		if r.FormValue("remove") != "" {
+			if err = st.SoftDelete(kind, key); err == store.ErrNotFound {
+				err = nil
+			}
+		} else {
+			err = st.Put(kind, key, &Pick{
+				Owner:    bggName,
+				GameID:   gameID,
+				GameName: r.FormValue("gameName"),
+				Added:    time.Now(),
+			})
+		}
+		if err != nil {
+			http.Error(w, "unable to update lists", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+
+		back := r.FormValue("return")
+		if !strings.HasPrefix(back, "/") || strings.HasPrefix(back, "//") {
+			back = "/picks?" + url.Values{"bggName": {bggName}}.Encode()
+		}
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,195 @@
+package plays
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// bgStatsDates are the date layouts found in BG Stats exports.
+var bgStatsDates = []string{"2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+func parseBGStatsDate(s string) (time.Time, error) {
+	for _, layout := range bgStatsDates {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("bad date %q", s)
+}
+
+// bgStatsExport is the part of a BG Stats JSON export that is imported.
+type bgStatsExport struct {
+	Games []struct {
+		ID    int    `json:"id"`
+		Name  string `json:"name"`
+		BGGID int    `json:"bggId"`
+	} `json:"games"`
+	Players []struct {
+		ID          int    `json:"id"`
+		Name        string `json:"name"`
+		BGGUsername string `json:"bggUsername"`
+	} `json:"players"`
+	Plays []struct {
+		UUID         string `json:"uuid"`
+		GameRefID    int    `json:"gameRefId"`
+		PlayDate     string `json:"playDate"`
+		Ignored      bool   `json:"ignored"`
+		PlayerScores []struct {
+			PlayerRefID int             `json:"playerRefId"`
+			Score       json.RawMessage `json:"score"` // a string, or a number in older exports
+			Winner      bool            `json:"winner"`
+			StartPlayer bool            `json:"startPlayer"`
+			SeatOrder   int             `json:"seatOrder"`
+		} `json:"playerScores"`
+	} `json:"plays"`
+}
+
+// ParseBGStats reads the plays of a BG Stats export, its JSON backup or a
+// CSV, picked by the file name. Plays keep their BG Stats ID, so importing
+// the same export again replaces them. GameID is the BGG ID of the game, or
+// empty when the export doesn't know it and the game has to be looked up by
+// GameName.
+func ParseBGStats(r io.Reader, filename string) ([]*Play, error) {
+	if strings.HasSuffix(strings.ToLower(filename), ".csv") {
+		return parseBGStatsCSV(r)
+	}
+
+	var ex bgStatsExport
+	if err := json.NewDecoder(r).Decode(&ex); err != nil {
+		return nil, fmt.Errorf("unable to read BG Stats export: %s", err)
+	}
+	type game struct{ id, name string }
+	games := make(map[int]game, len(ex.Games))
+	for _, g := range ex.Games {
+		id := ""
+		if g.BGGID > 0 {
+			id = strconv.Itoa(g.BGGID)
+		}
+		games[g.ID] = game{id: id, name: g.Name}
+	}
+	type player struct{ name, username string }
+	players := make(map[int]player, len(ex.Players))
+	for _, p := range ex.Players {
+		players[p.ID] = player{name: p.Name, username: p.BGGUsername}
+	}
+
+	var all []*Play
+	for i, ep := range ex.Plays {
+		if ep.Ignored {
+			continue
+		}
+		g, ok := games[ep.GameRefID]
+		if !ok {
+			return nil, fmt.Errorf("play %d is of unknown game %d", i+1, ep.GameRefID)
+		}
+		date, err := parseBGStatsDate(ep.PlayDate)
+		if err != nil {
+			return nil, fmt.Errorf("play %d: %s", i+1, err)
+		}
+		p := &Play{ID: "bgstats-" + ep.UUID, GameID: g.id, GameName: g.name, Date: date}
+		if ep.UUID == "" {
+			p.ID = ""
+		}
+		for _, ps := range ep.PlayerScores {
+			pl := players[ps.PlayerRefID]
+			player := Player{Name: pl.name, Username: pl.username, Seat: ps.SeatOrder, Win: ps.Winner}
+			if player.Seat == 0 && ps.StartPlayer {
+				player.Seat = 1
+			}
+			player.Score, player.HasScore = bgStatsScore(ps.Score)
+			p.Players = append(p.Players, player)
+		}
+		all = append(all, p)
+	}
+	return all, nil
+}
+
+// bgStatsScore reads a score, which BG Stats leaves empty when none was
+// entered.
+func bgStatsScore(raw json.RawMessage) (float64, bool) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		s = string(raw)
+	}
+	score, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return score, err == nil
+}
+
+// parseBGStatsCSV reads a CSV export with a header row. The date and game
+// columns are required, the BGG ID, players and winners columns are used if
+// present. Players and winners are separated by semicolons, their seats
+// are left unknown.
+func parseBGStatsCSV(r io.Reader) ([]*Play, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read CSV header: %s", err)
+	}
+	col := make(map[string]int)
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(h))
+		h = strings.NewReplacer(" ", "", "_", "").Replace(h)
+		col[h] = i
+	}
+	find := func(names ...string) int {
+		for _, n := range names {
+			if i, ok := col[n]; ok {
+				return i
+			}
+		}
+		return -1
+	}
+	dateCol, gameCol := find("date", "playdate"), find("game", "gamename", "name")
+	idCol, playersCol, winnersCol := find("bggid", "bgg"), find("players"), find("winners", "winner")
+	if dateCol < 0 || gameCol < 0 {
+		return nil, errors.New("the CSV needs date and game columns")
+	}
+
+	var all []*Play
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CSV: %s", err)
+		}
+		field := func(i int) string {
+			if i < 0 || i >= len(rec) {
+				return ""
+			}
+			return strings.TrimSpace(rec[i])
+		}
+		date, err := parseBGStatsDate(field(dateCol))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", line, err)
+		}
+		p := &Play{GameID: field(idCol), GameName: field(gameCol), Date: date}
+		if p.GameName == "" {
+			return nil, fmt.Errorf("line %d has no game", line)
+		}
+		winners := make(map[string]bool)
+		for _, w := range strings.Split(field(winnersCol), ";") {
+			winners[strings.ToLower(strings.TrimSpace(w))] = true
+		}
+		for _, name := range strings.Split(field(playersCol), ";") {
+			if name = strings.TrimSpace(name); name != "" {
+				p.Players = append(p.Players, Player{Name: name, Win: winners[strings.ToLower(name)]})
+			}
+		}
+		// The same row imported again replaces its play.
+		sum := sha256.Sum256([]byte(strings.Join([]string{field(dateCol), strings.ToLower(p.GameName), field(playersCol)}, "\n")))
+		p.ID = "bgstats-" + hex.EncodeToString(sum[:8])
+		all = append(all, p)
+	}
+	return all, nil
+}
@@ -0,0 +1,104 @@
+// Package plays stores the plays recorded for each user's games.
+package plays
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+	"github.com/mattkoler/board_game_helper/syncapi"
+)
+
+// Kind is the store kind plays are kept under.
+const Kind = "Play"
+
+func init() {
+	syncapi.Register(Kind)
+}
+
+// Player is a single participant of a play.
+type Player struct {
+	Name     string
+	Username string
+	Seat     int // 1 based start position, 0 when unknown
+	Score    float64
+	HasScore bool
+	Win      bool
+}
+
+// Play is a single recorded play of a game.
+type Play struct {
+	ID       string
+	Owner    string // bggName the play was recorded for
+	GameID   string
+	GameName string
+	Date     time.Time
+	Quantity int // times the game was played in a row, 1 if zero
+	Players  []Player
+}
+
+// Times returns how many times p counts as played.
+func (p *Play) Times() int {
+	if p.Quantity < 1 {
+		return 1
+	}
+	return p.Quantity
+}
+
+// Validate checks a play logged by hand.
+func (p *Play) Validate() error {
+	if _, err := strconv.Atoi(p.GameID); err != nil {
+		return errors.New("bad game id, please provide a numeric game id")
+	}
+	if p.Date.IsZero() || p.Date.After(time.Now()) {
+		return errors.New("bad date, please provide a date that isn't in the future")
+	}
+	if len(p.Players) > 100 {
+		return errors.New("too many players, please provide at most 100")
+	}
+	return nil
+}
+
+// Summary is how often and how recently a game was played.
+type Summary struct {
+	Plays int
+	Last  time.Time
+}
+
+func prefix(owner string) string {
+	return store.Key(strings.ToLower(owner), "")
+}
+
+// Put stores p, replacing any play with the same owner and ID.
+func Put(st *store.Store, p *Play) error {
+	return st.Put(Kind, store.Key(strings.ToLower(p.Owner), p.ID), p)
+}
+
+// List returns every play recorded for owner.
+func List(st *store.Store, owner string) ([]*Play, error) {
+	var all []*Play
+	if _, err := st.GetAll(Kind, prefix(owner), &all); err != nil {
+		return nil, err
+	}
+	return all, nil
+}
+
+// Summarize returns the summary of owner's plays of each game, by game ID.
+func Summarize(st *store.Store, owner string) (map[string]Summary, error) {
+	all, err := List(st, owner)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]Summary)
+	for _, p := range all {
+		s := sums[p.GameID]
+		s.Plays += p.Times()
+		if p.Date.After(s.Last) {
+			s.Last = p.Date
+		}
+		sums[p.GameID] = s
+	}
+	return sums, nil
+}
@@ -0,0 +1,124 @@
+// Package queue is a persistent task queue with named, deduplicated tasks
+// and retries, run by a worker loop in the same process.
+package queue
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Task is a unit of queued work. Name identifies the task within its queue,
+// adding a task whose name is already pending is a no-op.
+type Task struct {
+	Queue     string
+	Name      string
+	Payload   string
+	Attempts  int
+	LastError string
+	Created   time.Time
+	NotBefore time.Time // the task isn't run before this time
+	Leased    time.Time // when a worker took the task, zero if it is waiting
+}
+
+// Queue stores tasks until they are done.
+type Queue interface {
+	// Add queues t unless a task with the same queue and name is pending.
+	Add(t *Task) (added bool, err error)
+	// Lease takes the next due task of queue, or returns nil if there is
+	// none. Leases older than timeout are treated as abandoned.
+	Lease(queue string, now time.Time, timeout time.Duration) (*Task, error)
+	// Done removes a leased task.
+	Done(t *Task) error
+	// Retry records a failed attempt and puts t back to run again at at.
+	Retry(t *Task, at time.Time) error
+}
+
+// Handler runs a task.
+type Handler func(ctx context.Context, t *Task) error
+
+// Worker runs the tasks of one queue.
+type Worker struct {
+	Q           Queue
+	Queue       string
+	Handler     Handler
+	Poll        time.Duration // how often to look for new tasks, a second if zero
+	MaxAttempts int           // attempts before a task is dropped, 5 if zero
+}
+
+// leaseTimeout is how long a task may run before it is handed out again.
+const leaseTimeout = 10 * time.Minute
+
+// Run runs tasks until ctx is done.
+func (w *Worker) Run(ctx context.Context) {
+	poll := w.Poll
+	if poll == 0 {
+		poll = time.Second
+	}
+	tick := time.NewTicker(poll)
+	defer tick.Stop()
+	for {
+		for w.runOne(ctx) {
+			if ctx.Err() != nil {
+				return
+			}
+		}
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runOne runs the next due task and reports whether there was one.
+func (w *Worker) runOne(ctx context.Context) bool {
+	t, err := w.Q.Lease(w.Queue, time.Now(), leaseTimeout)
+	if err != nil {
+		log.Printf("warning: unable to lease %s task: %s", w.Queue, err)
+		return false
+	}
+	if t == nil {
+		return false
+	}
+
+	err = w.Handler(ctx, t)
+	if err == nil {
+		if err := w.Q.Done(t); err != nil {
+			log.Printf("warning: unable to finish %s task %q: %s", w.Queue, t.Name, err)
+		}
+		return true
+	}
+
+	t.Attempts++
+	t.LastError = err.Error()
+	max := w.MaxAttempts
+	if max == 0 {
+		max = 5
+	}
+	if t.Attempts >= max {
+		log.Printf("%s task %q failed %d times, dropping it: %s", w.Queue, t.Name, t.Attempts, err)
+		if err := w.Q.Done(t); err != nil {
+			log.Printf("warning: unable to drop %s task %q: %s", w.Queue, t.Name, err)
+		}
+		return true
+	}
+	log.Printf("%s task %q failed, retrying: %s", w.Queue, t.Name, err)
+	if err := w.Q.Retry(t, time.Now().Add(Backoff(t.Attempts))); err != nil {
+		log.Printf("warning: unable to retry %s task %q: %s", w.Queue, t.Name, err)
+	}
+	return true
+}
+
+// Backoff is how long to wait before running a task again after it has
+// failed attempts times: 10 seconds doubling up to an hour.
+func Backoff(attempts int) time.Duration {
+	d := 10 * time.Second
+	for i := 1; i < attempts && d < time.Hour; i++ {
+		d *= 2
+	}
+	if d > time.Hour {
+		d = time.Hour
+	}
+	return d
+}
@@ -0,0 +1,88 @@
+package queue
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+const taskKind = "Task"
+
+// StoreQueue is a Queue kept in a store.Store, so pending tasks survive a
+// restart when the store is persisted.
+type StoreQueue struct {
+	mu sync.Mutex // serializes check and update of tasks
+	st *store.Store
+}
+
+// NewStoreQueue returns a Queue keeping its tasks in st.
+func NewStoreQueue(st *store.Store) *StoreQueue {
+	return &StoreQueue{st: st}
+}
+
+func taskKey(t *Task) string {
+	return store.Key(t.Queue, t.Name)
+}
+
+// Add implements Queue.
+func (q *StoreQueue) Add(t *Task) (bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var existing Task
+	switch err := q.st.Get(taskKind, taskKey(t), &existing); err {
+	case nil:
+		return false, nil
+	case store.ErrNotFound:
+	default:
+		return false, err
+	}
+	if t.Created.IsZero() {
+		t.Created = time.Now()
+	}
+	t.Leased = time.Time{}
+	return true, q.st.Put(taskKind, taskKey(t), t)
+}
+
+// Lease implements Queue.
+func (q *StoreQueue) Lease(queue string, now time.Time, timeout time.Duration) (*Task, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var all []*Task
+	if _, err := q.st.GetAll(taskKind, store.Key(queue, ""), &all); err != nil {
+		return nil, err
+	}
+	var next *Task
+	for _, t := range all {
+		if now.Before(t.NotBefore) || !t.Leased.IsZero() && now.Sub(t.Leased) < timeout {
+			continue
+		}
+		if next == nil || t.NotBefore.Before(next.NotBefore) {
+			next = t
+		}
+	}
+	if next == nil {
+		return nil, nil
+	}
+	next.Leased = now
+	return next, q.st.Put(taskKind, taskKey(next), next)
+}
+
+// Done implements Queue.
+func (q *StoreQueue) Done(t *Task) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.st.Delete(taskKind, taskKey(t)); err != nil && err != store.ErrNotFound {
+		return err
+	}
+	return nil
+}
+
+// Retry implements Queue.
+func (q *StoreQueue) Retry(t *Task, at time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	t.NotBefore = at
+	t.Leased = time.Time{}
+	return q.st.Put(taskKind, taskKey(t), t)
+}
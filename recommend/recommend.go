@@ -0,0 +1,223 @@
+// Package recommend rates games for a game night. Scorers and enrichers are
+// registered at compile time, so a binary embedding this module can add its
+// own by importing a package that registers them from an init function:
+//
+//	func init() {
+//		recommend.RegisterScorer("light", recommend.ScorerFunc(func(g *recommend.Game, numPlayers int) float64 {
+//			return 5 - g.Weight
+//		}))
+//	}
+package recommend
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default is the name of the built in scorer.
+const Default = "default"
+
+// Game is a game evaluated for a specific number of players.
+type Game struct {
+	Name       string
+	ID         string
+	Best       bool
+	Rec        bool
+	MinPlayers int
+	MaxPlayers int
+	BestAt     []int // player counts the community voted best
+	GoodAt     []int // player counts voted best or recommended
+	Votes      Votes // the poll at the player count, zero unless the fit came from it
+	MinAge     int
+	Score      float64
+	Weight     float64
+	BScore     float64
+	Ratings    int
+	Categories []string
+	Mechanics  []string
+	Moods      []string
+	Fit        float64     // set by the scorer, higher is a better pick
+	Favorite   bool        // on the user's favorite list, Fit includes its boost
+	Plays      int         // times the user played it, from their recorded plays
+	LastPlayed time.Time   // zero if never played
+	Editions   []string    // other owned games that are editions or reimplementations of it
+	Expansions []Expansion // owned expansions of it, when they were asked for
+	With       string      // the owned expansion it needs at the player count, if any
+}
+
+// Votes is how the community voted on a single player count.
+type Votes struct {
+	Best int
+	Rec  int
+	Nay  int
+}
+
+// Total is the number of votes.
+func (v Votes) Total() int {
+	return v.Best + v.Rec + v.Nay
+}
+
+// Share is the part of the votes agreeing with the verdict, read the way
+// BGG's polls are: the nay votes when they match the others together, else
+// the best votes when they outvote recommended, else the best and
+// recommended votes. It is 0 without votes.
+func (v Votes) Share() float64 {
+	total := v.Total()
+	switch {
+	case total == 0:
+		return 0
+	case v.Best+v.Rec <= v.Nay:
+		return float64(v.Nay) / float64(total)
+	case v.Best > v.Rec:
+		return float64(v.Best) / float64(total)
+	}
+	return float64(v.Best+v.Rec) / float64(total)
+}
+
+// Percent is Share as a whole percentage.
+func (v Votes) Percent() int {
+	return int(math.Round(100 * v.Share()))
+}
+
+// Confidence is how sure the verdict is, from 0 to 1: the lower bound of
+// the 95% Wilson score interval of Share. A landslide of hundreds of votes
+// comes close to Share, a handful of votes stays well under it.
+func (v Votes) Confidence() float64 {
+	n := float64(v.Total())
+	if n == 0 {
+		return 0
+	}
+	const z = 1.96
+	p := v.Share()
+	return (p + z*z/(2*n) - z*math.Sqrt(p*(1-p)/n+z*z/(4*n*n))) / (1 + z*z/n)
+}
+
+// ConfidencePercent is Confidence as a whole percentage.
+func (v Votes) ConfidencePercent() int {
+	return int(math.Round(100 * v.Confidence()))
+}
+
+// Expansion is an owned expansion of a Game.
+type Expansion struct {
+	ID         string
+	Name       string
+	MinPlayers int
+	MaxPlayers int
+}
+
+// Scorer rates how good a pick g is for a night with numPlayers.
+type Scorer interface {
+	Score(g *Game, numPlayers int) float64
+}
+
+// ScorerFunc adapts a function to the Scorer interface.
+type ScorerFunc func(g *Game, numPlayers int) float64
+
+// Score calls f(g, numPlayers).
+func (f ScorerFunc) Score(g *Game, numPlayers int) float64 {
+	return f(g, numPlayers)
+}
+
+// Enricher adds data to a game after it is fetched from BGG and before it
+// is scored.
+type Enricher interface {
+	Enrich(g *Game) error
+}
+
+// EnricherFunc adapts a function to the Enricher interface.
+type EnricherFunc func(g *Game) error
+
+// Enrich calls f(g).
+func (f EnricherFunc) Enrich(g *Game) error {
+	return f(g)
+}
+
+type namedEnricher struct {
+	name string
+	e    Enricher
+}
+
+var (
+	mu        sync.RWMutex
+	scorers   = make(map[string]Scorer)
+	enrichers []namedEnricher
+)
+
+func init() {
+	RegisterScorer(Default, ScorerFunc(defaultScore))
+}
+
+// RegisterScorer makes a scorer available by name. It panics if the name
+// is already taken, as registration happens at init.
+func RegisterScorer(name string, s Scorer) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := scorers[name]; dup {
+		panic(fmt.Sprintf("recommend: scorer %q registered twice", name))
+	}
+	scorers[name] = s
+}
+
+// RegisterEnricher adds an enricher run on every fetched game, in
+// registration order. It panics if the name is already taken.
+func RegisterEnricher(name string, e Enricher) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, ne := range enrichers {
+		if ne.name == name {
+			panic(fmt.Sprintf("recommend: enricher %q registered twice", name))
+		}
+	}
+	enrichers = append(enrichers, namedEnricher{name, e})
+}
+
+// Scorers returns the names of the registered scorers, the default first.
+func Scorers() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	var names []string
+	for name := range scorers {
+		if name != Default {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{Default}, names...)
+}
+
+// Lookup returns the scorer registered as name.
+func Lookup(name string) (Scorer, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	s, ok := scorers[name]
+	return s, ok
+}
+
+// Enrich runs every registered enricher on g. A failing enricher is logged
+// and skipped so one bad plugin can't hide a game.
+func Enrich(g *Game) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, ne := range enrichers {
+		if err := ne.e.Enrich(g); err != nil {
+			log.Printf("warning: enricher %q failed for game %q: %s", ne.name, g.ID, err)
+		}
+	}
+}
+
+// defaultScore prefers games voted best over recommended ones, then breaks
+// ties with the BGG geek rating.
+func defaultScore(g *Game, numPlayers int) float64 {
+	var fit float64
+	switch {
+	case g.Best:
+		fit = 20
+	case g.Rec:
+		fit = 10
+	}
+	return fit + g.BScore
+}
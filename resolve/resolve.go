@@ -0,0 +1,88 @@
+// Package resolve combines what the site's data sources say about a game
+// into the values shown. Each field takes the value of the highest layer
+// that has one: a user override beats values adjusted for expansions, which
+// beat the BGG community polls, which beat the box.
+package resolve
+
+// Layer is a source of game fields. Later layers take precedence.
+type Layer int
+
+// The layers, lowest precedence first.
+const (
+	Box       Layer = iota // the publisher's values from the thing XML
+	Poll                   // the BGG community polls
+	Expansion              // adjusted for the expansions the user owns
+	Override               // set by the user
+)
+
+var layerNames = [...]string{"box", "BGG poll", "expansions", "user override"}
+
+func (l Layer) String() string {
+	if l < Box || l > Override {
+		return "unknown"
+	}
+	return layerNames[l]
+}
+
+// PlayerRange is the player counts a game supports.
+type PlayerRange struct {
+	Min, Max int
+}
+
+// Fit is how well a game suits the player count asked about.
+type Fit struct {
+	Best, Rec bool
+}
+
+// Input is what each layer says about a game. A layer without a say on a
+// field is left out of that field's map.
+type Input struct {
+	Players map[Layer]PlayerRange
+	Fit     map[Layer]Fit
+	Moods   map[Layer][]string
+}
+
+// NewInput returns an Input with nothing offered yet.
+func NewInput() *Input {
+	return &Input{
+		Players: make(map[Layer]PlayerRange),
+		Fit:     make(map[Layer]Fit),
+		Moods:   make(map[Layer][]string),
+	}
+}
+
+// Result is the resolved fields of a game and the layer each came from.
+// A field no layer had a say on is left zero, from Box.
+type Result struct {
+	Players     PlayerRange
+	PlayersFrom Layer
+	Fit         Fit
+	FitFrom     Layer
+	Moods       []string
+	MoodsFrom   Layer
+}
+
+// Resolve picks the value of each field from its highest layer.
+func (in *Input) Resolve() Result {
+	var r Result
+	if l, ok := top(func(l Layer) bool { _, ok := in.Players[l]; return ok }); ok {
+		r.Players, r.PlayersFrom = in.Players[l], l
+	}
+	if l, ok := top(func(l Layer) bool { _, ok := in.Fit[l]; return ok }); ok {
+		r.Fit, r.FitFrom = in.Fit[l], l
+	}
+	if l, ok := top(func(l Layer) bool { _, ok := in.Moods[l]; return ok }); ok {
+		r.Moods, r.MoodsFrom = in.Moods[l], l
+	}
+	return r
+}
+
+// top returns the highest layer for which has is true.
+func top(has func(Layer) bool) (Layer, bool) {
+	for l := Override; l >= Box; l-- {
+		if has(l) {
+			return l, true
+		}
+	}
+	return Box, false
+}
@@ -0,0 +1,88 @@
+package resolve
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	// Every layer says something different, the override that the game
+	// isn't a fit at all.
+	box := Fit{Rec: true}
+	poll := Fit{Best: true}
+	expansion := Fit{Best: true, Rec: true}
+	override := Fit{}
+
+	tests := []struct {
+		name    string
+		fit     map[Layer]Fit
+		want    Fit
+		wantSrc Layer
+	}{
+		{"no layer has a say", map[Layer]Fit{}, Fit{}, Box},
+		{"poll beats box", map[Layer]Fit{Box: box, Poll: poll}, poll, Poll},
+		{"expansion beats poll", map[Layer]Fit{Box: box, Poll: poll, Expansion: expansion}, expansion, Expansion},
+		{"override beats expansion", map[Layer]Fit{Box: box, Poll: poll, Expansion: expansion, Override: override}, override, Override},
+		{"override without the rest", map[Layer]Fit{Override: override}, override, Override},
+		{"empty override falls through to expansion", map[Layer]Fit{Box: box, Expansion: expansion}, expansion, Expansion},
+		{"empty expansion and override fall through to poll", map[Layer]Fit{Box: box, Poll: poll}, poll, Poll},
+		{"empty poll and expansion fall through to box", map[Layer]Fit{Box: box}, box, Box},
+		{"override over box alone", map[Layer]Fit{Box: box, Override: override}, override, Override},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := NewInput()
+			for l, f := range tt.fit {
+				in.Fit[l] = f
+			}
+			r := in.Resolve()
+			if r.Fit != tt.want {
+				t.Errorf("Fit = %+v, want %+v", r.Fit, tt.want)
+			}
+			if r.FitFrom != tt.wantSrc {
+				t.Errorf("FitFrom = %s, want %s", r.FitFrom, tt.wantSrc)
+			}
+		})
+	}
+}
+
+func TestResolveFieldsIndependently(t *testing.T) {
+	in := NewInput()
+	in.Players[Box] = PlayerRange{2, 4}
+	in.Players[Expansion] = PlayerRange{2, 6}
+	in.Fit[Poll] = Fit{Rec: true}
+	in.Moods[Box] = []string{"chill"}
+	in.Moods[Override] = []string{"cutthroat"}
+
+	want := Result{
+		Players:     PlayerRange{2, 6},
+		PlayersFrom: Expansion,
+		Fit:         Fit{Rec: true},
+		FitFrom:     Poll,
+		Moods:       []string{"cutthroat"},
+		MoodsFrom:   Override,
+	}
+	if got := in.Resolve(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve() = %+v, want %+v", got, want)
+	}
+}
+
+func TestResolveEmptyLayerValue(t *testing.T) {
+	// A layer with a say wins even when its value is the zero one, such as
+	// an override clearing every mood.
+	in := NewInput()
+	in.Moods[Box] = []string{"chill"}
+	in.Moods[Override] = nil
+	r := in.Resolve()
+	if len(r.Moods) != 0 || r.MoodsFrom != Override {
+		t.Errorf("Moods = %v from %s, want none from %s", r.Moods, r.MoodsFrom, Override)
+	}
+}
+
+func TestLayerString(t *testing.T) {
+	for l, want := range map[Layer]string{Box: "box", Poll: "BGG poll", Expansion: "expansions", Override: "user override", Layer(9): "unknown"} {
+		if got := l.String(); got != want {
+			t.Errorf("Layer(%d).String() = %q, want %q", int(l), got, want)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// Package resources holds the site's templates and static files, embedded
+// so the binary runs from any directory.
+package resources
+
+import "embed"
+
+// FS has the templates at its root and the static files under static/.
+//
+//go:embed *.html static
+var FS embed.FS
@@ -0,0 +1,153 @@
+// Package respcache keeps the rendered responses of expensive read only
+// pages until the store data they are built from changes.
+package respcache
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// maxEntries bounds the memory used by a Cache.
+const maxEntries = 1000
+
+// Cache holds rendered pages. Entries are keyed by path, query, Accept and
+// cookies, so every user and set of parameters gets its own copy.
+type Cache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*entry
+	gen     uint64 // bumped by every invalidation
+}
+
+type entry struct {
+	kinds   []string
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// New returns a Cache of pages built from st, keeping each for at most ttl.
+func New(st *store.Store, ttl time.Duration) *Cache {
+	c := &Cache{ttl: ttl, entries: make(map[string]*entry)}
+	st.Watch(func(kind, key string) { c.Invalidate(kind) })
+	return c
+}
+
+// SetTTL changes how long new pages are kept, for config reloads.
+func (c *Cache) SetTTL(ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ttl = ttl
+}
+
+// Invalidate drops every page built from kind. Pages still being rendered
+// are not kept either, even if nothing built from kind is cached yet.
+func (c *Cache) Invalidate(kind string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	for k, e := range c.entries {
+		for _, dep := range e.kinds {
+			if dep == kind {
+				delete(c.entries, k)
+				break
+			}
+		}
+	}
+}
+
+// Page caches the successful GET responses of h, which must be built only
+// from the store entities of kinds.
+func (c *Cache) Page(h http.Handler, kinds ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			h.ServeHTTP(w, r)
+			return
+		}
+		key := r.URL.Path + "?" + r.URL.Query().Encode() + "\n" + r.Header.Get("Accept") + "\n" + r.Header.Get("Cookie")
+		now := time.Now()
+
+		c.mu.Lock()
+		e, ok := c.entries[key]
+		gen, ttl := c.gen, c.ttl
+		c.mu.Unlock()
+		if ok && now.Before(e.expires) {
+			for k, v := range e.header {
+				w.Header()[k] = v
+			}
+			w.Write(e.body)
+			return
+		}
+
+		rec := &recorder{ResponseWriter: w, code: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		if rec.code != http.StatusOK {
+			return
+		}
+		c.store(key, gen, &entry{kinds: kinds, header: plainHeader(rec.Header()), body: rec.body.Bytes(), expires: now.Add(ttl)})
+	})
+}
+
+// plainHeader copies h without the headers a compressor wrapping the cache
+// adds. The body is kept as written by the page, uncompressed, and is
+// compressed again for each client that accepts it.
+func plainHeader(h http.Header) http.Header {
+	h = h.Clone()
+	h.Del("Content-Encoding")
+	h.Del("Content-Length")
+	var vary []string
+	for _, v := range h.Values("Vary") {
+		if !strings.EqualFold(strings.TrimSpace(v), "Accept-Encoding") {
+			vary = append(vary, v)
+		}
+	}
+	h.Del("Vary")
+	if len(vary) > 0 {
+		h["Vary"] = vary
+	}
+	return h
+}
+
+// store adds e unless the cache was invalidated since gen, when e may have
+// been built from data that is already gone.
+func (c *Cache) store(key string, gen uint64, e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.gen != gen {
+		return
+	}
+	if len(c.entries) >= maxEntries {
+		now := time.Now()
+		for k, old := range c.entries {
+			if now.After(old.expires) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxEntries {
+			return
+		}
+	}
+	c.entries[key] = e
+}
+
+// recorder keeps a copy of the response it writes through.
+type recorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (r *recorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
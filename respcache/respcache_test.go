@@ -0,0 +1,103 @@
+package respcache
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/middleware"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+const page = "<p>hello</p>"
+
+func newCache(t *testing.T) (*Cache, *store.Store) {
+	t.Helper()
+	st, err := store.Open("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(st, time.Minute), st
+}
+
+func TestPageThroughGzip(t *testing.T) {
+	c, _ := newCache(t)
+	renders := 0
+	h := middleware.Gzip(c.Page(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		renders++
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}), "Kind"))
+
+	tests := []struct {
+		name string
+		gzip bool
+	}{
+		{"miss with gzip", true},
+		{"hit with gzip", true},
+		{"hit without gzip", false},
+		{"hit with gzip again", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/page", nil)
+			if tt.gzip {
+				r.Header.Set("Accept-Encoding", "gzip")
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			body := w.Body.Bytes()
+			ce := w.Header().Get("Content-Encoding")
+			if tt.gzip {
+				if ce != "gzip" {
+					t.Fatalf("Content-Encoding = %q, want gzip", ce)
+				}
+				zr, err := gzip.NewReader(w.Body)
+				if err != nil {
+					t.Fatalf("body is not gzip: %s", err)
+				}
+				if body, err = ioutil.ReadAll(zr); err != nil {
+					t.Fatalf("unable to read gzip body: %s", err)
+				}
+			} else if ce != "" {
+				t.Fatalf("Content-Encoding = %q, want none", ce)
+			}
+			if string(body) != page {
+				t.Errorf("body = %q, want %q", body, page)
+			}
+			if vary := w.Header().Values("Vary"); tt.gzip && len(vary) != 1 {
+				t.Errorf("Vary = %q, want Accept-Encoding once", vary)
+			}
+		})
+	}
+	if renders != 1 {
+		t.Errorf("page rendered %d times, want 1", renders)
+	}
+}
+
+func TestInvalidateDuringRender(t *testing.T) {
+	c, st := newCache(t)
+	renders := 0
+	h := c.Page(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		renders++
+		if renders == 1 {
+			// A write to a kind nothing is cached for yet, while the
+			// first render is under way.
+			if err := st.Put("Kind", "a", 1); err != nil {
+				t.Fatal(err)
+			}
+		}
+		w.Write([]byte(page))
+	}), "Kind")
+
+	for i := 0; i < 2; i++ {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/page", nil))
+	}
+	if renders != 2 {
+		t.Errorf("page rendered %d times, want 2, the first render must not be kept", renders)
+	}
+}
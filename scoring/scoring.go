@@ -0,0 +1,151 @@
+// Package scoring keeps the score sheets of games, the categories players
+// score points in, and totals sheets filled in at the end of a play.
+package scoring
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+	"github.com/mattkoler/board_game_helper/syncapi"
+	"github.com/mattkoler/board_game_helper/trash"
+)
+
+// MaxCategories bounds the categories of a sheet.
+const MaxCategories = 20
+
+// Default is the sheet of games without one, a single total.
+var Default = []string{"Points"}
+
+// builtin is the sheets of popular games with scoring categories, by BGG ID.
+var builtin = map[string][]string{
+	"13":     {"Settlements", "Cities", "Longest road", "Largest army", "Victory point cards"},        // Catan
+	"822":    {"Roads", "Cities", "Monasteries", "Fields"},                                            // Carcassonne
+	"68448":  {"Military", "Coins", "Wonder", "Civilian", "Commercial", "Guilds", "Science"},          // 7 Wonders
+	"167791": {"Terraform rating", "Milestones", "Awards", "Greeneries", "Cities", "Cards"},           // Terraforming Mars
+	"199792": {"Cards", "Point tokens", "Prosperity", "Journey", "Events"},                            // Everdell
+	"266192": {"Birds", "Bonus cards", "End-of-round goals", "Eggs", "Food on cards", "Tucked cards"}, // Wingspan
+}
+
+// SheetKind is the store kind of the sheets users made for their games.
+const SheetKind = "ScoreSheet"
+
+func init() {
+	trash.Register(SheetKind, "Score sheet")
+	syncapi.Register(SheetKind)
+}
+
+// Sheet is a user's score sheet for a game, replacing the built in one.
+type Sheet struct {
+	Owner      string
+	GameID     string
+	Categories []string
+	Updated    time.Time
+}
+
+func sheetKey(owner, gameID string) string {
+	return store.Key(strings.ToLower(owner), gameID)
+}
+
+// Categories returns the scoring categories of a game for owner, preferring
+// the sheet they made over the built in one, and Default if there is
+// neither.
+func Categories(st *store.Store, owner, gameID string) []string {
+	var s Sheet
+	switch err := st.Get(SheetKind, sheetKey(owner, gameID), &s); err {
+	case nil:
+		return s.Categories
+	case store.ErrNotFound:
+	default:
+		log.Printf("warning: unable to load score sheet for %q: %s", gameID, err)
+	}
+	if c, ok := builtin[gameID]; ok {
+		return c
+	}
+	return Default
+}
+
+// Custom reports whether owner made their own sheet for a game.
+func Custom(st *store.Store, owner, gameID string) bool {
+	var s Sheet
+	return st.Get(SheetKind, sheetKey(owner, gameID), &s) == nil
+}
+
+// Clean drops blank and repeated categories, checking what is left.
+func Clean(categories []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var cleaned []string
+	for _, c := range categories {
+		c = strings.TrimSpace(c)
+		if c == "" || seen[strings.ToLower(c)] {
+			continue
+		}
+		if len(c) > 40 {
+			return nil, fmt.Errorf("bad category %q, please provide at most 40 characters", c)
+		}
+		seen[strings.ToLower(c)] = true
+		cleaned = append(cleaned, c)
+	}
+	if len(cleaned) == 0 || len(cleaned) > MaxCategories {
+		return nil, fmt.Errorf("bad categories param, please provide 1-%d categories", MaxCategories)
+	}
+	return cleaned, nil
+}
+
+// Save replaces owner's sheet for a game with categories, cleaned by Clean.
+func Save(st *store.Store, owner, gameID string, categories []string) error {
+	cleaned, err := Clean(categories)
+	if err != nil {
+		return err
+	}
+	return st.Put(SheetKind, sheetKey(owner, gameID), &Sheet{Owner: owner, GameID: gameID, Categories: cleaned, Updated: time.Now()})
+}
+
+// Reset moves owner's sheet for a game to the trash, so the built in one
+// applies again.
+func Reset(st *store.Store, owner, gameID string) error {
+	err := st.SoftDelete(SheetKind, sheetKey(owner, gameID))
+	if err == store.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Entry is one player's filled in sheet.
+type Entry struct {
+	Name   string
+	Points []float64 // by category
+	Total  float64
+	Win    bool
+}
+
+// Tally totals each entry's points and marks the highest totals as wins.
+// Every entry needs a name and points for each of categories.
+func Tally(categories []string, entries []*Entry) error {
+	if len(entries) == 0 {
+		return errors.New("bad players param, please fill in at least one player")
+	}
+	best := 0.0
+	for i, e := range entries {
+		if e.Name == "" {
+			return fmt.Errorf("player %d has no name", i+1)
+		}
+		if len(e.Points) != len(categories) {
+			return fmt.Errorf("player %s has %d scores, expected %d", e.Name, len(e.Points), len(categories))
+		}
+		e.Total = 0
+		for _, p := range e.Points {
+			e.Total += p
+		}
+		if i == 0 || e.Total > best {
+			best = e.Total
+		}
+	}
+	for _, e := range entries {
+		e.Win = e.Total == best
+	}
+	return nil
+}
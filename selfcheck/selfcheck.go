@@ -0,0 +1,57 @@
+// Package selfcheck runs the startup checks of the site and reports them in
+// one summary, so a broken deployment stops at boot with a way to fix it
+// instead of failing mid-request later.
+package selfcheck
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// Check is one thing the site needs to start.
+type Check struct {
+	Name string
+	Fix  string // what to do when the check fails
+
+	// Run does the check, returning a detail for the summary. Errors made
+	// with Warning are reported without stopping the site.
+	Run func(ctx context.Context) (string, error)
+}
+
+type warning struct{ error }
+
+// Warning marks err as a problem the site can run with.
+func Warning(err error) error {
+	return warning{err}
+}
+
+// Run runs checks in order and writes the summary to w. Checks after a
+// failed one are skipped, since they may depend on it. It reports whether
+// the site can start.
+func Run(ctx context.Context, w io.Writer, checks []Check) bool {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	defer tw.Flush()
+	fmt.Fprintln(tw, "startup self-check:")
+	ok := true
+	for _, c := range checks {
+		if !ok {
+			fmt.Fprintf(tw, "  skip\t%s\t\n", c.Name)
+			continue
+		}
+		detail, err := c.Run(ctx)
+		switch err.(type) {
+		case nil:
+			fmt.Fprintf(tw, "  ok\t%s\t%s\n", c.Name, detail)
+		case warning:
+			fmt.Fprintf(tw, "  WARN\t%s\t%s\n", c.Name, err)
+			fmt.Fprintf(tw, "  \t\tfix: %s\n", c.Fix)
+		default:
+			ok = false
+			fmt.Fprintf(tw, "  FAIL\t%s\t%s\n", c.Name, err)
+			fmt.Fprintf(tw, "  \t\tfix: %s\n", c.Fix)
+		}
+	}
+	return ok
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/gamefmt"
+	"github.com/mattkoler/board_game_helper/pdf"
+)
+
+// CatalogGame is an owned game as listed in the printable catalog.
+type CatalogGame struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	Image      string  `json:"image"`
+	Year       int     `json:"year"`
+	MinPlayers int     `json:"minPlayers"`
+	MaxPlayers int     `json:"maxPlayers"`
+	BestAt     []int   `json:"bestAt"`
+	MinTime    int     `json:"minTime"`
+	MaxTime    int     `json:"maxTime"`
+	Weight     float64 `json:"weight"`
+}
+
+// Catalog is a collection to print, for a binder at the game shelf or a
+// café menu.
+type Catalog struct {
+	BGGName string         `json:"bggName"`
+	Games   []*CatalogGame `json:"games"`
+	Pending int            `json:"pending"`
+	Stale   bool           `json:"stale"` // BGG is unavailable, the collection is the one last fetched
+}
+
+// Catalog lists bggName's owned games by name. Games not cached yet are
+// queued and left out.
+func (s *Service) Catalog(ctx context.Context, bggName string) (*Catalog, error) {
+	owned, stale, err := s.bgg.OwnedOrStale(ctx, bggName)
+	if err != nil {
+		return nil, err
+	}
+	c := &Catalog{BGGName: bggName, Games: []*CatalogGame{}, Stale: stale}
+	for _, g := range owned {
+		t := s.bgg.CachedThing(g.ID)
+		if t == nil {
+			c.Pending++
+			s.queueGameFetch(g.ID, false)
+			continue
+		}
+		cg := &CatalogGame{
+			ID:         g.ID,
+			Name:       t.Name,
+			Image:      t.Image,
+			Year:       t.Year,
+			MinPlayers: t.MinPlayers,
+			MaxPlayers: t.MaxPlayers,
+			MinTime:    t.MinTime,
+			MaxTime:    t.MaxTime,
+			Weight:     t.Weight,
+		}
+		if cg.Image == "" {
+			cg.Image = t.Thumbnail
+		}
+		if counts, err := t.PlayerCounts(); err == nil {
+			cg.BestAt = counts.Best
+		}
+		c.Games = append(c.Games, cg)
+	}
+	sort.Slice(c.Games, func(i, j int) bool {
+		return strings.ToLower(c.Games[i].Name) < strings.ToLower(c.Games[j].Name)
+	})
+	return c, nil
+}
+
+// Details sums up how g plays, such as "2-4 players (best 3) · 45-90 min ·
+// Medium Light 2.31".
+func (g *CatalogGame) Details() string {
+	var parts []string
+	if r := gamefmt.PlayerRange(g.MinPlayers, g.MaxPlayers); r != "" {
+		p := r + " players"
+		if len(g.BestAt) > 0 {
+			p += " (best " + gamefmt.CountList(g.BestAt) + ")"
+		}
+		parts = append(parts, p)
+	}
+	if t := gamefmt.PlayTime(g.MinTime, g.MaxTime); t != "" {
+		parts = append(parts, t)
+	}
+	if l := gamefmt.WeightLabel(g.Weight); l != "" {
+		parts = append(parts, fmt.Sprintf("%s %.2f", l, g.Weight))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// The layout of the PDF catalog, in points.
+const (
+	catalogMargin = 54
+	catalogRow    = 34
+)
+
+var (
+	catalogTitle = pdf.Font{Size: 20, Bold: true}
+	catalogName  = pdf.Font{Size: 12, Bold: true}
+	catalogInfo  = pdf.Font{Size: 9.5, Gray: 0.35}
+)
+
+// WritePDF writes c as a PDF to print, a game per row. Covers are left out,
+// the PDF is text only.
+func (c *Catalog) WritePDF(w io.Writer) error {
+	doc := pdf.New()
+	width := float64(pdf.PageWidth - 2*catalogMargin)
+	doc.Text(catalogMargin, catalogMargin+14, catalogTitle, pdf.Fit(c.BGGName+"'s games", catalogTitle, width))
+	doc.Text(catalogMargin, catalogMargin+30, catalogInfo, fmt.Sprintf("%d games, %s", len(c.Games), time.Now().Format("January 2006")))
+	y := float64(catalogMargin + 52)
+	for _, g := range c.Games {
+		if y+catalogRow > pdf.PageHeight-catalogMargin {
+			doc.AddPage()
+			y = catalogMargin
+		}
+		name := g.Name
+		if g.Year > 0 {
+			name += fmt.Sprintf(" (%d)", g.Year)
+		}
+		doc.Text(catalogMargin, y+12, catalogName, pdf.Fit(name, catalogName, width))
+		doc.Text(catalogMargin, y+25, catalogInfo, pdf.Fit(g.Details(), catalogInfo, width))
+		doc.Line(catalogMargin, y+catalogRow-2, pdf.PageWidth-catalogMargin, y+catalogRow-2)
+		y += catalogRow
+	}
+	_, err := doc.WriteTo(w)
+	return err
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/plays"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// challengeKind holds each user's 10x10 challenges, keyed by lowercased BGG
+// name and year.
+const challengeKind = "Challenge"
+
+// The 10x10 challenge is to play ChallengeGames games ChallengeGoal times
+// each in a year.
+const (
+	ChallengeGames = 10
+	ChallengeGoal  = 10
+)
+
+// Challenge is the games a user picked for their 10x10 challenge of a year.
+type Challenge struct {
+	BGGName string    `json:"bggName"`
+	Year    int       `json:"year"`
+	GameIDs []string  `json:"gameIds"`
+	Updated time.Time `json:"updated"`
+}
+
+// Validate checks c, dropping repeated games.
+func (c *Challenge) Validate() error {
+	if c.Year < 1900 || c.Year > time.Now().Year()+1 {
+		return errors.New("bad year param, please provide this year or a past one")
+	}
+	seen := make(map[string]bool)
+	var ids []string
+	for _, id := range c.GameIDs {
+		if _, err := strconv.Atoi(id); err != nil {
+			return fmt.Errorf("bad game id %q, please provide numeric game ids", id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) != ChallengeGames {
+		return fmt.Errorf("bad games param, please pick %d different games", ChallengeGames)
+	}
+	c.GameIDs = ids
+	return nil
+}
+
+// ChallengeGame is a game of a 10x10 challenge and how far along it is.
+type ChallengeGame struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Plays   int    `json:"plays"` // in the challenge year
+	Done    bool   `json:"done"`  // played ChallengeGoal times
+	Percent int    `json:"percent"`
+}
+
+// ChallengeProgress is how far a user is with their 10x10 challenge of a
+// year, going by their recorded plays.
+type ChallengeProgress struct {
+	BGGName  string           `json:"bggName"`
+	Year     int              `json:"year"`
+	Set      bool             `json:"set"`   // the games were picked
+	Games    []*ChallengeGame `json:"games"` // fewest plays first
+	Plays    int              `json:"plays"` // counting at most ChallengeGoal per game
+	Done     int              `json:"done"`  // games played ChallengeGoal times
+	Percent  int              `json:"percent"`
+	Choices  []SnapshotGame   `json:"choices"` // the owned games to pick from, by name
+	Selected map[string]bool  `json:"-"`       // the picked game IDs, for the picker
+	Stale    bool             `json:"stale"`   // BGG is unavailable, the choices are the collection last fetched
+}
+
+// SetChallenge saves c as the challenge of its user and year, replacing
+// any games picked before.
+func (s *Service) SetChallenge(c *Challenge) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	c.Updated = time.Now()
+	return s.st.Put(challengeKind, store.Key(strings.ToLower(c.BGGName), strconv.Itoa(c.Year)), c)
+}
+
+// ChallengeProgress reports bggName's 10x10 challenge of year, counting the
+// plays recorded for its games that year. Their BGG plays are queued to sync,
+// so plays logged on BGG advance it too.
+func (s *Service) ChallengeProgress(ctx context.Context, bggName string, year int) (*ChallengeProgress, error) {
+	owned, stale, err := s.bgg.OwnedOrStale(ctx, bggName)
+	if err != nil {
+		return nil, err
+	}
+	s.queuePlaysSync(bggName)
+	p := &ChallengeProgress{BGGName: bggName, Year: year, Games: []*ChallengeGame{}, Choices: []SnapshotGame{}, Selected: make(map[string]bool), Stale: stale}
+	names := make(map[string]string, len(owned))
+	for _, g := range owned {
+		names[g.ID] = g.Name
+		p.Choices = append(p.Choices, SnapshotGame{ID: g.ID, Name: g.Name})
+	}
+	sort.Slice(p.Choices, func(i, j int) bool {
+		return strings.ToLower(p.Choices[i].Name) < strings.ToLower(p.Choices[j].Name)
+	})
+
+	var c Challenge
+	switch err := s.st.Get(challengeKind, store.Key(strings.ToLower(bggName), strconv.Itoa(year)), &c); err {
+	case nil:
+	case store.ErrNotFound:
+		return p, nil
+	default:
+		return nil, err
+	}
+	p.Set = true
+	all, err := plays.List(s.st, bggName)
+	if err != nil {
+		return nil, err
+	}
+	games := make(map[string]*ChallengeGame, len(c.GameIDs))
+	for _, id := range c.GameIDs {
+		g := &ChallengeGame{ID: id, Name: names[id]}
+		games[id] = g
+		p.Games = append(p.Games, g)
+		p.Selected[id] = true
+	}
+	for _, pl := range all {
+		g := games[pl.GameID]
+		if g == nil || pl.Date.Year() != year {
+			continue
+		}
+		g.Plays += pl.Times()
+		if g.Name == "" {
+			g.Name = pl.GameName
+		}
+	}
+	for _, g := range p.Games {
+		if g.Name == "" {
+			if t := s.bgg.CachedThing(g.ID); t != nil {
+				g.Name = t.Name
+			} else {
+				g.Name = "Game " + g.ID
+			}
+		}
+		if g.Plays >= ChallengeGoal {
+			g.Done = true
+			p.Done++
+			p.Plays += ChallengeGoal
+			g.Percent = 100
+		} else {
+			p.Plays += g.Plays
+			g.Percent = g.Plays * 100 / ChallengeGoal
+		}
+	}
+	p.Percent = p.Plays * 100 / (ChallengeGames * ChallengeGoal)
+	sort.SliceStable(p.Games, func(i, j int) bool {
+		if p.Games[i].Plays != p.Games[j].Plays {
+			return p.Games[i].Plays < p.Games[j].Plays
+		}
+		return strings.ToLower(p.Games[i].Name) < strings.ToLower(p.Games[j].Name)
+	})
+	return p, nil
+}
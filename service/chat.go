@@ -0,0 +1,232 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mattkoler/board_game_helper/recommend"
+)
+
+// DiscordLimit is the most characters Discord allows in a message.
+const DiscordLimit = 2000
+
+// webhookClient posts chat messages, separate from the BGG client so a slow
+// chat service can't take BGG request slots.
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// SlackLimit is the most characters Slack shows in a message before
+// truncating it.
+const SlackLimit = 4000
+
+// TelegramLimit is the most characters Telegram allows in a message.
+const TelegramLimit = 4096
+
+// chatStyle is the markup a chat service uses for recommendation messages.
+type chatStyle struct {
+	escape  *strings.Replacer
+	bold    string            // before bold text
+	boldEnd string            // after bold text, the same as bold if empty
+	emoji   map[string]string // emoji for shortcodes the service doesn't know, if any
+}
+
+// discordStyle escapes the characters Discord treats as markdown.
+var discordStyle = chatStyle{
+	escape: strings.NewReplacer(`\`, `\\`, `*`, `\*`, `_`, `\_`, `~`, `\~`, "`", "\\`", `|`, `\|`, `>`, `\>`),
+	bold:   "**",
+}
+
+// telegramStyle is Telegram's HTML parse mode, which knows no emoji
+// shortcodes.
+var telegramStyle = chatStyle{
+	escape:  strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;"),
+	bold:    "<b>",
+	boldEnd: "</b>",
+	emoji:   map[string]string{"game_die": "🎲", "star": "⭐", "thumbsup": "👍", "shrug": "🤷"},
+}
+
+// slackStyle escapes the characters Slack treats as control sequences,
+// Slack has no way to escape its markdown.
+var slackStyle = chatStyle{
+	escape: strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;"),
+	bold:   "*",
+}
+
+func (st chatStyle) strong(text string) string {
+	if st.boldEnd == "" {
+		return st.bold + text + st.bold
+	}
+	return st.bold + text + st.boldEnd
+}
+
+// icon returns the emoji called name, as a shortcode unless the style maps
+// it.
+func (st chatStyle) icon(name string) string {
+	if e, ok := st.emoji[name]; ok {
+		return e
+	}
+	return ":" + name + ":"
+}
+
+// DiscordMessage formats the recommendations in c, as returned by Recommend,
+// as a Discord markdown message of at most limit characters. Games that
+// don't fit are summed up in the last line.
+func DiscordMessage(c *Collection, limit int) string {
+	return chatMessage(c, limit, discordStyle)
+}
+
+// SlackMessage is DiscordMessage for Slack's mrkdwn.
+func SlackMessage(c *Collection, limit int) string {
+	return chatMessage(c, limit, slackStyle)
+}
+
+// TelegramMessage is DiscordMessage for Telegram's HTML parse mode.
+func TelegramMessage(c *Collection, limit int) string {
+	return chatMessage(c, limit, telegramStyle)
+}
+
+func chatMessage(c *Collection, limit int, st chatStyle) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s from %s's collection", st.icon("game_die"), st.strong(fmt.Sprintf("Game night picks for %d players", c.NumPlayers)), st.escape.Replace(c.BGGName))
+	if c.Mood != "" {
+		fmt.Fprintf(&b, ", feeling %s", c.Mood)
+	}
+	b.WriteString("\n")
+	if len(c.Games) == 0 {
+		b.WriteString("Nothing voted best or recommended at that count " + st.icon("shrug") + "\n")
+		return b.String()
+	}
+
+	type line struct {
+		text string
+		game bool
+	}
+	var lines []line
+	best, rec := false, false
+	for _, g := range c.Games {
+		switch {
+		case g.Best && !best:
+			best = true
+			lines = append(lines, line{text: st.icon("star") + " " + st.strong("Best")})
+		case !g.Best && !rec:
+			rec = true
+			lines = append(lines, line{text: st.icon("thumbsup") + " " + st.strong("Recommended")})
+		}
+		lines = append(lines, line{text: chatLine(g, st), game: true})
+	}
+
+	// Keep room for the "and more" line unless the last game fits.
+	size := utf8.RuneCountInString(b.String())
+	reserve := utf8.RuneCountInString(fmt.Sprintf("…and %d more", len(c.Games)))
+	shown := 0
+	for i, l := range lines {
+		n := utf8.RuneCountInString(l.text) + 1
+		if size+n > limit || i < len(lines)-1 && size+n+reserve > limit {
+			fmt.Fprintf(&b, "…and %d more", len(c.Games)-shown)
+			break
+		}
+		b.WriteString(l.text)
+		b.WriteString("\n")
+		size += n
+		if l.game {
+			shown++
+		}
+	}
+	return b.String()
+}
+
+func chatLine(g *recommend.Game, st chatStyle) string {
+	line := fmt.Sprintf("• %s (%d-%dp, weight %.1f)", st.strong(st.escape.Replace(g.Name)), g.MinPlayers, g.MaxPlayers, g.Weight)
+	if len(g.Moods) > 0 {
+		line += " · " + strings.Join(g.Moods, ", ")
+	}
+	return line
+}
+
+// DiscordPickMessage suggests g as the game to play.
+func DiscordPickMessage(g *recommend.Game) string {
+	return ":game_die: How about this one?\n" + chatLine(g, discordStyle)
+}
+
+// TelegramPickMessage is DiscordPickMessage for Telegram's HTML parse mode.
+func TelegramPickMessage(g *recommend.Game) string {
+	return telegramStyle.icon("game_die") + " How about this one?\n" + chatLine(g, telegramStyle)
+}
+
+// DiscordGameMessage formats a game's details as a Discord markdown message.
+func DiscordGameMessage(d *GameDetail) string {
+	st, g := discordStyle, d.Game
+	var b strings.Builder
+	fmt.Fprintf(&b, ":game_die: %s", st.strong(st.escape.Replace(g.Name)))
+	if d.Year != 0 {
+		fmt.Fprintf(&b, " (%d)", d.Year)
+	}
+	fmt.Fprintf(&b, "\n%d-%d players · weight %.1f · rated %.1f by %d users\n", g.MinPlayers, g.MaxPlayers, g.Weight, g.Score, g.Ratings)
+	if len(g.Moods) > 0 {
+		fmt.Fprintf(&b, "Moods: %s\n", strings.Join(g.Moods, ", "))
+	}
+	if desc := []rune(d.Description); len(desc) > 300 {
+		fmt.Fprintf(&b, "%s…\n", st.escape.Replace(string(desc[:300])))
+	} else if len(desc) > 0 {
+		fmt.Fprintf(&b, "%s\n", st.escape.Replace(d.Description))
+	}
+	fmt.Fprintf(&b, "<https://boardgamegeek.com/boardgame/%s>", g.ID)
+	return b.String()
+}
+
+// PostDiscord posts msg to a Discord webhook. Mentions are disabled so game
+// names can't ping anyone.
+func (s *Service) PostDiscord(ctx context.Context, webhookURL, msg string) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"content":          msg,
+		"allowed_mentions": map[string][]string{"parse": {}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to discord: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Bad status code posting to discord: %s", resp.Status)
+	}
+	return nil
+}
+
+// PostSlack posts msg to a Slack slash command's response URL, visible to
+// the whole channel.
+func (s *Service) PostSlack(ctx context.Context, responseURL, msg string) error {
+	body, err := json.Marshal(map[string]string{
+		"response_type": "in_channel",
+		"text":          msg,
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("error posting to slack: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Bad status code posting to slack: %s", resp.Status)
+	}
+	return nil
+}
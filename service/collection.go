@@ -0,0 +1,402 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/family"
+	"github.com/mattkoler/board_game_helper/moods"
+	"github.com/mattkoler/board_game_helper/picks"
+	"github.com/mattkoler/board_game_helper/plays"
+	"github.com/mattkoler/board_game_helper/recommend"
+)
+
+// CollectionRequest describes which collection to load and how to filter
+// and score it.
+type CollectionRequest struct {
+	BGGName    string
+	NumPlayers int
+	Mood       string // only show games with this mood, if set
+	Scorer     string // name of a registered scorer, the default if empty
+	Family     bool   // hide games unsuitable for family mode
+	Unplayed   bool   // only show games not played within UnplayedFor
+	Expansions bool   // nest the owned expansions under their base games
+	// MinConfidence is how sure, in percent, the poll's verdict at the
+	// player count must be for a game to be shown. Games whose fit doesn't
+	// come from the poll have no confidence. 0 shows every game.
+	MinConfidence int
+}
+
+// UnplayedFor is how long a game has to go unplayed to be shown to
+// requests for unplayed games.
+const UnplayedFor = 6 * 30 * 24 * time.Hour
+
+// Validate checks r, filling in the default scorer if none was picked.
+func (r *CollectionRequest) Validate() error {
+	if len(r.BGGName) < 4 || len(r.BGGName) > 20 {
+		return errors.New("bad bgg name param, please provide a name between 4-20 characters")
+	}
+	if r.NumPlayers < 1 || r.NumPlayers > 100 {
+		return errors.New("bad num players param, please provide a number between 1 and 100")
+	}
+	if r.MinConfidence < 0 || r.MinConfidence > 100 {
+		return errors.New("bad min confidence param, please provide a percentage between 0 and 100")
+	}
+	if r.Mood != "" && !moods.Valid(r.Mood) {
+		return errors.New("bad mood param, please pick one of " + strings.Join(moods.All, ", "))
+	}
+	if r.Scorer == "" {
+		r.Scorer = recommend.Default
+	}
+	if _, ok := recommend.Lookup(r.Scorer); !ok {
+		return errors.New("bad scorer param, please pick one of " + strings.Join(recommend.Scorers(), ", "))
+	}
+	return nil
+}
+
+// Progress reports how far a collection load has got. It is sent once with
+// Done at zero when the size of the collection is known, then once per game.
+type Progress struct {
+	Done     int
+	Total    int
+	Deferred int                   // games left to load in the background
+	Stale    bool                  // BGG is unavailable, the collection is the one last fetched
+	Pending  []bgg.OwnedGame       // the games about to load, only set when Done is zero
+	Orphans  []recommend.Expansion // owned expansions of games not owned, only set when Done is zero
+	Loaded   int                   // games loaded successfully so far
+	Hidden   int                   // games hidden by family mode or the hidden list so far
+	ID       string                // the game that just finished
+	Name     string
+	Game     *recommend.Game // nil unless the game is shown
+}
+
+// Collection is a loaded and filtered collection.
+type Collection struct {
+	CollectionRequest
+	Total    int  // games loaded for this request
+	Deferred int  // games left to load in the background
+	Stale    bool // BGG is unavailable, the collection is the one last fetched
+	Loaded   int
+	Hidden   int
+	Games    []*recommend.Game     // the games to show, in the order they loaded
+	Orphans  []recommend.Expansion // owned expansions of games not owned, when expansions were asked for
+}
+
+// LoadCollection loads the games owned by req.BGGName, applying its mood,
+// family mode and scorer choices. Games are fetched concurrently and
+// progress, which may be nil, is called as each one finishes.
+func (s *Service) LoadCollection(ctx context.Context, req CollectionRequest, progress func(Progress)) (*Collection, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	scorer, _ := recommend.Lookup(req.Scorer)
+
+	owned, stale, err := s.bgg.OwnedOrStale(ctx, req.BGGName)
+	if err != nil {
+		return nil, err
+	}
+	if progress == nil {
+		progress = func(Progress) {}
+	}
+
+	if !stale {
+		if err := s.snapshot(req.BGGName, owned); err != nil {
+			log.Printf("warning: unable to snapshot the collection of %q: %s", req.BGGName, err)
+		}
+	}
+	s.queuePlaysSync(req.BGGName)
+	games, deferred := s.selectGames(owned)
+	for _, id := range deferred {
+		s.queueGameFetch(id, false)
+	}
+	c := &Collection{CollectionRequest: req, Total: len(games), Deferred: len(deferred), Stale: stale}
+	names := make(map[string]string, len(owned))
+	for _, o := range owned {
+		names[o.ID] = o.Name
+	}
+	var expansions map[string][]recommend.Expansion
+	if req.Expansions {
+		expansions, c.Orphans = s.ownedExpansions(ctx, req.BGGName, names)
+	}
+	f := s.newFilter(req, scorer)
+	p := Progress{Total: c.Total, Deferred: c.Deferred, Stale: stale, Pending: games, Orphans: c.Orphans}
+	progress(p)
+	p.Pending, p.Orphans = nil, nil
+	for r := range s.streamGames(ctx, games, req.NumPlayers, req.BGGName, expansions) {
+		g := r.game
+		p.Done++
+		p.ID, p.Name, p.Game = r.id, "", nil
+		if g != nil {
+			c.Loaded++
+			p.Name = g.Name
+			g.Editions = s.editions(g.ID, names)
+			g.Expansions = expansions[g.ID]
+			switch show, hidden := f.apply(g); {
+			case hidden:
+				c.Hidden++
+			case show:
+				c.Games = append(c.Games, g)
+				p.Game = g
+			}
+		}
+		p.Loaded, p.Hidden = c.Loaded, c.Hidden
+		progress(p)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// editions returns the names of the owned games, by ID in names, that are
+// editions or reimplementations of gameID. BGG links them both ways, so the
+// links of gameID are enough.
+func (s *Service) editions(gameID string, names map[string]string) []string {
+	t := s.bgg.CachedThing(gameID)
+	if t == nil {
+		return nil
+	}
+	var editions []string
+	seen := map[string]bool{gameID: true}
+	for _, id := range t.Editions() {
+		if name, ok := names[id]; ok && !seen[id] {
+			seen[id] = true
+			editions = append(editions, name)
+		}
+	}
+	sort.Strings(editions)
+	return editions
+}
+
+// selectGames splits a collection into the games to load now and the ones
+// to leave to the background. Cached games are always loaded, as are up to
+// CollectionLimit uncached ones, picking the most played and then highest
+// ranked games first so big collections still render quickly.
+func (s *Service) selectGames(owned []bgg.OwnedGame) (now []bgg.OwnedGame, later []string) {
+	limit := s.config().CollectionLimit
+	var uncached []bgg.OwnedGame
+	for _, g := range owned {
+		if s.bgg.CachedThing(g.ID) != nil {
+			now = append(now, g)
+		} else {
+			uncached = append(uncached, g)
+		}
+	}
+	if len(uncached) > limit {
+		sort.SliceStable(uncached, func(i, j int) bool {
+			a, b := uncached[i], uncached[j]
+			if a.NumPlays != b.NumPlays {
+				return a.NumPlays > b.NumPlays
+			}
+			if (a.Rank == 0) != (b.Rank == 0) {
+				return a.Rank != 0
+			}
+			return a.Rank < b.Rank
+		})
+	}
+	for i, g := range uncached {
+		if i < limit {
+			now = append(now, g)
+		} else {
+			later = append(later, g.ID)
+		}
+	}
+	return now, later
+}
+
+// Recommend loads a collection and returns it with the games sorted best
+// first: games voted best at the player count, then recommended ones, each
+// by their fit.
+func (s *Service) Recommend(ctx context.Context, req CollectionRequest) (*Collection, error) {
+	c, err := s.LoadCollection(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.Games = bestFirst(c.Games)
+	return c, nil
+}
+
+// RecommendCached is Recommend using only what is already cached, so it
+// never waits on BGG. ok is false if the collection hasn't been fetched yet.
+// Games of it that aren't cached are left out and counted as deferred.
+func (s *Service) RecommendCached(req CollectionRequest) (c *Collection, ok bool, err error) {
+	if err := req.Validate(); err != nil {
+		return nil, false, err
+	}
+	scorer, _ := recommend.Lookup(req.Scorer)
+	owned := s.bgg.CachedOwned(req.BGGName)
+	if owned == nil {
+		return nil, false, nil
+	}
+
+	ids := make([]string, 0, len(owned))
+	for id := range owned {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids) // so games with the same fit keep their order
+	c = &Collection{CollectionRequest: req}
+	f := s.newFilter(req, scorer)
+	for _, id := range ids {
+		if s.bgg.CachedThing(id) == nil {
+			c.Deferred++
+			continue
+		}
+		c.Total++
+		g, _, _, err := s.game(context.Background(), id, req.NumPlayers, req.BGGName, nil)
+		if err != nil {
+			log.Printf("warning: unable to rate cached game %q: %s", id, err)
+			continue
+		}
+		c.Loaded++
+		switch show, hidden := f.apply(g); {
+		case hidden:
+			c.Hidden++
+		case show:
+			c.Games = append(c.Games, g)
+		}
+	}
+	c.Games = bestFirst(c.Games)
+	return c, true, nil
+}
+
+// CollectionVersion returns a version of what LoadCollection would return
+// for req, which changes whenever the BGG data or the user's choices it is
+// built from change. ok is false when the collection would have to be
+// fetched again first: it isn't cached, some of its games aren't, or it was
+// fetched longer than the page cache TTL ago.
+func (s *Service) CollectionVersion(req CollectionRequest) (version string, ok bool) {
+	fetched, changed := s.bgg.OwnedFetched(req.BGGName)
+	if fetched.IsZero() || time.Since(fetched) > s.config().PageCacheTTL {
+		return "", false
+	}
+	owned := s.bgg.CachedOwned(req.BGGName)
+	ids := make([]string, 0, len(owned))
+	for id := range owned {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\n%+v\n%d\n", s.started.UnixNano(), req, changed.UnixNano())
+	for _, id := range ids {
+		t := s.bgg.Fetched(id)
+		if t.IsZero() {
+			return "", false
+		}
+		fmt.Fprintf(h, "%s %d\n", id, t.UnixNano())
+	}
+	for _, kind := range []string{profileKind, moods.OverrideKind, picks.HiddenKind, picks.FavoriteKind, family.ExclusionKind, plays.Kind} {
+		fmt.Fprintf(h, "%s %d\n", kind, s.version(kind))
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16]), true
+}
+
+// bestFirst returns the games voted best or recommended at the player count,
+// best ones first, each by their fit.
+func bestFirst(all []*recommend.Game) []*recommend.Game {
+	var games []*recommend.Game
+	for _, g := range all {
+		if g.Best || g.Rec {
+			games = append(games, g)
+		}
+	}
+	sort.SliceStable(games, func(i, j int) bool {
+		if games[i].Best != games[j].Best {
+			return games[i].Best
+		}
+		return games[i].Fit > games[j].Fit
+	})
+	return games
+}
+
+// streamed is a game sent by streamGames, game is nil if it failed to load.
+type streamed struct {
+	id   string
+	game *recommend.Game
+}
+
+// streamGames fetches every game in owned concurrently and sends each one on
+// the returned channel as soon as it is ready. Games that fail to load are
+// still sent so receivers can track progress. The channel is closed once
+// every game has been sent. Games are rated with their owned expansions in
+// expansions, by ID, which may be nil.
+func (s *Service) streamGames(ctx context.Context, owned []bgg.OwnedGame, numPlayers int, owner string, expansions map[string][]recommend.Expansion) <-chan streamed {
+	games := make(chan streamed, len(owned)) // buffered so an abandoned stream doesn't leak goroutines
+	var wg sync.WaitGroup
+	for _, o := range owned {
+		wg.Add(1)
+		id := o.ID // don't capture loop variables
+		go func() {
+			defer wg.Done()
+			g, _, _, err := s.game(ctx, id, numPlayers, owner, expansions[id])
+			if err != nil {
+				log.Printf("warning: unable to fetch game %q info: %s", id, err)
+			}
+			games <- streamed{id: id, game: g}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(games)
+	}()
+	return games
+}
+
+// filter applies the mood, family mode and scorer choices of a request, and
+// the user's hidden and favorite lists.
+type filter struct {
+	s        *Service
+	req      CollectionRequest
+	excluded map[string]bool
+	picks    picks.Lists
+	plays    map[string]plays.Summary
+	scorer   recommend.Scorer
+}
+
+func (s *Service) newFilter(req CollectionRequest, scorer recommend.Scorer) *filter {
+	f := &filter{s: s, req: req, scorer: scorer, picks: picks.Load(s.st, req.BGGName)}
+	if req.Family {
+		f.excluded = family.Excluded(s.st, req.BGGName)
+	}
+	var err error
+	if f.plays, err = plays.Summarize(s.st, req.BGGName); err != nil {
+		log.Printf("warning: unable to summarize plays of %q: %s", req.BGGName, err)
+	}
+	return f
+}
+
+// apply scores g and reports whether it should be shown, or whether it was
+// hidden by family mode or the hidden list.
+func (f *filter) apply(g *recommend.Game) (show, hidden bool) {
+	if f.picks.Hidden[g.ID] {
+		return false, true
+	}
+	if f.req.Family && (f.excluded[g.ID] || family.Hidden(g.MinAge, g.Categories)) {
+		return false, true
+	}
+	if sum, ok := f.plays[g.ID]; ok {
+		g.Plays, g.LastPlayed = sum.Plays, sum.Last
+	}
+	g.Fit = f.scorer.Score(g, f.req.NumPlayers)
+	if f.picks.Favorite[g.ID] {
+		g.Favorite = true
+		g.Fit += math.Abs(g.Fit) * picks.Boost
+	}
+	if f.req.Unplayed && time.Since(g.LastPlayed) < UnplayedFor {
+		return false, false
+	}
+	if f.req.MinConfidence > 0 && 100*g.Votes.Confidence() < float64(f.req.MinConfidence) {
+		return false, false
+	}
+	return f.req.Mood == "" || moods.Has(g.Moods, f.req.Mood), false
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/plays"
+)
+
+// How much each signal counts towards a game's cull score. They add up to 1.
+const (
+	cullRatingWeight  = 0.3
+	cullPlaysWeight   = 0.3
+	cullScoreWeight   = 0.2
+	cullOverlapWeight = 0.2
+)
+
+// CullCandidate is an owned game scored on how good a candidate it is to
+// trade away.
+type CullCandidate struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name"`
+	Score    float64  `json:"score"`  // 0 to 1, higher is a better candidate
+	Rating   float64  `json:"rating"` // the owner's, 0 if unrated
+	Plays    int      `json:"plays"`
+	BGGScore float64  `json:"bggScore"` // 0 if the game isn't cached yet
+	Overlap  float64  `json:"overlap"`  // share of its player counts better games cover
+	Better   []string `json:"better"`   // the better games covering its player counts
+	Reasons  []string `json:"reasons"`
+}
+
+// CullReport ranks a collection's games by how good a candidate each is to
+// trade away.
+type CullReport struct {
+	BGGName string           `json:"bggName"`
+	Games   []*CullCandidate `json:"games"` // best candidate first
+	Pending int              `json:"pending"`
+	Stale   bool             `json:"stale"` // BGG is unavailable, the collection is the one last fetched
+}
+
+// Cull scores the games owned by bggName on a low personal rating, few
+// plays, a low BGG score, and how much of their player count range games the
+// owner likes better already cover. Games not cached yet are scored without
+// a BGG score or player counts and queued, so reloading the report sharpens
+// it.
+func (s *Service) Cull(ctx context.Context, bggName string) (*CullReport, error) {
+	owned, stale, err := s.bgg.OwnedOrStale(ctx, bggName)
+	if err != nil {
+		return nil, err
+	}
+	logged, err := plays.Summarize(s.st, bggName)
+	if err != nil {
+		return nil, err
+	}
+	r := &CullReport{BGGName: bggName, Games: []*CullCandidate{}, Stale: stale}
+	things := make([]*bgg.Thing, len(owned))
+	for i, g := range owned {
+		if things[i] = s.bgg.CachedThing(g.ID); things[i] == nil {
+			r.Pending++
+			s.queueGameFetch(g.ID, false)
+		}
+	}
+	// liking is how much the owner likes a game, their rating if they gave
+	// one and BGG's otherwise.
+	liking := func(i int) float64 {
+		if owned[i].Rating > 0 {
+			return owned[i].Rating
+		}
+		if things[i] != nil {
+			return things[i].Score
+		}
+		return 0
+	}
+
+	for i, g := range owned {
+		c := &CullCandidate{ID: g.ID, Name: g.Name, Rating: g.Rating, Plays: g.NumPlays}
+		if n := logged[g.ID].Plays; n > c.Plays {
+			c.Plays = n
+		}
+		rating, score, overlap := 0.5, 0.5, 0.0 // unknowns count as middling
+		if g.Rating > 0 {
+			rating = clamp01((10 - g.Rating) / 9)
+			if g.Rating <= 5 {
+				c.Reasons = append(c.Reasons, fmt.Sprintf("you rated it %.0f/10", g.Rating))
+			}
+		}
+		playsScore := 1 / float64(1+c.Plays)
+		if c.Plays == 0 {
+			c.Reasons = append(c.Reasons, "never played")
+		}
+		if t := things[i]; t != nil {
+			c.BGGScore = t.Score
+			score = clamp01((10 - t.Score) / 9)
+			if t.Score > 0 && t.Score < 6.5 {
+				c.Reasons = append(c.Reasons, fmt.Sprintf("BGG score %.1f", t.Score))
+			}
+			c.Overlap, c.Better = coverage(i, owned, things, liking)
+			overlap = c.Overlap
+			if len(c.Better) > 0 {
+				c.Reasons = append(c.Reasons, coveredBy(c.Better))
+			}
+		}
+		c.Score = cullRatingWeight*rating + cullPlaysWeight*playsScore + cullScoreWeight*score + cullOverlapWeight*overlap
+		r.Games = append(r.Games, c)
+	}
+	sort.SliceStable(r.Games, func(i, j int) bool { return r.Games[i].Score > r.Games[j].Score })
+	return r, nil
+}
+
+// coverage returns the share of the player counts of owned[i] that a game
+// the owner likes better also plays, and the names of those games, best
+// liked first.
+func coverage(i int, owned []bgg.OwnedGame, things []*bgg.Thing, liking func(int) float64) (float64, []string) {
+	t := things[i]
+	if t.MinPlayers < 1 || t.MaxPlayers < t.MinPlayers {
+		return 0, nil
+	}
+	var better []int
+	covered := 0
+	for n := t.MinPlayers; n <= t.MaxPlayers; n++ {
+		found := false
+		for j, o := range things {
+			if j == i || o == nil || liking(j) <= liking(i) || n < o.MinPlayers || n > o.MaxPlayers {
+				continue
+			}
+			found = true
+			if !containsInt(better, j) {
+				better = append(better, j)
+			}
+		}
+		if found {
+			covered++
+		}
+	}
+	sort.SliceStable(better, func(a, b int) bool { return liking(better[a]) > liking(better[b]) })
+	names := make([]string, len(better))
+	for k, j := range better {
+		names[k] = owned[j].Name
+	}
+	return float64(covered) / float64(t.MaxPlayers-t.MinPlayers+1), names
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// coveredBy sums up the better games covering a game's player counts.
+func coveredBy(names []string) string {
+	switch len(names) {
+	case 1:
+		return names[0] + " covers its player counts"
+	case 2:
+		return strings.Join(names, " and ") + " cover its player counts"
+	default:
+		return fmt.Sprintf("%s, %s and %d more cover its player counts", names[0], names[1], len(names)-2)
+	}
+}
+
+func clamp01(v float64) float64 {
+	switch {
+	case v < 0:
+		return 0
+	case v > 1:
+		return 1
+	}
+	return v
+}
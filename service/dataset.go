@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/mattkoler/board_game_helper/dataset"
+	"github.com/mattkoler/board_game_helper/plays"
+)
+
+// ExportData writes owner's collection, the cached details of its games and
+// their recorded plays to w. Games missing from the cache are left out
+// rather than fetched, so an export never waits on BGG for more than the
+// collection. progress, which may be nil, is called after each record. It
+// returns how many records were written.
+func (s *Service) ExportData(ctx context.Context, owner string, w dataset.Writer, progress func(done, total int)) (int, error) {
+	if len(owner) < 4 || len(owner) > 20 {
+		return 0, errors.New("bad bgg name param, please provide a name between 4-20 characters")
+	}
+	if progress == nil {
+		progress = func(int, int) {}
+	}
+	owned, err := s.bgg.Owned(ctx, owner)
+	if err != nil {
+		return 0, err
+	}
+	ps, err := plays.List(s.st, owner)
+	if err != nil {
+		return 0, err
+	}
+
+	var records []dataset.Record
+	for _, g := range owned {
+		records = append(records, dataset.Record{Type: "collection", Data: g})
+	}
+	for _, g := range owned {
+		if t := s.bgg.CachedThing(g.ID); t != nil {
+			records = append(records, dataset.Record{Type: "game", Data: t})
+		}
+	}
+	for _, p := range ps {
+		records = append(records, dataset.Record{Type: "play", Data: p})
+	}
+
+	for i, r := range records {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if err := w.Write(r); err != nil {
+			return i, err
+		}
+		progress(i+1, len(records))
+	}
+	return len(records), w.Close()
+}
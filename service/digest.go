@@ -0,0 +1,68 @@
+package service
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/plays"
+	"github.com/mattkoler/board_game_helper/recommend"
+)
+
+// DigestPicks is the most unplayed games a digest suggests.
+const DigestPicks = 5
+
+// Digest is a summary of a user's recent games, for the weekly email.
+type Digest struct {
+	BGGName    string
+	NumPlayers int
+	Since      time.Time
+	Plays      []*plays.Play     // plays since Since, newest first
+	Unplayed   []*recommend.Game // the best picks not played within UnplayedFor
+}
+
+// Digest summarizes bggName's plays since since and suggests games for
+// numPlayers they haven't played in a while. Suggestions only come from the
+// cache, so none are made for a collection that was never loaded.
+func (s *Service) Digest(bggName string, numPlayers int, since time.Time) (*Digest, error) {
+	d := &Digest{BGGName: bggName, NumPlayers: numPlayers, Since: since}
+	all, err := plays.List(s.st, bggName)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range all {
+		if !p.Date.Before(since) {
+			d.Plays = append(d.Plays, p)
+		}
+	}
+	sort.Slice(d.Plays, func(i, j int) bool { return d.Plays[i].Date.After(d.Plays[j].Date) })
+
+	c, ok, err := s.RecommendCached(CollectionRequest{BGGName: bggName, NumPlayers: numPlayers, Unplayed: true})
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		d.Unplayed = c.Games
+		if len(d.Unplayed) > DigestPicks {
+			d.Unplayed = d.Unplayed[:DigestPicks]
+		}
+	}
+	return d, nil
+}
+
+// GameNames returns the names of the games played in d, most played first.
+func (d *Digest) GameNames() []string {
+	counts := make(map[string]int)
+	var names []string
+	for _, p := range d.Plays {
+		name := p.GameName
+		if name == "" {
+			name = "#" + p.GameID
+		}
+		if counts[name] == 0 {
+			names = append(names, name)
+		}
+		counts[name] += p.Times()
+	}
+	sort.SliceStable(names, func(i, j int) bool { return counts[names[i]] > counts[names[j]] })
+	return names
+}
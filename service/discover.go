@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// discoverKind holds the co-ownership model under discoverKey. It is built
+// in the background from every stored collection, so it is a single entity
+// rebuilt whole.
+const (
+	discoverKind = "DiscoverModel"
+	discoverKey  = "model"
+)
+
+// How much of the co-ownership model is kept: the games most often owned
+// alongside each game, and only games owned by enough collections to tell
+// anything.
+const (
+	discoverNeighbors = 50
+	discoverMinOwners = 2
+)
+
+// DiscoverPicks is how many games a discover page suggests.
+const DiscoverPicks = 20
+
+// coOwned is a game owned alongside another.
+type coOwned struct {
+	ID     string
+	Name   string
+	Both   int // collections owning both games
+	Owners int // collections owning this one
+}
+
+// discoverModel is which games are owned together across the stored
+// collections.
+type discoverModel struct {
+	Collections int
+	Built       time.Time
+	Games       map[string][]coOwned // by game ID, most often owned together first
+	Owners      map[string]int       // collections owning each game
+}
+
+// Discovery is a game suggested because owners of the user's games also
+// own it.
+type Discovery struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Score   float64  `json:"score"`   // higher is a stronger suggestion
+	Because []string `json:"because"` // the owned games pointing to it most
+}
+
+// DiscoverReport is the games a user doesn't own that owners of their games
+// also own.
+type DiscoverReport struct {
+	BGGName     string       `json:"bggName"`
+	Games       []*Discovery `json:"games"`       // strongest first
+	Collections int          `json:"collections"` // collections the model was built from
+	Built       time.Time    `json:"built"`       // zero if it was never built
+	Stale       bool         `json:"stale"`       // BGG is unavailable, the collection is the one last fetched
+}
+
+// BuildDiscoverModel counts which games are owned together in the latest
+// snapshot of every stored collection and stores the model Discover reads.
+func (s *Service) BuildDiscoverModel() error {
+	var snaps []*CollectionSnapshot
+	if _, err := s.st.GetAll(snapshotKind, "", &snaps); err != nil {
+		return err
+	}
+	latest := make(map[string]*CollectionSnapshot)
+	for _, snap := range snaps { // in key order, so later snapshots win
+		latest[strings.ToLower(snap.BGGName)] = snap
+	}
+
+	owners := make(map[string]int)
+	names := make(map[string]string)
+	both := make(map[string]map[string]int)
+	for _, snap := range latest {
+		for _, g := range snap.Games {
+			owners[g.ID]++
+			names[g.ID] = g.Name
+		}
+	}
+	for _, snap := range latest {
+		for _, a := range snap.Games {
+			if owners[a.ID] < discoverMinOwners {
+				continue
+			}
+			for _, b := range snap.Games {
+				if a.ID == b.ID || owners[b.ID] < discoverMinOwners {
+					continue
+				}
+				if both[a.ID] == nil {
+					both[a.ID] = make(map[string]int)
+				}
+				both[a.ID][b.ID]++
+			}
+		}
+	}
+
+	m := &discoverModel{Collections: len(latest), Built: time.Now(), Games: make(map[string][]coOwned, len(both)), Owners: make(map[string]int)}
+	for id, others := range both {
+		m.Owners[id] = owners[id]
+		list := make([]coOwned, 0, len(others))
+		for other, n := range others {
+			list = append(list, coOwned{ID: other, Name: names[other], Both: n, Owners: owners[other]})
+		}
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].Both != list[j].Both {
+				return list[i].Both > list[j].Both
+			}
+			return list[i].ID < list[j].ID
+		})
+		if len(list) > discoverNeighbors {
+			list = list[:discoverNeighbors]
+		}
+		m.Games[id] = list
+	}
+	return s.st.Put(discoverKind, discoverKey, m)
+}
+
+// DiscoverEvery builds the discover model straight away and then every
+// interval until ctx is done.
+func (s *Service) DiscoverEvery(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		if err := s.BuildDiscoverModel(); err != nil {
+			log.Printf("warning: unable to build the discover model: %s", err)
+		}
+		select {
+		case <-tick.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Discover suggests games bggName doesn't own, scoring each by how often it
+// is owned alongside each of their games, relative to how common both games
+// are, so games everyone owns don't crowd out the telling ones.
+func (s *Service) Discover(ctx context.Context, bggName string) (*DiscoverReport, error) {
+	owned, stale, err := s.bgg.OwnedOrStale(ctx, bggName)
+	if err != nil {
+		return nil, err
+	}
+	r := &DiscoverReport{BGGName: bggName, Games: []*Discovery{}, Stale: stale}
+	var m discoverModel
+	switch err := s.st.Get(discoverKind, discoverKey, &m); {
+	case err == store.ErrNotFound:
+		return r, nil
+	case err != nil:
+		return nil, err
+	}
+	r.Collections, r.Built = m.Collections, m.Built
+
+	ownedIDs := make(map[string]bool, len(owned))
+	for _, g := range owned {
+		ownedIDs[g.ID] = true
+	}
+	type pointer struct {
+		name string
+		sim  float64
+	}
+	found := make(map[string]*Discovery)
+	pointers := make(map[string][]pointer)
+	for _, g := range owned {
+		for _, o := range m.Games[g.ID] {
+			if ownedIDs[o.ID] {
+				continue
+			}
+			sim := float64(o.Both) / math.Sqrt(float64(m.Owners[g.ID]*o.Owners))
+			d := found[o.ID]
+			if d == nil {
+				d = &Discovery{ID: o.ID, Name: o.Name}
+				found[o.ID] = d
+			}
+			d.Score += sim
+			pointers[o.ID] = append(pointers[o.ID], pointer{g.Name, sim})
+		}
+	}
+	for id, d := range found {
+		ps := pointers[id]
+		sort.SliceStable(ps, func(i, j int) bool { return ps[i].sim > ps[j].sim })
+		for i := 0; i < len(ps) && i < 3; i++ {
+			d.Because = append(d.Because, ps[i].name)
+		}
+		r.Games = append(r.Games, d)
+	}
+	sort.Slice(r.Games, func(i, j int) bool {
+		if r.Games[i].Score != r.Games[j].Score {
+			return r.Games[i].Score > r.Games[j].Score
+		}
+		return strings.ToLower(r.Games[i].Name) < strings.ToLower(r.Games[j].Name)
+	})
+	if len(r.Games) > DiscoverPicks {
+		r.Games = r.Games[:DiscoverPicks]
+	}
+	return r, nil
+}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/recommend"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+const eventKind = "Event"
+
+// eventVoterKind maps each attendee's voting token to the attendee, and
+// eventVoteKind holds their votes, keyed by event token and attendee.
+const (
+	eventVoterKind = "EventVoter"
+	eventVoteKind  = "EventVote"
+)
+
+// MaxAttendees is the most attendees an event may list.
+const MaxAttendees = 12
+
+// Event is a planned game night. Its picks are worked out from the
+// attendees' collections whenever it is viewed, so they follow what the
+// attendees own.
+type Event struct {
+	Token      string    `json:"token"`
+	Date       time.Time `json:"date"`
+	Location   string    `json:"location"`
+	Attendees  []string  `json:"attendees"` // BGG names
+	NumPlayers int       `json:"numPlayers"`
+	Created    time.Time `json:"created"`
+	// Key lets the organizer see the attendees' voting links, it is
+	// cleared by Public.
+	Key string `json:"key,omitempty"`
+}
+
+// Public returns a copy of e without its organizer key, for showing to
+// anyone with the event link.
+func (e *Event) Public() *Event {
+	c := *e
+	c.Key = ""
+	return &c
+}
+
+// Validate checks e, dropping empty and repeated attendees.
+func (e *Event) Validate() error {
+	if e.Date.IsZero() {
+		return errors.New("bad date param, please provide a date")
+	}
+	if len(e.Location) > 200 {
+		return errors.New("bad location param, please provide at most 200 characters")
+	}
+	if e.NumPlayers < 1 || e.NumPlayers > 100 {
+		return errors.New("bad num players param, please provide a number between 1 and 100")
+	}
+	seen := make(map[string]bool)
+	var attendees []string
+	for _, a := range e.Attendees {
+		a = strings.TrimSpace(a)
+		if a == "" || seen[strings.ToLower(a)] {
+			continue
+		}
+		if len(a) < 4 || len(a) > 20 {
+			return fmt.Errorf("bad attendee %q, please provide bgg names between 4-20 characters", a)
+		}
+		seen[strings.ToLower(a)] = true
+		attendees = append(attendees, a)
+	}
+	if len(attendees) == 0 || len(attendees) > MaxAttendees {
+		return fmt.Errorf("bad attendees param, please provide between 1 and %d bgg names", MaxAttendees)
+	}
+	e.Attendees = attendees
+	return nil
+}
+
+// EventGame is a pick of an event, with the attendees who own it and the
+// attendees' votes on it.
+type EventGame struct {
+	*recommend.Game
+	Owners []string `json:"owners"`
+	Up     int      `json:"up"`
+	Down   int      `json:"down"`
+}
+
+// Votes is the tally of g's votes.
+func (g *EventGame) Votes() int {
+	return g.Up - g.Down
+}
+
+// EventPicks are the recommendations of an event.
+type EventPicks struct {
+	Event  *Event       `json:"event"`
+	Games  []*EventGame `json:"games"`  // best first
+	Failed []string     `json:"failed"` // attendees whose collections couldn't be loaded
+	// Winner is the pick with the best tally, nil until something got an
+	// upvote. Ties go to the better pick.
+	Winner *EventGame `json:"winner"`
+}
+
+// eventVoter is the attendee a voting token belongs to.
+type eventVoter struct {
+	Event    string
+	Attendee string
+}
+
+// eventVote is an attendee's votes on an event's picks, +1 or -1 by game
+// ID.
+type eventVote struct {
+	Event    string
+	Attendee string
+	Votes    map[string]int
+	Updated  time.Time
+}
+
+// EventVoter is an attendee voting on an event's picks.
+type EventVoter struct {
+	Token    string
+	Event    *Event
+	Attendee string
+	Votes    map[string]int // the attendee's votes, +1 or -1 by game ID
+}
+
+// newKey returns a random token that is safe in URLs and too long to guess.
+func newKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateEvent saves e under a new random token.
+func (s *Service) CreateEvent(e *Event) (*Event, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	e.Created = time.Now()
+	var err error
+	if e.Key, err = newKey(); err != nil {
+		return nil, fmt.Errorf("unable to generate event key: %s", err)
+	}
+	// Tokens are short, so retry on the rare collision instead of
+	// overwriting someone else's event.
+	for i := 0; i < 3; i++ {
+		if e.Token, err = newToken(); err != nil {
+			return nil, fmt.Errorf("unable to generate event token: %s", err)
+		}
+		if _, err = s.st.PutIf(eventKind, e.Token, e, 0); err != store.ErrConflict {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range e.Attendees {
+		key, err := newKey()
+		if err != nil {
+			return nil, fmt.Errorf("unable to generate voting token: %s", err)
+		}
+		if err := s.st.Put(eventVoterKind, key, &eventVoter{Event: e.Token, Attendee: a}); err != nil {
+			return nil, err
+		}
+	}
+	return e, nil
+}
+
+// Event returns the event saved under token, or ErrNotFound.
+func (s *Service) Event(token string) (*Event, error) {
+	e := &Event{}
+	switch err := s.st.Get(eventKind, token, e); err {
+	case nil:
+		return e, nil
+	case store.ErrNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, err
+	}
+}
+
+// EventsOf returns the events bggName is attending that are dated after
+// since, soonest first.
+func (s *Service) EventsOf(bggName string, since time.Time) ([]*Event, error) {
+	var all []*Event
+	if _, err := s.st.GetAll(eventKind, "", &all); err != nil {
+		return nil, err
+	}
+	var events []*Event
+	for _, e := range all {
+		if e.Date.Before(since) {
+			continue
+		}
+		for _, a := range e.Attendees {
+			if strings.EqualFold(a, bggName) {
+				events = append(events, e.Public())
+				break
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Date.Before(events[j].Date) })
+	return events, nil
+}
+
+// EventPicks merges the recommendations of every attendee's collection for
+// the event's player count. A game owned by several attendees is listed once,
+// rated as its owner rating it best sees it. Attendees whose collections
+// can't be loaded are skipped and listed in Failed, the picks only fail when
+// no collection could be loaded.
+func (s *Service) EventPicks(ctx context.Context, e *Event) (*EventPicks, error) {
+	picks := &EventPicks{Event: e, Games: []*EventGame{}}
+	byID := make(map[string]*EventGame)
+	var lastErr error
+	for _, a := range e.Attendees {
+		c, err := s.Recommend(ctx, CollectionRequest{BGGName: a, NumPlayers: e.NumPlayers})
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("warning: unable to load collection of %q for event %s: %s", a, e.Token, err)
+			picks.Failed = append(picks.Failed, a)
+			lastErr = err
+			continue
+		}
+		for _, g := range c.Games {
+			eg, ok := byID[g.ID]
+			if !ok {
+				eg = &EventGame{Game: g}
+				byID[g.ID] = eg
+				picks.Games = append(picks.Games, eg)
+			} else if g.Fit > eg.Fit {
+				eg.Game = g
+			}
+			eg.Owners = append(eg.Owners, a)
+		}
+	}
+	if len(picks.Failed) == len(e.Attendees) {
+		return nil, lastErr
+	}
+	sort.SliceStable(picks.Games, func(i, j int) bool {
+		a, b := picks.Games[i], picks.Games[j]
+		if a.Best != b.Best {
+			return a.Best
+		}
+		return a.Fit > b.Fit
+	})
+
+	var votes []*eventVote
+	if _, err := s.st.GetAll(eventVoteKind, store.Key(e.Token, ""), &votes); err != nil {
+		return nil, err
+	}
+	for _, v := range votes {
+		for id, vote := range v.Votes {
+			switch g := byID[id]; {
+			case g == nil: // no longer a pick
+			case vote > 0:
+				g.Up++
+			case vote < 0:
+				g.Down++
+			}
+		}
+	}
+	for _, g := range picks.Games {
+		if g.Up > 0 && (picks.Winner == nil || g.Votes() > picks.Winner.Votes()) {
+			picks.Winner = g
+		}
+	}
+	return picks, nil
+}
+
+// VotingLinks returns the voting token of each attendee of e, by attendee.
+func (s *Service) VotingLinks(e *Event) (map[string]string, error) {
+	var voters []*eventVoter
+	keys, err := s.st.GetAll(eventVoterKind, "", &voters)
+	if err != nil {
+		return nil, err
+	}
+	links := make(map[string]string)
+	for i, v := range voters {
+		if v.Event == e.Token {
+			links[v.Attendee] = keys[i]
+		}
+	}
+	return links, nil
+}
+
+// Voter returns the attendee voting with token, or ErrNotFound.
+func (s *Service) Voter(token string) (*EventVoter, error) {
+	var v eventVoter
+	switch err := s.st.Get(eventVoterKind, token, &v); err {
+	case nil:
+	case store.ErrNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, err
+	}
+	e, err := s.Event(v.Event)
+	if err != nil {
+		return nil, err
+	}
+	var votes eventVote
+	if err := s.st.Get(eventVoteKind, store.Key(v.Event, strings.ToLower(v.Attendee)), &votes); err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+	if votes.Votes == nil {
+		votes.Votes = make(map[string]int)
+	}
+	return &EventVoter{Token: token, Event: e, Attendee: v.Attendee, Votes: votes.Votes}, nil
+}
+
+// Vote records voter's vote on the pick gameID: 1 for up, -1 for down and 0
+// to take a vote back.
+func (s *Service) Vote(voter *EventVoter, gameID string, vote int) error {
+	if vote < -1 || vote > 1 {
+		return errors.New("bad vote param, please pick 1, -1 or 0")
+	}
+	if vote == 0 {
+		delete(voter.Votes, gameID)
+	} else {
+		voter.Votes[gameID] = vote
+	}
+	return s.st.Put(eventVoteKind, store.Key(voter.Event.Token, strings.ToLower(voter.Attendee)), &eventVote{
+		Event:    voter.Event.Token,
+		Attendee: voter.Attendee,
+		Votes:    voter.Votes,
+		Updated:  time.Now(),
+	})
+}
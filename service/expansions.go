@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/recommend"
+	"github.com/mattkoler/board_game_helper/resolve"
+)
+
+// ownedExpansions loads the expansions owned by bggName and attaches each
+// to the base games it expands, by ID, using the games owned by ID in
+// names. Expansions of games not owned are returned as orphans. BGG
+// failures only leave expansions out, they don't fail the collection.
+func (s *Service) ownedExpansions(ctx context.Context, bggName string, names map[string]string) (map[string][]recommend.Expansion, []recommend.Expansion) {
+	owned, err := s.bgg.OwnedExpansions(ctx, bggName)
+	if err != nil {
+		log.Printf("warning: unable to fetch the expansions of %q: %s", bggName, err)
+		return nil, nil
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	byBase := make(map[string][]recommend.Expansion)
+	var orphans []recommend.Expansion
+	for _, o := range owned {
+		wg.Add(1)
+		id := o.ID // don't capture loop variables
+		go func() {
+			defer wg.Done()
+			t, err := s.bgg.Thing(ctx, id)
+			if err != nil {
+				log.Printf("warning: unable to fetch expansion %q info: %s", id, err)
+				return
+			}
+			e := recommend.Expansion{ID: id, Name: t.Name, MinPlayers: t.MinPlayers, MaxPlayers: t.MaxPlayers}
+			mu.Lock()
+			defer mu.Unlock()
+			attached := false
+			for _, base := range t.Expands {
+				if _, ok := names[base.ID]; ok {
+					byBase[base.ID] = append(byBase[base.ID], e)
+					attached = true
+				}
+			}
+			if !attached {
+				orphans = append(orphans, e)
+			}
+		}()
+	}
+	wg.Wait()
+
+	byName := func(list []recommend.Expansion) {
+		sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name) })
+	}
+	for _, list := range byBase {
+		byName(list)
+	}
+	byName(orphans)
+	return byBase, orphans
+}
+
+// offerExpansions offers the owned expansions of t to in: the widest
+// player range they allow, and, when the base game alone doesn't play
+// numPlayers, how the expansion that does plays at that count. The
+// expansion's own poll is used when it has one, trusted as the base game's
+// is, otherwise it is taken to be recommended across its box range.
+func (s *Service) offerExpansions(in *resolve.Input, t *bgg.Thing, numPlayers int, expansions []recommend.Expansion) error {
+	max := t.MaxPlayers
+	for _, e := range expansions {
+		if e.MaxPlayers > max {
+			max = e.MaxPlayers
+		}
+	}
+	if max == t.MaxPlayers {
+		return nil
+	}
+	in.Players[resolve.Expansion] = resolve.PlayerRange{Min: t.MinPlayers, Max: max}
+	if numPlayers <= t.MaxPlayers {
+		return nil
+	}
+	e := expansionAt(expansions, numPlayers)
+	if e == nil {
+		return nil
+	}
+	fit := resolve.Fit{Rec: true}
+	if et := s.bgg.CachedThing(e.ID); et != nil && len(et.Polls) > 0 {
+		bestAt, recAt, err := et.PlayerFit(numPlayers, s.config().MinPollVotes)
+		if err != nil {
+			return fmt.Errorf("error parsing polls of expansion %q: %s", e.ID, err)
+		}
+		fit = resolve.Fit{Best: bestAt, Rec: recAt}
+	}
+	in.Fit[resolve.Expansion] = fit
+	return nil
+}
+
+// expansionAt returns the first of expansions whose box range includes
+// numPlayers, or nil if none does.
+func expansionAt(expansions []recommend.Expansion, numPlayers int) *recommend.Expansion {
+	for i, e := range expansions {
+		if e.MinPlayers <= numPlayers && numPlayers <= e.MaxPlayers {
+			return &expansions[i]
+		}
+	}
+	return nil
+}
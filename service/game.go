@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/moods"
+	"github.com/mattkoler/board_game_helper/picks"
+	"github.com/mattkoler/board_game_helper/recommend"
+	"github.com/mattkoler/board_game_helper/resolve"
+	"github.com/mattkoler/board_game_helper/sleeves"
+)
+
+// GameDetail is everything shown about a single game.
+type GameDetail struct {
+	Game        *recommend.Game
+	Year        int
+	Thumbnail   string
+	Description string
+	Polls       []bgg.PlayerPoll
+
+	InfoOrigin  bgg.Origin    // of the name, players, polls and description
+	StatsOrigin bgg.Origin    // of the score, weight and ratings
+	MoodOrigin  bgg.Origin    // a user override or the derived tags
+	Stale       bool          // some of the data is older than the game TTL
+	Hidden      bool          // on the user's hidden list
+	Sleeves     *sleeves.Game // nil if the game's cards aren't known
+}
+
+// Game loads gameID rated for numPlayers, which may be zero, with the moods
+// bggName, which may be empty, sees for it.
+func (s *Service) Game(ctx context.Context, gameID string, numPlayers int, bggName string) (*GameDetail, error) {
+	g, t, r, err := s.game(ctx, gameID, numPlayers, bggName, nil)
+	if err != nil {
+		return nil, err
+	}
+	d := &GameDetail{
+		Game:        g,
+		Year:        t.Year,
+		Thumbnail:   t.Thumbnail,
+		Description: t.Description,
+		Polls:       t.Polls,
+		InfoOrigin:  t.Info,
+		StatsOrigin: t.Stats,
+		MoodOrigin:  bgg.Origin{Source: "tags derived from the categories and mechanics", Fetched: t.Info.Fetched},
+	}
+	if r.MoodsFrom == resolve.Override {
+		if o := moods.Lookup(s.st, bggName, gameID); o != nil {
+			d.MoodOrigin = bgg.Origin{Source: "your override", Fetched: o.Updated}
+		}
+	}
+	if bggName != "" {
+		d.Hidden = picks.Has(s.st, picks.HiddenKind, bggName, gameID)
+		g.Favorite = picks.Has(s.st, picks.FavoriteKind, bggName, gameID)
+	}
+	d.Sleeves = sleeves.Lookup(s.st, gameID)
+	cutoff := time.Now().Add(-s.config().GameTTL)
+	d.Stale = t.Info.Fetched.Before(cutoff) || t.Stats.Fetched.Before(cutoff)
+	return d, nil
+}
+
+// RefreshGame fetches gameID from BGG again, replacing the cached copy.
+func (s *Service) RefreshGame(ctx context.Context, gameID string) error {
+	t, err := s.bgg.RefreshThing(ctx, gameID)
+	if err != nil {
+		return err
+	}
+	s.recordTrend(t)
+	return nil
+}
@@ -0,0 +1,151 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// snapshotKind holds the history of each user's collection, keyed by
+// lowercased BGG name and the time the snapshot was taken.
+const snapshotKind = "CollectionSnapshot"
+
+// snapshotTime formats snapshot times in their keys. It is fixed width so
+// keys sort in time order.
+const snapshotTime = "2006-01-02T15:04:05.000000000Z"
+
+// SnapshotGame is a game of a collection snapshot.
+type SnapshotGame struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// CollectionSnapshot is a user's collection as fetched from BGG at Taken.
+type CollectionSnapshot struct {
+	BGGName string         `json:"bggName"`
+	Taken   time.Time      `json:"taken"`
+	Games   []SnapshotGame `json:"games"` // sorted by ID
+}
+
+// CollectionDiff is what changed in a collection between two dates.
+type CollectionDiff struct {
+	BGGName string         `json:"bggName"`
+	From    time.Time      `json:"from"` // when the snapshot compared against was taken
+	To      time.Time      `json:"to"`   // when the snapshot compared was taken
+	Added   []SnapshotGame `json:"added"`
+	Removed []SnapshotGame `json:"removed"`
+	Total   int            `json:"total"` // games owned at To
+}
+
+// snapshot records owned as bggName's collection. A snapshot is only stored
+// when the collection differs from the last one, so the history holds every
+// change without growing with each fetch.
+func (s *Service) snapshot(bggName string, owned []bgg.OwnedGame) error {
+	games := make([]SnapshotGame, len(owned))
+	for i, g := range owned {
+		games[i] = SnapshotGame{ID: g.ID, Name: g.Name}
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].ID < games[j].ID })
+
+	s.snapMu.Lock()
+	defer s.snapMu.Unlock()
+	history, err := s.snapshots(bggName)
+	if err != nil {
+		return err
+	}
+	if n := len(history); n > 0 && sameGames(history[n-1].Games, games) {
+		return nil
+	}
+	now := time.Now().UTC()
+	return s.st.Put(snapshotKind, store.Key(strings.ToLower(bggName), now.Format(snapshotTime)), &CollectionSnapshot{
+		BGGName: bggName,
+		Taken:   now,
+		Games:   games,
+	})
+}
+
+func sameGames(a, b []SnapshotGame) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID {
+			return false
+		}
+	}
+	return true
+}
+
+// snapshots returns bggName's collection snapshots, oldest first.
+func (s *Service) snapshots(bggName string) ([]*CollectionSnapshot, error) {
+	var history []*CollectionSnapshot
+	if _, err := s.st.GetAll(snapshotKind, store.Key(strings.ToLower(bggName), ""), &history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// History returns the times bggName's collection was seen to change, oldest
+// first, the first being when it was first fetched.
+func (s *Service) History(bggName string) ([]time.Time, error) {
+	history, err := s.snapshots(bggName)
+	if err != nil {
+		return nil, err
+	}
+	times := make([]time.Time, len(history))
+	for i, snap := range history {
+		times[i] = snap.Taken
+	}
+	return times, nil
+}
+
+// CollectionDiff compares bggName's collection as it was at from with how it
+// was at to, using the last snapshot taken by each. A from before the first
+// snapshot compares against the first snapshot. ErrNotFound is returned if
+// the collection was never fetched.
+func (s *Service) CollectionDiff(bggName string, from, to time.Time) (*CollectionDiff, error) {
+	history, err := s.snapshots(bggName)
+	if err != nil {
+		return nil, err
+	}
+	if len(history) == 0 {
+		return nil, ErrNotFound
+	}
+	if to.Before(from) {
+		from, to = to, from
+	}
+	at := func(t time.Time) *CollectionSnapshot {
+		i := sort.Search(len(history), func(i int) bool { return history[i].Taken.After(t) })
+		if i == 0 {
+			return history[0]
+		}
+		return history[i-1]
+	}
+	a, b := at(from), at(to)
+	d := &CollectionDiff{BGGName: b.BGGName, From: a.Taken, To: b.Taken, Total: len(b.Games)}
+	before := make(map[string]bool, len(a.Games))
+	for _, g := range a.Games {
+		before[g.ID] = true
+	}
+	after := make(map[string]bool, len(b.Games))
+	for _, g := range b.Games {
+		after[g.ID] = true
+		if !before[g.ID] {
+			d.Added = append(d.Added, g)
+		}
+	}
+	for _, g := range a.Games {
+		if !after[g.ID] {
+			d.Removed = append(d.Removed, g)
+		}
+	}
+	byName := func(games []SnapshotGame) {
+		sort.Slice(games, func(i, j int) bool { return strings.ToLower(games[i].Name) < strings.ToLower(games[j].Name) })
+	}
+	byName(d.Added)
+	byName(d.Removed)
+	return d, nil
+}
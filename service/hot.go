@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/family"
+)
+
+// HotGame is an entry of the hotness list, with whatever is already known
+// about it.
+type HotGame struct {
+	Rank       int
+	ID         string
+	Name       string
+	Year       string
+	Thumbnail  string
+	Owned      bool
+	Cached     bool // whether the game details below are known
+	MinPlayers int
+	MaxPlayers int
+	Score      float64
+	Weight     float64
+}
+
+// HotList is the hotness list as seen by one user.
+type HotList struct {
+	Games  []*HotGame
+	Hidden int // games hidden by family mode
+}
+
+// Hot returns the BGG hotness list, marking the games bggName owns when it
+// is set. Game details are filled in from the cache only, so the list stays
+// a single call to BGG, and games missing from the cache are queued to be
+// fetched in the background.
+func (s *Service) Hot(ctx context.Context, bggName string, familyMode bool) (*HotList, error) {
+	items, err := s.bgg.Hot(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var owned map[string]bool
+	if bggName != "" {
+		if owned = s.bgg.CachedOwned(bggName); owned == nil {
+			if _, err := s.bgg.Owned(ctx, bggName); err != nil {
+				log.Printf("warning: unable to fetch collection for %q: %s", bggName, err)
+			}
+			owned = s.bgg.CachedOwned(bggName)
+		}
+	}
+
+	var excluded map[string]bool
+	if familyMode && bggName != "" {
+		excluded = family.Excluded(s.st, bggName)
+	}
+	list := &HotList{}
+	for _, item := range items {
+		g := &HotGame{
+			Rank:      item.Rank,
+			ID:        item.ID,
+			Name:      item.Name,
+			Year:      item.Year,
+			Thumbnail: item.Thumbnail,
+			Owned:     owned[item.ID],
+		}
+		t := s.bgg.CachedThing(item.ID)
+		if familyMode && (excluded[item.ID] || t != nil && family.Hidden(t.MinAge, t.Categories)) {
+			list.Hidden++
+			continue
+		}
+		if t != nil {
+			g.Cached = true
+			g.MinPlayers = t.MinPlayers
+			g.MaxPlayers = t.MaxPlayers
+			g.Score = t.Score
+			g.Weight = t.Weight
+		} else {
+			s.queueGameFetch(item.ID, false)
+		}
+		list.Games = append(list.Games, g)
+	}
+	return list, nil
+}
+
+// Search finds board games by name.
+func (s *Service) Search(ctx context.Context, query string) ([]bgg.SearchItem, error) {
+	return s.bgg.Search(ctx, query)
+}
@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+	"github.com/mattkoler/board_game_helper/trash"
+)
+
+// loanKind holds the games users lent out, keyed by lowercased BGG name and
+// loan ID.
+const loanKind = "Loan"
+
+func init() {
+	trash.Register(loanKind, "Loan")
+}
+
+// returnedShown is how many returned loans the lending page lists.
+const returnedShown = 20
+
+// NudgeEvery is how often a borrower with an email address is reminded of
+// an overdue game.
+const NudgeEvery = 7 * 24 * time.Hour
+
+// Loan is a game a user lent to a friend.
+type Loan struct {
+	ID       string    `json:"id"`
+	Owner    string    `json:"owner"`
+	GameID   string    `json:"gameId"`
+	GameName string    `json:"gameName"`
+	Borrower string    `json:"borrower"`
+	Email    string    `json:"email,omitempty"` // the borrower's, to nudge them when overdue
+	Lent     time.Time `json:"lent"`
+	Due      time.Time `json:"due,omitempty"` // zero if no date was agreed
+	Returned time.Time `json:"returned,omitempty"`
+	Nudged   time.Time `json:"nudged,omitempty"` // when the borrower was last emailed
+}
+
+// Overdue reports whether l is still out after its due date.
+func (l *Loan) Overdue(now time.Time) bool {
+	return l.Returned.IsZero() && !l.Due.IsZero() && now.After(l.Due.AddDate(0, 0, 1))
+}
+
+// DaysOut is how many days l has been out, or was out if it was returned.
+func (l *Loan) DaysOut(now time.Time) int {
+	if !l.Returned.IsZero() {
+		now = l.Returned
+	}
+	return int(now.Sub(l.Lent).Hours() / 24)
+}
+
+// Validate checks l as entered by its owner.
+func (l *Loan) Validate() error {
+	if l.GameID == "" {
+		return errors.New("bad game param, please pick a game")
+	}
+	if l.Borrower == "" || len(l.Borrower) > 40 {
+		return errors.New("bad borrower param, please provide a name of 1-40 characters")
+	}
+	if l.Lent.IsZero() || l.Lent.After(time.Now()) {
+		return errors.New("bad lent param, please provide a date that isn't in the future")
+	}
+	if !l.Due.IsZero() && l.Due.Before(l.Lent) {
+		return errors.New("bad due param, please provide a date after the game was lent")
+	}
+	return nil
+}
+
+// LendingReport is the games a user has lent out and got back.
+type LendingReport struct {
+	BGGName  string         `json:"bggName"`
+	Out      []*Loan        `json:"out"`      // due soonest first
+	Returned []*Loan        `json:"returned"` // most recent first
+	Games    []SnapshotGame `json:"games"`    // owned games not lent out, by name
+	Now      time.Time      `json:"-"`
+	Stale    bool           `json:"stale"` // BGG is unavailable, the games are the collection last fetched
+}
+
+// Lending reports the games bggName lent out, with the owned games that are
+// on the shelf to lend.
+func (s *Service) Lending(ctx context.Context, bggName string) (*LendingReport, error) {
+	owned, stale, err := s.bgg.OwnedOrStale(ctx, bggName)
+	if err != nil {
+		return nil, err
+	}
+	var loans []*Loan
+	if _, err := s.st.GetAll(loanKind, store.Key(strings.ToLower(bggName), ""), &loans); err != nil {
+		return nil, err
+	}
+	r := &LendingReport{BGGName: bggName, Out: []*Loan{}, Returned: []*Loan{}, Games: []SnapshotGame{}, Now: time.Now(), Stale: stale}
+	out := make(map[string]bool)
+	for _, l := range loans {
+		if l.Returned.IsZero() {
+			r.Out = append(r.Out, l)
+			out[l.GameID] = true
+		} else {
+			r.Returned = append(r.Returned, l)
+		}
+	}
+	// Loans without a due date go after the others, longest out first.
+	sort.Slice(r.Out, func(i, j int) bool {
+		a, b := r.Out[i], r.Out[j]
+		if a.Due.IsZero() != b.Due.IsZero() {
+			return b.Due.IsZero()
+		}
+		if !a.Due.Equal(b.Due) {
+			return a.Due.Before(b.Due)
+		}
+		return a.Lent.Before(b.Lent)
+	})
+	sort.Slice(r.Returned, func(i, j int) bool { return r.Returned[i].Returned.After(r.Returned[j].Returned) })
+	if len(r.Returned) > returnedShown {
+		r.Returned = r.Returned[:returnedShown]
+	}
+	for _, g := range owned {
+		if !out[g.ID] {
+			r.Games = append(r.Games, SnapshotGame{ID: g.ID, Name: g.Name})
+		}
+	}
+	sort.Slice(r.Games, func(i, j int) bool { return strings.ToLower(r.Games[i].Name) < strings.ToLower(r.Games[j].Name) })
+	return r, nil
+}
+
+// ErrNotOwned is returned when lending a game the owner doesn't own.
+var ErrNotOwned = errors.New("bad game param, please pick a game from your collection")
+
+// Lend records l as lent by its owner. The game must be in the owner's
+// collection, its name is taken from there.
+func (s *Service) Lend(ctx context.Context, l *Loan) error {
+	if err := l.Validate(); err != nil {
+		return err
+	}
+	owned, _, err := s.bgg.OwnedOrStale(ctx, l.Owner)
+	if err != nil {
+		return err
+	}
+	l.GameName = ""
+	for _, g := range owned {
+		if g.ID == l.GameID {
+			l.GameName = g.Name
+		}
+	}
+	if l.GameName == "" {
+		return ErrNotOwned
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("unable to generate loan id: %s", err)
+	}
+	l.ID = hex.EncodeToString(b)
+	return s.st.Put(loanKind, store.Key(strings.ToLower(l.Owner), l.ID), l)
+}
+
+// ReturnLoan marks bggName's loan id as returned, or returns ErrNotFound.
+func (s *Service) ReturnLoan(bggName, id string) error {
+	key := store.Key(strings.ToLower(bggName), id)
+	var l Loan
+	switch err := s.st.Get(loanKind, key, &l); err {
+	case nil:
+	case store.ErrNotFound:
+		return ErrNotFound
+	default:
+		return err
+	}
+	l.Returned = time.Now()
+	return s.st.Put(loanKind, key, &l)
+}
+
+// DeleteLoan moves bggName's loan id to the trash, for loans entered by
+// mistake, or returns ErrNotFound.
+func (s *Service) DeleteLoan(bggName, id string) error {
+	err := s.st.SoftDelete(loanKind, store.Key(strings.ToLower(bggName), id))
+	if err == store.ErrNotFound {
+		return ErrNotFound
+	}
+	return err
+}
+
+// LoansToNudge returns the overdue loans with a borrower email that weren't
+// nudged within NudgeEvery.
+func (s *Service) LoansToNudge(now time.Time) ([]*Loan, error) {
+	var all []*Loan
+	if _, err := s.st.GetAll(loanKind, "", &all); err != nil {
+		return nil, err
+	}
+	var due []*Loan
+	for _, l := range all {
+		if l.Email != "" && l.Overdue(now) && now.Sub(l.Nudged) >= NudgeEvery {
+			due = append(due, l)
+		}
+	}
+	return due, nil
+}
+
+// MarkNudged records that l's borrower was reminded at now.
+func (s *Service) MarkNudged(l *Loan, now time.Time) error {
+	l.Nudged = now
+	return s.st.Put(loanKind, store.Key(strings.ToLower(l.Owner), l.ID), l)
+}
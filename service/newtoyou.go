@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/plays"
+)
+
+// NewGame is a game first played in the year of a new to you report.
+type NewGame struct {
+	Rank   int       `json:"rank"`
+	ID     string    `json:"id"`
+	Name   string    `json:"name"`
+	First  time.Time `json:"first"`  // date of the first play
+	Plays  int       `json:"plays"`  // in the year
+	Rating float64   `json:"rating"` // the owner's, 0 if unrated or not owned
+}
+
+// NewToYouReport is the games a user played for the first time in a year,
+// like the new to you geeklists posted on BGG every year.
+type NewToYouReport struct {
+	BGGName string     `json:"bggName"`
+	Year    int        `json:"year"`
+	Games   []*NewGame `json:"games"` // best rated first
+	Plays   int        `json:"plays"` // of the games in the year
+	Years   []int      `json:"years"` // with plays logged and Year, newest first
+	Stale   bool       `json:"stale"` // BGG is unavailable, the ratings are the ones last fetched
+}
+
+// NewToYou reports the games bggName first played in year, going by the
+// plays recorded for them, with how often they were played that year and
+// the rating bggName gave them on BGG.
+func (s *Service) NewToYou(ctx context.Context, bggName string, year int) (*NewToYouReport, error) {
+	all, err := plays.List(s.st, bggName)
+	if err != nil {
+		return nil, err
+	}
+	owned, stale, err := s.bgg.OwnedOrStale(ctx, bggName)
+	if err != nil {
+		return nil, err
+	}
+	ratings := make(map[string]float64, len(owned))
+	for _, g := range owned {
+		ratings[g.ID] = g.Rating
+	}
+
+	r := &NewToYouReport{BGGName: bggName, Year: year, Games: []*NewGame{}, Years: []int{}, Stale: stale}
+	games := make(map[string]*NewGame)
+	years := map[int]bool{year: true}
+	for _, p := range all {
+		years[p.Date.Year()] = true
+		g := games[p.GameID]
+		if g == nil {
+			g = &NewGame{ID: p.GameID, Name: p.GameName, First: p.Date, Rating: ratings[p.GameID]}
+			games[p.GameID] = g
+		}
+		if p.Date.Before(g.First) {
+			g.First = p.Date
+		}
+		if p.Date.Year() == year {
+			g.Plays += p.Times()
+		}
+	}
+	for y := range years {
+		r.Years = append(r.Years, y)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(r.Years)))
+
+	for _, g := range games {
+		if g.First.Year() != year {
+			continue
+		}
+		if g.Name == "" {
+			if t := s.bgg.CachedThing(g.ID); t != nil {
+				g.Name = t.Name
+			} else {
+				g.Name = "Game " + g.ID
+			}
+		}
+		r.Plays += g.Plays
+		r.Games = append(r.Games, g)
+	}
+	sort.Slice(r.Games, func(i, j int) bool {
+		a, b := r.Games[i], r.Games[j]
+		if a.Rating != b.Rating {
+			return a.Rating > b.Rating
+		}
+		if a.Plays != b.Plays {
+			return a.Plays > b.Plays
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+	for i, g := range r.Games {
+		g.Rank = i + 1
+	}
+	return r, nil
+}
+
+// Markdown formats the report for posting, each game linked to its BGG
+// page with its plays and rating.
+func (r *NewToYouReport) Markdown() string {
+	esc := discordStyle.escape
+	var b strings.Builder
+	title := fmt.Sprintf("%d new to you: %s", r.Year, r.BGGName)
+	b.WriteString(discordStyle.strong(esc.Replace(title)) + "\n\n")
+	if len(r.Games) == 0 {
+		b.WriteString("No new games played.\n")
+		return b.String()
+	}
+	fmt.Fprintf(&b, "%d games played for the first time, %d plays in all.\n\n", len(r.Games), r.Plays)
+	for _, g := range r.Games {
+		fmt.Fprintf(&b, "%d. [%s](https://boardgamegeek.com/boardgame/%s) - %s", g.Rank, esc.Replace(g.Name), g.ID, pluralPlays(g.Plays))
+		if g.Rating > 0 {
+			fmt.Fprintf(&b, ", rated %g/10", g.Rating)
+		}
+		fmt.Fprintf(&b, ", first played %s\n", g.First.Format("2 Jan"))
+	}
+	return b.String()
+}
+
+func pluralPlays(n int) string {
+	if n == 1 {
+		return "1 play"
+	}
+	return fmt.Sprintf("%d plays", n)
+}
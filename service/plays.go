@@ -0,0 +1,261 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/analytics"
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/plays"
+	"github.com/mattkoler/board_game_helper/queue"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// StatsQueue is the queue of users whose precomputed stats need refreshing.
+// Tasks are named by user, so a burst of imports refreshes them once.
+const StatsQueue = "stats"
+
+// PlaysQueue is the queue of users whose plays are synced from BGG. Tasks
+// are named by user.
+const PlaysQueue = "plays"
+
+// playSyncKind is the store kind of when each user's BGG plays were last
+// synced, keyed by lower case BGG name.
+const playSyncKind = "PlaySync"
+
+// playSync records a sync of a user's BGG plays.
+type playSync struct {
+	Owner  string
+	Synced time.Time
+	Plays  int
+}
+
+// ImportPlays stores ps as plays of owner, replacing plays with the same ID.
+// Plays without an ID are given a new one. It returns how many plays were
+// stored before any error. The owner's stats are refreshed in the
+// background once anything was stored.
+func (s *Service) ImportPlays(ctx context.Context, owner string, ps []*plays.Play) (n int, err error) {
+	if len(owner) < 4 || len(owner) > 20 {
+		return 0, errors.New("bad bgg name param, please provide a name between 4-20 characters")
+	}
+	defer func() {
+		if n > 0 {
+			s.queueStats(owner)
+		}
+	}()
+	for i, p := range ps {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if p.GameID == "" {
+			return i, fmt.Errorf("play %d has no game id", i+1)
+		}
+		if p.ID == "" {
+			b := make([]byte, 8)
+			if _, err := rand.Read(b); err != nil {
+				return i, fmt.Errorf("unable to generate play id: %s", err)
+			}
+			p.ID = hex.EncodeToString(b)
+		}
+		p.Owner = owner
+		if err := plays.Put(s.st, p); err != nil {
+			return i, fmt.Errorf("unable to store play %s: %s", p.ID, err)
+		}
+	}
+	return len(ps), nil
+}
+
+// ImportBGStats stores plays read by plays.ParseBGStats as plays of owner.
+// Games the export has no BGG ID for are looked up on BGG by name, plays of
+// games that can't be found are skipped and counted in unmatched.
+func (s *Service) ImportBGStats(ctx context.Context, owner string, ps []*plays.Play) (n, unmatched int, err error) {
+	ids := make(map[string]string) // BGG ID by lower case game name, empty if not found
+	matched := make([]*plays.Play, 0, len(ps))
+	for _, p := range ps {
+		if p.GameID == "" {
+			key := strings.ToLower(p.GameName)
+			id, ok := ids[key]
+			if !ok {
+				if id, err = s.findGame(ctx, p.GameName); err != nil {
+					return 0, 0, err
+				}
+				ids[key] = id
+			}
+			p.GameID = id
+		}
+		if p.GameID == "" {
+			unmatched++
+			continue
+		}
+		matched = append(matched, p)
+	}
+	n, err = s.ImportPlays(ctx, owner, matched)
+	return n, unmatched, err
+}
+
+// findGame returns the BGG ID of the game called name, or of the only game
+// BGG finds for it. It is empty if there is no such game, or too many to
+// pick one.
+func (s *Service) findGame(ctx context.Context, name string) (string, error) {
+	items, err := s.bgg.Search(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("unable to look up %q on BGG: %s", name, err)
+	}
+	for _, it := range items {
+		if strings.EqualFold(it.Name, name) {
+			return it.ID, nil
+		}
+	}
+	if len(items) == 1 {
+		return items[0].ID, nil
+	}
+	return "", nil
+}
+
+// ErrNoPush is returned when a play is to be logged on BGG for a user other
+// than the one owning the site's BGG token, where it would land on the
+// wrong account.
+var ErrNoPush = errors.New("plays can only be logged on BGG for the account of the site's BGG token")
+
+// LogPlay records p as a play of owner. With push set it is logged on BGG
+// first and recorded under BGG's ID, so syncing owner's plays doesn't count
+// it twice. If BGG doesn't take it the play is still recorded, with pushed
+// false. Pushing is only for the owner of the BGG token, ErrNoPush is
+// returned for anyone else.
+func (s *Service) LogPlay(ctx context.Context, owner string, p *plays.Play, push bool) (pushed bool, err error) {
+	if err := p.Validate(); err != nil {
+		return false, err
+	}
+	if push && !s.CanPushPlays(owner) {
+		return false, ErrNoPush
+	}
+	if t := s.bgg.CachedThing(p.GameID); t != nil && p.GameName == "" {
+		p.GameName = t.Name
+	}
+	if push {
+		id, err := s.bgg.LogPlay(ctx, bggPlay(p))
+		if err != nil {
+			log.Printf("warning: unable to log play of %q on BGG: %s", owner, err)
+		} else {
+			p.ID, pushed = "bgg-"+id, true
+		}
+	}
+	if _, err := s.ImportPlays(ctx, owner, []*plays.Play{p}); err != nil {
+		return pushed, err
+	}
+	return pushed, nil
+}
+
+// CanPushPlays reports whether plays of owner can be logged on BGG, which
+// takes the site's BGG token being owner's.
+func (s *Service) CanPushPlays(owner string) bool {
+	user := s.config().BGGTokenUser
+	return s.bgg.Authenticated() && user != "" && strings.EqualFold(owner, user)
+}
+
+// bggPlay converts p for logging on BGG.
+func bggPlay(p *plays.Play) bgg.LoggedPlay {
+	lp := bgg.LoggedPlay{GameID: p.GameID, GameName: p.GameName, Date: p.Date, Quantity: p.Quantity}
+	for _, pl := range p.Players {
+		score := ""
+		if pl.HasScore {
+			score = strconv.FormatFloat(pl.Score, 'f', -1, 64)
+		}
+		lp.Players = append(lp.Players, bgg.LoggedPlayer{Username: pl.Username, Name: pl.Name, Seat: pl.Seat, Score: score, Win: pl.Win})
+	}
+	return lp
+}
+
+// queueStats queues owner's stats to be recomputed in the background.
+func (s *Service) queueStats(owner string) {
+	if s.queue == nil {
+		return
+	}
+	if _, err := s.queue.Add(&queue.Task{Queue: StatsQueue, Name: owner}); err != nil {
+		log.Printf("warning: unable to queue stats of %q: %s", owner, err)
+	}
+}
+
+// StatsTask is the handler of StatsQueue.
+func (s *Service) StatsTask(ctx context.Context, t *queue.Task) error {
+	_, err := analytics.Precompute(s.st, t.Name)
+	return err
+}
+
+// SyncPlays fetches every play owner logged on BGG and stores them as
+// owner's plays, replacing those stored by an earlier sync. It returns how
+// many plays were stored.
+func (s *Service) SyncPlays(ctx context.Context, owner string) (int, error) {
+	var ps []*plays.Play
+	for page := 1; ; page++ {
+		logged, total, err := s.bgg.Plays(ctx, owner, page)
+		if err != nil {
+			return 0, err
+		}
+		for _, lp := range logged {
+			ps = append(ps, loggedPlay(lp))
+		}
+		if len(logged) == 0 || page*bgg.PlaysPerPage >= total {
+			break
+		}
+	}
+	n, err := s.ImportPlays(ctx, owner, ps)
+	if err != nil {
+		return n, err
+	}
+	err = s.st.Put(playSyncKind, strings.ToLower(owner), &playSync{Owner: owner, Synced: time.Now(), Plays: n})
+	return n, err
+}
+
+// loggedPlay converts a play logged on BGG. Its ID is BGG's, so syncing
+// again replaces it.
+func loggedPlay(lp bgg.LoggedPlay) *plays.Play {
+	p := &plays.Play{ID: "bgg-" + lp.ID, GameID: lp.GameID, GameName: lp.GameName, Date: lp.Date, Quantity: lp.Quantity}
+	for _, pl := range lp.Players {
+		score, err := strconv.ParseFloat(pl.Score, 64)
+		p.Players = append(p.Players, plays.Player{
+			Name:     pl.Name,
+			Username: pl.Username,
+			Seat:     pl.Seat,
+			Score:    score,
+			HasScore: err == nil,
+			Win:      pl.Win,
+		})
+	}
+	return p
+}
+
+// queuePlaysSync queues owner's BGG plays to be synced in the background,
+// unless they were synced within the collection TTL.
+func (s *Service) queuePlaysSync(owner string) {
+	if s.queue == nil {
+		return
+	}
+	var last playSync
+	switch err := s.st.Get(playSyncKind, strings.ToLower(owner), &last); err {
+	case nil:
+		if time.Since(last.Synced) < s.config().CollectionTTL {
+			return
+		}
+	case store.ErrNotFound:
+	default:
+		log.Printf("warning: unable to read play sync of %q: %s", owner, err)
+		return
+	}
+	if _, err := s.queue.Add(&queue.Task{Queue: PlaysQueue, Name: owner}); err != nil {
+		log.Printf("warning: unable to queue play sync of %q: %s", owner, err)
+	}
+}
+
+// PlaysTask is the handler of PlaysQueue.
+func (s *Service) PlaysTask(ctx context.Context, t *queue.Task) error {
+	_, err := s.SyncPlays(ctx, t.Name)
+	return err
+}
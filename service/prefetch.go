@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/queue"
+)
+
+// GameFetchQueue is the queue of games to fetch into the cache ahead of
+// time. Tasks are named by game ID, so each game is queued at most once.
+const GameFetchQueue = "game-fetch"
+
+// refreshPayload marks game-fetch tasks that replace a stale cached copy.
+const refreshPayload = "refresh"
+
+// queueGameFetch queues gameID to be fetched in the background, replacing the
+// cached copy if refresh is set.
+func (s *Service) queueGameFetch(gameID string, refresh bool) {
+	if s.queue == nil {
+		return
+	}
+	t := &queue.Task{Queue: GameFetchQueue, Name: gameID}
+	if refresh {
+		t.Payload = refreshPayload
+	}
+	if _, err := s.queue.Add(t); err != nil {
+		log.Printf("warning: unable to queue fetch of game %q: %s", gameID, err)
+	}
+}
+
+// FetchGameTask is the handler of GameFetchQueue.
+func (s *Service) FetchGameTask(ctx context.Context, t *queue.Task) error {
+	var thing *bgg.Thing
+	var err error
+	if t.Payload == refreshPayload {
+		thing, err = s.bgg.RefreshThing(ctx, t.Name)
+	} else {
+		thing, err = s.bgg.Thing(ctx, t.Name)
+	}
+	if err != nil {
+		return err
+	}
+	s.recordTrend(thing)
+	return nil
+}
+
+// Refresh re-fetches stale cached collections and queues stale or missing
+// games of those collections, so user requests find a warm cache.
+func (s *Service) Refresh(ctx context.Context) {
+	for _, bggName := range s.bgg.StaleCollections(s.config().CollectionTTL) {
+		if ctx.Err() != nil {
+			return
+		}
+		owned, err := s.bgg.Owned(ctx, bggName)
+		if err != nil {
+			log.Printf("warning: unable to refresh collection of %q: %s", bggName, err)
+			continue
+		}
+		for _, g := range owned {
+			if s.bgg.CachedThing(g.ID) == nil {
+				s.queueGameFetch(g.ID, false)
+			}
+		}
+	}
+	for _, id := range s.bgg.StaleThings(s.config().GameTTL) {
+		s.queueGameFetch(id, true)
+	}
+}
+
+// RefreshCollection fetches the collection of bggName from BGG again,
+// replacing the cached copy, and queues its games that aren't cached.
+func (s *Service) RefreshCollection(ctx context.Context, bggName string) error {
+	owned, err := s.bgg.Owned(ctx, bggName)
+	if err != nil {
+		return err
+	}
+	for _, g := range owned {
+		if s.bgg.CachedThing(g.ID) == nil {
+			s.queueGameFetch(g.ID, false)
+		}
+	}
+	return nil
+}
+
+// RefreshEvery runs Refresh every interval until ctx is done.
+func (s *Service) RefreshEvery(ctx context.Context, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			s.Refresh(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+const profileKind = "Profile"
+
+// Profile is a user's sharing settings.
+type Profile struct {
+	BGGName string
+	Public  bool // the collection is shown at /u/{BGGName}
+	Updated time.Time
+}
+
+// ShelfGame is a game of a public collection. Only the name and plays are
+// known until the game has been fetched into the cache.
+type ShelfGame struct {
+	ID         string  `json:"id"`
+	Name       string  `json:"name"`
+	NumPlays   int     `json:"numPlays"`
+	Year       int     `json:"year,omitempty"`
+	MinPlayers int     `json:"minPlayers,omitempty"`
+	MaxPlayers int     `json:"maxPlayers,omitempty"`
+	Weight     float64 `json:"weight,omitempty"`
+	Thumbnail  string  `json:"thumbnail,omitempty"`
+}
+
+// Profile returns bggName's sharing settings, private if they have none.
+func (s *Service) Profile(bggName string) (*Profile, error) {
+	p := &Profile{BGGName: bggName}
+	err := s.st.Get(profileKind, strings.ToLower(bggName), p)
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SetPublic publishes or hides bggName's collection.
+func (s *Service) SetPublic(bggName string, public bool) error {
+	return s.st.Put(profileKind, strings.ToLower(bggName), &Profile{BGGName: bggName, Public: public, Updated: time.Now()})
+}
+
+// PublicCollection returns the games owned by bggName, sorted by name, or
+// ErrNotFound unless they made their collection public. Games missing from
+// the cache are queued so the next view has their details.
+func (s *Service) PublicCollection(ctx context.Context, bggName string) ([]ShelfGame, error) {
+	p, err := s.Profile(bggName)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Public {
+		return nil, ErrNotFound
+	}
+	owned, err := s.bgg.Owned(ctx, bggName)
+	if err != nil {
+		return nil, err
+	}
+	games := make([]ShelfGame, 0, len(owned))
+	for _, o := range owned {
+		g := ShelfGame{ID: o.ID, Name: o.Name, NumPlays: o.NumPlays}
+		if t := s.bgg.CachedThing(o.ID); t != nil {
+			g.Year, g.MinPlayers, g.MaxPlayers, g.Weight, g.Thumbnail = t.Year, t.MinPlayers, t.MaxPlayers, t.Weight, t.Thumbnail
+		} else {
+			s.queueGameFetch(o.ID, false)
+		}
+		games = append(games, g)
+	}
+	sort.Slice(games, func(i, j int) bool { return strings.ToLower(games[i].Name) < strings.ToLower(games[j].Name) })
+	return games, nil
+}
+
+// PublicPages returns the profiles of the public collections and the IDs of
+// the games in them, sorted, for listing in a sitemap. Only collections
+// already in the cache are looked at, so this never calls BGG.
+func (s *Service) PublicPages() ([]*Profile, []string, error) {
+	var all []*Profile
+	if _, err := s.st.GetAll(profileKind, "", &all); err != nil {
+		return nil, nil, err
+	}
+	var public []*Profile
+	seen := make(map[string]bool)
+	var gameIDs []string
+	for _, p := range all {
+		if !p.Public {
+			continue
+		}
+		public = append(public, p)
+		for id := range s.bgg.CachedOwned(p.BGGName) {
+			if !seen[id] {
+				seen[id] = true
+				gameIDs = append(gameIDs, id)
+			}
+		}
+	}
+	sort.Slice(public, func(i, j int) bool { return public[i].BGGName < public[j].BGGName })
+	sort.Strings(gameIDs)
+	return public, gameIDs, nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/plays"
+	"github.com/mattkoler/board_game_helper/scoring"
+)
+
+// ScoreSheet returns the scoring categories of a game for bggName, and
+// whether they made the sheet themselves.
+func (s *Service) ScoreSheet(bggName, gameID string) (categories []string, custom bool) {
+	return scoring.Categories(s.st, bggName, gameID), scoring.Custom(s.st, bggName, gameID)
+}
+
+// SaveScoreSheet replaces bggName's sheet for a game with categories.
+func (s *Service) SaveScoreSheet(bggName, gameID string, categories []string) error {
+	return scoring.Save(s.st, bggName, gameID, categories)
+}
+
+// ResetScoreSheet drops bggName's sheet for a game, so the built in one
+// applies again.
+func (s *Service) ResetScoreSheet(bggName, gameID string) error {
+	return scoring.Reset(s.st, bggName, gameID)
+}
+
+// LogScores totals the filled in score sheets of a play of gameID on date
+// and records it as a play of bggName, each player scoring their total and
+// the highest totals winning. With push set it is logged on BGG too, as
+// LogPlay does.
+func (s *Service) LogScores(ctx context.Context, bggName, gameID, gameName string, date time.Time, entries []*scoring.Entry, push bool) (pushed bool, err error) {
+	if err := scoring.Tally(scoring.Categories(s.st, bggName, gameID), entries); err != nil {
+		return false, err
+	}
+	p := &plays.Play{GameID: gameID, GameName: gameName, Date: date}
+	for _, e := range entries {
+		p.Players = append(p.Players, plays.Player{Name: e.Name, Score: e.Total, HasScore: true, Win: e.Win})
+	}
+	return s.LogPlay(ctx, bggName, p, push)
+}
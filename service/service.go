@@ -0,0 +1,147 @@
+// Package service holds the business logic of the site, free of HTTP, so the
+// web handlers, command line tools and bots can all share it. Methods take a
+// context and plain structs and return plain structs.
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/config"
+	"github.com/mattkoler/board_game_helper/moods"
+	"github.com/mattkoler/board_game_helper/queue"
+	"github.com/mattkoler/board_game_helper/recommend"
+	"github.com/mattkoler/board_game_helper/resolve"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// ErrNotFound is returned for data that doesn't exist or isn't shared with
+// the caller.
+var ErrNotFound = errors.New("not found")
+
+// Service is the entry point to the site's features.
+type Service struct {
+	cfgMu sync.RWMutex
+	cfg   *config.Config
+	bgg   *bgg.Client
+	st    *store.Store
+	queue queue.Queue
+
+	started  time.Time // so pages rendered by an older build get new ETags
+	verMu    sync.Mutex
+	versions map[string]uint64 // store changes by kind
+	snapMu   sync.Mutex        // serializes collection snapshots
+	trendMu  sync.Mutex        // serializes game trend updates
+}
+
+// New returns a Service configured by cfg, fetching game data with client
+// and keeping user data in st. Background work is queued on q, which may be
+// nil to skip it.
+func New(cfg *config.Config, client *bgg.Client, st *store.Store, q queue.Queue) *Service {
+	s := &Service{cfg: cfg, bgg: client, st: st, queue: q, started: time.Now(), versions: make(map[string]uint64)}
+	st.Watch(func(kind, key string) {
+		s.verMu.Lock()
+		s.versions[kind]++
+		s.verMu.Unlock()
+	})
+	return s
+}
+
+// version returns a count of the changes made to the store entities of kind.
+func (s *Service) version(kind string) uint64 {
+	s.verMu.Lock()
+	defer s.verMu.Unlock()
+	return s.versions[kind]
+}
+
+// SetConfig replaces the configuration of s, for config reloads.
+func (s *Service) SetConfig(cfg *config.Config) {
+	s.cfgMu.Lock()
+	defer s.cfgMu.Unlock()
+	s.cfg = cfg
+}
+
+// config returns the current configuration of s.
+func (s *Service) config() *config.Config {
+	s.cfgMu.RLock()
+	defer s.cfgMu.RUnlock()
+	return s.cfg
+}
+
+// game loads gameID and rates it for numPlayers, with its fields resolved
+// for owner, who may be empty, and the owned expansions of the game, which
+// may be nil. The returned game has no fit yet, that depends on the scorer.
+func (s *Service) game(ctx context.Context, gameID string, numPlayers int, owner string, expansions []recommend.Expansion) (*recommend.Game, *bgg.Thing, resolve.Result, error) {
+	t, err := s.bgg.Thing(ctx, gameID)
+	if err != nil {
+		return nil, nil, resolve.Result{}, err
+	}
+	r, err := s.resolve(t, numPlayers, owner, expansions)
+	if err != nil {
+		return nil, nil, resolve.Result{}, err
+	}
+
+	g := &recommend.Game{
+		Name:       t.Name,
+		ID:         gameID,
+		Best:       r.Fit.Best,
+		Rec:        r.Fit.Rec,
+		MinPlayers: r.Players.Min,
+		MaxPlayers: r.Players.Max,
+		MinAge:     t.MinAge,
+		Score:      t.Score,
+		Weight:     t.Weight,
+		BScore:     t.BScore,
+		Ratings:    t.Ratings,
+		Categories: t.Categories,
+		Mechanics:  t.Mechanics,
+		Moods:      r.Moods,
+	}
+	counts, err := t.PlayerCounts()
+	if err != nil {
+		return nil, nil, resolve.Result{}, fmt.Errorf("error parsing polls: %s", err)
+	}
+	g.BestAt, g.GoodAt = counts.Best, counts.Good
+	if r.FitFrom == resolve.Poll {
+		p, _, err := t.PollAt(numPlayers)
+		if err != nil {
+			return nil, nil, resolve.Result{}, fmt.Errorf("error parsing polls: %s", err)
+		}
+		g.Votes = recommend.Votes{Best: p.Best, Rec: p.Rec, Nay: p.Nay}
+	}
+	if r.FitFrom == resolve.Expansion {
+		g.With = expansionAt(expansions, numPlayers).Name // the one the fit came from
+	}
+	recommend.Enrich(g)
+	return g, t, r, nil
+}
+
+// resolve offers what each data source says about t to the precedence
+// rules of the resolve package.
+func (s *Service) resolve(t *bgg.Thing, numPlayers int, owner string, expansions []recommend.Expansion) (resolve.Result, error) {
+	in := resolve.NewInput()
+	in.Players[resolve.Box] = resolve.PlayerRange{Min: t.MinPlayers, Max: t.MaxPlayers}
+	in.Moods[resolve.Box] = moods.Tag(t.Categories, t.Mechanics)
+	minVotes := s.config().MinPollVotes
+	bestAt, recAt, err := t.PlayerFit(numPlayers, minVotes)
+	if err != nil {
+		return resolve.Result{}, fmt.Errorf("error parsing polls: %s", err)
+	}
+	if t.PollVoters() < minVotes {
+		// Too few votes to go by, the fit is from the box counts.
+		in.Fit[resolve.Box] = resolve.Fit{Best: bestAt, Rec: recAt}
+	} else {
+		in.Fit[resolve.Poll] = resolve.Fit{Best: bestAt, Rec: recAt}
+	}
+	if err := s.offerExpansions(in, t, numPlayers, expansions); err != nil {
+		return resolve.Result{}, err
+	}
+	if o := moods.Lookup(s.st, owner, t.ID); o != nil {
+		in.Moods[resolve.Override] = o.Moods
+	}
+	return in.Resolve(), nil
+}
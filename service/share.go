@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/recommend"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+const shareKind = "Share"
+
+// ShareWindow is how long a shared recommendation stays available.
+const ShareWindow = 30 * 24 * time.Hour
+
+// Snapshot is a recommendation result frozen for sharing, so the people it
+// is sent to see the same list without anything being fetched again.
+type Snapshot struct {
+	Token   string            `json:"token"`
+	Request CollectionRequest `json:"request"`
+	Games   []*recommend.Game `json:"games"`
+	Created time.Time         `json:"created"`
+}
+
+// Expires is when the snapshot stops being served.
+func (s *Snapshot) Expires() time.Time {
+	return s.Created.Add(ShareWindow)
+}
+
+// newToken returns a short random token that is safe in URLs.
+func newToken() (string, error) {
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Share snapshots the recommendations for req under a new random token.
+func (s *Service) Share(ctx context.Context, req CollectionRequest) (*Snapshot, error) {
+	c, err := s.Recommend(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{Request: c.CollectionRequest, Games: c.Games, Created: time.Now()}
+	// Tokens are short, so retry on the rare collision instead of
+	// overwriting someone else's snapshot.
+	for i := 0; i < 3; i++ {
+		if snap.Token, err = newToken(); err != nil {
+			return nil, fmt.Errorf("unable to generate share token: %s", err)
+		}
+		if _, err = s.st.PutIf(shareKind, snap.Token, snap, 0); err != store.ErrConflict {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// Shared returns the snapshot saved under token, or ErrNotFound if there is
+// none or it has expired.
+func (s *Service) Shared(token string) (*Snapshot, error) {
+	snap := &Snapshot{}
+	err := s.st.Get(shareKind, token, snap)
+	if err == store.ErrNotFound || err == nil && time.Now().After(snap.Expires()) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/queue"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// shelfKind holds the shelf units users store their games on, keyed by
+// lowercased BGG name and unit ID.
+const shelfKind = "ShelfUnit"
+
+// BoxQueue is the queue of games to fetch the box size of. Tasks are named
+// by game ID.
+const BoxQueue = "box"
+
+// boxKind is the store kind of game box sizes, keyed by game ID.
+const boxKind = "Box"
+
+// BoxTTL is the age at which a game's box size is fetched again, new
+// editions rarely change it.
+const BoxTTL = 180 * 24 * time.Hour
+
+// gameBox is the box size of a game, Box is nil if BGG has none.
+type gameBox struct {
+	GameID  string
+	Box     *bgg.Box
+	Fetched time.Time
+}
+
+// ShelfUnit is a kind of shelf space, such as a Kallax cube, sized in
+// centimeters on the inside. Width runs along the shelf.
+type ShelfUnit struct {
+	ID      string    `json:"id"`
+	Owner   string    `json:"owner"`
+	Name    string    `json:"name"`
+	Width   float64   `json:"width"`
+	Height  float64   `json:"height"`
+	Depth   float64   `json:"depth"`
+	Count   int       `json:"count"` // how many of them there are
+	Updated time.Time `json:"updated"`
+}
+
+// ShelfPresets are common shelf units to start from.
+var ShelfPresets = []ShelfUnit{
+	{Name: "Kallax cube", Width: 33, Height: 33, Depth: 39, Count: 1},
+	{Name: "Billy shelf", Width: 76, Height: 35, Depth: 26, Count: 1},
+}
+
+// Validate checks u as entered by its owner.
+func (u *ShelfUnit) Validate() error {
+	if u.Name == "" || len(u.Name) > 40 {
+		return errors.New("bad name param, please provide a name of 1-40 characters")
+	}
+	for _, d := range []float64{u.Width, u.Height, u.Depth} {
+		if d < 1 || d > 500 {
+			return errors.New("bad size param, please provide sizes between 1 and 500 cm")
+		}
+	}
+	if u.Count < 1 || u.Count > 100 {
+		return errors.New("bad count param, please provide a number between 1 and 100")
+	}
+	return nil
+}
+
+// ShelfUnits returns bggName's shelf units, by name.
+func (s *Service) ShelfUnits(bggName string) ([]*ShelfUnit, error) {
+	var units []*ShelfUnit
+	if _, err := s.st.GetAll(shelfKind, store.Key(strings.ToLower(bggName), ""), &units); err != nil {
+		return nil, err
+	}
+	sort.Slice(units, func(i, j int) bool { return units[i].Name < units[j].Name })
+	return units, nil
+}
+
+// AddShelfUnit stores u as a shelf unit of its owner.
+func (s *Service) AddShelfUnit(u *ShelfUnit) error {
+	if err := u.Validate(); err != nil {
+		return err
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("unable to generate shelf unit id: %s", err)
+	}
+	u.ID, u.Updated = hex.EncodeToString(b), time.Now()
+	return s.st.Put(shelfKind, store.Key(strings.ToLower(u.Owner), u.ID), u)
+}
+
+// DeleteShelfUnit drops bggName's shelf unit id.
+func (s *Service) DeleteShelfUnit(bggName, id string) error {
+	err := s.st.Delete(shelfKind, store.Key(strings.ToLower(bggName), id))
+	if err == store.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// ShelvedGame is a game placed on a shelf.
+type ShelvedGame struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Flat bool   `json:"flat"` // lying flat, it can't stand on the shelf
+}
+
+// Shelf is one shelf of a plan and the games placed on it.
+type Shelf struct {
+	Name  string         `json:"name"`
+	Unit  *ShelfUnit     `json:"unit"`
+	Games []*ShelvedGame `json:"games"`
+	Used  float64        `json:"used"` // of the width, in centimeters
+
+	stacks []shelfStack
+}
+
+// UsedPercent is how much of the shelf's width is taken.
+func (sh *Shelf) UsedPercent() int {
+	return int(sh.Used * 100 / sh.Unit.Width)
+}
+
+// shelfStack is a stack of boxes lying flat, width is how much of the
+// shelf it takes.
+type shelfStack struct {
+	width, height float64
+}
+
+// ShelfPlan suggests which shelf each owned game goes on.
+type ShelfPlan struct {
+	BGGName string         `json:"bggName"`
+	Units   []*ShelfUnit   `json:"units"`
+	Shelves []*Shelf       `json:"shelves"`
+	TooBig  []SnapshotGame `json:"tooBig"`  // fit on none of the shelves
+	NoRoom  []SnapshotGame `json:"noRoom"`  // would fit, but the shelves are full
+	Unknown []SnapshotGame `json:"unknown"` // BGG has no box size for
+	Pending int            `json:"pending"`
+	Stale   bool           `json:"stale"` // BGG is unavailable, the collection is the one last fetched
+}
+
+// ShelfPlan packs bggName's owned games onto their shelf units, biggest
+// box first, each on the first shelf with room. Boxes stand spine out
+// where they can and lie flat in stacks otherwise. Games without a box
+// size yet are queued and left out.
+func (s *Service) ShelfPlan(ctx context.Context, bggName string) (*ShelfPlan, error) {
+	owned, stale, err := s.bgg.OwnedOrStale(ctx, bggName)
+	if err != nil {
+		return nil, err
+	}
+	units, err := s.ShelfUnits(bggName)
+	if err != nil {
+		return nil, err
+	}
+	p := &ShelfPlan{BGGName: bggName, Units: units, Shelves: []*Shelf{}, TooBig: []SnapshotGame{}, NoRoom: []SnapshotGame{}, Unknown: []SnapshotGame{}, Stale: stale}
+	for _, u := range units {
+		for i := 1; i <= u.Count; i++ {
+			name := u.Name
+			if u.Count > 1 {
+				name += " " + strconv.Itoa(i)
+			}
+			p.Shelves = append(p.Shelves, &Shelf{Name: name, Unit: u, Games: []*ShelvedGame{}})
+		}
+	}
+
+	type boxed struct {
+		game SnapshotGame
+		dims [3]float64 // largest first
+	}
+	var boxes []boxed
+	for _, g := range owned {
+		var b gameBox
+		switch err := s.st.Get(boxKind, g.ID, &b); {
+		case err == store.ErrNotFound:
+			p.Pending++
+			s.queueBoxFetch(g.ID)
+			continue
+		case err != nil:
+			return nil, err
+		case time.Since(b.Fetched) > BoxTTL:
+			s.queueBoxFetch(g.ID)
+		}
+		if b.Box == nil {
+			p.Unknown = append(p.Unknown, SnapshotGame{ID: g.ID, Name: g.Name})
+			continue
+		}
+		boxes = append(boxes, boxed{SnapshotGame{ID: g.ID, Name: g.Name}, boxDims(b.Box)})
+	}
+	sort.SliceStable(boxes, func(i, j int) bool {
+		a, b := boxes[i].dims, boxes[j].dims
+		return a[0]*a[1]*a[2] > b[0]*b[1]*b[2]
+	})
+
+	for _, b := range boxes {
+		placed, fits := false, false
+		for _, sh := range p.Shelves {
+			var flat bool
+			if placed, flat = sh.place(b.dims); placed {
+				sh.Games = append(sh.Games, &ShelvedGame{ID: b.game.ID, Name: b.game.Name, Flat: flat})
+				break
+			}
+			fits = fits || sh.Unit.fits(b.dims)
+		}
+		switch {
+		case placed:
+		case fits:
+			p.NoRoom = append(p.NoRoom, b.game)
+		default:
+			p.TooBig = append(p.TooBig, b.game)
+		}
+	}
+	return p, nil
+}
+
+// queueBoxFetch queues gameID to have its box size fetched in the background.
+func (s *Service) queueBoxFetch(gameID string) {
+	if s.queue == nil {
+		return
+	}
+	if _, err := s.queue.Add(&queue.Task{Queue: BoxQueue, Name: gameID}); err != nil {
+		log.Printf("warning: unable to queue box size of game %q: %s", gameID, err)
+	}
+}
+
+// BoxTask is the handler of BoxQueue.
+func (s *Service) BoxTask(ctx context.Context, t *queue.Task) error {
+	b, err := s.bgg.BoxSize(ctx, t.Name)
+	if err != nil {
+		return err
+	}
+	return s.st.Put(boxKind, t.Name, &gameBox{GameID: t.Name, Box: b, Fetched: time.Now()})
+}
+
+// boxDims returns the sides of b, largest first.
+func boxDims(b *bgg.Box) [3]float64 {
+	d := []float64{b.Width, b.Length, b.Depth}
+	sort.Sort(sort.Reverse(sort.Float64Slice(d)))
+	return [3]float64{d[0], d[1], d[2]}
+}
+
+// stands reports whether a box of dims, largest first, stands spine out on
+// u, its thinnest side along the shelf.
+func (u *ShelfUnit) stands(dims [3]float64) bool {
+	return dims[2] <= u.Width &&
+		(dims[0] <= u.Height && dims[1] <= u.Depth || dims[1] <= u.Height && dims[0] <= u.Depth)
+}
+
+// lies reports whether a box of dims, largest first, lies flat on u, and
+// the width of shelf it takes then.
+func (u *ShelfUnit) lies(dims [3]float64) (ok bool, width float64) {
+	if dims[2] > u.Height {
+		return false, 0
+	}
+	// Take the least width the depth of the shelf allows.
+	if dims[0] <= u.Depth && dims[1] <= u.Width {
+		return true, dims[1]
+	}
+	if dims[1] <= u.Depth && dims[0] <= u.Width {
+		return true, dims[0]
+	}
+	return false, 0
+}
+
+// fits reports whether a box of dims fits on an empty shelf of u.
+func (u *ShelfUnit) fits(dims [3]float64) bool {
+	ok, _ := u.lies(dims)
+	return ok || u.stands(dims)
+}
+
+// place puts a box of dims on sh if there is room, standing if it can.
+func (sh *Shelf) place(dims [3]float64) (placed, flat bool) {
+	u := sh.Unit
+	if u.stands(dims) && sh.Used+dims[2] <= u.Width {
+		sh.Used += dims[2]
+		return true, false
+	}
+	ok, width := u.lies(dims)
+	if !ok {
+		return false, false
+	}
+	for i := range sh.stacks {
+		st := &sh.stacks[i]
+		if width <= st.width && st.height+dims[2] <= u.Height {
+			st.height += dims[2]
+			return true, true
+		}
+	}
+	if sh.Used+width > u.Width {
+		return false, false
+	}
+	sh.Used += width
+	sh.stacks = append(sh.stacks, shelfStack{width: width, height: dims[2]})
+	return true, true
+}
@@ -0,0 +1,64 @@
+package service
+
+import "context"
+
+// SimilarGame is a game BGG recommends to the fans of another.
+type SimilarGame struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Owned      bool   `json:"owned"`
+	Wishlisted bool   `json:"wishlisted"`
+}
+
+// SimilarReport is what fans of a game also like, checked against a
+// user's collection and wishlist when there is a user.
+type SimilarReport struct {
+	ID      string         `json:"id"`
+	Name    string         `json:"name"`
+	BGGName string         `json:"bggName,omitempty"`
+	Games   []*SimilarGame `json:"games"` // best match first
+	Owned   int            `json:"owned"`
+}
+
+// Similar loads the games BGG recommends to fans of gameID. When bggName
+// isn't empty, the games they own and have wishlisted are marked, so the
+// rest are the ones they could wishlist. Games wishlisted as "don't buy
+// this" count as wishlisted, they were already turned down.
+func (s *Service) Similar(ctx context.Context, gameID, bggName string) (*SimilarReport, error) {
+	t, err := s.bgg.Thing(ctx, gameID)
+	if err != nil {
+		return nil, err
+	}
+	related, err := s.bgg.Related(ctx, gameID)
+	if err != nil {
+		return nil, err
+	}
+	r := &SimilarReport{ID: gameID, Name: t.Name, BGGName: bggName, Games: []*SimilarGame{}}
+
+	owned := make(map[string]bool)
+	wished := make(map[string]bool)
+	if bggName != "" {
+		games, _, err := s.bgg.OwnedOrStale(ctx, bggName)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range games {
+			owned[g.ID] = true
+		}
+		wishlist, err := s.bgg.Wishlist(ctx, bggName)
+		if err != nil {
+			return nil, err
+		}
+		for _, g := range wishlist {
+			wished[g.ID] = true
+		}
+	}
+	for _, g := range related {
+		sg := &SimilarGame{ID: g.ID, Name: g.Name, Owned: owned[g.ID], Wishlisted: wished[g.ID]}
+		if sg.Owned {
+			r.Owned++
+		}
+		r.Games = append(r.Games, sg)
+	}
+	return r, nil
+}
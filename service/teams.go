@@ -0,0 +1,152 @@
+package service
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/analytics"
+)
+
+// teamTrials is how many random splits are tried, keeping the best.
+const teamTrials = 200
+
+// Team is a team of a split.
+type Team struct {
+	Name    string   `json:"name"`
+	Players []string `json:"players"`
+	Skill   float64  `json:"skill"` // the players' summed Elo ratings, 0 unless weighted
+}
+
+// TeamSplit is a list of players split into teams.
+type TeamSplit struct {
+	Teams      []*Team  `json:"teams"`
+	Weighted   bool     `json:"weighted"`   // teams were balanced by Elo rating
+	Unrated    []string `json:"unrated"`    // weighted players without a rating, counted at the start rating
+	Violations int      `json:"violations"` // pairs kept apart that had to share a team
+}
+
+// SplitTeams splits players into n teams of sizes at most one apart, at
+// random but keeping each group of apart in different teams where it can.
+// With bggName set the teams are balanced by the Elo ratings of the
+// players in bggName's leaderboard.
+func (s *Service) SplitTeams(players []string, n int, apart [][]string, bggName string) (*TeamSplit, error) {
+	split := &TeamSplit{Teams: []*Team{}, Unrated: []string{}, Weighted: bggName != ""}
+	skill := make(map[string]float64, len(players))
+	for _, p := range players {
+		skill[p] = 0
+	}
+	if split.Weighted {
+		a, err := analytics.LoadAggregate(s.st, bggName)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range players {
+			r, ok := 0.0, false
+			if a.Standings != nil {
+				r, ok = a.Standings.Rating(p)
+			}
+			if !ok {
+				r = analytics.StartRating
+				split.Unrated = append(split.Unrated, p)
+			}
+			skill[p] = r
+		}
+	}
+	// apartFrom lists, by lowercased player, who they are to be kept apart
+	// from. Names that aren't playing are dropped first, so the pairs are
+	// bounded by the players however long the groups are.
+	playing := make(map[string]bool, len(players))
+	for _, p := range players {
+		playing[strings.ToLower(p)] = true
+	}
+	apartFrom := make(map[string]map[string]bool)
+	for _, group := range apart {
+		var in []string
+		for _, name := range group {
+			if name := strings.ToLower(name); playing[name] {
+				in = append(in, name)
+			}
+		}
+		for _, a := range in {
+			for _, b := range in {
+				if a == b {
+					continue
+				}
+				if apartFrom[a] == nil {
+					apartFrom[a] = make(map[string]bool)
+				}
+				apartFrom[a][b] = true
+			}
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	bestCost := math.Inf(1)
+	order := make([]string, len(players))
+	copy(order, players)
+	for trial := 0; trial < teamTrials; trial++ {
+		rnd.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		if trial == 0 {
+			// Dealing the best players first balances skill best, the
+			// other trials deal at random to find splits the constraints
+			// allow.
+			sort.SliceStable(order, func(i, j int) bool { return skill[order[i]] > skill[order[j]] })
+		}
+		teams, violations := dealTeams(order, n, skill, apartFrom)
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, t := range teams {
+			lo, hi = math.Min(lo, t.Skill), math.Max(hi, t.Skill)
+		}
+		if cost := float64(violations)*1e9 + hi - lo; cost < bestCost {
+			bestCost, split.Teams, split.Violations = cost, teams, violations
+		}
+		if !split.Weighted && violations == 0 {
+			break // without ratings every split without violations is as good
+		}
+	}
+	return split, nil
+}
+
+// dealTeams deals players, in order, to n teams, each to the smallest team
+// with the least skill that has no one they are kept apart from, or the
+// smallest team with the least skill if every team has. It returns the
+// teams and how many pairs kept apart share one.
+func dealTeams(players []string, n int, skill map[string]float64, apartFrom map[string]map[string]bool) ([]*Team, int) {
+	teams := make([]*Team, n)
+	for i := range teams {
+		teams[i] = &Team{Name: "Team " + strconv.Itoa(i+1), Players: []string{}}
+	}
+	violations := 0
+	for _, p := range players {
+		best, bestClash := -1, 0
+		for i, t := range teams {
+			// The first len(players)%n teams take a player more.
+			size := len(players) / n
+			if i < len(players)%n {
+				size++
+			}
+			if len(t.Players) >= size {
+				continue
+			}
+			clash := 0
+			for _, q := range t.Players {
+				if apartFrom[strings.ToLower(p)][strings.ToLower(q)] {
+					clash++
+				}
+			}
+			if best < 0 || clash < bestClash ||
+				clash == bestClash && (len(t.Players) < len(teams[best].Players) ||
+					len(t.Players) == len(teams[best].Players) && t.Skill < teams[best].Skill) {
+				best, bestClash = i, clash
+			}
+		}
+		teams[best].Players = append(teams[best].Players, p)
+		teams[best].Skill += skill[p]
+		violations += bestClash
+	}
+	return teams, violations
+}
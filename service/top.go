@@ -0,0 +1,125 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TopBy is the fields a top list can rank games by.
+var TopBy = []string{"weight", "score", "bscore"}
+
+// MaxTop is the longest top list.
+const MaxTop = 100
+
+// TopGame is a game of a top list.
+type TopGame struct {
+	Rank  int     `json:"rank"`
+	ID    string  `json:"id"`
+	Name  string  `json:"name"`
+	Value float64 `json:"value"` // of the field the list ranks by
+}
+
+// TopList is the top games of a collection by one field.
+type TopList struct {
+	BGGName    string     `json:"bggName"`
+	By         string     `json:"by"`
+	N          int        `json:"n"`
+	Category   string     `json:"category,omitempty"`
+	Games      []*TopGame `json:"games"`
+	Categories []string   `json:"categories"` // of the cached games, to pick from
+	Pending    int        `json:"pending"`    // owned games not cached yet, left out
+}
+
+// Top ranks the cached games of bggName's collection by by, one of TopBy,
+// highest first, keeping the first n in category, if set. Only cached data
+// is used, ok is false if the collection was never loaded. Games not cached
+// yet are queued and left out.
+func (s *Service) Top(bggName, by string, n int, category string) (l *TopList, ok bool) {
+	owned := s.bgg.CachedOwned(bggName)
+	if owned == nil {
+		return nil, false
+	}
+
+	l = &TopList{BGGName: bggName, By: by, N: n, Category: category, Games: []*TopGame{}, Categories: []string{}}
+	seen := make(map[string]bool)
+	for id := range owned {
+		t := s.bgg.CachedThing(id)
+		if t == nil {
+			l.Pending++
+			s.queueGameFetch(id, false)
+			continue
+		}
+		inCategory := category == ""
+		for _, c := range t.Categories {
+			if !seen[c] {
+				seen[c] = true
+				l.Categories = append(l.Categories, c)
+			}
+			if strings.EqualFold(c, category) {
+				inCategory = true
+			}
+		}
+		if !inCategory {
+			continue
+		}
+		g := &TopGame{ID: id, Name: t.Name}
+		switch by {
+		case "weight":
+			g.Value = t.Weight
+		case "score":
+			g.Value = t.Score
+		case "bscore":
+			g.Value = t.BScore
+		}
+		l.Games = append(l.Games, g)
+	}
+	sort.Strings(l.Categories)
+	sort.Slice(l.Games, func(i, j int) bool {
+		if l.Games[i].Value != l.Games[j].Value {
+			return l.Games[i].Value > l.Games[j].Value
+		}
+		return strings.ToLower(l.Games[i].Name) < strings.ToLower(l.Games[j].Name)
+	})
+	if len(l.Games) > n {
+		l.Games = l.Games[:n]
+	}
+	for i, g := range l.Games {
+		g.Rank = i + 1
+	}
+	return l, true
+}
+
+// ValidTopBy reports whether a top list can rank by by.
+func ValidTopBy(by string) bool {
+	for _, b := range TopBy {
+		if b == by {
+			return true
+		}
+	}
+	return false
+}
+
+// Title names the list, such as "Top 10 by weight in bob's collection".
+func (l *TopList) Title() string {
+	title := fmt.Sprintf("Top %d by %s in %s's collection", l.N, l.By, l.BGGName)
+	if l.Category != "" {
+		title += ", " + l.Category
+	}
+	return title
+}
+
+// Markdown formats the list for forums and group chats, with each game
+// linked to its BGG page.
+func (l *TopList) Markdown() string {
+	esc := discordStyle.escape
+	var b strings.Builder
+	b.WriteString(discordStyle.strong(esc.Replace(l.Title())) + "\n\n")
+	if len(l.Games) == 0 {
+		b.WriteString("No games yet.\n")
+	}
+	for _, g := range l.Games {
+		fmt.Fprintf(&b, "%d. [%s](https://boardgamegeek.com/boardgame/%s) - %.2f\n", g.Rank, esc.Replace(g.Name), g.ID, g.Value)
+	}
+	return b.String()
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+)
+
+// TradeGame is a game one user has for trade and the other wants.
+type TradeGame struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Priority int    `json:"priority"` // on the wanting user's wishlist, 1 is must have
+}
+
+// TradeSwap pairs a game each user gives the other.
+type TradeSwap struct {
+	AGives TradeGame `json:"aGives"`
+	BGives TradeGame `json:"bGives"`
+}
+
+// TradeMatch is what two users could trade with each other.
+type TradeMatch struct {
+	A string `json:"a"`
+	B string `json:"b"`
+	// Swaps pair what each user wants most from the other. The games left
+	// over once either side runs out are in AGives and BGives.
+	Swaps  []TradeSwap `json:"swaps"`
+	AGives []TradeGame `json:"aGives"` // A's games for trade B wants, not in a swap
+	BGives []TradeGame `json:"bGives"`
+}
+
+// TradeMatch cross references the games a and b flagged for trade with each
+// other's wishlists. Games wishlisted as "don't buy this" don't count.
+func (s *Service) TradeMatch(ctx context.Context, a, b string) (*TradeMatch, error) {
+	aTrade, aWants, err := s.bgg.TradeLists(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	bTrade, bWants, err := s.bgg.TradeLists(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+	m := &TradeMatch{A: a, B: b, Swaps: []TradeSwap{}}
+	aGives, bGives := wanted(aTrade, bWants), wanted(bTrade, aWants)
+	for len(aGives) > 0 && len(bGives) > 0 {
+		m.Swaps = append(m.Swaps, TradeSwap{AGives: aGives[0], BGives: bGives[0]})
+		aGives, bGives = aGives[1:], bGives[1:]
+	}
+	m.AGives, m.BGives = aGives, bGives
+	return m, nil
+}
+
+// wanted returns the games of forTrade on wishlist, most wanted first.
+func wanted(forTrade, wishlist []bgg.ListedGame) []TradeGame {
+	priority := make(map[string]int)
+	for _, g := range wishlist {
+		if g.Priority != bgg.DontBuy {
+			priority[g.ID] = g.Priority
+		}
+	}
+	games := []TradeGame{}
+	for _, g := range forTrade {
+		if p, ok := priority[g.ID]; ok {
+			games = append(games, TradeGame{ID: g.ID, Name: g.Name, Priority: p})
+		}
+	}
+	sort.SliceStable(games, func(i, j int) bool {
+		if games[i].Priority != games[j].Priority {
+			return games[i].Priority < games[j].Priority
+		}
+		return strings.ToLower(games[i].Name) < strings.ToLower(games[j].Name)
+	})
+	return games
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"log"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// trendKind holds the rating history of each game, keyed by game ID.
+const trendKind = "GameTrend"
+
+// MaxTrendPoints is how many fetches of a game's ratings are kept, two years
+// of weekly refreshes.
+const MaxTrendPoints = 104
+
+// TrendPoint is a game's ratings as fetched at At.
+type TrendPoint struct {
+	At         time.Time `json:"at"`
+	Score      float64   `json:"score"`
+	BayesScore float64   `json:"bayesScore"`
+	Weight     float64   `json:"weight"`
+	Ratings    int       `json:"ratings"`
+}
+
+// GameTrend is how a game's ratings moved over the fetches kept.
+type GameTrend struct {
+	ID     string       `json:"id"`
+	Name   string       `json:"name"`
+	Points []TrendPoint `json:"points"` // oldest first
+	// Change is the move of the Bayes score, which BGG ranks by, from the
+	// first point to the last. Direction sums it up as climbing, falling or
+	// steady, it is empty until there are two points.
+	Change    float64 `json:"change"`
+	Direction string  `json:"direction"`
+}
+
+// steadyWithin is the smallest change of the Bayes score counted as a move.
+const steadyWithin = 0.01
+
+// recordTrend adds t's ratings to its history if they were fetched after the
+// last point. It is called from the background fetches and RefreshGame, not
+// on page loads, so each fetch costs one store write at most. Failures are
+// only logged, the history is a nicety.
+func (s *Service) recordTrend(t *bgg.Thing) {
+	if t.Stats.Fetched.IsZero() {
+		return
+	}
+	s.trendMu.Lock()
+	defer s.trendMu.Unlock()
+	trend := &GameTrend{}
+	if err := s.st.Get(trendKind, t.ID, trend); err != nil && err != store.ErrNotFound {
+		log.Printf("warning: unable to load the trend of game %q: %s", t.ID, err)
+		return
+	}
+	if n := len(trend.Points); n > 0 && !t.Stats.Fetched.After(trend.Points[n-1].At) {
+		return
+	}
+	trend.ID, trend.Name = t.ID, t.Name
+	trend.Points = append(trend.Points, TrendPoint{
+		At:         t.Stats.Fetched,
+		Score:      t.Score,
+		BayesScore: t.BScore,
+		Weight:     t.Weight,
+		Ratings:    t.Ratings,
+	})
+	if len(trend.Points) > MaxTrendPoints {
+		trend.Points = trend.Points[len(trend.Points)-MaxTrendPoints:]
+	}
+	if err := s.st.Put(trendKind, t.ID, trend); err != nil {
+		log.Printf("warning: unable to save the trend of game %q: %s", t.ID, err)
+	}
+}
+
+// Trend returns the rating history of gameID, or ErrNotFound if it was never
+// fetched in the background or refreshed.
+func (s *Service) Trend(gameID string) (*GameTrend, error) {
+	trend := &GameTrend{}
+	switch err := s.st.Get(trendKind, gameID, trend); err {
+	case nil:
+	case store.ErrNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, err
+	}
+	if n := len(trend.Points); n > 1 {
+		trend.Change = trend.Points[n-1].BayesScore - trend.Points[0].BayesScore
+		switch {
+		case trend.Change >= steadyWithin:
+			trend.Direction = "climbing"
+		case trend.Change <= -steadyWithin:
+			trend.Direction = "falling"
+		default:
+			trend.Direction = "steady"
+		}
+	}
+	return trend, nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// turnOrderKind holds the first players picked for each play group, keyed
+// by lowercased group name.
+const turnOrderKind = "TurnOrder"
+
+// maxFirsts is how many past first players are kept per group.
+const maxFirsts = 20
+
+// turnHistory is who went first in a group's recent picks.
+type turnHistory struct {
+	Group   string
+	Firsts  []string // lowercased player names, oldest first
+	Updated time.Time
+}
+
+// TurnOrder is a picked seating and turn order, starting with the first
+// player.
+type TurnOrder struct {
+	Group    string   `json:"group,omitempty"`
+	Players  []string `json:"players"`
+	First    string   `json:"first"`
+	Weighted bool     `json:"weighted"`
+}
+
+// PickTurnOrder shuffles players into a turn order. With weighted set and a
+// group the pick is recorded for, whoever went first last time doesn't go
+// first again and players who went first less often in the group's
+// history are more likely to. The first player is recorded for the group,
+// if any.
+func (s *Service) PickTurnOrder(group string, players []string, weighted bool) (*TurnOrder, error) {
+	var h turnHistory
+	if group != "" {
+		if err := s.st.Get(turnOrderKind, strings.ToLower(group), &h); err != nil && err != store.ErrNotFound {
+			return nil, err
+		}
+	}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	weights := make([]float64, len(players))
+	total := 0.0
+	for i, p := range players {
+		weights[i] = 1
+		if weighted {
+			weights[i] = firstWeight(h.Firsts, strings.ToLower(p))
+		}
+		total += weights[i]
+	}
+	if total == 0 {
+		// Everyone was ruled out, which only happens with a single player.
+		for i := range weights {
+			weights[i] = 1
+		}
+		total = float64(len(weights))
+	}
+	first, x := 0, rnd.Float64()*total
+	for i, w := range weights {
+		if x < w {
+			first = i
+			break
+		}
+		x -= w
+	}
+
+	o := &TurnOrder{Group: group, First: players[first], Weighted: weighted}
+	rest := make([]string, 0, len(players)-1)
+	rest = append(rest, players[:first]...)
+	rest = append(rest, players[first+1:]...)
+	rnd.Shuffle(len(rest), func(i, j int) { rest[i], rest[j] = rest[j], rest[i] })
+	o.Players = append([]string{o.First}, rest...)
+
+	if group != "" {
+		h.Group = group
+		h.Firsts = append(h.Firsts, strings.ToLower(o.First))
+		if len(h.Firsts) > maxFirsts {
+			h.Firsts = h.Firsts[len(h.Firsts)-maxFirsts:]
+		}
+		h.Updated = time.Now()
+		if err := s.st.Put(turnOrderKind, strings.ToLower(group), &h); err != nil {
+			return nil, err
+		}
+	}
+	return o, nil
+}
+
+// firstWeight is how likely player is to be picked first given the
+// group's past first players: not at all if they went first last time,
+// otherwise less the more often they went first.
+func firstWeight(firsts []string, player string) float64 {
+	if len(firsts) > 0 && firsts[len(firsts)-1] == player {
+		return 0
+	}
+	n := 0
+	for _, f := range firsts {
+		if f == player {
+			n++
+		}
+	}
+	return 1 / float64(1+n)
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/queue"
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// PriceQueue is the queue of games to price from their marketplace
+// listings. Tasks are named by game ID.
+const PriceQueue = "price"
+
+// priceKind is the store kind of game prices, keyed by game ID.
+const priceKind = "Price"
+
+// PriceTTL is the age at which a game's price is worked out again.
+const PriceTTL = 30 * 24 * time.Hour
+
+// gamePrice is what a game's marketplace listings in one currency ask.
+type gamePrice struct {
+	GameID   string
+	Currency string
+	Median   float64
+	Low      float64
+	High     float64
+	Listings int // 0 when nobody is selling it, so nothing is known
+	Fetched  time.Time
+}
+
+// ValuedGame is a game of a value report.
+type ValuedGame struct {
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	Value    float64   `json:"value"` // median asking price, 0 if unknown
+	Low      float64   `json:"low"`
+	High     float64   `json:"high"`
+	Listings int       `json:"listings"`
+	Priced   time.Time `json:"priced"` // zero while the game is being priced
+}
+
+// ValueReport estimates what a collection is worth from the asking prices
+// of the BGG marketplace. It is a rough guide, asking prices aren't what
+// games sell for.
+type ValueReport struct {
+	BGGName  string        `json:"bggName"`
+	Currency string        `json:"currency"`
+	Games    []*ValuedGame `json:"games"` // most valuable first
+	Total    float64       `json:"total"`
+	Priced   int           `json:"priced"`   // games with a value
+	Unlisted int           `json:"unlisted"` // games nobody is selling
+	Pending  int           `json:"pending"`  // games still being priced
+	Stale    bool          `json:"stale"`    // BGG is unavailable, the collection is the one last fetched
+}
+
+// Value estimates the worth of the games owned by bggName. Games without a
+// price, or with one older than PriceTTL, are queued to be priced, so
+// reloading the report fills it in.
+func (s *Service) Value(ctx context.Context, bggName string) (*ValueReport, error) {
+	owned, stale, err := s.bgg.OwnedOrStale(ctx, bggName)
+	if err != nil {
+		return nil, err
+	}
+	currency := s.config().ValueCurrency
+	r := &ValueReport{BGGName: bggName, Currency: currency, Games: []*ValuedGame{}, Stale: stale}
+	for _, g := range owned {
+		vg := &ValuedGame{ID: g.ID, Name: g.Name}
+		r.Games = append(r.Games, vg)
+		var p gamePrice
+		switch err := s.st.Get(priceKind, g.ID, &p); {
+		case err == store.ErrNotFound || (err == nil && p.Currency != currency):
+			r.Pending++
+			s.queuePricing(g.ID)
+			continue
+		case err != nil:
+			return nil, err
+		case time.Since(p.Fetched) > PriceTTL:
+			s.queuePricing(g.ID)
+		}
+		vg.Value, vg.Low, vg.High, vg.Listings, vg.Priced = p.Median, p.Low, p.High, p.Listings, p.Fetched
+		if p.Listings == 0 {
+			r.Unlisted++
+			continue
+		}
+		r.Priced++
+		r.Total += p.Median
+	}
+	sort.SliceStable(r.Games, func(i, j int) bool {
+		a, b := r.Games[i], r.Games[j]
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		return strings.ToLower(a.Name) < strings.ToLower(b.Name)
+	})
+	return r, nil
+}
+
+// queuePricing queues gameID to be priced in the background.
+func (s *Service) queuePricing(gameID string) {
+	if s.queue == nil {
+		return
+	}
+	if _, err := s.queue.Add(&queue.Task{Queue: PriceQueue, Name: gameID}); err != nil {
+		log.Printf("warning: unable to queue pricing of game %q: %s", gameID, err)
+	}
+}
+
+// PriceTask is the handler of PriceQueue. It prices the game from its
+// listings in the value currency.
+func (s *Service) PriceTask(ctx context.Context, t *queue.Task) error {
+	listings, err := s.bgg.Listings(ctx, t.Name)
+	if err != nil {
+		return err
+	}
+	p := &gamePrice{GameID: t.Name, Currency: s.config().ValueCurrency, Fetched: time.Now()}
+	var prices []float64
+	for _, l := range listings {
+		if l.Currency == p.Currency {
+			prices = append(prices, l.Price)
+		}
+	}
+	if n := len(prices); n > 0 {
+		sort.Float64s(prices)
+		p.Listings, p.Low, p.High = n, prices[0], prices[n-1]
+		p.Median = prices[n/2]
+		if n%2 == 0 {
+			p.Median = (prices[n/2-1] + prices[n/2]) / 2
+		}
+	}
+	return s.st.Put(priceKind, t.Name, p)
+}
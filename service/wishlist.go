@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/bgg"
+	"github.com/mattkoler/board_game_helper/gamefmt"
+)
+
+// thinCoverage is how few owned games may play a player count, or sit at a
+// weight, for it to count as a gap.
+const thinCoverage = 1
+
+// maxGapPlayers is the largest player count checked for gaps.
+const maxGapPlayers = 8
+
+// How much each signal counts towards a wished game's chance of getting
+// played. They add up to 1.
+const (
+	wishPriorityWeight = 0.35
+	wishGapWeight      = 0.25
+	wishWeightWeight   = 0.2
+	wishFitWeight      = 0.2
+)
+
+// WishedGame is a game of a wishlist, judged on how likely it is to get
+// played.
+type WishedGame struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Priority   int      `json:"priority"` // 1 is must have
+	MinPlayers int      `json:"minPlayers"`
+	MaxPlayers int      `json:"maxPlayers"`
+	Weight     float64  `json:"weight"`
+	Best       bool     `json:"best"` // at the request's player count
+	Rec        bool     `json:"rec"`
+	GapCounts  []int    `json:"gapCounts"` // player counts few owned games play
+	GapWeight  bool     `json:"gapWeight"` // few owned games are this heavy
+	Score      float64  `json:"score"`     // 0 to 1, the chance it gets played
+	Reasons    []string `json:"reasons"`
+}
+
+// WishlistReport is a wishlist sorted by how likely each game is to get
+// played, a gift buying guide.
+type WishlistReport struct {
+	BGGName    string        `json:"bggName"`
+	NumPlayers int           `json:"numPlayers"` // the usual group size, 0 if not given
+	Games      []*WishedGame `json:"games"`      // likeliest to get played first
+	Deferred   int           `json:"deferred"`   // games left to load in the background
+	// PlayedWeight is the weight of the games the owner plays, weighted by
+	// plays.
+	PlayedWeight float64 `json:"playedWeight"`
+}
+
+// Wishlist loads bggName's wishlist and sorts it by how likely each game is
+// to get played: its wishlist priority, whether it plays at player counts
+// or weights the owned collection lacks, how close it is to the weight of
+// the games they actually play, and how it plays at numPlayers, which may be
+// zero. Games wishlisted as "don't buy this" are left out.
+func (s *Service) Wishlist(ctx context.Context, bggName string, numPlayers int) (*WishlistReport, error) {
+	wishlist, err := s.bgg.Wishlist(ctx, bggName)
+	if err != nil {
+		return nil, err
+	}
+	owned, _, err := s.bgg.OwnedOrStale(ctx, bggName)
+	if err != nil {
+		return nil, err
+	}
+	r := &WishlistReport{BGGName: bggName, NumPlayers: numPlayers, Games: []*WishedGame{}}
+
+	ownedIDs := make(map[string]bool, len(owned))
+	counts := make(map[int]int)
+	weights := make(map[string]int)
+	var weightSum, playsSum float64
+	for _, g := range owned {
+		ownedIDs[g.ID] = true
+		t := s.bgg.CachedThing(g.ID)
+		if t == nil {
+			continue
+		}
+		for n := t.MinPlayers; n <= t.MaxPlayers && n <= maxGapPlayers; n++ {
+			counts[n]++
+		}
+		if t.Weight > 0 {
+			weights[gamefmt.WeightLabel(t.Weight)]++
+			weightSum += t.Weight * float64(g.NumPlays+1)
+			playsSum += float64(g.NumPlays + 1)
+		}
+	}
+	if playsSum > 0 {
+		r.PlayedWeight = weightSum / playsSum
+	}
+
+	priority := make(map[string]int)
+	var wanted []bgg.OwnedGame
+	for _, g := range wishlist {
+		if g.Priority == bgg.DontBuy || ownedIDs[g.ID] {
+			continue
+		}
+		priority[g.ID] = g.Priority
+		wanted = append(wanted, bgg.OwnedGame{ID: g.ID, Name: g.Name})
+	}
+	now, later := s.selectGames(wanted)
+	for _, id := range later {
+		s.queueGameFetch(id, false)
+	}
+	r.Deferred = len(later)
+
+	for loaded := range s.streamGames(ctx, now, numPlayers, bggName, nil) {
+		g := loaded.game
+		if g == nil {
+			continue
+		}
+		w := &WishedGame{
+			ID: g.ID, Name: g.Name, Priority: priority[g.ID],
+			MinPlayers: g.MinPlayers, MaxPlayers: g.MaxPlayers, Weight: g.Weight,
+			Best: g.Best, Rec: g.Rec,
+		}
+		for n := g.MinPlayers; n <= g.MaxPlayers && n <= maxGapPlayers; n++ {
+			if counts[n] <= thinCoverage {
+				w.GapCounts = append(w.GapCounts, n)
+			}
+		}
+		if g.Weight > 0 && weights[gamefmt.WeightLabel(g.Weight)] <= thinCoverage {
+			w.GapWeight = true
+		}
+		w.Score, w.Reasons = wishScore(w, r)
+		r.Games = append(r.Games, w)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(r.Games, func(i, j int) bool {
+		if r.Games[i].Score != r.Games[j].Score {
+			return r.Games[i].Score > r.Games[j].Score
+		}
+		return strings.ToLower(r.Games[i].Name) < strings.ToLower(r.Games[j].Name)
+	})
+	return r, nil
+}
+
+// wishScore rates how likely w is to get played, with the reasons worth
+// telling a gift buyer.
+func wishScore(w *WishedGame, r *WishlistReport) (float64, []string) {
+	var reasons []string
+	priority := 0.5 // unknown
+	if w.Priority >= 1 && w.Priority < bgg.DontBuy {
+		priority = float64(bgg.DontBuy-w.Priority) / float64(bgg.DontBuy-1)
+		if w.Priority == 1 {
+			reasons = append(reasons, "a must have")
+		}
+	}
+
+	gap := 0.0
+	if span := w.MaxPlayers - w.MinPlayers + 1; span > 0 && len(w.GapCounts) > 0 {
+		gap = math.Min(1, float64(len(w.GapCounts))/float64(span)*2)
+		reasons = append(reasons, "plays at "+gamefmt.CountList(w.GapCounts)+" players, few owned games do")
+	}
+	if w.GapWeight {
+		gap = math.Min(1, gap+0.5)
+		reasons = append(reasons, fmt.Sprintf("a %s game, few owned games are", strings.ToLower(gamefmt.WeightLabel(w.Weight))))
+	}
+
+	weight := 0.5
+	if w.Weight > 0 && r.PlayedWeight > 0 {
+		weight = 1 - math.Min(1, math.Abs(w.Weight-r.PlayedWeight)/2)
+		if weight >= 0.75 {
+			reasons = append(reasons, "as heavy as the games played most")
+		}
+	}
+
+	fit := 0.5
+	if r.NumPlayers > 0 {
+		switch {
+		case w.Best:
+			fit = 1
+			reasons = append(reasons, fmt.Sprintf("best at %d", r.NumPlayers))
+		case w.Rec:
+			fit = 0.6
+		case r.NumPlayers >= w.MinPlayers && r.NumPlayers <= w.MaxPlayers:
+			fit = 0.3
+		default:
+			fit = 0
+			reasons = append(reasons, fmt.Sprintf("doesn't play %d", r.NumPlayers))
+		}
+	}
+	return wishPriorityWeight*priority + wishGapWeight*gap + wishWeightWeight*weight + wishFitWeight*fit, reasons
+}
@@ -0,0 +1,122 @@
+// Package session remembers the choices a browser made last time, so
+// returning users don't have to retype their BGG name and filters.
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+const cookieName = "session"
+
+// maxAge is how long a session is remembered after its last use.
+const maxAge = 365 * 24 * time.Hour
+
+const prefsKind = "Session"
+
+// Sorts are the orders the collection tables can be sorted in, the first is
+// the default.
+var Sorts = []string{"fit", "score", "bscore", "weight", "name"}
+
+// ValidSort reports whether s is one of Sorts.
+func ValidSort(s string) bool {
+	for _, v := range Sorts {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Prefs are the preferences saved for a session.
+type Prefs struct {
+	BGGName    string
+	NumPlayers int
+	Mood       string
+	Scorer     string
+	Sort       string
+	Updated    time.Time
+}
+
+// Sessions loads and saves preferences keyed by a random session cookie.
+type Sessions struct {
+	st *store.Store
+}
+
+// New returns Sessions keeping preferences in st.
+func New(st *store.Store) *Sessions {
+	return &Sessions{st: st}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Load returns the preferences of the request's session, empty ones if it
+// has none.
+func (s *Sessions) Load(r *http.Request) *Prefs {
+	p := &Prefs{}
+	c, err := r.Cookie(cookieName)
+	if err != nil {
+		return p
+	}
+	if err := s.st.Get(prefsKind, c.Value, p); err != nil && err != store.ErrNotFound {
+		log.Printf("warning: unable to load session: %s", err)
+	}
+	return p
+}
+
+// Save stores p for the request's session, starting a new session if it
+// doesn't have one yet. Failures are only logged, losing preferences
+// shouldn't fail the page that saves them.
+func (s *Sessions) Save(w http.ResponseWriter, r *http.Request, p *Prefs) {
+	var id string
+	if c, err := r.Cookie(cookieName); err == nil && c.Value != "" {
+		id = c.Value
+	} else {
+		if id, err = newID(); err != nil {
+			log.Printf("warning: unable to generate session id: %s", err)
+			return
+		}
+	}
+	p.Updated = time.Now()
+	if err := s.st.Put(prefsKind, id, p); err != nil {
+		log.Printf("warning: unable to save session: %s", err)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(maxAge / time.Second),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Forget drops the request's session and its preferences, for when someone
+// else is using the browser.
+func (s *Sessions) Forget() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if c, err := r.Cookie(cookieName); err == nil {
+			if err := s.st.Delete(prefsKind, c.Value); err != nil && err != store.ErrNotFound {
+				log.Printf("warning: unable to delete session: %s", err)
+			}
+		}
+		http.SetCookie(w, &http.Cookie{Name: cookieName, Path: "/", MaxAge: -1})
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
@@ -0,0 +1,73 @@
+// Package sitemap tells search engines which pages of the site to index:
+// the published collections and their games, and nothing else.
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/service"
+)
+
+type urlSet struct {
+	XMLName xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []entry  `xml:"url"`
+}
+
+type entry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// Handler serves /sitemap.xml, listing the public pages under siteURL. With
+// no siteURL the site isn't meant to be indexed and there is no sitemap.
+func Handler(svc *service.Service, siteURL string) http.HandlerFunc {
+	base := strings.TrimSuffix(siteURL, "/")
+	return func(w http.ResponseWriter, r *http.Request) {
+		if base == "" {
+			http.NotFound(w, r)
+			return
+		}
+		profiles, gameIDs, err := svc.PublicPages()
+		if err != nil {
+			http.Error(w, "unable to list public pages", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+
+		set := urlSet{URLs: []entry{{Loc: base + "/"}}}
+		for _, p := range profiles {
+			set.URLs = append(set.URLs, entry{
+				Loc:     base + "/u/" + url.PathEscape(p.BGGName),
+				LastMod: p.Updated.Format("2006-01-02"),
+			})
+		}
+		for _, id := range gameIDs {
+			set.URLs = append(set.URLs, entry{Loc: base + "/game?" + url.Values{"id": {id}}.Encode()})
+		}
+
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		fmt.Fprint(w, xml.Header)
+		if err := xml.NewEncoder(w).Encode(set); err != nil {
+			log.Printf("Error encoding sitemap: %s", err)
+		}
+	}
+}
+
+// Robots serves /robots.txt, pointing crawlers at the sitemap, or keeping
+// them out entirely when there is no siteURL.
+func Robots(siteURL string) http.HandlerFunc {
+	base := strings.TrimSuffix(siteURL, "/")
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if base == "" {
+			fmt.Fprint(w, "User-agent: *\nDisallow: /\n")
+			return
+		}
+		fmt.Fprintf(w, "User-agent: *\nAllow: /$\nAllow: /u/\nAllow: /game\nDisallow: /\nSitemap: %s/sitemap.xml\n", base)
+	}
+}
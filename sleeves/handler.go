@@ -0,0 +1,73 @@
+package sleeves
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// maxEdit bounds the size of an edited game.
+const maxEdit = 64 << 10
+
+// AdminHandler is /admin/sleeves, for admins to correct the dataset. GET
+// lists every game with cards, or the one of a gameID param, as JSON. PUT
+// replaces a game's cards with the JSON game in the body, and DELETE with a
+// gameID param goes back to the bundled cards.
+func AdminHandler(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			var v interface{}
+			if id := r.FormValue("gameID"); id != "" {
+				g := Lookup(st, id)
+				if g == nil {
+					http.NotFound(w, r)
+					return
+				}
+				v = g
+			} else {
+				games, err := All(st)
+				if err != nil {
+					http.Error(w, "unable to load sleeves", http.StatusInternalServerError)
+					log.Printf("%s", err)
+					return
+				}
+				v = games
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(v); err != nil {
+				log.Printf("Error encoding sleeves: %s", err)
+			}
+		case http.MethodPut:
+			var g Game
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEdit)).Decode(&g); err != nil {
+				http.Error(w, "bad body, please provide a game as JSON", http.StatusBadRequest)
+				return
+			}
+			if err := g.Validate(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err := Save(st, &g); err != nil {
+				http.Error(w, "unable to save sleeves", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if err := json.NewEncoder(w).Encode(&g); err != nil {
+				log.Printf("Error encoding sleeves: %s", err)
+			}
+		case http.MethodDelete:
+			if err := Reset(st, r.FormValue("gameID")); err != nil {
+				http.Error(w, "unable to reset sleeves", http.StatusInternalServerError)
+				log.Printf("%s", err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+// Package sleeves knows how many cards games have and the sleeves that fit
+// them, from a bundled dataset admins can correct.
+package sleeves
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// Size is a sleeve size, sized in millimeters.
+type Size struct {
+	Name   string `json:"name"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// Sizes are the sleeve sizes games are listed with.
+var Sizes = []Size{
+	{"mini American", 41, 63},
+	{"mini Euro", 45, 68},
+	{"Catan", 56, 82},
+	{"standard American", 57, 89},
+	{"standard Euro", 59, 92},
+	{"standard card game", 66, 91},
+	{"7 Wonders", 67, 103},
+	{"square", 70, 70},
+	{"tarot", 70, 120},
+}
+
+// ValidSize reports whether name is one of Sizes.
+func ValidSize(name string) bool {
+	for _, s := range Sizes {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Deck is cards of a game taking one sleeve size.
+type Deck struct {
+	Cards int    `json:"cards"`
+	Size  string `json:"size"`
+}
+
+// Game is the cards of a game.
+type Game struct {
+	GameID  string    `json:"gameID"`
+	Name    string    `json:"name"`
+	Decks   []Deck    `json:"decks"`
+	Edited  bool      `json:"edited"` // by an admin, rather than bundled
+	Updated time.Time `json:"updated"`
+}
+
+// Validate checks g as edited by an admin.
+func (g *Game) Validate() error {
+	if _, err := strconv.Atoi(g.GameID); err != nil {
+		return errors.New("bad gameID param, please provide a numeric game id")
+	}
+	if len(g.Decks) == 0 || len(g.Decks) > 20 {
+		return errors.New("bad decks param, please provide 1-20 decks")
+	}
+	for _, d := range g.Decks {
+		if d.Cards < 1 || d.Cards > 10000 {
+			return errors.New("bad cards param, please provide a number between 1 and 10000")
+		}
+		if !ValidSize(d.Size) {
+			names := make([]string, len(Sizes))
+			for i, s := range Sizes {
+				names[i] = s.Name
+			}
+			return fmt.Errorf("bad size param, please pick one of %s", strings.Join(names, ", "))
+		}
+	}
+	return nil
+}
+
+// String sums the cards of each size, such as "120x standard American +
+// 60x mini Euro".
+func (g *Game) String() string {
+	var sizes []string
+	cards := make(map[string]int)
+	for _, d := range g.Decks {
+		if cards[d.Size] == 0 {
+			sizes = append(sizes, d.Size)
+		}
+		cards[d.Size] += d.Cards
+	}
+	parts := make([]string, len(sizes))
+	for i, s := range sizes {
+		parts[i] = fmt.Sprintf("%dx %s", cards[s], s)
+	}
+	return strings.Join(parts, " + ")
+}
+
+//go:embed sleeves.json
+var bundledJSON []byte
+
+// bundled is the dataset shipped with the site, by BGG ID.
+var bundled = func() map[string]*Game {
+	var games map[string]*Game
+	if err := json.Unmarshal(bundledJSON, &games); err != nil {
+		panic(fmt.Sprintf("sleeves: bad bundled dataset: %s", err))
+	}
+	for id, g := range games {
+		g.GameID = id
+	}
+	return games
+}()
+
+// Kind is the store kind of the games admins edited, keyed by game ID.
+const Kind = "Sleeves"
+
+// Lookup returns the cards of a game, preferring an admin's edit over the
+// bundled dataset, or nil if neither has it.
+func Lookup(st *store.Store, gameID string) *Game {
+	var g Game
+	switch err := st.Get(Kind, gameID, &g); err {
+	case nil:
+		return &g
+	case store.ErrNotFound:
+	default:
+		log.Printf("warning: unable to load sleeves for %q: %s", gameID, err)
+	}
+	if g, ok := bundled[gameID]; ok {
+		c := *g
+		return &c
+	}
+	return nil
+}
+
+// All returns every game with cards, by name.
+func All(st *store.Store) ([]*Game, error) {
+	byID := make(map[string]*Game, len(bundled))
+	for id, g := range bundled {
+		c := *g
+		byID[id] = &c
+	}
+	var edited []*Game
+	if _, err := st.GetAll(Kind, "", &edited); err != nil {
+		return nil, err
+	}
+	for _, g := range edited {
+		byID[g.GameID] = g
+	}
+	games := make([]*Game, 0, len(byID))
+	for _, g := range byID {
+		games = append(games, g)
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].Name < games[j].Name })
+	return games, nil
+}
+
+// Save stores g in place of the game's bundled cards.
+func Save(st *store.Store, g *Game) error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+	g.Edited, g.Updated = true, time.Now()
+	return st.Put(Kind, g.GameID, g)
+}
+
+// Reset drops an admin's edit of a game, so the bundled cards, if any, are
+// used again.
+func Reset(st *store.Store, gameID string) error {
+	err := st.Delete(Kind, gameID)
+	if err == store.ErrNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,390 @@
+// Package store persists application data as JSON documents grouped by kind,
+// optionally backed by a file on disk.
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned when no entity exists for a kind and key.
+var ErrNotFound = errors.New("store: entity not found")
+
+// ErrConflict is returned by PutIf when the entity changed since it was read.
+var ErrConflict = errors.New("store: entity changed since it was read")
+
+type record struct {
+	Value   json.RawMessage `json:"value"`
+	Updated time.Time       `json:"updated"`
+	Deleted *time.Time      `json:"deleted,omitempty"`
+	Version int64           `json:"version"`       // bumped by every write
+	Seq     int64           `json:"seq,omitempty"` // store wide sequence of the last change
+}
+
+// live reports whether rec exists and hasn't been soft deleted.
+func (rec *record) live() bool {
+	return rec != nil && rec.Deleted == nil
+}
+
+// Store is a kind/key document store. All methods are safe for concurrent use.
+type Store struct {
+	mu       sync.RWMutex
+	path     string
+	kinds    map[string]map[string]*record
+	seq      int64 // highest Seq handed out
+	watchers []func(kind, key string)
+}
+
+// tombstoneKind keeps a record of every purged entity, keyed by its kind and
+// key, so Changes can report it.
+const tombstoneKind = "_tombstone"
+
+// Open returns a Store loaded from path. An empty path gives a memory only
+// store and a missing file is treated as an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:  path,
+		kinds: make(map[string]map[string]*record),
+	}
+	if path == "" {
+		return s, nil
+	}
+	raw, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read store %q: %s", path, err)
+	}
+	if err := json.Unmarshal(raw, &s.kinds); err != nil {
+		return nil, fmt.Errorf("unable to decode store %q: %s", path, err)
+	}
+	for _, recs := range s.kinds {
+		for _, rec := range recs {
+			if rec.Version == 0 { // written before versions were kept
+				rec.Version = 1
+			}
+			if rec.Seq > s.seq {
+				s.seq = rec.Seq
+			}
+		}
+	}
+	return s, nil
+}
+
+// Watch calls fn after every write, delete or restore with the kind and key
+// of the entity changed. fn is called with the store locked, so it must not
+// use the store.
+func (s *Store) Watch(fn func(kind, key string)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.watchers = append(s.watchers, fn)
+}
+
+// changed stamps rec with the next sequence number and tells the watchers,
+// rec is nil when the entity is gone. The caller must hold s.mu.
+func (s *Store) changed(kind, key string, rec *record) {
+	if rec != nil {
+		s.seq++
+		rec.Seq = s.seq
+	}
+	for _, fn := range s.watchers {
+		fn(kind, key)
+	}
+}
+
+// Key joins parts into a single key. Keys sharing leading parts can be
+// listed together with GetAll.
+func Key(parts ...string) string {
+	return strings.Join(parts, "/")
+}
+
+// Get decodes the entity stored under kind and key into dst.
+func (s *Store) Get(kind, key string, dst interface{}) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec := s.kinds[kind][key]
+	if !rec.live() {
+		return ErrNotFound
+	}
+	return json.Unmarshal(rec.Value, dst)
+}
+
+// GetVersion is Get, also returning the version of the entity for a later
+// PutIf.
+func (s *Store) GetVersion(kind, key string, dst interface{}) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	rec := s.kinds[kind][key]
+	if !rec.live() {
+		return 0, ErrNotFound
+	}
+	return rec.Version, json.Unmarshal(rec.Value, dst)
+}
+
+// Version returns the version of the entity stored under kind and key, or 0
+// if there is none.
+func (s *Store) Version(kind, key string) int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if rec := s.kinds[kind][key]; rec.live() {
+		return rec.Version
+	}
+	return 0
+}
+
+// Put stores src under kind and key, replacing any existing entity, soft
+// deleted or not.
+func (s *Store) Put(kind, key string, src interface{}) error {
+	_, err := s.put(kind, key, src, -1)
+	return err
+}
+
+// PutIf stores src under kind and key only if the entity is still at
+// version, with 0 meaning it must not exist yet, and returns the new
+// version. ErrConflict is returned if someone else wrote it in between.
+func (s *Store) PutIf(kind, key string, src interface{}, version int64) (int64, error) {
+	return s.put(kind, key, src, version)
+}
+
+// put stores src, checking the current version unless version is negative.
+func (s *Store) put(kind, key string, src interface{}, version int64) (int64, error) {
+	raw, err := json.Marshal(src)
+	if err != nil {
+		return 0, fmt.Errorf("unable to encode %s %q: %s", kind, key, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.kinds[kind] == nil {
+		s.kinds[kind] = make(map[string]*record)
+	}
+	old := s.kinds[kind][key]
+	if version >= 0 {
+		current := int64(0)
+		if old.live() {
+			current = old.Version
+		}
+		if current != version {
+			return 0, ErrConflict
+		}
+	}
+	rec := &record{Value: raw, Updated: time.Now(), Version: 1}
+	if old != nil {
+		rec.Version = old.Version + 1
+	}
+	s.kinds[kind][key] = rec
+	delete(s.kinds[tombstoneKind], Key(kind, key))
+	s.changed(kind, key, rec)
+	return rec.Version, s.save()
+}
+
+// Delete permanently removes the entity stored under kind and key. No
+// tombstone is kept, so Changes won't report it; it is meant for bookkeeping
+// such as tasks and sessions, user data is soft deleted.
+func (s *Store) Delete(kind, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.kinds[kind][key]; !ok {
+		return ErrNotFound
+	}
+	delete(s.kinds[kind], key)
+	s.changed(kind, key, nil)
+	return s.save()
+}
+
+// SoftDelete hides the entity stored under kind and key from Get and GetAll
+// while keeping it around for Restore until it is purged.
+func (s *Store) SoftDelete(kind, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.kinds[kind][key]
+	if !rec.live() {
+		return ErrNotFound
+	}
+	now := time.Now()
+	rec.Deleted = &now
+	rec.Version++
+	s.changed(kind, key, rec)
+	return s.save()
+}
+
+// Restore brings back a soft deleted entity.
+func (s *Store) Restore(kind, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.kinds[kind][key]
+	if rec == nil || rec.Deleted == nil {
+		return ErrNotFound
+	}
+	rec.Deleted = nil
+	rec.Version++
+	s.changed(kind, key, rec)
+	return s.save()
+}
+
+// Trashed is a soft deleted entity.
+type Trashed struct {
+	Kind    string
+	Key     string
+	Value   json.RawMessage
+	Deleted time.Time
+}
+
+// Trash returns the soft deleted entities of kind whose key starts with
+// prefix, most recently deleted first.
+func (s *Store) Trash(kind, prefix string) []Trashed {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var trash []Trashed
+	for key, rec := range s.kinds[kind] {
+		if rec.Deleted != nil && strings.HasPrefix(key, prefix) {
+			trash = append(trash, Trashed{Kind: kind, Key: key, Value: rec.Value, Deleted: *rec.Deleted})
+		}
+	}
+	sort.Slice(trash, func(i, j int) bool { return trash[i].Deleted.After(trash[j].Deleted) })
+	return trash
+}
+
+// Purge permanently removes every entity soft deleted before cutoff and
+// returns how many were removed.
+func (s *Store) Purge(cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	if s.kinds[tombstoneKind] == nil {
+		s.kinds[tombstoneKind] = make(map[string]*record)
+	}
+	for kind, recs := range s.kinds {
+		for key, rec := range recs {
+			if rec.Deleted != nil && rec.Deleted.Before(cutoff) {
+				delete(recs, key)
+				tomb := &record{Value: json.RawMessage("null"), Updated: time.Now(), Version: 1}
+				s.kinds[tombstoneKind][Key(kind, key)] = tomb
+				s.changed(kind, key, tomb)
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, s.save()
+}
+
+// Change is an entity changed after a Changes cursor. Deleted entities are
+// reported as tombstones without a value.
+type Change struct {
+	Kind    string          `json:"kind"`
+	Key     string          `json:"key"`
+	Seq     int64           `json:"seq"`
+	Value   json.RawMessage `json:"value,omitempty"`
+	Deleted bool            `json:"deleted,omitempty"`
+}
+
+// Seq returns the sequence number of the latest change, a cursor for
+// Changes covering everything stored so far.
+func (s *Store) Seq() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.seq
+}
+
+// Changes returns the entities of kind whose key starts with prefix that
+// were written, soft deleted, restored or purged after the change numbered
+// since, in the order they changed.
+func (s *Store) Changes(kind, prefix string, since int64) []Change {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var changes []Change
+	for key, rec := range s.kinds[kind] {
+		if rec.Seq > since && strings.HasPrefix(key, prefix) {
+			c := Change{Kind: kind, Key: key, Seq: rec.Seq, Deleted: rec.Deleted != nil}
+			if !c.Deleted {
+				c.Value = rec.Value
+			}
+			changes = append(changes, c)
+		}
+	}
+	tombPrefix := Key(kind, prefix)
+	for key, rec := range s.kinds[tombstoneKind] {
+		if rec.Seq > since && strings.HasPrefix(key, tombPrefix) {
+			changes = append(changes, Change{Kind: kind, Key: strings.TrimPrefix(key, Key(kind, "")), Seq: rec.Seq, Deleted: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Seq < changes[j].Seq })
+	return changes
+}
+
+// GetAll appends every entity of kind whose key starts with prefix to dst,
+// which must be a pointer to a slice, in key order. The matching keys are
+// returned in the same order.
+func (s *Store) GetAll(kind, prefix string, dst interface{}) ([]string, error) {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("store: GetAll dst must be a pointer to a slice, got %T", dst)
+	}
+	slice := v.Elem()
+	elem := slice.Type().Elem()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []string
+	for key, rec := range s.kinds[kind] {
+		if rec.live() && strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var item reflect.Value
+		if elem.Kind() == reflect.Ptr {
+			item = reflect.New(elem.Elem())
+		} else {
+			item = reflect.New(elem)
+		}
+		if err := json.Unmarshal(s.kinds[kind][key].Value, item.Interface()); err != nil {
+			return nil, fmt.Errorf("unable to decode %s %q: %s", kind, key, err)
+		}
+		if elem.Kind() != reflect.Ptr {
+			item = item.Elem()
+		}
+		slice = reflect.Append(slice, item)
+	}
+	v.Elem().Set(slice)
+	return keys, nil
+}
+
+// save writes the store to disk, the caller must hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	raw, err := json.Marshal(s.kinds)
+	if err != nil {
+		return fmt.Errorf("unable to encode store: %s", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, raw, 0600); err != nil {
+		return fmt.Errorf("unable to write store: %s", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("unable to replace store: %s", err)
+	}
+	return nil
+}
+
+// Check saves the store, reporting whether its file can be written. It does
+// nothing for a memory only store.
+func (s *Store) Check() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save()
+}
@@ -0,0 +1,87 @@
+// Package syncapi lets companion apps keep an offline copy of a user's data
+// by fetching only what changed since their last sync.
+package syncapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// pageSize is the most changes returned at once, clients keep calling with
+// the returned cursor while more is set.
+const pageSize = 500
+
+var (
+	mu    sync.RWMutex
+	kinds []string
+)
+
+// Register makes entities of kind available to sync. Entities must be keyed
+// by their lowercased owner first, only the owner's entities are synced to
+// them. Register panics if kind is registered twice.
+func Register(kind string) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, k := range kinds {
+		if k == kind {
+			panic("syncapi: kind " + kind + " registered twice")
+		}
+	}
+	kinds = append(kinds, kind)
+}
+
+// Response is a page of changes.
+type Response struct {
+	Cursor  string         `json:"cursor"` // pass as since to get the next changes
+	More    bool           `json:"more"`   // more changes are waiting after Cursor
+	Changes []store.Change `json:"changes"`
+}
+
+// Handler serves /api/v1/sync?bggName={name}&since={cursor}, the changes to
+// bggName's data after cursor, everything if since is empty. Deleted
+// entities are sent as tombstones.
+func Handler(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		var since int64
+		if v := r.FormValue("since"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				http.Error(w, "bad since param, please provide a cursor from a previous sync", http.StatusBadRequest)
+				return
+			}
+			since = n
+		}
+
+		// Take the cursor first, anything changing while the changes are
+		// gathered is sent again next time rather than missed.
+		resp := Response{Cursor: strconv.FormatInt(st.Seq(), 10), Changes: []store.Change{}}
+		prefix := store.Key(strings.ToLower(bggName), "")
+		mu.RLock()
+		for _, kind := range kinds {
+			resp.Changes = append(resp.Changes, st.Changes(kind, prefix, since)...)
+		}
+		mu.RUnlock()
+		sort.Slice(resp.Changes, func(i, j int) bool { return resp.Changes[i].Seq < resp.Changes[j].Seq })
+		if len(resp.Changes) > pageSize {
+			resp.Changes, resp.More = resp.Changes[:pageSize], true
+			resp.Cursor = strconv.FormatInt(resp.Changes[pageSize-1].Seq, 10)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			log.Printf("Error encoding changes: %s", err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package timer
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/mattkoler/board_game_helper/websocket"
+)
+
+type pageData struct {
+	Room       string
+	MaxPlayers int
+}
+
+// Page serves /timer/{room}, the timer page every phone at the table opens.
+// /timer/ alone opens a new room with a random name.
+func Page(tpl *template.Template, m *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/timer/"))
+		if name == "" {
+			b := make([]byte, 4)
+			if _, err := rand.Read(b); err != nil {
+				http.Error(w, "unable to open a timer", http.StatusInternalServerError)
+				log.Printf("unable to generate room name: %s", err)
+				return
+			}
+			http.Redirect(w, r, "/timer/"+hex.EncodeToString(b), http.StatusSeeOther)
+			return
+		}
+		if !ValidName(name) {
+			http.Error(w, "bad room name, please use 1-40 lower case letters, digits and dashes", http.StatusBadRequest)
+			return
+		}
+		if err := tpl.ExecuteTemplate(w, "timer.html", pageData{Room: name, MaxPlayers: MaxPlayers}); err != nil {
+			log.Printf("Error executing template: %s", err)
+		}
+	}
+}
+
+// message is sent to a single client when its action was refused.
+type message struct {
+	Error string `json:"error"`
+}
+
+// Socket serves /ws/timer/{room}, sending the room's state on connecting
+// and on every change, and applying the actions the client sends.
+func Socket(m *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.ToLower(strings.TrimPrefix(r.URL.Path, "/ws/timer/"))
+		if !ValidName(name) {
+			http.Error(w, "bad room name, please use 1-40 lower case letters, digits and dashes", http.StatusBadRequest)
+			return
+		}
+		rm, err := m.Room(name)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := websocket.Upgrade(w, r)
+		if err != nil {
+			log.Printf("%s", err)
+			return
+		}
+		defer conn.Close()
+
+		states, cancel := rm.Subscribe()
+		defer cancel()
+
+		gone := make(chan struct{})
+		go func() {
+			defer close(gone)
+			for {
+				_, p, err := conn.ReadMessage()
+				if err != nil {
+					return
+				}
+				var a Action
+				if err := json.Unmarshal(p, &a); err != nil {
+					conn.WriteJSON(message{Error: "bad message, please send an action as JSON"})
+					continue
+				}
+				if err := rm.Apply(a); err != nil {
+					conn.WriteJSON(message{Error: err.Error()})
+				}
+			}
+		}()
+
+		if err := conn.WriteJSON(rm.State()); err != nil {
+			log.Printf("%s", err)
+			return
+		}
+		for {
+			select {
+			case s := <-states:
+				if err := conn.WriteJSON(s); err != nil {
+					log.Printf("%s", err)
+					return
+				}
+			case <-gone:
+				return
+			}
+		}
+	}
+}
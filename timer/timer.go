@@ -0,0 +1,256 @@
+// Package timer keeps shared game timers, chess clocks for the players at
+// a table, in rooms every phone at the table follows live.
+package timer
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits of a room.
+const (
+	MaxPlayers = 12
+	MaxTotal   = 24 * time.Hour
+	maxRooms   = 1000
+	// idle is how long a room nobody follows is kept.
+	idle = 12 * time.Hour
+)
+
+// Clock is a player's clock.
+type Clock struct {
+	Name      string        `json:"name"`
+	Remaining time.Duration `json:"remaining"` // of the total time, 0 without one
+	Used      time.Duration `json:"used"`      // over the whole game
+	Turns     int           `json:"turns"`     // taken, counting the current one
+}
+
+// State is a point in time snapshot of a room. Durations are in
+// nanoseconds, as of At.
+type State struct {
+	Room     string        `json:"room"`
+	Players  []Clock       `json:"players"`
+	Current  int           `json:"current"` // index of the player whose turn it is
+	Running  bool          `json:"running"`
+	Turn     time.Duration `json:"turn"`     // per turn limit, 0 for none
+	Total    time.Duration `json:"total"`    // total time per player, 0 for none
+	TurnUsed time.Duration `json:"turnUsed"` // of the current turn
+	At       time.Time     `json:"at"`
+}
+
+// Action is a change to a room sent by a client.
+type Action struct {
+	Action  string   `json:"action"` // setup, start, pause, pass or back
+	Players []string `json:"players,omitempty"`
+	Turn    int      `json:"turnSeconds,omitempty"`
+	Total   int      `json:"totalSeconds,omitempty"`
+}
+
+// Room is a table's timer.
+type Room struct {
+	Name string
+
+	mu       sync.Mutex
+	players  []Clock
+	current  int
+	running  bool
+	turn     time.Duration
+	total    time.Duration
+	turnUsed time.Duration // of the current turn before since
+	since    time.Time     // when the clock last started running
+	touched  time.Time
+	subs     map[chan State]struct{}
+}
+
+// State returns the room's current state.
+func (rm *Room) State() State {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	return rm.state(time.Now())
+}
+
+// state snapshots the room at now, the caller must hold rm.mu.
+func (rm *Room) state(now time.Time) State {
+	s := State{
+		Room:     rm.Name,
+		Players:  make([]Clock, len(rm.players)),
+		Current:  rm.current,
+		Running:  rm.running,
+		Turn:     rm.turn,
+		Total:    rm.total,
+		TurnUsed: rm.turnUsed,
+		At:       now,
+	}
+	copy(s.Players, rm.players)
+	if rm.running {
+		d := now.Sub(rm.since)
+		s.TurnUsed += d
+		c := &s.Players[rm.current]
+		c.Used += d
+		if rm.total > 0 {
+			if c.Remaining -= d; c.Remaining < 0 {
+				c.Remaining = 0
+			}
+		}
+	}
+	return s
+}
+
+// stop commits the time run since rm.since to the current player, the
+// caller must hold rm.mu.
+func (rm *Room) stop(now time.Time) {
+	if !rm.running {
+		return
+	}
+	s := rm.state(now)
+	rm.players[rm.current] = s.Players[rm.current]
+	rm.turnUsed = s.TurnUsed
+	rm.running = false
+}
+
+// Apply makes the change a sets out and sends the new state to the room's
+// subscribers.
+func (rm *Room) Apply(a Action) error {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	now := time.Now()
+	switch a.Action {
+	case "setup":
+		if len(a.Players) < 1 || len(a.Players) > MaxPlayers {
+			return fmt.Errorf("bad players, please provide 1-%d players", MaxPlayers)
+		}
+		turn, total := time.Duration(a.Turn)*time.Second, time.Duration(a.Total)*time.Second
+		if turn < 0 || total < 0 || turn > MaxTotal || total > MaxTotal {
+			return errors.New("bad time settings, please provide at most a day")
+		}
+		players := make([]Clock, 0, len(a.Players))
+		for _, p := range a.Players {
+			p = strings.TrimSpace(p)
+			if p == "" || len(p) > 40 {
+				return errors.New("bad players, please provide names of 1-40 characters")
+			}
+			players = append(players, Clock{Name: p, Remaining: total})
+		}
+		players[0].Turns = 1
+		rm.players, rm.current, rm.running, rm.turn, rm.total, rm.turnUsed = players, 0, false, turn, total, 0
+	case "start":
+		if len(rm.players) == 0 {
+			return errors.New("the timer isn't set up yet")
+		}
+		if !rm.running {
+			rm.running, rm.since = true, now
+		}
+	case "pause":
+		rm.stop(now)
+	case "pass", "back":
+		if len(rm.players) == 0 {
+			return errors.New("the timer isn't set up yet")
+		}
+		running := rm.running
+		rm.stop(now)
+		step := 1
+		if a.Action == "back" {
+			step = len(rm.players) - 1
+		}
+		rm.current = (rm.current + step) % len(rm.players)
+		rm.players[rm.current].Turns++
+		rm.turnUsed = 0
+		rm.running, rm.since = running, now
+	default:
+		return fmt.Errorf("unknown action %q", a.Action)
+	}
+	rm.publish(now)
+	return nil
+}
+
+// Subscribe returns a channel of the room's states, sent on every change,
+// and a func to stop. States are dropped if the subscriber falls behind.
+func (rm *Room) Subscribe() (states <-chan State, cancel func()) {
+	ch := make(chan State, 16)
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.subs[ch] = struct{}{}
+	rm.touched = time.Now()
+	return ch, func() {
+		rm.mu.Lock()
+		defer rm.mu.Unlock()
+		if _, ok := rm.subs[ch]; ok {
+			delete(rm.subs, ch)
+			close(ch)
+		}
+		rm.touched = time.Now()
+	}
+}
+
+// publish sends the state at now to subscribers, the caller must hold
+// rm.mu.
+func (rm *Room) publish(now time.Time) {
+	rm.touched = now
+	s := rm.state(now)
+	for ch := range rm.subs {
+		select {
+		case ch <- s:
+		default:
+		}
+	}
+}
+
+// abandoned reports whether nobody has followed the room for idle, the
+// caller must hold rm.mu.
+func (rm *Room) abandoned(now time.Time) bool {
+	return len(rm.subs) == 0 && now.Sub(rm.touched) > idle
+}
+
+// Manager keeps the rooms in memory, timers don't outlive a restart.
+type Manager struct {
+	mu    sync.Mutex
+	rooms map[string]*Room
+}
+
+// NewManager returns a manager without rooms.
+func NewManager() *Manager {
+	return &Manager{rooms: make(map[string]*Room)}
+}
+
+// ErrTooManyRooms is returned when no more rooms can be opened.
+var ErrTooManyRooms = errors.New("too many timer rooms are open, please try again later")
+
+// Room returns the room called name, opening it if it isn't yet. Rooms
+// nobody followed for a while are closed first.
+func (m *Manager) Room(name string) (*Room, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rm, ok := m.rooms[name]; ok {
+		return rm, nil
+	}
+	now := time.Now()
+	for n, rm := range m.rooms {
+		rm.mu.Lock()
+		if rm.abandoned(now) {
+			delete(m.rooms, n)
+		}
+		rm.mu.Unlock()
+	}
+	if len(m.rooms) >= maxRooms {
+		return nil, ErrTooManyRooms
+	}
+	rm := &Room{Name: name, touched: now, subs: make(map[chan State]struct{})}
+	m.rooms[name] = rm
+	return rm, nil
+}
+
+// ValidName reports whether name can name a room: 1-40 lower case letters,
+// digits and dashes.
+func ValidName(name string) bool {
+	if len(name) < 1 || len(name) > 40 {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
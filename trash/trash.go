@@ -0,0 +1,184 @@
+// Package trash lets users undo deletions. Deleted entities are soft deleted
+// in the store, stay restorable for Window and are purged after that.
+package trash
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattkoler/board_game_helper/store"
+)
+
+// Window is how long deleted entities can be restored.
+const Window = 30 * 24 * time.Hour
+
+var (
+	mu     sync.RWMutex
+	labels = make(map[string]string) // kind -> label
+	order  []string
+)
+
+// Register makes soft deleted entities of kind restorable from the trash
+// page, shown with label. Entities must be keyed by their lowercased owner
+// first and should have GameID and GameName fields to describe them.
+// Register panics if kind is registered twice.
+func Register(kind, label string) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := labels[kind]; ok {
+		panic("trash: kind " + kind + " registered twice")
+	}
+	labels[kind] = label
+	order = append(order, kind)
+}
+
+// Item is a restorable entity on the trash page.
+type Item struct {
+	Kind     string
+	Key      string
+	Label    string
+	GameID   string
+	GameName string
+	Deleted  time.Time
+	Expires  time.Time
+}
+
+// DaysLeft is how many days, rounded up, remain to restore the item.
+func (i Item) DaysLeft() int {
+	const day = 24 * time.Hour
+	return int((time.Until(i.Expires) + day - 1) / day)
+}
+
+// Items returns everything owner deleted that can still be restored, most
+// recently deleted first within each kind.
+func Items(st *store.Store, owner string) []Item {
+	mu.RLock()
+	defer mu.RUnlock()
+	cutoff := time.Now().Add(-Window)
+	var items []Item
+	for _, kind := range order {
+		for _, t := range st.Trash(kind, store.Key(strings.ToLower(owner), "")) {
+			if t.Deleted.Before(cutoff) {
+				continue
+			}
+			var desc struct{ GameID, GameName string }
+			if err := json.Unmarshal(t.Value, &desc); err != nil {
+				log.Printf("warning: unable to describe deleted %s %q: %s", kind, t.Key, err)
+			}
+			items = append(items, Item{
+				Kind:     kind,
+				Key:      t.Key,
+				Label:    labels[kind],
+				GameID:   desc.GameID,
+				GameName: desc.GameName,
+				Deleted:  t.Deleted,
+				Expires:  t.Deleted.Add(Window),
+			})
+		}
+	}
+	return items
+}
+
+type trashData struct {
+	BGGName string
+	Items   []Item
+}
+
+// Page is the page listing a user's recently deleted entities.
+func Page(tpl *template.Template, st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bggName := r.FormValue("bggName")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		data := trashData{BGGName: bggName, Items: Items(st, bggName)}
+		if err := tpl.ExecuteTemplate(w, "trash.html", data); err != nil {
+			log.Printf("Error executing template: %s", err)
+			return
+		}
+	}
+}
+
+// Restore brings back one of a user's deleted entities.
+func Restore(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		bggName, kind, key := r.FormValue("bggName"), r.FormValue("kind"), r.FormValue("key")
+		if len(bggName) < 4 || len(bggName) > 20 {
+			http.Error(w, "bad bgg name param, please provide a name between 4-20 characters", http.StatusBadRequest)
+			return
+		}
+		mu.RLock()
+		_, ok := labels[kind]
+		mu.RUnlock()
+		if !ok || !strings.HasPrefix(key, store.Key(strings.ToLower(bggName), "")) {
+			http.Error(w, "nothing to restore", http.StatusNotFound)
+			return
+		}
+
+		switch err := st.Restore(kind, key); err {
+		case nil:
+		case store.ErrNotFound:
+			http.Error(w, "nothing to restore", http.StatusNotFound)
+			return
+		default:
+			http.Error(w, "unable to restore", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		http.Redirect(w, r, "/trash?"+url.Values{"bggName": {bggName}}.Encode(), http.StatusSeeOther)
+	}
+}
+
+// Purge permanently removes everything deleted longer than Window ago.
+func Purge(st *store.Store) (int, error) {
+	return st.Purge(time.Now().Add(-Window))
+}
+
+// PurgeHandler runs Purge on demand, for admins.
+func PurgeHandler(st *store.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		n, err := Purge(st)
+		if err != nil {
+			http.Error(w, "unable to purge", http.StatusInternalServerError)
+			log.Printf("%s", err)
+			return
+		}
+		fmt.Fprintf(w, "purged %d entities\n", n)
+	}
+}
+
+// PurgeEvery runs Purge every interval until ctx is done.
+func PurgeEvery(ctx context.Context, st *store.Store, interval time.Duration) {
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			n, err := Purge(st)
+			if err != nil {
+				log.Printf("warning: unable to purge deleted entities: %s", err)
+			} else if n > 0 {
+				log.Printf("purged %d deleted entities", n)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
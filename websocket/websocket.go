@@ -0,0 +1,225 @@
+// Package websocket is a small server side implementation of the WebSocket
+// protocol (RFC 6455), enough for pushing live updates to the browser and
+// reading short messages back.
+package websocket
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The message opcodes.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// maxMessage is the largest message accepted from a client.
+const maxMessage = 64 << 10
+
+const acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// ErrClosed is returned when reading from a connection the peer closed.
+var ErrClosed = errors.New("websocket: connection closed")
+
+// Conn is an upgraded WebSocket connection. Writes are safe for concurrent
+// use, reads must come from a single goroutine.
+type Conn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	wmu  sync.Mutex
+}
+
+// Upgrade completes the WebSocket handshake for r. Only same origin
+// browser requests are accepted. On failure an error response has already
+// been written.
+func Upgrade(w http.ResponseWriter, r *http.Request) (*Conn, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: not an upgrade request")
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-Websocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusBadRequest)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-Websocket-Key")
+	if key == "" {
+		http.Error(w, "missing websocket key", http.StatusBadRequest)
+		return nil, errors.New("websocket: missing key")
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || !strings.EqualFold(u.Host, r.Host) {
+			http.Error(w, "cross origin websocket not allowed", http.StatusForbidden)
+			return nil, fmt.Errorf("websocket: origin %q not allowed", origin)
+		}
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, errors.New("websocket: response does not support hijacking")
+	}
+	conn, brw, err := hj.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("websocket: hijack failed: %s", err)
+	}
+	conn.SetDeadline(time.Time{}) // the server's request timeouts don't apply to sockets
+
+	sum := sha1.Sum([]byte(key + acceptGUID))
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + base64.StdEncoding.EncodeToString(sum[:]) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("websocket: handshake failed: %s", err)
+	}
+	return &Conn{conn: conn, br: brw.Reader}, nil
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// WriteMessage sends a single unfragmented message.
+func (c *Conn) WriteMessage(opcode int, p []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	header := []byte{0x80 | byte(opcode), 0}
+	switch n := len(p); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = append(header, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = 127
+		header = append(header, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(append(header, p...)); err != nil {
+		return fmt.Errorf("websocket: write failed: %s", err)
+	}
+	return nil
+}
+
+// WriteJSON sends v encoded as JSON in a text message.
+func (c *Conn) WriteJSON(v interface{}) error {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("websocket: unable to encode message: %s", err)
+	}
+	return c.WriteMessage(TextMessage, p)
+}
+
+// ReadMessage returns the next text or binary message. Pings are answered
+// and fragmented messages reassembled. ErrClosed is returned once the peer
+// closes the connection.
+func (c *Conn) ReadMessage() (opcode int, p []byte, err error) {
+	var msg []byte
+	msgOp := 0
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch op {
+		case PingMessage:
+			if err := c.WriteMessage(PongMessage, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case PongMessage:
+			continue
+		case CloseMessage:
+			c.WriteMessage(CloseMessage, payload)
+			return 0, nil, ErrClosed
+		case 0: // continuation
+			if msgOp == 0 {
+				return 0, nil, errors.New("websocket: unexpected continuation frame")
+			}
+		default:
+			msgOp = op
+		}
+		msg = append(msg, payload...)
+		if len(msg) > maxMessage {
+			return 0, nil, errors.New("websocket: message too large")
+		}
+		if fin {
+			return msgOp, msg, nil
+		}
+	}
+}
+
+func (c *Conn) readFrame() (fin bool, opcode int, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, ErrClosed
+	}
+	fin = head[0]&0x80 != 0
+	opcode = int(head[0] & 0x0f)
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("websocket: client frames must be masked")
+	}
+	n := uint64(head[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, ErrClosed
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return false, 0, nil, ErrClosed
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxMessage {
+		return false, 0, nil, errors.New("websocket: frame too large")
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(c.br, mask[:]); err != nil {
+		return false, 0, nil, ErrClosed
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, ErrClosed
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// Close sends a close frame and closes the connection.
+func (c *Conn) Close() error {
+	c.WriteMessage(CloseMessage, []byte{0x03, 0xe8}) // 1000 normal closure
+	return c.conn.Close()
+}